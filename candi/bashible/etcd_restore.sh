@@ -0,0 +1,173 @@
+#!/bin/bash
+# Copyright 2022 Flant JSC
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Restores the etcd member of the control-plane node from the snapshot as a new single-member cluster.
+# The snapshot is the SNAPSHOT file on the node, e.g. taken by the EtcdBackup of the control-plane-manager module.
+# The snapshot checksum is checked before the restore if SNAPSHOT_SHA256 is set or there is <name>.json next to the snapshot.
+
+set -Eeuo pipefail
+
+manifests_dir="/etc/kubernetes/manifests"
+manifest="${manifests_dir}/etcd.yaml"
+stopped_manifest="/etc/kubernetes/etcd.yaml.restore"
+pki_dir="/etc/kubernetes/pki/etcd"
+backup_dir="/var/lib/deckhouse-etcd-backup"
+
+if [[ -z "${SNAPSHOT:-}" ]]; then
+  >&2 echo "ERROR: SNAPSHOT is not set."
+  exit 1
+fi
+if [[ ! -f "$SNAPSHOT" ]]; then
+  >&2 echo "ERROR: Snapshot $SNAPSHOT is not found."
+  exit 1
+fi
+
+if [[ -f "$stopped_manifest" && ! -f "$manifest" ]]; then
+  # the previous restore was interrupted
+  manifest_source="$stopped_manifest"
+elif [[ -f "$manifest" ]]; then
+  manifest_source="$manifest"
+else
+  >&2 echo "ERROR: etcd static Pod manifest $manifest is not found, is it a control-plane node?"
+  exit 1
+fi
+
+info="${SNAPSHOT%.snapshot}.json"
+if [[ -z "${SNAPSHOT_SHA256:-}" && "$info" != "$SNAPSHOT" && -f "$info" ]]; then
+  # the checksum stored by the EtcdBackup next to the snapshot
+  SNAPSHOT_SHA256="$(grep -oE '"sha256": *"[0-9a-f]+"' "$info" | grep -oE '[0-9a-f]{64}' || true)"
+fi
+
+if [[ -n "${SNAPSHOT_SHA256:-}" ]]; then
+  echo "Checking snapshot checksum"
+  if [[ "$(sha256sum "$SNAPSHOT" | cut -d' ' -f1)" != "$SNAPSHOT_SHA256" ]]; then
+    >&2 echo "ERROR: Snapshot $SNAPSHOT checksum does not match $SNAPSHOT_SHA256."
+    exit 1
+  fi
+fi
+
+function manifest_arg() {
+  grep -oE -- "--$1=[^\"' ]+" "$manifest_source" | head -n1 | cut -d= -f2-
+}
+
+image="$(grep -oE 'image: *[^ ]+' "$manifest_source" | head -n1 | sed -E 's/image: *//; s/"//g')"
+name="$(manifest_arg name)"
+peer_url="$(manifest_arg initial-advertise-peer-urls)"
+data_dir="$(manifest_arg data-dir)"
+data_dir="${data_dir:-/var/lib/etcd}"
+
+if [[ -z "$name" || -z "$peer_url" ]]; then
+  >&2 echo "ERROR: Cannot get --name and --initial-advertise-peer-urls from $manifest_source."
+  exit 1
+fi
+
+restore_dir="${data_dir}.restore"
+saved_member="${backup_dir}/member-$(date +%Y%m%d%H%M%S)"
+
+function start_etcd() {
+  if [[ -f "$stopped_manifest" ]]; then
+    mv "$stopped_manifest" "$manifest"
+  fi
+}
+
+function rollback() {
+  >&2 echo "ERROR: Restore failed, starting etcd with the previous data."
+  if [[ -d "$saved_member" && ! -d "${data_dir}/member" ]]; then
+    mv "$saved_member" "${data_dir}/member"
+  fi
+  rm -rf "$restore_dir"
+  start_etcd
+}
+
+function restore_snapshot() {
+  local args=(
+    snapshot restore "$1"
+    --name "$name"
+    --initial-cluster "${name}=${peer_url}"
+    --initial-advertise-peer-urls "$peer_url"
+    --data-dir "$2"
+  )
+
+  if command -v etcdutl >/dev/null 2>&1; then
+    etcdutl "${args[@]}"
+  elif command -v etcdctl >/dev/null 2>&1; then
+    ETCDCTL_API=3 etcdctl "${args[@]}"
+  elif command -v ctr >/dev/null 2>&1 && ctr -n k8s.io images ls -q | grep -qxF "$image"; then
+    # etcdctl from the etcd image which is already on the node
+    ctr -n k8s.io run --rm \
+      --mount "type=bind,src=$(dirname "$1"),dst=/snapshot,options=rbind:ro" \
+      --mount "type=bind,src=$(dirname "$2"),dst=/restore,options=rbind:rw" \
+      --env ETCDCTL_API=3 \
+      "$image" "etcd-restore-$$" \
+      etcdctl "${args[@]:0:2}" "/snapshot/$(basename "$1")" "${args[@]:3:6}" --data-dir "/restore/$(basename "$2")"
+  elif command -v docker >/dev/null 2>&1; then
+    docker run --rm \
+      -v "$(dirname "$1"):/snapshot:ro" \
+      -v "$(dirname "$2"):/restore" \
+      -e ETCDCTL_API=3 \
+      --entrypoint etcdctl \
+      "$image" "${args[@]:0:2}" "/snapshot/$(basename "$1")" "${args[@]:3:6}" --data-dir "/restore/$(basename "$2")"
+  else
+    >&2 echo "ERROR: There is no etcdutl, etcdctl, ctr or docker on the node to restore the snapshot."
+    return 1
+  fi
+}
+
+echo "Restoring etcd member $name ($peer_url) from $SNAPSHOT"
+
+if [[ "$manifest_source" == "$manifest" ]]; then
+  echo "Stopping etcd"
+  mv "$manifest" "$stopped_manifest"
+fi
+trap rollback ERR
+
+for i in $(seq 1 60); do
+  if ! pgrep -x etcd >/dev/null; then
+    break
+  fi
+  if [[ "$i" == "60" ]]; then
+    >&2 echo "ERROR: etcd is not stopped in 120 seconds."
+    false
+  fi
+  sleep 2
+done
+
+rm -rf "$restore_dir"
+restore_snapshot "$SNAPSHOT" "$restore_dir"
+
+if [[ -d "${data_dir}/member" ]]; then
+  echo "Saving the current etcd data to $saved_member"
+  mkdir -p "$backup_dir"
+  mv "${data_dir}/member" "$saved_member"
+fi
+mkdir -p "$data_dir"
+mv "${restore_dir}/member" "${data_dir}/member"
+rm -rf "$restore_dir"
+
+trap - ERR
+
+echo "Starting etcd"
+start_etcd
+
+for i in $(seq 1 60); do
+  if curl -sf --cacert "${pki_dir}/ca.crt" --cert "${pki_dir}/ca.crt" --key "${pki_dir}/ca.key" https://127.0.0.1:2379/health | grep -q '"health":"true"'; then
+    echo "etcd is restored and healthy"
+    exit 0
+  fi
+  sleep 5
+done
+
+>&2 echo "ERROR: etcd is not healthy in 300 seconds after the restore, the previous data is saved to $saved_member."
+exit 1
@@ -15,11 +15,15 @@
 package helpers
 
 import (
+	"time"
+
 	sh_app "github.com/flant/shell-operator/pkg/app"
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/deckhouse/deckhouse/deckhouse-controller/pkg/helpers/jwt"
+	"github.com/deckhouse/deckhouse/deckhouse-controller/pkg/helpers/updatewatchdog"
 	dhctlapp "github.com/deckhouse/deckhouse/dhctl/cmd/dhctl/commands"
+	"github.com/deckhouse/deckhouse/go_lib/dependency/k8s"
 )
 
 func DefineHelperCommands(kpApp *kingpin.Application) {
@@ -35,6 +39,32 @@ func DefineHelperCommands(kpApp *kingpin.Application) {
 		})
 	}
 
+	{
+		watchdogCommand := helpersCommand.Command("update-watchdog", "Roll Deckhouse back if the deployed release is not verified in time.")
+		var opts updatewatchdog.Options
+		var deployedAt string
+		watchdogCommand.Flag("release", "Name of the DeckhouseRelease being verified.").Required().StringVar(&opts.Release)
+		watchdogCommand.Flag("version", "Version of the release in the d8-release-updating ConfigMap.").Required().StringVar(&opts.Version)
+		watchdogCommand.Flag("previous-release", "Name of the DeckhouseRelease to roll back to.").Required().StringVar(&opts.PreviousRelease)
+		watchdogCommand.Flag("previous-image", "Deckhouse image of the previous release.").Required().StringVar(&opts.PreviousImage)
+		watchdogCommand.Flag("deployed-at", "Time the release is deployed at in RFC3339 format.").Required().StringVar(&deployedAt)
+		watchdogCommand.Flag("timeout", "Time for the release to pass the verification.").Required().DurationVar(&opts.Timeout)
+		watchdogCommand.Action(func(c *kingpin.ParseContext) error {
+			var err error
+			opts.DeployedAt, err = time.Parse(time.RFC3339, deployedAt)
+			if err != nil {
+				return err
+			}
+
+			kubeClient, err := k8s.NewClient()
+			if err != nil {
+				return err
+			}
+
+			return updatewatchdog.Run(kubeClient, opts)
+		})
+	}
+
 	// dhctl parser for ClusterConfiguration and <Provider-name>ClusterConfiguration secrets
 	dhctlapp.DefineCommandParseClusterConfiguration(kpApp, helpersCommand)
 	dhctlapp.DefineCommandParseCloudDiscoveryData(kpApp, helpersCommand)
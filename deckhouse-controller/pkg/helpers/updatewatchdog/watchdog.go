@@ -0,0 +1,207 @@
+// Copyright 2022 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package updatewatchdog rolls Deckhouse back if the deployed release is not verified in time.
+//
+// The watchdog runs in a Job with the image of the previous release, so it does not depend on the new release:
+// a crash-looping Deckhouse cannot verify itself, neither can it roll itself back. The new release signals
+// the successful verification by deleting the d8-release-updating ConfigMap.
+package updatewatchdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency/k8s"
+)
+
+const (
+	namespace      = "d8-system"
+	deploymentName = "deckhouse"
+	updatingCMName = "d8-release-updating"
+
+	pollInterval = 15 * time.Second
+)
+
+var releaseGVR = schema.GroupVersionResource{Group: "deckhouse.io", Version: "v1alpha1", Resource: "deckhousereleases"}
+
+type Options struct {
+	// Release is the name of the DeckhouseRelease being verified, Version is its version in the updating ConfigMap.
+	Release string
+	Version string
+
+	PreviousRelease string
+	PreviousImage   string
+
+	DeployedAt time.Time
+	Timeout    time.Duration
+}
+
+// Run waits until the release is verified or the timeout is expired. In the latter case, the release is marked
+// as Failed and Deckhouse is rolled back to the previous release. Rollback is idempotent, so the Job can be restarted.
+func Run(kubeClient k8s.Client, opts Options) error {
+	ctx := context.TODO()
+	deadline := opts.DeployedAt.Add(opts.Timeout)
+
+	for {
+		pending, err := verificationPending(ctx, kubeClient, opts.Version)
+		switch {
+		case err != nil:
+			log.Warnf("Cannot check the verification of release %s: %v", opts.Release, err)
+		case !pending:
+			log.Infof("Release %s is verified or superseded, the watchdog is not needed", opts.Release)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return err
+			}
+			break
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	return rollback(ctx, kubeClient, opts)
+}
+
+// verificationPending reports if the updating ConfigMap is still present for the version.
+func verificationPending(ctx context.Context, kubeClient k8s.Client, version string) (bool, error) {
+	cm, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, updatingCMName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return cm.Data["version"] == version, nil
+}
+
+func rollback(ctx context.Context, kubeClient k8s.Client, opts Options) error {
+	failures, err := verificationFailures(ctx, kubeClient, opts.Version)
+	if err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("Post-update verification failed after %s: %s", opts.Timeout, failures)
+	log.Warnf("Release %s is failed, rolling back to %s: %s", opts.Release, opts.PreviousRelease, reason)
+
+	err = patchReleaseStatus(ctx, kubeClient, opts.Release, map[string]interface{}{
+		"phase":   "Failed",
+		"message": reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = patchReleaseStatus(ctx, kubeClient, opts.PreviousRelease, map[string]interface{}{
+		"phase":    "Deployed",
+		"message":  fmt.Sprintf("Rolled back from failed release v%s", opts.Version),
+		"approved": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	deployments := kubeClient.AppsV1().Deployments(namespace)
+	deployment, err := deployments.Get(ctx, deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	deployment.Spec.Template.Spec.Containers[0].Image = opts.PreviousImage
+	_, err = deployments.Update(ctx, deployment, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("roll back the deckhouse deployment: %v", err)
+	}
+
+	// The ConfigMap is deleted last, the restarted Job repeats the rollback if something above fails.
+	err = kubeClient.CoreV1().ConfigMaps(namespace).Delete(ctx, updatingCMName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// verificationFailures returns the reason of the failed verification. A Deckhouse pod which is not ready cannot
+// report anything, otherwise the failures are reported by the release itself.
+func verificationFailures(ctx context.Context, kubeClient k8s.Client, version string) (string, error) {
+	pods, err := kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=deckhouse"})
+	if err != nil {
+		return "", err
+	}
+
+	ready := false
+	for i := range pods.Items {
+		if podRunsVersion(&pods.Items[i], version) && podReady(&pods.Items[i]) {
+			ready = true
+		}
+	}
+	if !ready {
+		return "deckhouse pod is not ready", nil
+	}
+
+	cm, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, updatingCMName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if failures := cm.Data["failures"]; failures != "" {
+		return failures, nil
+	}
+
+	return "the release is not verified", nil
+}
+
+func podRunsVersion(pod *corev1.Pod, version string) bool {
+	if len(pod.Spec.Containers) == 0 {
+		return false
+	}
+	image := pod.Spec.Containers[0].Image
+	tag := image[strings.LastIndex(image, ":")+1:]
+	return strings.TrimPrefix(tag, "v") == version
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	return pod.Status.ContainerStatuses[0].Ready
+}
+
+func patchReleaseStatus(ctx context.Context, kubeClient k8s.Client, name string, status map[string]interface{}) error {
+	status["transitionTime"] = time.Now().UTC().Format(time.RFC3339)
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return err
+	}
+
+	_, err = kubeClient.Dynamic().Resource(releaseGVR).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return fmt.Errorf("patch status of DeckhouseRelease %s: %v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updatewatchdog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flant/kube-client/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency/k8s"
+)
+
+func newCluster(t *testing.T, withUpdatingCM bool) k8s.Client {
+	cluster := fake.NewFakeCluster(k8s.DefaultFakeClusterVersion)
+	cluster.RegisterCRD("deckhouse.io", "v1alpha1", "DeckhouseRelease", false)
+	client := cluster.Client
+	ctx := context.TODO()
+
+	for _, name := range []string{"v1-25-0", "v1-26-0"} {
+		release := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "deckhouse.io/v1alpha1",
+			"kind":       "DeckhouseRelease",
+			"metadata":   map[string]interface{}{"name": name},
+		}}
+		_, err := client.Dynamic().Resource(releaseGVR).Create(ctx, release, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// the new pod never becomes ready
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "deckhouse-6f46df5bd7-nk4j7", Namespace: namespace, Labels: map[string]string{"app": "deckhouse"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "deckhouse", Image: "my.registry.com/deckhouse:v1.26.0"}}},
+		Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "deckhouse", Ready: false}}},
+	}
+	_, err := client.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: deploymentName, Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "deckhouse", Image: "my.registry.com/deckhouse:v1.26.0"}},
+		}}},
+	}
+	_, err = client.AppsV1().Deployments(namespace).Create(ctx, deployment, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	if withUpdatingCM {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: updatingCMName, Namespace: namespace},
+			Data:       map[string]string{"version": "1.26.0", "previousVersion": "1.25.0"},
+		}
+		_, err = client.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	return client
+}
+
+func testOptions() Options {
+	return Options{
+		Release:         "v1-26-0",
+		Version:         "1.26.0",
+		PreviousRelease: "v1-25-0",
+		PreviousImage:   "my.registry.com/deckhouse:v1.25.0",
+		DeployedAt:      time.Now().Add(-time.Hour),
+		Timeout:         30 * time.Minute,
+	}
+}
+
+func deploymentImage(t *testing.T, client k8s.Client) string {
+	deployment, err := client.AppsV1().Deployments(namespace).Get(context.TODO(), deploymentName, metav1.GetOptions{})
+	require.NoError(t, err)
+	return deployment.Spec.Template.Spec.Containers[0].Image
+}
+
+func releaseStatus(t *testing.T, client k8s.Client, name string) map[string]interface{} {
+	release, err := client.Dynamic().Resource(releaseGVR).Get(context.TODO(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status, _, _ := unstructured.NestedMap(release.Object, "status")
+	return status
+}
+
+func TestRollbackIfNewPodIsNeverReady(t *testing.T) {
+	client := newCluster(t, true)
+
+	require.NoError(t, Run(client, testOptions()))
+
+	assert.Equal(t, "my.registry.com/deckhouse:v1.25.0", deploymentImage(t, client))
+
+	failed := releaseStatus(t, client, "v1-26-0")
+	assert.Equal(t, "Failed", failed["phase"])
+	assert.Equal(t, "Post-update verification failed after 30m0s: deckhouse pod is not ready", failed["message"])
+
+	previous := releaseStatus(t, client, "v1-25-0")
+	assert.Equal(t, "Deployed", previous["phase"])
+	assert.Equal(t, true, previous["approved"])
+	assert.Equal(t, "Rolled back from failed release v1.26.0", previous["message"])
+
+	_, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), updatingCMName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestNoRollbackIfReleaseIsVerified(t *testing.T) {
+	client := newCluster(t, false)
+
+	require.NoError(t, Run(client, testOptions()))
+
+	assert.Equal(t, "my.registry.com/deckhouse:v1.26.0", deploymentImage(t, client))
+	assert.Empty(t, releaseStatus(t, client, "v1-26-0"))
+}
@@ -17,6 +17,7 @@ package bootstrap
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 
 	"github.com/google/uuid"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -127,6 +128,96 @@ func bootstrapAdditionalNodesForCloudCluster(kubeCl *client.KubernetesClient, me
 	})
 }
 
+// baseInfraOutputs are saved into the phases journal to skip base-infra phase on the next run.
+// Terraform states contain provider credentials, so the journal keeps only their keys in the state cache
+// and states are loaded from the cache when the phase is skipped.
+type baseInfraOutputs struct {
+	CloudDiscovery         []byte `json:"cloudDiscovery"`
+	TerraformState         []byte `json:"-"`
+	TerraformStateCacheKey string `json:"terraformStateCacheKey"`
+	BastionHost            string `json:"bastionHost,omitempty"`
+
+	MasterNodeName               string `json:"masterNodeName"`
+	MasterTerraformState         []byte `json:"-"`
+	MasterTerraformStateCacheKey string `json:"masterTerraformStateCacheKey"`
+	MasterIPForSSH               string `json:"masterIPForSSH"`
+	NodeInternalIP               string `json:"nodeInternalIP"`
+	KubeDataDevicePath           string `json:"kubeDataDevicePath"`
+}
+
+// loadTerraformStates restores Terraform states of the outputs restored from the journal.
+func (o *baseInfraOutputs) loadTerraformStates(stateCache state.Cache) error {
+	var err error
+	if o.TerraformState == nil {
+		o.TerraformState, err = loadCachedTerraformState(stateCache, o.TerraformStateCacheKey)
+		if err != nil {
+			return err
+		}
+	}
+	if o.MasterTerraformState == nil {
+		o.MasterTerraformState, err = loadCachedTerraformState(stateCache, o.MasterTerraformStateCacheKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadCachedTerraformState(stateCache state.Cache, key string) ([]byte, error) {
+	if key == "" {
+		return nil, fmt.Errorf("terraform state key is not recorded in the bootstrap phases journal, run bootstrap with --resume-from=%s", bootstrap.BaseInfraPhase)
+	}
+
+	inCache, err := stateCache.InCache(key)
+	if err != nil {
+		return nil, err
+	}
+	if !inCache {
+		return nil, fmt.Errorf("terraform state %s is not found in the cache, run bootstrap with --resume-from=%s", key, bootstrap.BaseInfraPhase)
+	}
+
+	return stateCache.Load(key)
+}
+
+func createBaseInfrastructure(metaConfig *config.MetaConfig, stateCache state.Cache) (baseInfraOutputs, error) {
+	var outputs baseInfraOutputs
+
+	baseRunner := terraform.NewRunnerFromConfig(metaConfig, "base-infrastructure", stateCache).
+		WithVariables(metaConfig.MarshalConfig()).
+		WithAutoApprove(true)
+	tomb.RegisterOnShutdown("base-infrastructure", baseRunner.Stop)
+
+	baseOutputs, err := terraform.ApplyPipeline(baseRunner, "Kubernetes cluster", terraform.GetBaseInfraResult)
+	if err != nil {
+		return outputs, err
+	}
+
+	masterNodeName := fmt.Sprintf("%s-master-0", metaConfig.ClusterPrefix)
+	masterRunner := terraform.NewRunnerFromConfig(metaConfig, "master-node", stateCache).
+		WithVariables(metaConfig.NodeGroupConfig("master", 0, "")).
+		WithName(masterNodeName).
+		WithAutoApprove(true)
+	tomb.RegisterOnShutdown(masterNodeName, masterRunner.Stop)
+
+	masterOutputs, err := terraform.ApplyPipeline(masterRunner, masterNodeName, terraform.GetMasterNodeResult)
+	if err != nil {
+		return outputs, err
+	}
+
+	return baseInfraOutputs{
+		CloudDiscovery:               baseOutputs.CloudDiscovery,
+		TerraformState:               baseOutputs.TerraformState,
+		TerraformStateCacheKey:       baseRunner.StateName(),
+		BastionHost:                  baseOutputs.BastionHost,
+		MasterNodeName:               masterNodeName,
+		MasterTerraformState:         masterOutputs.TerraformState,
+		MasterTerraformStateCacheKey: masterRunner.StateName(),
+		MasterIPForSSH:               masterOutputs.MasterIPForSSH,
+		NodeInternalIP:               masterOutputs.NodeInternalIP,
+		KubeDataDevicePath:           masterOutputs.KubeDataDevicePath,
+	}, nil
+}
+
 func setBastionHostFromCloudProvider(host string, sshClient *ssh.Client) {
 	app.SSHBastionHost = host
 	app.SSHBastionUser = app.SSHUser
@@ -150,6 +241,7 @@ func DefineBootstrapCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 	app.DefineDeckhouseFlags(cmd)
 	app.DefineDontUsePublicImagesFlags(cmd)
 	app.DefinePostBootstrapScriptFlags(cmd)
+	app.DefineBootstrapResumeFlags(cmd)
 
 	runFunc := func() error {
 		masterAddressesForSSH := make(map[string]string)
@@ -212,74 +304,69 @@ func DefineBootstrapCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 		deckhouseInstallConfig.KubeadmBootstrap = true
 		deckhouseInstallConfig.MasterNodeSelector = true
 
-		var nodeIP string
-		var devicePath string
+		journal, err := bootstrap.NewPhaseJournal(stateCache)
+		if err != nil {
+			return err
+		}
+
+		journal, err = journal.WithResumeFrom(bootstrap.Phase(app.ResumeFromPhase))
+		if err != nil {
+			return err
+		}
+
+		var baseInfra baseInfraOutputs
 		var resourcesTemplateData map[string]interface{}
 
 		if metaConfig.ClusterType == config.CloudClusterType {
-			err = log.Process("bootstrap", "Cloud infrastructure", func() error {
-				baseRunner := terraform.NewRunnerFromConfig(metaConfig, "base-infrastructure", stateCache).
-					WithVariables(metaConfig.MarshalConfig()).
-					WithAutoApprove(true)
-				tomb.RegisterOnShutdown("base-infrastructure", baseRunner.Stop)
-
-				baseOutputs, err := terraform.ApplyPipeline(baseRunner, "Kubernetes cluster", terraform.GetBaseInfraResult)
-				if err != nil {
-					return err
-				}
-
-				var cloudDiscoveryData map[string]interface{}
-				err = json.Unmarshal(baseOutputs.CloudDiscovery, &cloudDiscoveryData)
-				if err != nil {
+			err = journal.Run(bootstrap.BaseInfraPhase, bootstrap.PhaseInputs{
+				"config": metaConfig.MarshalConfig(),
+			}, &baseInfra, func() error {
+				return log.Process("bootstrap", "Cloud infrastructure", func() error {
+					var err error
+					baseInfra, err = createBaseInfrastructure(metaConfig, stateCache)
 					return err
-				}
-
-				resourcesTemplateData = map[string]interface{}{
-					"cloudDiscovery": cloudDiscoveryData,
-				}
+				})
+			})
+			if err != nil {
+				return err
+			}
 
-				masterNodeName := fmt.Sprintf("%s-master-0", metaConfig.ClusterPrefix)
-				masterRunner := terraform.NewRunnerFromConfig(metaConfig, "master-node", stateCache).
-					WithVariables(metaConfig.NodeGroupConfig("master", 0, "")).
-					WithName(masterNodeName).
-					WithAutoApprove(true)
-				tomb.RegisterOnShutdown(masterNodeName, masterRunner.Stop)
+			if err := baseInfra.loadTerraformStates(stateCache); err != nil {
+				return err
+			}
 
-				masterOutputs, err := terraform.ApplyPipeline(masterRunner, masterNodeName, terraform.GetMasterNodeResult)
-				if err != nil {
-					return err
-				}
+			var cloudDiscoveryData map[string]interface{}
+			err = json.Unmarshal(baseInfra.CloudDiscovery, &cloudDiscoveryData)
+			if err != nil {
+				return err
+			}
 
-				deckhouseInstallConfig.CloudDiscovery = baseOutputs.CloudDiscovery
-				deckhouseInstallConfig.TerraformState = baseOutputs.TerraformState
+			resourcesTemplateData = map[string]interface{}{
+				"cloudDiscovery": cloudDiscoveryData,
+			}
 
-				if baseOutputs.BastionHost != "" {
-					setBastionHostFromCloudProvider(baseOutputs.BastionHost, sshClient)
-					operations.SaveBastionHostToCache(baseOutputs.BastionHost)
-				}
+			deckhouseInstallConfig.CloudDiscovery = baseInfra.CloudDiscovery
+			deckhouseInstallConfig.TerraformState = baseInfra.TerraformState
 
-				app.SSHHosts = []string{masterOutputs.MasterIPForSSH}
-				sshClient.Settings.SetAvailableHosts(app.SSHHosts)
+			if baseInfra.BastionHost != "" {
+				setBastionHostFromCloudProvider(baseInfra.BastionHost, sshClient)
+				operations.SaveBastionHostToCache(baseInfra.BastionHost)
+			}
 
-				nodeIP = masterOutputs.NodeInternalIP
-				devicePath = masterOutputs.KubeDataDevicePath
+			app.SSHHosts = []string{baseInfra.MasterIPForSSH}
+			sshClient.Settings.SetAvailableHosts(app.SSHHosts)
 
-				deckhouseInstallConfig.NodesTerraformState = make(map[string][]byte)
-				deckhouseInstallConfig.NodesTerraformState[masterNodeName] = masterOutputs.TerraformState
+			deckhouseInstallConfig.NodesTerraformState = make(map[string][]byte)
+			deckhouseInstallConfig.NodesTerraformState[baseInfra.MasterNodeName] = baseInfra.MasterTerraformState
 
-				masterAddressesForSSH[masterNodeName] = masterOutputs.MasterIPForSSH
-				operations.SaveMasterHostsToCache(masterAddressesForSSH)
-				return nil
-			})
-			if err != nil {
-				return err
-			}
+			masterAddressesForSSH[baseInfra.MasterNodeName] = baseInfra.MasterIPForSSH
+			operations.SaveMasterHostsToCache(masterAddressesForSSH)
 		} else {
 			var static struct {
 				NodeIP string `json:"nodeIP"`
 			}
 			_ = json.Unmarshal(metaConfig.ClusterConfig["static"], &static)
-			nodeIP = static.NodeIP
+			baseInfra.NodeInternalIP = static.NodeIP
 		}
 
 		// next parse and check resources
@@ -298,29 +385,55 @@ func DefineBootstrapCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 		if err := operations.WaitForSSHConnectionOnMaster(sshClient); err != nil {
 			return err
 		}
-		if err := operations.RunBashiblePipeline(sshClient, metaConfig, nodeIP, devicePath); err != nil {
+
+		err = journal.Run(bootstrap.ExecBashiblePhase, bootstrap.PhaseInputs{
+			"config":     metaConfig,
+			"registry":   metaConfig.Registry,
+			"host":       app.SSHHosts,
+			"nodeIP":     baseInfra.NodeInternalIP,
+			"devicePath": baseInfra.KubeDataDevicePath,
+		}, nil, func() error {
+			return operations.RunBashiblePipeline(sshClient, metaConfig, baseInfra.NodeInternalIP, baseInfra.KubeDataDevicePath)
+		})
+		if err != nil {
 			return err
 		}
+
 		kubeCl, err := operations.ConnectToKubernetesAPI(sshClient)
 		if err != nil {
 			return err
 		}
-		if err := operations.InstallDeckhouse(kubeCl, deckhouseInstallConfig); err != nil {
-			return err
-		}
 
-		if metaConfig.ClusterType == config.CloudClusterType {
-			err := converge.NewInLockLocalRunner(kubeCl, "local-bootstraper").Run(func() error {
-				return bootstrapAdditionalNodesForCloudCluster(kubeCl, metaConfig, masterAddressesForSSH)
-			})
-			if err != nil {
+		// Additional cloud nodes are created by the same phase,
+		// because there is no separate command for them in "bootstrap-phase".
+		err = journal.Run(bootstrap.InstallDeckhousePhase, bootstrap.PhaseInputs{
+			"installConfig":   deckhouseInstallConfig,
+			"masterNodeGroup": metaConfig.MasterNodeGroupSpec,
+			"terraNodeGroups": metaConfig.GetTerraNodeGroups(),
+		}, nil, func() error {
+			if err := operations.InstallDeckhouse(kubeCl, deckhouseInstallConfig); err != nil {
 				return err
 			}
+
+			if metaConfig.ClusterType != config.CloudClusterType {
+				return nil
+			}
+
+			return converge.NewInLockLocalRunner(kubeCl, "local-bootstraper").Run(func() error {
+				return bootstrapAdditionalNodesForCloudCluster(kubeCl, metaConfig, masterAddressesForSSH)
+			})
+		})
+		if err != nil {
+			return err
 		}
 
 		if resourcesToCreate != nil {
-			err = log.Process("bootstrap", "Create Resources", func() error {
-				return resources.CreateResourcesLoop(kubeCl, resourcesToCreate)
+			err = journal.Run(bootstrap.CreateResourcesPhase, bootstrap.PhaseInputs{
+				"resources": resourcesToCreate,
+			}, nil, func() error {
+				return log.Process("bootstrap", "Create Resources", func() error {
+					return resources.CreateResourcesLoop(kubeCl, resourcesToCreate)
+				})
 			})
 			if err != nil {
 				return err
@@ -328,15 +441,26 @@ func DefineBootstrapCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 		}
 
 		if app.PostBootstrapScriptPath != "" {
-			postScriptExecutor := bootstrap.NewPostBootstrapScriptExecutor(sshClient, app.PostBootstrapScriptPath, bootstrapState).
-				WithTimeout(app.PostBootstrapScriptTimeout)
+			script, err := ioutil.ReadFile(app.PostBootstrapScriptPath)
+			if err != nil {
+				return err
+			}
+
+			err = journal.Run(bootstrap.ExecPostBootstrapPhase, bootstrap.PhaseInputs{
+				"script": script,
+			}, nil, func() error {
+				postScriptExecutor := bootstrap.NewPostBootstrapScriptExecutor(sshClient, app.PostBootstrapScriptPath, bootstrapState).
+					WithTimeout(app.PostBootstrapScriptTimeout)
 
-			if err := postScriptExecutor.Execute(); err != nil {
+				return postScriptExecutor.Execute()
+			})
+			if err != nil {
 				return err
 			}
 		}
 
 		_ = log.Process("bootstrap", "Clear cache", func() error {
+			// the phases journal is deleted too, next bootstrap starts from the beginning
 			cache.Global().CleanWithExceptions(
 				operations.MasterHostsCacheKey,
 				operations.ManifestCreatedInClusterCacheKey,
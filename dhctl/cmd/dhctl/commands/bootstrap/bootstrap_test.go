@@ -0,0 +1,80 @@
+// Copyright 2022 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/operations/bootstrap"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/cache"
+)
+
+func TestBaseInfraOutputsJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dhctl-bootstrap-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stateCache, err := cache.NewStateCache(dir)
+	require.NoError(t, err)
+
+	baseState := []byte(`{"resources":[{"instances":[{"attributes":{"password":"secret"}}]}]}`)
+	masterState := []byte(`{"resources":[{"instances":[{"attributes":{"ssh_key":"secret"}}]}]}`)
+	require.NoError(t, stateCache.Save("base-infrastructure.tfstate", baseState))
+	require.NoError(t, stateCache.Save("test-master-0.tfstate", masterState))
+
+	journal, err := bootstrap.NewPhaseJournal(stateCache)
+	require.NoError(t, err)
+
+	var outputs baseInfraOutputs
+	err = journal.Run(bootstrap.BaseInfraPhase, bootstrap.PhaseInputs{"config": "test"}, &outputs, func() error {
+		outputs = baseInfraOutputs{
+			CloudDiscovery:               []byte(`{}`),
+			TerraformState:               baseState,
+			TerraformStateCacheKey:       "base-infrastructure.tfstate",
+			MasterNodeName:               "test-master-0",
+			MasterTerraformState:         masterState,
+			MasterTerraformStateCacheKey: "test-master-0.tfstate",
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	record := journal.Record(bootstrap.BaseInfraPhase)
+	require.NotContains(t, string(record.Outputs), "secret")
+
+	// The next run skips the phase and restores the outputs from the journal.
+	journal, err = bootstrap.NewPhaseJournal(stateCache)
+	require.NoError(t, err)
+
+	var restored baseInfraOutputs
+	err = journal.Run(bootstrap.BaseInfraPhase, bootstrap.PhaseInputs{"config": "test"}, &restored, func() error {
+		t.Fatal("base-infra phase must be skipped")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Nil(t, restored.TerraformState)
+
+	require.NoError(t, restored.loadTerraformStates(stateCache))
+	require.Equal(t, baseState, restored.TerraformState)
+	require.Equal(t, masterState, restored.MasterTerraformState)
+
+	stateCache.Delete("test-master-0.tfstate")
+	restored.MasterTerraformState = nil
+	require.Error(t, restored.loadTerraformStates(stateCache))
+}
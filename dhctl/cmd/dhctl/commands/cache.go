@@ -0,0 +1,299 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/config"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/client"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/operations"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state/cache"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state/terraform"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh"
+)
+
+func cacheIdentity() (string, error) {
+	if app.CacheIdentity != "" {
+		return app.CacheIdentity, nil
+	}
+
+	if app.ConfigPath == "" {
+		return "", fmt.Errorf("--cache-identity or --config is required")
+	}
+
+	metaConfig, err := config.LoadConfigFromFile(app.ConfigPath)
+	if err != nil {
+		return "", err
+	}
+	return metaConfig.CachePath(), nil
+}
+
+func openCache(readOnly bool) (string, state.Cache, error) {
+	identity, err := cacheIdentity()
+	if err != nil {
+		return "", nil, err
+	}
+
+	stateCache, err := cache.NewCache(cache.DefaultBackend(), cache.BackendParams{
+		Identity: identity,
+		URL:      app.CacheURL,
+		ReadOnly: readOnly,
+	})
+	return identity, stateCache, err
+}
+
+func printOutput(v interface{}) error {
+	var data []byte
+	var err error
+	switch app.OutputFormat {
+	case "yaml":
+		data, err = yaml.Marshal(v)
+	case "json":
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("Unknown output format %s", app.OutputFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(data))
+	return nil
+}
+
+func DefineCacheListCommand(parent *kingpin.CmdClause) *kingpin.CmdClause {
+	cmd := parent.Command("list", "List keys of terraform state cache.")
+	app.DefineCacheSourceFlags(cmd)
+	app.DefineOutputFlag(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		_, stateCache, err := openCache(true)
+		if err != nil {
+			return err
+		}
+
+		keys, err := cache.ListKeys(stateCache)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(keys)
+	})
+	return cmd
+}
+
+func DefineCacheShowCommand(parent *kingpin.CmdClause) *kingpin.CmdClause {
+	cmd := parent.Command("show", "Print content of the terraform state cache key.")
+	app.DefineCacheSourceFlags(cmd)
+	app.DefineCacheShowFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		_, stateCache, err := openCache(true)
+		if err != nil {
+			return err
+		}
+
+		ok, err := stateCache.InCache(app.CacheKey)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("key %s not found in cache", app.CacheKey)
+		}
+
+		content, err := stateCache.Load(app.CacheKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(content)
+		return err
+	})
+	return cmd
+}
+
+func DefineCacheExportCommand(parent *kingpin.CmdClause) *kingpin.CmdClause {
+	cmd := parent.Command("export", "Export all keys of terraform state cache into the archive.")
+	app.DefineCacheSourceFlags(cmd)
+	app.DefineCacheExportFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		identity, stateCache, err := openCache(true)
+		if err != nil {
+			return err
+		}
+
+		archive, err := cache.NewArchive(identity, stateCache)
+		if err != nil {
+			return err
+		}
+
+		if app.CacheArchivePath == "-" {
+			return archive.Write(os.Stdout, app.CacheArchiveFormat)
+		}
+
+		f, err := os.OpenFile(app.CacheArchivePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if err := archive.Write(f, app.CacheArchiveFormat); err != nil {
+			return err
+		}
+
+		log.InfoF("%d keys were exported to %s\n", len(archive.Entries), app.CacheArchivePath)
+		return nil
+	})
+	return cmd
+}
+
+func DefineCacheImportCommand(parent *kingpin.CmdClause) *kingpin.CmdClause {
+	cmd := parent.Command("import", "Import all keys from the archive into terraform state cache.")
+	app.DefineCacheSourceFlags(cmd)
+	app.DefineCacheImportFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		var r io.Reader = os.Stdin
+		if app.CacheArchivePath != "-" {
+			f, err := os.Open(app.CacheArchivePath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		archive, err := cache.ReadArchive(r)
+		if err != nil {
+			return err
+		}
+
+		identity, stateCache, err := openCache(false)
+		if err != nil {
+			return err
+		}
+
+		if archive.Identity != identity {
+			log.WarnF("Archive was exported from the cache %q, importing into %q\n", archive.Identity, identity)
+		}
+
+		keys, err := archive.Restore(stateCache, app.ImportForce)
+		if err != nil {
+			return err
+		}
+
+		log.InfoF("%d keys were imported.\n", len(keys))
+		if archive.HasTombstone() {
+			log.WarnLn("The archive contains the tombstone, the cache is marked as exhausted.")
+		}
+		return nil
+	})
+	return cmd
+}
+
+type cacheDiffKubeGetter struct {
+	kubeCl *client.KubernetesClient
+}
+
+func (g *cacheDiffKubeGetter) GetKubeClient() (*client.KubernetesClient, error) {
+	if g.kubeCl != nil {
+		return g.kubeCl, nil
+	}
+
+	sshClient, err := ssh.NewInitClientFromFlags(true)
+	if err != nil {
+		return nil, err
+	}
+
+	g.kubeCl, err = operations.ConnectToKubernetesAPI(sshClient)
+	return g.kubeCl, err
+}
+
+func DefineCacheDiffCommand(parent *kingpin.CmdClause) *kingpin.CmdClause {
+	cmd := parent.Command("diff", "Compare terraform states from the cache with the states saved in the Kubernetes cluster.")
+	app.DefineCacheSourceFlags(cmd)
+	app.DefineOutputFlag(cmd)
+	app.DefineSSHFlags(cmd)
+	app.DefineBecomeFlags(cmd)
+	app.DefineKubeFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		_, stateCache, err := openCache(true)
+		if err != nil {
+			return err
+		}
+
+		// dummy cache forces the loader to get states from the cluster
+		clusterLoader := terraform.NewCachedTerraStateLoader(&cacheDiffKubeGetter{}, cache.Dummy())
+
+		diff, err := terraform.DiffCacheWithCluster(stateCache, clusterLoader)
+		if err != nil {
+			return err
+		}
+
+		return printOutput(diff)
+	})
+	return cmd
+}
+
+func DefineCacheMigrateCommand(parent *kingpin.CmdClause) *kingpin.CmdClause {
+	cmd := parent.Command("migrate", "Copy terraform state cache from one backend to another.")
+	app.DefineCacheIdentityFlags(cmd)
+	app.DefineCacheMigrateFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		identity, err := cacheIdentity()
+		if err != nil {
+			return err
+		}
+
+		return log.Process("default", "Migrate cache", func() error {
+			from, err := cache.NewCache(app.MigrateFromBackend, cache.BackendParams{Identity: identity, URL: app.MigrateFromURL})
+			if err != nil {
+				return fmt.Errorf("open source cache: %v", err)
+			}
+
+			to, err := cache.NewCache(app.MigrateToBackend, cache.BackendParams{Identity: identity, URL: app.MigrateToURL})
+			if err != nil {
+				return fmt.Errorf("open destination cache: %v", err)
+			}
+
+			keys, err := cache.Migrate(from, to, app.MigrateForce)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				log.InfoF("%s\n", key)
+			}
+			log.InfoF("%d keys were copied from %s to %s backend.\n", len(keys), app.MigrateFromBackend, app.MigrateToBackend)
+			log.InfoLn("The source cache was not changed. Use --cache-backend and --cache-url flags to work with the new cache.")
+			return nil
+		})
+	})
+	return cmd
+}
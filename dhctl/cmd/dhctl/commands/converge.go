@@ -15,14 +15,19 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/yaml"
 
 	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/config"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/actions/converge"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/client"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/operations"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/state/cache"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh"
@@ -34,6 +39,7 @@ func DefineConvergeCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 	app.DefineSSHFlags(cmd)
 	app.DefineBecomeFlags(cmd)
 	app.DefineKubeFlags(cmd)
+	app.DefineConvergePlanFlags(cmd)
 
 	runFunc := func(sshClient *ssh.Client) error {
 		kubeCl, err := operations.ConnectToKubernetesAPI(sshClient)
@@ -41,6 +47,10 @@ func DefineConvergeCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 			return err
 		}
 
+		if app.ConvergePlanOnly {
+			return runConvergePlan(kubeCl)
+		}
+
 		cacheIdentity := ""
 		if app.KubeConfigInCluster {
 			cacheIdentity = "in-cluster"
@@ -84,6 +94,50 @@ func DefineConvergeCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 	return cmd
 }
 
+// runConvergePlan checks all terraform layers and prints the plan. It does not touch the cache and the converge lock.
+func runConvergePlan(kubeCl *client.KubernetesClient) error {
+	metaConfig, err := config.ParseConfigInCluster(kubeCl)
+	if err != nil {
+		return err
+	}
+
+	metaConfig.UUID, err = converge.GetClusterUUID(kubeCl)
+	if err != nil {
+		return err
+	}
+
+	plan, checkErr := converge.CheckPlan(kubeCl, metaConfig)
+
+	var data []byte
+	switch app.OutputFormat {
+	case "yaml":
+		data, err = yaml.Marshal(plan)
+	case "json":
+		data, err = json.MarshalIndent(plan, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("Unknown output format %s", app.OutputFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	if app.ConvergePlanFile != "" {
+		err = ioutil.WriteFile(app.ConvergePlanFile, data, 0o644)
+		if err != nil {
+			return fmt.Errorf("can't write plan: %v", err)
+		}
+		log.InfoF("Converge plan was saved to %s\n", app.ConvergePlanFile)
+	} else {
+		fmt.Print(string(data))
+	}
+
+	if checkErr != nil {
+		return fmt.Errorf("converge plan is incomplete: %v", checkErr)
+	}
+	return nil
+}
+
 func DefineAutoConvergeCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 	cmd := kpApp.Command("converge-periodical", "Start service for periodical run converge.")
 	app.DefineAutoConvergeFlags(cmd)
@@ -120,7 +174,14 @@ func DefineAutoConvergeCommand(kpApp *kingpin.Application) *kingpin.CmdClause {
 			WithExcludedNodes([]string{app.RunningNodeName}).
 			WithSkipPhases([]converge.Phase{converge.PhaseAllNodes})
 
-		converger := operations.NewAutoConverger(runner, app.AutoConvergeListenAddress, app.ApplyInterval)
+		converger := operations.NewAutoConverger(kubeCl, runner, app.AutoConvergeListenAddress, app.ApplyInterval).
+			WithMode(app.AutoConvergeMode).
+			WithStatusRecorder(operations.NewAutoConvergeStatusRecorder(kubeCl, app.RunningNodeName))
+
+		if app.LeaderElection {
+			converger.WithLeaderElection(app.LeaderElectionIdentity)
+		}
+
 		return converger.Start()
 	})
 	return cmd
@@ -0,0 +1,81 @@
+// Copyright 2022 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/operations/restore"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/terminal"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/input"
+)
+
+const restoreEtcdMessage = `etcd on the control-plane node %s will be stopped and restored from the snapshot as a single-member cluster.
+All changes made in the cluster after the snapshot was taken will be lost.
+`
+
+const restoreEtcdMultiMasterMessage = `If the cluster has several control-plane nodes, remove the etcd data on the other ones
+(move /etc/kubernetes/manifests/etcd.yaml away and delete /var/lib/etcd/member)
+and wait for control-plane-manager to join them to the restored etcd.
+`
+
+func DefineRestoreEtcdCommand(parent *kingpin.CmdClause) *kingpin.CmdClause {
+	cmd := parent.Command("etcd", "Restore etcd on the control-plane node from the snapshot.")
+	app.DefineSSHFlags(cmd)
+	app.DefineBecomeFlags(cmd)
+	app.DefineSanityFlags(cmd)
+	app.DefineRestoreEtcdFlags(cmd)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		if (app.EtcdSnapshotPath == "") == (app.EtcdSnapshotPathOnHost == "") {
+			return fmt.Errorf("exactly one of --snapshot or --snapshot-on-host flags is required")
+		}
+
+		sshClient, err := ssh.NewClientFromFlags().Start()
+		if err != nil {
+			return err
+		}
+
+		if err := terminal.AskBecomePassword(); err != nil {
+			return err
+		}
+
+		host := sshClient.Check().String()
+		if !app.SanityCheck {
+			log.WarnF(restoreEtcdMessage, host)
+			if !input.NewConfirmation().WithMessage("Do you want to restore etcd?").Ask() {
+				return fmt.Errorf("Don't confirm etcd restore")
+			}
+		}
+
+		err = restore.RestoreEtcd(&restore.EtcdParams{
+			SSHClient:      sshClient,
+			LocalSnapshot:  app.EtcdSnapshotPath,
+			SnapshotOnHost: app.EtcdSnapshotPathOnHost,
+		})
+		if err != nil {
+			return err
+		}
+
+		log.WarnLn(restoreEtcdMultiMasterMessage)
+		return nil
+	})
+	return cmd
+}
@@ -72,12 +72,27 @@ func main() {
 
 	commands.DefineDestroyCommand(kpApp)
 
+	restoreCmd := kpApp.Command("restore", "Restore cluster components from backups.")
+	{
+		commands.DefineRestoreEtcdCommand(restoreCmd)
+	}
+
 	terraformCmd := kpApp.Command("terraform", "Terraform commands.")
 	{
 		commands.DefineTerraformConvergeExporterCommand(terraformCmd)
 		commands.DefineTerraformCheckCommand(terraformCmd)
 	}
 
+	cacheCmd := kpApp.Command("cache", "Manage terraform state cache.")
+	{
+		commands.DefineCacheListCommand(cacheCmd)
+		commands.DefineCacheShowCommand(cacheCmd)
+		commands.DefineCacheExportCommand(cacheCmd)
+		commands.DefineCacheImportCommand(cacheCmd)
+		commands.DefineCacheDiffCommand(cacheCmd)
+		commands.DefineCacheMigrateCommand(cacheCmd)
+	}
+
 	configCmd := kpApp.Command("config", "Load, edit and save various dhctl configurations.")
 	{
 		parseCmd := configCmd.Command("parse", "Parse, validate and output configurations.")
@@ -123,6 +138,10 @@ func main() {
 
 	kpApp.Action(func(c *kingpin.ParseContext) error {
 		log.InitLogger(app.LoggerType)
+		if err := log.InitProgressOutput(app.ProgressOutput); err != nil {
+			return err
+		}
+		tomb.RegisterOnShutdown("Close progress output", log.CloseProgressOutput)
 		return nil
 	})
 
@@ -134,6 +153,7 @@ func main() {
 		if err != nil {
 			log.DebugLn(command)
 			log.ErrorLn(err)
+			log.EmitError(err)
 			errorCode = 1
 		}
 		tomb.Shutdown(errorCode)
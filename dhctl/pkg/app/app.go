@@ -32,6 +32,8 @@ var (
 	SanityCheck = false
 	LoggerType  = "pretty"
 	IsDebug     = false
+
+	ProgressOutput = ""
 )
 
 func init() {
@@ -49,6 +51,10 @@ func GlobalFlags(cmd *kingpin.Application) {
 		Envar(configEnvName("TMP_DIR")).
 		Default(TmpDirName).
 		StringVar(&TmpDirName)
+	cmd.Flag("progress-output", `Emit progress events as newline-delimited JSON.
+Pass a file descriptor (fd://3) or a path to an unix socket (unix:///run/dhctl.sock).`).
+		Envar(configEnvName("PROGRESS_OUTPUT")).
+		StringVar(&ProgressOutput)
 }
 
 func DefineConfigFlags(cmd *kingpin.CmdClause) {
@@ -20,10 +20,23 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+const (
+	// AutoConvergeModeDismissDestructive applies all changes except destructive ones layer by layer.
+	AutoConvergeModeDismissDestructive = "dismiss-destructive"
+	// AutoConvergeModeNonDestructiveOnly applies changes only if the whole plan has no destructive changes.
+	AutoConvergeModeNonDestructiveOnly = "non-destructive-only"
+	// AutoConvergeModeDryRun never applies changes and only records the plan.
+	AutoConvergeModeDryRun = "dry-run"
+)
+
 var (
 	ApplyInterval             = 30 * time.Minute
 	AutoConvergeListenAddress = ":9101"
 	RunningNodeName           = ""
+
+	AutoConvergeMode       = AutoConvergeModeDismissDestructive
+	LeaderElection         = false
+	LeaderElectionIdentity = ""
 )
 
 func DefineAutoConvergeFlags(cmd *kingpin.CmdClause) {
@@ -38,4 +51,20 @@ func DefineAutoConvergeFlags(cmd *kingpin.CmdClause) {
 	cmd.Flag("node-name", "Node name where running auto-converger pod").
 		Envar(configEnvName("RUNNING_NODE_NAME")).
 		StringVar(&RunningNodeName)
+
+	cmd.Flag("mode", `How to apply changes:
+  dismiss-destructive - apply every change except destructive ones;
+  non-destructive-only - apply changes only if the plan has no destructive changes, otherwise leave them pending;
+  dry-run - only check the plan.`).
+		Envar(configEnvName("AUTO_CONVERGE_MODE")).
+		Default(AutoConvergeModeDismissDestructive).
+		EnumVar(&AutoConvergeMode, AutoConvergeModeDismissDestructive, AutoConvergeModeNonDestructiveOnly, AutoConvergeModeDryRun)
+
+	cmd.Flag("leader-election", "Run converge only on the leader replica.").
+		Envar(configEnvName("LEADER_ELECTION")).
+		BoolVar(&LeaderElection)
+
+	cmd.Flag("leader-election-identity", "Identity of the replica for leader election. Pod name is usually used.").
+		Envar(configEnvName("LEADER_ELECTION_IDENTITY")).
+		StringVar(&LeaderElectionIdentity)
 }
@@ -112,3 +112,13 @@ func DefineDeckhouseInstallFlags(cmd *kingpin.CmdClause) {
 		Default("false").
 		BoolVar(&MasterNodeSelector)
 }
+
+var ResumeFromPhase = ""
+
+func DefineBootstrapResumeFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("resume-from", `Force bootstrap to start from the phase. All previous phases must be completed.
+Phases: base-infra, exec-bashible, install-deckhouse, create-resources, exec-post-bootstrap.
+Without the flag completed phases with unchanged inputs are skipped.`).
+		Envar(configEnvName("RESUME_FROM")).
+		StringVar(&ResumeFromPhase)
+}
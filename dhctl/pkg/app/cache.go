@@ -0,0 +1,100 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	CacheIdentity = ""
+
+	MigrateFromBackend = ""
+	MigrateFromURL     = ""
+	MigrateToBackend   = ""
+	MigrateToURL       = ""
+	MigrateForce       = false
+
+	CacheKey           = ""
+	CacheArchivePath   = ""
+	CacheArchiveFormat = "tar"
+	ImportForce        = false
+)
+
+func DefineCacheIdentityFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("cache-identity", `Identity of the cache. It is the cluster prefix based name for bootstrap
+	(e.g. "prefix-openstack-terraform-state-cache") and the ssh host for converge (e.g. "ubuntu@10.0.0.1:22").`).
+		Envar(configEnvName("CACHE_IDENTITY")).
+		StringVar(&CacheIdentity)
+	cmd.Flag("config", "Config file path. It is used to get the cache identity if --cache-identity is not set.").
+		Envar(configEnvName("CONFIG")).
+		StringVar(&ConfigPath)
+	cmd.Flag("cache-dir", "Directory to store the cache.").
+		Envar(configEnvName("CACHE_DIR")).
+		StringVar(&CacheDir)
+}
+
+func DefineCacheMigrateFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("from-backend", "Backend to migrate the cache from.").
+		Required().
+		EnumVar(&MigrateFromBackend, CacheBackends...)
+	cmd.Flag("from-url", "Location of the source cache, see --cache-url.").
+		StringVar(&MigrateFromURL)
+	cmd.Flag("to-backend", "Backend to migrate the cache to.").
+		Required().
+		EnumVar(&MigrateToBackend, CacheBackends...)
+	cmd.Flag("to-url", "Location of the destination cache, see --cache-url.").
+		StringVar(&MigrateToURL)
+	cmd.Flag("force", "Overwrite keys in the destination cache if it is not empty.").
+		Default("false").
+		BoolVar(&MigrateForce)
+
+	DefineCacheEncryptionFlags(cmd)
+	DefineCacheKubeStoreFlags(cmd)
+}
+
+// DefineCacheSourceFlags defines flags to open the cache of any backend.
+func DefineCacheSourceFlags(cmd *kingpin.CmdClause) {
+	DefineCacheIdentityFlags(cmd)
+	DefineCacheBackendFlags(cmd)
+	DefineCacheKubeStoreFlags(cmd)
+}
+
+func DefineCacheShowFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("key", "Key of the cache to show.").
+		Required().
+		StringVar(&CacheKey)
+}
+
+func DefineCacheExportFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("archive", "Path to the archive file. Use '-' to write to stdout.").
+		Envar(configEnvName("CACHE_ARCHIVE")).
+		Default("-").
+		StringVar(&CacheArchivePath)
+	cmd.Flag("format", "Format of the archive.").
+		Envar(configEnvName("CACHE_ARCHIVE_FORMAT")).
+		Default(CacheArchiveFormat).
+		EnumVar(&CacheArchiveFormat, "tar", "json")
+}
+
+func DefineCacheImportFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("archive", "Path to the archive file (tar or json). Use '-' to read from stdin.").
+		Envar(configEnvName("CACHE_ARCHIVE")).
+		Required().
+		StringVar(&CacheArchivePath)
+	cmd.Flag("force", "Overwrite keys in the cache if it is not empty.").
+		Default("false").
+		BoolVar(&ImportForce)
+}
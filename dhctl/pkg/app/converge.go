@@ -45,3 +45,18 @@ func DefineOutputFlag(cmd *kingpin.CmdClause) {
 		Short('o').
 		EnumVar(&OutputFormat, "yaml", "json")
 }
+
+var (
+	ConvergePlanOnly = false
+	ConvergePlanFile = ""
+)
+
+func DefineConvergePlanFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("plan-only", "Print the converge plan without applying it.").
+		Envar(configEnvName("PLAN_ONLY")).
+		BoolVar(&ConvergePlanOnly)
+	cmd.Flag("plan-file", "Write the converge plan into the file instead of stdout.").
+		Envar(configEnvName("PLAN_FILE")).
+		StringVar(&ConvergePlanFile)
+	DefineOutputFlag(cmd)
+}
@@ -0,0 +1,33 @@
+// Copyright 2022 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	EtcdSnapshotPath       = ""
+	EtcdSnapshotPathOnHost = ""
+)
+
+func DefineRestoreEtcdFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("snapshot", "Path to the local etcd snapshot to upload to the control-plane node and restore.").
+		Envar(configEnvName("ETCD_SNAPSHOT")).
+		ExistingFileVar(&EtcdSnapshotPath)
+	cmd.Flag("snapshot-on-host", "Path to the etcd snapshot on the control-plane node, e.g. in the Local storage of the EtcdBackup.").
+		Envar(configEnvName("ETCD_SNAPSHOT_ON_HOST")).
+		StringVar(&EtcdSnapshotPathOnHost)
+}
@@ -25,6 +25,13 @@ import (
 
 const DefaultSSHAgentPrivateKeys = "~/.ssh/id_rsa"
 
+const (
+	// SSHTransportOpenSSH runs ssh, scp, ssh-agent and ssh-add binaries.
+	SSHTransportOpenSSH = "openssh"
+	// SSHTransportNative uses built-in ssh client and does not require OpenSSH installed.
+	SSHTransportNative = "native"
+)
+
 var (
 	SSHAgentPrivateKeys = make([]string, 0)
 	SSHPrivateKeys      = make([]string, 0)
@@ -35,6 +42,7 @@ var (
 	SSHHosts            = make([]string, 0)
 	SSHPort             = ""
 	SSHExtraArgs        = ""
+	SSHTransport        = SSHTransportOpenSSH
 
 	AskBecomePass = false
 	BecomePass    = ""
@@ -67,6 +75,10 @@ func DefineSSHFlags(cmd *kingpin.CmdClause) {
 	cmd.Flag("ssh-extra-args", "extra args for ssh commands (-vvv)").
 		Envar(configEnvName("SSH_EXTRA_ARGS")).
 		StringVar(&SSHExtraArgs)
+	cmd.Flag("ssh-transport", "How to connect to servers: 'openssh' runs ssh and scp binaries, 'native' uses built-in ssh client (--ssh-extra-args are ignored).").
+		Envar(configEnvName("SSH_TRANSPORT")).
+		Default(SSHTransportOpenSSH).
+		EnumVar(&SSHTransport, SSHTransportOpenSSH, SSHTransportNative)
 
 	cmd.PreAction(func(c *kingpin.ParseContext) (err error) {
 		if len(SSHAgentPrivateKeys) == 0 {
@@ -80,6 +92,10 @@ func DefineSSHFlags(cmd *kingpin.CmdClause) {
 	})
 }
 
+func IsNativeSSHTransport() bool {
+	return SSHTransport == SSHTransportNative
+}
+
 func ParseSSHPrivateKeyPaths(pathSets []string) ([]string, error) {
 	res := make([]string, 0)
 	if len(pathSets) == 0 || (len(pathSets) == 1 && pathSets[0] == "") {
@@ -57,14 +57,14 @@ type Statistics struct {
 	Cluster       ClusterCheckResult     `json:"cluster,omitempty"`
 }
 
-func checkClusterState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig) (int, error) {
+func checkClusterState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig) (int, []terraform.ResourceChange, error) {
 	clusterState, err := GetClusterStateFromCluster(kubeCl)
 	if err != nil {
-		return terraform.PlanHasNoChanges, fmt.Errorf("terraform cluster state in Kubernetes cluster not found: %w", err)
+		return terraform.PlanHasNoChanges, nil, fmt.Errorf("terraform cluster state in Kubernetes cluster not found: %w", err)
 	}
 
 	if clusterState == nil {
-		return terraform.PlanHasNoChanges, fmt.Errorf("kubernetes cluster has no state")
+		return terraform.PlanHasNoChanges, nil, fmt.Errorf("kubernetes cluster has no state")
 	}
 
 	baseRunner := terraform.NewImmutableRunnerFromConfig(metaConfig, "base-infrastructure").
@@ -73,13 +73,14 @@ func checkClusterState(kubeCl *client.KubernetesClient, metaConfig *config.MetaC
 		WithAutoApprove(true)
 	tomb.RegisterOnShutdown("base-infrastructure", baseRunner.Stop)
 
-	return terraform.CheckBaseInfrastructurePipeline(baseRunner, "Kubernetes cluster")
+	changed, err := terraform.CheckBaseInfrastructurePipeline(baseRunner, "Kubernetes cluster")
+	return changed, baseRunner.ResourceChanges(), err
 }
 
-func checkNodeState(metaConfig *config.MetaConfig, nodeGroup *NodeGroupGroupOptions, nodeName string) (int, error) {
+func checkNodeState(metaConfig *config.MetaConfig, nodeGroup *NodeGroupGroupOptions, nodeName string) (int, []terraform.ResourceChange, error) {
 	index, ok := getIndexFromNodeName(nodeName)
 	if !ok {
-		return terraform.PlanHasNoChanges, fmt.Errorf("can't extract index from terraform state secret, skip %s", nodeName)
+		return terraform.PlanHasNoChanges, nil, fmt.Errorf("can't extract index from terraform state secret, skip %s", nodeName)
 	}
 
 	nodeRunner := terraform.NewImmutableRunnerFromConfig(metaConfig, nodeGroup.Step).
@@ -88,28 +89,51 @@ func checkNodeState(metaConfig *config.MetaConfig, nodeGroup *NodeGroupGroupOpti
 		WithName(nodeName)
 	tomb.RegisterOnShutdown(nodeName, nodeRunner.Stop)
 
-	return terraform.CheckPipeline(nodeRunner, nodeName)
+	changed, err := terraform.CheckPipeline(nodeRunner, nodeName)
+	return changed, nodeRunner.ResourceChanges(), err
+}
+
+func statusFromPlan(changed int) string {
+	switch changed {
+	case terraform.PlanHasChanges:
+		return ChangedStatus
+	case terraform.PlanHasDestructiveChanges:
+		return DestructiveStatus
+	default:
+		return OKStatus
+	}
 }
 
 func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig) (*Statistics, error) {
+	statistics, _, err := checkState(kubeCl, metaConfig)
+	return statistics, err
+}
+
+// CheckPlan returns resource changes for every terraform layer and nodes which will be created or deleted.
+func CheckPlan(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig) (*Plan, error) {
+	_, plan, err := checkState(kubeCl, metaConfig)
+	return plan, err
+}
+
+func checkState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig) (*Statistics, *Plan, error) {
 	statistics := Statistics{
 		Node:          make([]NodeCheckResult, 0),
 		NodeTemplates: make([]NodeGroupCheckResult, 0),
 		Cluster:       ClusterCheckResult{Status: OKStatus},
 	}
+	plan := newPlan()
 
 	var allErrs *multierror.Error
 
-	clusterChanged, err := checkClusterState(kubeCl, metaConfig)
+	clusterChanged, clusterChanges, err := checkClusterState(kubeCl, metaConfig)
 	switch {
 	case err != nil:
 		statistics.Cluster.Status = ErrorStatus
 		allErrs = multierror.Append(allErrs, err)
-	case clusterChanged == terraform.PlanHasChanges:
-		statistics.Cluster.Status = ChangedStatus
-	case clusterChanged == terraform.PlanHasDestructiveChanges:
-		statistics.Cluster.Status = DestructiveStatus
+	default:
+		statistics.Cluster.Status = statusFromPlan(clusterChanged)
 	}
+	plan.setBaseInfrastructure(statistics.Cluster.Status, clusterChanges, err)
 
 	nodesState, err := GetNodesStateFromCluster(kubeCl)
 	if err != nil {
@@ -123,6 +147,7 @@ func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig)
 
 	// We have no nodeTemplate settings for master nodes
 	statistics.NodeTemplates = append(statistics.NodeTemplates, NodeGroupCheckResult{Name: "master", Status: OKStatus})
+	plan.nodeGroup(MasterNodeGroupName, OKStatus)
 
 	var nodeGroupsWithStateInCluster []string
 	for _, group := range metaConfig.GetTerraNodeGroups() {
@@ -136,6 +161,7 @@ func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig)
 			templateStatus = AbsentStatus
 		}
 		statistics.NodeTemplates = append(statistics.NodeTemplates, NodeGroupCheckResult{Name: group.Name, Status: templateStatus})
+		plan.nodeGroup(group.Name, templateStatus).DesiredReplicas = group.Replicas
 
 		// Skip if node group terraform state exists, we will update node group state below
 		if _, ok := nodesState[group.Name]; ok {
@@ -147,6 +173,7 @@ func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig)
 		for _, nodeName := range expectedNodeNames(metaConfig, group.Name, group.Replicas) {
 			result := getStatusForMissedNode(kubeCl, nodeName, group.Name, &allErrs)
 			statistics.Node = append(statistics.Node, result)
+			plan.addMissedNode(result)
 		}
 	}
 
@@ -155,6 +182,10 @@ func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig)
 		replicas := getReplicasByNodeGroupName(metaConfig, nodeGroupName)
 		step := getStepByNodeGroupName(nodeGroupName)
 
+		nodeGroupPlan := plan.nodeGroup(nodeGroupName, "")
+		nodeGroupPlan.CurrentReplicas = len(nodeGroupState.State)
+		nodeGroupPlan.DesiredReplicas = replicas
+
 		if replicas > len(nodeGroupState.State) {
 			insufficientQuantity := len(nodeGroupState.State)
 			var missedNodes []string
@@ -176,6 +207,7 @@ func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig)
 			for _, nodeName := range missedNodes {
 				result := getStatusForMissedNode(kubeCl, nodeName, nodeGroupName, &allErrs)
 				statistics.Node = append(statistics.Node, result)
+				plan.addMissedNode(result)
 			}
 		} else if replicas < len(nodeGroupState.State) {
 			sortedNodeNames, err := sortNodesByIndex(nodeGroupState.State)
@@ -194,6 +226,7 @@ func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig)
 					Name:   nodeName,
 					Status: AbandonedStatus,
 				})
+				plan.addAbandonedNode(nodeGroupName, nodeName)
 
 				sortedNodeNames = sortedNodeNames[:lastIndex]
 				delete(nodeGroupState.State, nodeName)
@@ -208,29 +241,35 @@ func CheckState(kubeCl *client.KubernetesClient, metaConfig *config.MetaConfig)
 			State:           nodeGroupState.State,
 		}
 
+		nodeNames := make([]string, 0, len(nodeGroupState.State))
 		for name := range nodeGroupState.State {
+			nodeNames = append(nodeNames, name)
+		}
+		sort.Strings(nodeNames)
+
+		for _, name := range nodeNames {
 			// track changed and ok
 			checkResult := NodeCheckResult{
 				Group:  nodeGroupName,
 				Name:   name,
 				Status: OKStatus,
 			}
-			changed, err := checkNodeState(metaConfig, &nodeGroup, name)
+			changed, changes, err := checkNodeState(metaConfig, &nodeGroup, name)
 			switch {
 			case err != nil:
 				checkResult.Status = ErrorStatus
-				allErrs = multierror.Append(allErrs, fmt.Errorf("node %s: %v", name, err))
-			case changed == terraform.PlanHasChanges:
-				checkResult.Status = ChangedStatus
-			case changed == terraform.PlanHasDestructiveChanges:
-				checkResult.Status = DestructiveStatus
+				err = fmt.Errorf("node %s: %v", name, err)
+				allErrs = multierror.Append(allErrs, err)
+			default:
+				checkResult.Status = statusFromPlan(changed)
 			}
 
 			statistics.Node = append(statistics.Node, checkResult)
+			plan.addNode(checkResult, changes, err)
 		}
 	}
 
-	return &statistics, allErrs.ErrorOrNil()
+	return &statistics, plan, allErrs.ErrorOrNil()
 }
 
 func expectedNodeNames(cfg *config.MetaConfig, nodeGroupName string, replicas int) []string {
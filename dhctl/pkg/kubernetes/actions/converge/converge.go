@@ -115,6 +115,11 @@ func (r *Runner) isSkip(phase Phase) bool {
 	return ok
 }
 
+// SkipsPhase returns true if the phase is not converged by the runner.
+func (r *Runner) SkipsPhase(phase Phase) bool {
+	return r.isSkip(phase)
+}
+
 func (r *Runner) RunConverge() error {
 	return r.lockRunner.Run(r.converge)
 }
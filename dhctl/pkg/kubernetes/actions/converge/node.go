@@ -152,6 +152,17 @@ func UpdateNodeGroup(kubeCl *client.KubernetesClient, nodeGroupName string, ng *
 	return err
 }
 
+// readyNodesReporter emits the progress event once for every Ready node while waiting.
+type readyNodesReporter map[string]struct{}
+
+func (r readyNodesReporter) report(node *apiv1.Node) {
+	if _, ok := r[node.Name]; ok {
+		return
+	}
+	r[node.Name] = struct{}{}
+	log.EmitNodeReady(node.Labels["node.deckhouse.io/group"], node.Name)
+}
+
 func WaitForSingleNodeBecomeReady(kubeCl *client.KubernetesClient, nodeName string) error {
 	return retry.NewLoop(fmt.Sprintf("Waiting for  Node %s to become Ready", nodeName), 100, 20*time.Second).Run(func() error {
 		node, err := kubeCl.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
@@ -162,6 +173,7 @@ func WaitForSingleNodeBecomeReady(kubeCl *client.KubernetesClient, nodeName stri
 		for _, c := range node.Status.Conditions {
 			if c.Type == apiv1.NodeReady {
 				if c.Status == apiv1.ConditionTrue {
+					readyNodesReporter{}.report(node)
 					return nil
 				}
 			}
@@ -172,6 +184,7 @@ func WaitForSingleNodeBecomeReady(kubeCl *client.KubernetesClient, nodeName stri
 }
 
 func WaitForNodesBecomeReady(kubeCl *client.KubernetesClient, nodeGroupName string, desiredReadyNodes int) error {
+	reporter := make(readyNodesReporter)
 	return retry.NewLoop(fmt.Sprintf("Waiting for NodeGroup %s to become Ready", nodeGroupName), 100, 20*time.Second).Run(func() error {
 		nodes, err := kubeCl.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: "node.deckhouse.io/group=" + nodeGroupName})
 		if err != nil {
@@ -180,11 +193,12 @@ func WaitForNodesBecomeReady(kubeCl *client.KubernetesClient, nodeGroupName stri
 
 		readyNodes := make(map[string]struct{})
 
-		for _, node := range nodes.Items {
+		for i, node := range nodes.Items {
 			for _, c := range node.Status.Conditions {
 				if c.Type == apiv1.NodeReady {
 					if c.Status == apiv1.ConditionTrue {
 						readyNodes[node.Name] = struct{}{}
+						reporter.report(&nodes.Items[i])
 					}
 				}
 			}
@@ -209,6 +223,7 @@ func WaitForNodesBecomeReady(kubeCl *client.KubernetesClient, nodeGroupName stri
 }
 
 func WaitForNodesListBecomeReady(kubeCl *client.KubernetesClient, nodes []string) error {
+	reporter := make(readyNodesReporter)
 	return retry.NewLoop("Waiting for nodes to become Ready", 100, 20*time.Second).Run(func() error {
 		desiredReadyNodes := len(nodes)
 		var nodesList apiv1.NodeList
@@ -223,11 +238,12 @@ func WaitForNodesListBecomeReady(kubeCl *client.KubernetesClient, nodes []string
 
 		readyNodes := make(map[string]struct{})
 
-		for _, node := range nodesList.Items {
+		for i, node := range nodesList.Items {
 			for _, c := range node.Status.Conditions {
 				if c.Type == apiv1.NodeReady {
 					if c.Status == apiv1.ConditionTrue {
 						readyNodes[node.Name] = struct{}{}
+						reporter.report(&nodesList.Items[i])
 					}
 				}
 			}
@@ -0,0 +1,176 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converge
+
+import (
+	"github.com/deckhouse/deckhouse/dhctl/pkg/terraform"
+)
+
+// LayerPlan is a terraform plan for base infrastructure or for a single node.
+type LayerPlan struct {
+	Name        string                     `json:"name"`
+	Status      string                     `json:"status"`
+	Destructive bool                       `json:"destructive"`
+	Changes     []terraform.ResourceChange `json:"changes"`
+	Error       string                     `json:"error,omitempty"`
+}
+
+type NodeGroupPlan struct {
+	Name            string      `json:"name"`
+	TemplateStatus  string      `json:"templateStatus,omitempty"`
+	CurrentReplicas int         `json:"currentReplicas"`
+	DesiredReplicas int         `json:"desiredReplicas"`
+	NodesToCreate   []string    `json:"nodesToCreate"`
+	NodesToDelete   []string    `json:"nodesToDelete"`
+	Nodes           []LayerPlan `json:"nodes"`
+}
+
+// Plan describes all changes which converge will make without applying them.
+type Plan struct {
+	BaseInfrastructure    LayerPlan        `json:"baseInfrastructure"`
+	NodeGroups            []*NodeGroupPlan `json:"nodeGroups"`
+	HasChanges            bool             `json:"hasChanges"`
+	HasDestructiveChanges bool             `json:"hasDestructiveChanges"`
+	Errors                []string         `json:"errors,omitempty"`
+}
+
+func newPlan() *Plan {
+	return &Plan{NodeGroups: make([]*NodeGroupPlan, 0)}
+}
+
+func newLayerPlan(name, status string, changes []terraform.ResourceChange, err error) LayerPlan {
+	layer := LayerPlan{
+		Name:        name,
+		Status:      status,
+		Destructive: status == DestructiveStatus,
+		Changes:     changes,
+	}
+	if layer.Changes == nil {
+		layer.Changes = make([]terraform.ResourceChange, 0)
+	}
+	if err != nil {
+		layer.Error = err.Error()
+	}
+	return layer
+}
+
+func (p *Plan) trackStatus(status string) {
+	switch status {
+	case ChangedStatus, AbsentStatus:
+		p.HasChanges = true
+	case DestructiveStatus, AbandonedStatus:
+		p.HasChanges = true
+		p.HasDestructiveChanges = true
+	}
+}
+
+func (p *Plan) setBaseInfrastructure(status string, changes []terraform.ResourceChange, err error) {
+	p.BaseInfrastructure = newLayerPlan("base-infrastructure", status, changes, err)
+	p.trackStatus(status)
+	if err != nil {
+		p.Errors = append(p.Errors, err.Error())
+	}
+}
+
+// nodeGroup returns the plan for the node group and creates it if necessary.
+// Empty templateStatus does not override the status of the existing plan.
+func (p *Plan) nodeGroup(name, templateStatus string) *NodeGroupPlan {
+	for _, ng := range p.NodeGroups {
+		if ng.Name == name {
+			if templateStatus != "" {
+				ng.TemplateStatus = templateStatus
+			}
+			return ng
+		}
+	}
+
+	ng := &NodeGroupPlan{
+		Name:           name,
+		TemplateStatus: templateStatus,
+		NodesToCreate:  make([]string, 0),
+		NodesToDelete:  make([]string, 0),
+		Nodes:          make([]LayerPlan, 0),
+	}
+	p.NodeGroups = append(p.NodeGroups, ng)
+	p.trackStatus(templateStatus)
+	return ng
+}
+
+// addMissedNode tracks the node without terraform state. Absent node will be created,
+// node that exists in the cluster without state is an error which converge can't fix.
+func (p *Plan) addMissedNode(result NodeCheckResult) {
+	ng := p.nodeGroup(result.Group, "")
+	if result.Status == AbsentStatus {
+		ng.NodesToCreate = append(ng.NodesToCreate, result.Name)
+		p.trackStatus(result.Status)
+		return
+	}
+
+	ng.Nodes = append(ng.Nodes, newLayerPlan(result.Name, result.Status, nil, nil))
+	p.Errors = append(p.Errors, "node "+result.Name+" has no terraform state and can't be created")
+}
+
+func (p *Plan) addAbandonedNode(nodeGroupName, nodeName string) {
+	ng := p.nodeGroup(nodeGroupName, "")
+	ng.NodesToDelete = append(ng.NodesToDelete, nodeName)
+	p.trackStatus(AbandonedStatus)
+}
+
+func (p *Plan) addNode(result NodeCheckResult, changes []terraform.ResourceChange, err error) {
+	ng := p.nodeGroup(result.Group, "")
+	ng.Nodes = append(ng.Nodes, newLayerPlan(result.Name, result.Status, changes, err))
+	p.trackStatus(result.Status)
+	if err != nil {
+		p.Errors = append(p.Errors, err.Error())
+	}
+}
+
+// PlanSummary is a short description of the plan without resource changes.
+type PlanSummary struct {
+	HasChanges            bool     `json:"hasChanges"`
+	HasDestructiveChanges bool     `json:"hasDestructiveChanges"`
+	BaseInfrastructure    string   `json:"baseInfrastructure"`
+	ChangedLayers         []string `json:"changedLayers,omitempty"`
+	DestructiveLayers     []string `json:"destructiveLayers,omitempty"`
+	NodesToCreate         []string `json:"nodesToCreate,omitempty"`
+	NodesToDelete         []string `json:"nodesToDelete,omitempty"`
+}
+
+// Summary describes only the base infrastructure if withNodes is false.
+func (p *Plan) Summary(withNodes bool) PlanSummary {
+	summary := PlanSummary{BaseInfrastructure: p.BaseInfrastructure.Status}
+
+	layers := []LayerPlan{p.BaseInfrastructure}
+	if withNodes {
+		for _, ng := range p.NodeGroups {
+			layers = append(layers, ng.Nodes...)
+			summary.NodesToCreate = append(summary.NodesToCreate, ng.NodesToCreate...)
+			summary.NodesToDelete = append(summary.NodesToDelete, ng.NodesToDelete...)
+		}
+	}
+
+	for _, layer := range layers {
+		switch layer.Status {
+		case ChangedStatus:
+			summary.ChangedLayers = append(summary.ChangedLayers, layer.Name)
+		case DestructiveStatus:
+			summary.DestructiveLayers = append(summary.DestructiveLayers, layer.Name)
+		}
+	}
+
+	summary.HasDestructiveChanges = len(summary.DestructiveLayers) > 0 || len(summary.NodesToDelete) > 0
+	summary.HasChanges = summary.HasDestructiveChanges || len(summary.ChangedLayers) > 0 || len(summary.NodesToCreate) > 0
+	return summary
+}
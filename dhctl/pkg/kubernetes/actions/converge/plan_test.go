@@ -0,0 +1,99 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converge
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/terraform"
+)
+
+func TestPlan(t *testing.T) {
+	t.Run("Without changes", func(t *testing.T) {
+		plan := newPlan()
+		plan.setBaseInfrastructure(OKStatus, nil, nil)
+		plan.nodeGroup(MasterNodeGroupName, OKStatus)
+		plan.addNode(NodeCheckResult{Group: MasterNodeGroupName, Name: "test-master-0", Status: OKStatus}, nil, nil)
+
+		require.False(t, plan.HasChanges)
+		require.False(t, plan.HasDestructiveChanges)
+		require.Len(t, plan.NodeGroups, 1)
+		require.NotNil(t, plan.NodeGroups[0].Nodes[0].Changes)
+	})
+
+	t.Run("Nodes to create and delete", func(t *testing.T) {
+		plan := newPlan()
+		plan.nodeGroup("khm", AbsentStatus)
+		plan.addMissedNode(NodeCheckResult{Group: "khm", Name: "test-khm-0", Status: AbsentStatus})
+		require.True(t, plan.HasChanges)
+		require.False(t, plan.HasDestructiveChanges)
+
+		plan.addAbandonedNode(MasterNodeGroupName, "test-master-2")
+		require.True(t, plan.HasDestructiveChanges)
+
+		require.Len(t, plan.NodeGroups, 2)
+		require.Equal(t, AbsentStatus, plan.NodeGroups[0].TemplateStatus)
+		require.Equal(t, []string{"test-khm-0"}, plan.NodeGroups[0].NodesToCreate)
+		require.Equal(t, []string{"test-master-2"}, plan.NodeGroups[1].NodesToDelete)
+	})
+
+	t.Run("Destructive node changes", func(t *testing.T) {
+		changes := []terraform.ResourceChange{{
+			Address:     "yandex_compute_instance.master",
+			Actions:     []string{"delete", "create"},
+			Destructive: true,
+		}}
+
+		plan := newPlan()
+		plan.nodeGroup(MasterNodeGroupName, OKStatus)
+		plan.addNode(NodeCheckResult{Group: MasterNodeGroupName, Name: "test-master-0", Status: DestructiveStatus}, changes, nil)
+
+		require.True(t, plan.HasDestructiveChanges)
+		require.True(t, plan.NodeGroups[0].Nodes[0].Destructive)
+		require.Equal(t, changes, plan.NodeGroups[0].Nodes[0].Changes)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		plan := newPlan()
+		plan.setBaseInfrastructure(ErrorStatus, nil, fmt.Errorf("kubernetes cluster has no state"))
+		plan.addMissedNode(NodeCheckResult{Group: "khm", Name: "test-khm-1", Status: ErrorStatus})
+
+		require.False(t, plan.HasChanges)
+		require.Len(t, plan.Errors, 2)
+		require.Equal(t, "kubernetes cluster has no state", plan.BaseInfrastructure.Error)
+		require.Empty(t, plan.NodeGroups[0].NodesToCreate)
+	})
+}
+
+func TestPlanSummary(t *testing.T) {
+	plan := newPlan()
+	plan.setBaseInfrastructure(ChangedStatus, nil, nil)
+	plan.nodeGroup(MasterNodeGroupName, OKStatus)
+	plan.addNode(NodeCheckResult{Group: MasterNodeGroupName, Name: "test-master-0", Status: DestructiveStatus}, nil, nil)
+	plan.addAbandonedNode(MasterNodeGroupName, "test-master-1")
+
+	summary := plan.Summary(false)
+	require.True(t, summary.HasChanges)
+	require.False(t, summary.HasDestructiveChanges, "node changes should not be taken into account")
+	require.Equal(t, []string{"base-infrastructure"}, summary.ChangedLayers)
+
+	summary = plan.Summary(true)
+	require.True(t, summary.HasDestructiveChanges)
+	require.Equal(t, []string{"test-master-0"}, summary.DestructiveLayers)
+	require.Equal(t, []string{"test-master-1"}, summary.NodesToDelete)
+}
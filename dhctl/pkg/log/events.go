@@ -0,0 +1,304 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	PhaseStartedEvent      EventType = "PhaseStarted"
+	PhaseFinishedEvent     EventType = "PhaseFinished"
+	TerraformResourceEvent EventType = "TerraformResource"
+	NodeReadyEvent         EventType = "NodeReady"
+	RetryAttemptEvent      EventType = "RetryAttempt"
+	ErrorEvent             EventType = "Error"
+)
+
+// Event is a single line of the progress stream. Only the field for the event type is set.
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// PhaseID is an id of the innermost running phase, 0 means that there is no running phase.
+	PhaseID int `json:"phaseID,omitempty"`
+
+	Phase     *PhaseInfo             `json:"phase,omitempty"`
+	Terraform *TerraformResourceInfo `json:"terraform,omitempty"`
+	Node      *NodeInfo              `json:"node,omitempty"`
+	Retry     *RetryInfo             `json:"retry,omitempty"`
+	Error     *ErrorInfo             `json:"error,omitempty"`
+}
+
+type PhaseInfo struct {
+	ID       int    `json:"id"`
+	ParentID int    `json:"parentID,omitempty"`
+	Process  string `json:"process"`
+	Name     string `json:"name"`
+	// Duration is set for the finished phase only
+	Duration float64 `json:"durationSeconds,omitempty"`
+	Success  *bool   `json:"success,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+const (
+	ResourceProgressStarted    = "started"
+	ResourceProgressInProgress = "in_progress"
+	ResourceProgressComplete   = "complete"
+)
+
+type TerraformResourceInfo struct {
+	// Layer is a name of the terraform runner: base-infrastructure or node name
+	Layer   string `json:"layer,omitempty"`
+	Address string `json:"address"`
+	// Action is one of create, update, delete and read
+	Action  string `json:"action"`
+	Status  string `json:"status"`
+	Elapsed string `json:"elapsed,omitempty"`
+}
+
+type NodeInfo struct {
+	Name      string `json:"name"`
+	NodeGroup string `json:"nodeGroup,omitempty"`
+}
+
+type RetryInfo struct {
+	Name        string `json:"name"`
+	Attempt     int    `json:"attempt"`
+	MaxAttempts int    `json:"maxAttempts"`
+	Wait        string `json:"wait"`
+	Error       string `json:"error"`
+}
+
+type ErrorInfo struct {
+	Message string `json:"message"`
+	// Causes are messages of the wrapped errors from the outermost to the innermost
+	Causes []string `json:"causes,omitempty"`
+}
+
+type progressEmitter struct {
+	mu     sync.Mutex
+	out    io.WriteCloser
+	lastID int
+	phases []int
+}
+
+var (
+	// progressMu guards the progress emitter itself, emitter fields are guarded by its own mutex.
+	progressMu sync.RWMutex
+	progress   *progressEmitter
+)
+
+func getProgress() *progressEmitter {
+	progressMu.RLock()
+	defer progressMu.RUnlock()
+	return progress
+}
+
+// InitProgressOutput opens the destination for the progress stream.
+// Target is a file descriptor "fd://3" (or just "3") or a unix socket "unix:///run/dhctl.sock".
+func InitProgressOutput(target string) error {
+	if target == "" {
+		return nil
+	}
+
+	out, err := openProgressOutput(target)
+	if err != nil {
+		return fmt.Errorf("can't open progress output %s: %v", target, err)
+	}
+
+	progressMu.Lock()
+	progress = &progressEmitter{out: out}
+	progressMu.Unlock()
+	return nil
+}
+
+func openProgressOutput(target string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(target, "unix://"):
+		return net.Dial("unix", strings.TrimPrefix(target, "unix://"))
+	case strings.HasPrefix(target, "fd://"):
+		target = strings.TrimPrefix(target, "fd://")
+	}
+
+	fd, err := strconv.Atoi(target)
+	if err != nil || fd < 0 {
+		return nil, fmt.Errorf("progress output should be a file descriptor or an unix socket")
+	}
+	if fd <= 2 {
+		return nil, fmt.Errorf("stdin, stdout and stderr are not allowed, they are used by logs")
+	}
+	return os.NewFile(uintptr(fd), "progress-output"), nil
+}
+
+func CloseProgressOutput() {
+	progressMu.Lock()
+	p := progress
+	progress = nil
+	progressMu.Unlock()
+
+	if p == nil {
+		return
+	}
+
+	// Events can still be emitted by callers which got the emitter before it was closed, they are dropped.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_ = p.out.Close()
+	p.out = nil
+}
+
+func (p *progressEmitter) emit(event Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.write(event)
+}
+
+func (p *progressEmitter) write(event Event) {
+	if p.out == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.PhaseID == 0 && len(p.phases) > 0 {
+		event.PhaseID = p.phases[len(p.phases)-1]
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	// the progress stream should never break dhctl, so write errors are ignored
+	_, _ = p.out.Write(append(data, '\n'))
+}
+
+func (p *progressEmitter) startPhase(process, name string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastID++
+	info := &PhaseInfo{ID: p.lastID, Process: process, Name: name}
+	if len(p.phases) > 0 {
+		info.ParentID = p.phases[len(p.phases)-1]
+	}
+	p.phases = append(p.phases, p.lastID)
+
+	p.write(Event{Type: PhaseStartedEvent, PhaseID: info.ID, Phase: info})
+	return info.ID
+}
+
+func (p *progressEmitter) finishPhase(id, parentID int, process, name string, startedAt time.Time, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := len(p.phases) - 1; i >= 0; i-- {
+		if p.phases[i] == id {
+			p.phases = append(p.phases[:i], p.phases[i+1:]...)
+			break
+		}
+	}
+
+	success := err == nil
+	info := &PhaseInfo{
+		ID:       id,
+		ParentID: parentID,
+		Process:  process,
+		Name:     name,
+		Duration: time.Since(startedAt).Seconds(),
+		Success:  &success,
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+
+	p.write(Event{Type: PhaseFinishedEvent, PhaseID: id, Phase: info})
+}
+
+func (p *progressEmitter) currentPhase() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.phases) == 0 {
+		return 0
+	}
+	return p.phases[len(p.phases)-1]
+}
+
+// trackPhase emits started and finished events around the process.
+func trackPhase(process, name string, run func() error) error {
+	p := getProgress()
+	if p == nil {
+		return run()
+	}
+
+	parentID := p.currentPhase()
+	startedAt := time.Now()
+	id := p.startPhase(process, name)
+
+	err := run()
+
+	p.finishPhase(id, parentID, process, name, startedAt, err)
+	return err
+}
+
+func Emit(event Event) {
+	p := getProgress()
+	if p == nil {
+		return
+	}
+	p.emit(event)
+}
+
+func EmitTerraformResource(info TerraformResourceInfo) {
+	Emit(Event{Type: TerraformResourceEvent, Terraform: &info})
+}
+
+func EmitNodeReady(nodeGroup, name string) {
+	Emit(Event{Type: NodeReadyEvent, Node: &NodeInfo{Name: name, NodeGroup: nodeGroup}})
+}
+
+func EmitRetryAttempt(name string, attempt, maxAttempts int, wait time.Duration, err error) {
+	info := &RetryInfo{Name: name, Attempt: attempt, MaxAttempts: maxAttempts, Wait: wait.String()}
+	if err != nil {
+		info.Error = err.Error()
+	}
+	Emit(Event{Type: RetryAttemptEvent, Retry: info})
+}
+
+func EmitError(err error) {
+	if err == nil {
+		return
+	}
+
+	info := &ErrorInfo{Message: err.Error()}
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+		info.Causes = append(info.Causes, cause.Error())
+	}
+	Emit(Event{Type: ErrorEvent, Error: info})
+}
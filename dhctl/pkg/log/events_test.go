@@ -0,0 +1,147 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressOutput(t *testing.T) {
+	defaultLogger = &SilentLogger{}
+	defer func() { defaultLogger = &DummyLogger{} }()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-progress-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "progress.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	eventsCh := make(chan []Event)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(eventsCh)
+			return
+		}
+
+		var events []Event
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			var e Event
+			if err := json.Unmarshal(s.Bytes(), &e); err == nil {
+				events = append(events, e)
+			}
+		}
+		eventsCh <- events
+	}()
+
+	require.NoError(t, InitProgressOutput("unix://"+socketPath))
+
+	cause := fmt.Errorf("connection refused")
+	_ = Process("bootstrap", "Install Deckhouse", func() error {
+		EmitNodeReady("master", "test-master-0")
+		return Process("default", "Wait", func() error {
+			EmitRetryAttempt("Wait", 1, 3, 5*time.Second, cause)
+			return nil
+		})
+	})
+	EmitError(fmt.Errorf("bootstrap failed: %w", cause))
+
+	CloseProgressOutput()
+
+	events := <-eventsCh
+	require.Len(t, events, 7)
+
+	types := make([]EventType, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []EventType{
+		PhaseStartedEvent, NodeReadyEvent, PhaseStartedEvent, RetryAttemptEvent, PhaseFinishedEvent, PhaseFinishedEvent, ErrorEvent,
+	}, types)
+
+	require.Equal(t, "Install Deckhouse", events[0].Phase.Name)
+	require.Equal(t, events[0].Phase.ID, events[1].PhaseID, "node event should belong to the outer phase")
+	require.Equal(t, events[0].Phase.ID, events[2].Phase.ParentID)
+	require.Equal(t, events[2].Phase.ID, events[3].PhaseID)
+	require.Equal(t, 1, events[3].Retry.Attempt)
+	require.Equal(t, "connection refused", events[3].Retry.Error)
+	require.True(t, *events[5].Phase.Success)
+	require.Equal(t, 0, events[6].PhaseID)
+	require.Equal(t, []string{"connection refused"}, events[6].Error.Causes)
+}
+
+func TestProgressOutputTarget(t *testing.T) {
+	_, err := openProgressOutput("fd://1")
+	require.Error(t, err)
+
+	_, err = openProgressOutput("/tmp/progress")
+	require.Error(t, err)
+
+	// Nothing is emitted without progress output
+	Emit(Event{Type: ErrorEvent})
+}
+
+func TestCloseProgressOutputWhileEmitting(t *testing.T) {
+	defaultLogger = &SilentLogger{}
+	defer func() { defaultLogger = &DummyLogger{} }()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	go func() { _, _ = io.Copy(ioutil.Discard, r) }()
+
+	progressMu.Lock()
+	progress = &progressEmitter{out: w}
+	progressMu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				EmitNodeReady("master", "test-master-0")
+				_ = Process("default", "Wait", func() error {
+					EmitError(fmt.Errorf("retry"))
+					return nil
+				})
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	CloseProgressOutput()
+	wg.Wait()
+
+	require.Nil(t, getProgress())
+	// Events after close are dropped.
+	EmitNodeReady("master", "test-master-0")
+}
@@ -373,7 +373,9 @@ func (d *DummyLogger) Write(content []byte) (int, error) {
 }
 
 func Process(p, t string, run func() error) error {
-	return defaultLogger.LogProcess(p, t, run)
+	return trackPhase(p, t, func() error {
+		return defaultLogger.LogProcess(p, t, run)
+	})
 }
 
 func InfoF(format string, a ...interface{}) {
@@ -0,0 +1,177 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/actions/converge"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/client"
+)
+
+const (
+	autoConvergerNamespace       = "d8-system"
+	autoConvergerDeployment      = "terraform-auto-converger"
+	autoConvergerStatusConfigMap = "d8-terraform-auto-converger-status"
+)
+
+const (
+	ConvergeResultSucceeded = "Succeeded"
+	ConvergeResultNoChanges = "NoChanges"
+	// ConvergeResultPending means that the plan has destructive changes which should be applied manually.
+	ConvergeResultPending = "Pending"
+	ConvergeResultPlanned = "Planned"
+	ConvergeResultFailed  = "Failed"
+)
+
+type AutoConvergeStatus struct {
+	Identity  string                `json:"identity,omitempty"`
+	Mode      string                `json:"mode"`
+	Result    string                `json:"result"`
+	StartedAt time.Time             `json:"startedAt"`
+	Duration  time.Duration         `json:"-"`
+	Error     string                `json:"error,omitempty"`
+	Plan      *converge.PlanSummary `json:"plan,omitempty"`
+}
+
+func (s *AutoConvergeStatus) eventReasonAndType() (string, string) {
+	switch s.Result {
+	case ConvergeResultFailed:
+		return "ConvergeFailed", apiv1.EventTypeWarning
+	case ConvergeResultPending:
+		return "ConvergePending", apiv1.EventTypeWarning
+	default:
+		return "Converge" + s.Result, apiv1.EventTypeNormal
+	}
+}
+
+func (s *AutoConvergeStatus) message() string {
+	msg := fmt.Sprintf("Converge in %s mode finished with result %s in %s", s.Mode, s.Result, s.Duration.Round(time.Second))
+	if s.Plan != nil && s.Plan.HasDestructiveChanges {
+		destructive := append(append([]string{}, s.Plan.DestructiveLayers...), s.Plan.NodesToDelete...)
+		msg += fmt.Sprintf(". Destructive changes: %s", strings.Join(destructive, ", "))
+	}
+	if s.Error != "" {
+		msg += ": " + s.Error
+	}
+	return msg
+}
+
+// AutoConvergeStatusRecorder saves the result of the last run into the ConfigMap and creates an Event for every run.
+type AutoConvergeStatusRecorder struct {
+	kubeCl   *client.KubernetesClient
+	hostname string
+}
+
+func NewAutoConvergeStatusRecorder(kubeCl *client.KubernetesClient, hostname string) *AutoConvergeStatusRecorder {
+	return &AutoConvergeStatusRecorder{kubeCl: kubeCl, hostname: hostname}
+}
+
+func (r *AutoConvergeStatusRecorder) Record(status AutoConvergeStatus) error {
+	configMapErr := r.updateConfigMap(status)
+	eventErr := r.createEvent(status)
+
+	switch {
+	case configMapErr != nil:
+		return fmt.Errorf("can't update status ConfigMap: %v", configMapErr)
+	case eventErr != nil:
+		return fmt.Errorf("can't create Event: %v", eventErr)
+	}
+	return nil
+}
+
+func (r *AutoConvergeStatusRecorder) updateConfigMap(status AutoConvergeStatus) error {
+	data := map[string]string{
+		"identity":    status.Identity,
+		"mode":        status.Mode,
+		"result":      status.Result,
+		"lastRunTime": status.StartedAt.UTC().Format(time.RFC3339),
+		"duration":    status.Duration.Round(time.Second).String(),
+		"error":       status.Error,
+		"plan":        "",
+	}
+	if status.Plan != nil {
+		plan, err := json.Marshal(status.Plan)
+		if err != nil {
+			return err
+		}
+		data["plan"] = string(plan)
+	}
+
+	configMaps := r.kubeCl.CoreV1().ConfigMaps(autoConvergerNamespace)
+
+	cm, err := configMaps.Get(context.TODO(), autoConvergerStatusConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      autoConvergerStatusConfigMap,
+				Namespace: autoConvergerNamespace,
+				Labels: map[string]string{
+					"heritage": "deckhouse",
+					"app":      autoConvergerDeployment,
+				},
+			},
+			Data: data,
+		}
+		_, err = configMaps.Create(context.TODO(), cm, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cm.Data = data
+	_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
+
+func (r *AutoConvergeStatusRecorder) createEvent(status AutoConvergeStatus) error {
+	reason, eventType := status.eventReasonAndType()
+	now := metav1.NewTime(time.Now())
+
+	event := &apiv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", autoConvergerDeployment, now.UnixNano()),
+			Namespace: autoConvergerNamespace,
+		},
+		InvolvedObject: apiv1.ObjectReference{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       autoConvergerDeployment,
+			Namespace:  autoConvergerNamespace,
+		},
+		Reason:         reason,
+		Message:        status.message(),
+		Type:           eventType,
+		Count:          1,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Source: apiv1.EventSource{
+			Component: autoConvergerDeployment,
+			Host:      r.hostname,
+		},
+	}
+
+	_, err := r.kubeCl.CoreV1().Events(autoConvergerNamespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
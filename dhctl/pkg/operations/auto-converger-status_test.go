@@ -0,0 +1,75 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/actions/converge"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/client"
+)
+
+func TestAutoConvergeStatusRecorder(t *testing.T) {
+	fakeClient := client.NewFakeKubernetesClient()
+	recorder := NewAutoConvergeStatusRecorder(fakeClient, "master-0")
+
+	err := recorder.Record(AutoConvergeStatus{
+		Mode:      "dry-run",
+		Result:    ConvergeResultPlanned,
+		StartedAt: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+		Duration:  42 * time.Second,
+	})
+	require.NoError(t, err)
+
+	err = recorder.Record(AutoConvergeStatus{
+		Mode:      "non-destructive-only",
+		Result:    ConvergeResultPending,
+		StartedAt: time.Date(2021, 6, 1, 10, 30, 0, 0, time.UTC),
+		Duration:  time.Minute,
+		Plan: &converge.PlanSummary{
+			HasChanges:            true,
+			HasDestructiveChanges: true,
+			DestructiveLayers:     []string{"base-infrastructure"},
+		},
+	})
+	require.NoError(t, err)
+
+	cm, err := fakeClient.CoreV1().ConfigMaps("d8-system").Get(context.TODO(), "d8-terraform-auto-converger-status", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "Pending", cm.Data["result"])
+	require.Equal(t, "2021-06-01T10:30:00Z", cm.Data["lastRunTime"])
+	require.Equal(t, "1m0s", cm.Data["duration"])
+	require.Contains(t, cm.Data["plan"], `"hasDestructiveChanges":true`)
+
+	events, err := fakeClient.CoreV1().Events("d8-system").List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 2)
+
+	reasons := map[string]string{}
+	for _, e := range events.Items {
+		require.Equal(t, "terraform-auto-converger", e.InvolvedObject.Name)
+		reasons[e.Reason] = e.Type
+	}
+	require.Equal(t, map[string]string{
+		"ConvergePlanned": apiv1.EventTypeNormal,
+		"ConvergePending": apiv1.EventTypeWarning,
+	}, reasons)
+}
@@ -21,42 +21,78 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 
+	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/actions/converge"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/client"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/util/cache"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/util/tomb"
 )
 
+const autoConvergerLeaderLease = "terraform-auto-converger-leader"
+
 type AutoConverger struct {
+	kubeCl        *client.KubernetesClient
 	runner        *converge.Runner
 	checkInterval time.Duration
 	listenAddress string
+
+	mode           string
+	leaderElection bool
+	identity       string
+	statusRecorder *AutoConvergeStatusRecorder
 }
 
-func NewAutoConverger(runner *converge.Runner, listenAddress string, interval time.Duration) *AutoConverger {
+func NewAutoConverger(kubeCl *client.KubernetesClient, runner *converge.Runner, listenAddress string, interval time.Duration) *AutoConverger {
 	return &AutoConverger{
+		kubeCl:        kubeCl,
 		checkInterval: interval,
 		listenAddress: listenAddress,
 		runner:        runner,
+		mode:          app.AutoConvergeModeDismissDestructive,
 	}
 }
 
+func (c *AutoConverger) WithMode(mode string) *AutoConverger {
+	c.mode = mode
+	return c
+}
+
+// WithLeaderElection makes the converger run converge only while it holds the leader lease.
+func (c *AutoConverger) WithLeaderElection(identity string) *AutoConverger {
+	c.leaderElection = true
+	c.identity = identity
+	return c
+}
+
+func (c *AutoConverger) WithStatusRecorder(recorder *AutoConvergeStatusRecorder) *AutoConverger {
+	c.statusRecorder = recorder
+	return c
+}
+
 func (c *AutoConverger) Start() error {
 	defer log.InfoLn("Stop autoconverger fully")
 
 	log.InfoLn("Start exporter")
 	log.InfoLn("Address: ", c.listenAddress)
 	log.InfoLn("Checks interval: ", c.checkInterval)
+	log.InfoLn("Mode: ", c.mode)
+
+	if c.leaderElection && c.identity == "" {
+		return fmt.Errorf("leader election identity is required")
+	}
 
-	// channels to stop converge loop
-	shutdownAllCh := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
 	doneCh := make(chan struct{})
 
 	httpServer := c.getHTTPServer()
 
 	tomb.RegisterOnShutdown("Stop http server and auto-converger loop", func() {
-		close(shutdownAllCh)
+		cancel()
 		<-doneCh
 
 		err := httpServer.Shutdown(context.TODO())
@@ -65,7 +101,14 @@ func (c *AutoConverger) Start() error {
 		}
 	})
 
-	go c.convergerLoop(shutdownAllCh, doneCh)
+	go func() {
+		defer close(doneCh)
+		if c.leaderElection {
+			c.leaderElectionLoop(ctx)
+			return
+		}
+		c.convergerLoop(ctx)
+	}()
 
 	err := httpServer.ListenAndServe()
 	if err != http.ErrServerClosed {
@@ -75,7 +118,50 @@ func (c *AutoConverger) Start() error {
 	return nil
 }
 
-func (c *AutoConverger) convergerLoop(shutdownCh <-chan struct{}, doneCh chan<- struct{}) {
+// leaderElectionLoop campaigns for the lease until the context is canceled.
+// Losing the lease stops the converger loop, and the replica becomes a candidate again.
+func (c *AutoConverger) leaderElectionLoop(ctx context.Context) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      autoConvergerLeaderLease,
+			Namespace: autoConvergerNamespace,
+		},
+		Client:     c.kubeCl.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: c.identity},
+	}
+
+	for {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   60 * time.Second,
+			RenewDeadline:   40 * time.Second,
+			RetryPeriod:     10 * time.Second,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					log.InfoF("Replica %s became the leader\n", c.identity)
+					c.convergerLoop(leaderCtx)
+				},
+				OnStoppedLeading: func() {
+					log.InfoF("Replica %s is not the leader anymore\n", c.identity)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != c.identity {
+						log.InfoF("Current leader is %s\n", identity)
+					}
+				},
+			},
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+func (c *AutoConverger) convergerLoop(ctx context.Context) {
 	c.runConverge()
 
 	ticker := time.NewTicker(c.checkInterval)
@@ -86,8 +172,7 @@ func (c *AutoConverger) convergerLoop(shutdownCh <-chan struct{}, doneCh chan<-
 		case <-ticker.C:
 			cache.ClearTemporaryDirs()
 			c.runConverge()
-		case <-shutdownCh:
-			doneCh <- struct{}{}
+		case <-ctx.Done():
 			return
 		}
 	}
@@ -114,8 +199,77 @@ func (c *AutoConverger) getHTTPServer() *http.Server {
 func (c *AutoConverger) runConverge() {
 	log.InfoLn("Start next converge")
 
-	err := c.runner.RunConverge()
+	status := AutoConvergeStatus{
+		Identity:  c.identity,
+		Mode:      c.mode,
+		StartedAt: time.Now(),
+	}
+
+	result, summary, err := c.converge()
+
+	status.Result = result
+	status.Plan = summary
+	status.Duration = time.Since(status.StartedAt)
 	if err != nil {
+		status.Error = err.Error()
 		log.ErrorF("Converge error: %v\n", err)
+	} else {
+		log.InfoF("Converge finished with result %s\n", result)
+	}
+
+	if c.statusRecorder != nil {
+		if err := c.statusRecorder.Record(status); err != nil {
+			log.ErrorF("Cannot record converge status: %v\n", err)
+		}
+	}
+}
+
+func (c *AutoConverger) converge() (string, *converge.PlanSummary, error) {
+	summary, planErr := c.planSummary()
+
+	if c.mode == app.AutoConvergeModeDismissDestructive {
+		// the runner dismisses destructive changes itself, so the plan is only recorded into the status trail
+		if planErr != nil {
+			log.WarnF("Cannot check converge plan, the status will not contain the plan summary: %v\n", planErr)
+		}
+		if err := c.runner.RunConverge(); err != nil {
+			return ConvergeResultFailed, summary, err
+		}
+		return ConvergeResultSucceeded, summary, nil
+	}
+
+	if planErr != nil {
+		return ConvergeResultFailed, nil, planErr
 	}
+
+	switch {
+	case c.mode == app.AutoConvergeModeDryRun:
+		return ConvergeResultPlanned, summary, nil
+	case !summary.HasChanges:
+		return ConvergeResultNoChanges, summary, nil
+	case summary.HasDestructiveChanges:
+		log.WarnLn("Plan has destructive changes, they should be applied manually with dhctl converge")
+		return ConvergeResultPending, summary, nil
+	}
+
+	// the runner still dismisses destructive changes in case they appear between the check and the converge
+	if err := c.runner.RunConverge(); err != nil {
+		return ConvergeResultFailed, summary, err
+	}
+	return ConvergeResultSucceeded, summary, nil
+}
+
+func (c *AutoConverger) planSummary() (*converge.PlanSummary, error) {
+	metaConfig, err := converge.GetMetaConfig(c.kubeCl)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := converge.CheckPlan(c.kubeCl, metaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("converge plan is incomplete: %v", err)
+	}
+
+	summary := plan.Summary(!c.runner.SkipsPhase(converge.PhaseAllNodes))
+	return &summary, nil
 }
@@ -0,0 +1,288 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+)
+
+const PhaseJournalCacheKey = "bootstrap-phases"
+
+type Phase string
+
+const (
+	BaseInfraPhase         Phase = "base-infra"
+	ExecBashiblePhase      Phase = "exec-bashible"
+	InstallDeckhousePhase  Phase = "install-deckhouse"
+	CreateResourcesPhase   Phase = "create-resources"
+	ExecPostBootstrapPhase Phase = "exec-post-bootstrap"
+)
+
+// Phases are ordered as they are executed by the bootstrap command.
+var Phases = []Phase{
+	BaseInfraPhase,
+	ExecBashiblePhase,
+	InstallDeckhousePhase,
+	CreateResourcesPhase,
+	ExecPostBootstrapPhase,
+}
+
+const (
+	PhaseResultRunning   = "Running"
+	PhaseResultCompleted = "Completed"
+	PhaseResultFailed    = "Failed"
+)
+
+// PhaseInputs are values which affect the result of the phase. Every value is marshaled to JSON and hashed,
+// so the journal does not keep inputs as is.
+type PhaseInputs map[string]interface{}
+
+type PhaseRecord struct {
+	Phase Phase `json:"phase"`
+	// Inputs contains sha256 digests of every input
+	Inputs     map[string]string `json:"inputs"`
+	Checksum   string            `json:"checksum"`
+	Result     string            `json:"result"`
+	Error      string            `json:"error,omitempty"`
+	Outputs    json.RawMessage   `json:"outputs,omitempty"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+}
+
+// PhaseJournal keeps results of bootstrap phases in the state cache.
+// Completed phases with unchanged inputs are skipped. After the first executed phase all next phases are executed too,
+// because their inputs usually depend on the outputs of the previous ones.
+type PhaseJournal struct {
+	cache   state.Cache
+	records map[Phase]*PhaseRecord
+
+	resumeFrom Phase
+	executing  bool
+}
+
+func IsValidPhase(phase Phase) bool {
+	return phaseIndex(phase) >= 0
+}
+
+func phaseIndex(phase Phase) int {
+	for i, p := range Phases {
+		if p == phase {
+			return i
+		}
+	}
+	return -1
+}
+
+func PhasesNames() []string {
+	names := make([]string, 0, len(Phases))
+	for _, p := range Phases {
+		names = append(names, string(p))
+	}
+	return names
+}
+
+func NewPhaseJournal(stateCache state.Cache) (*PhaseJournal, error) {
+	j := &PhaseJournal{cache: stateCache, records: make(map[Phase]*PhaseRecord)}
+
+	inCache, err := stateCache.InCache(PhaseJournalCacheKey)
+	if err != nil {
+		return nil, err
+	}
+	if !inCache {
+		return j, nil
+	}
+
+	var records []*PhaseRecord
+	if err := stateCache.LoadStruct(PhaseJournalCacheKey, &records); err != nil {
+		return nil, fmt.Errorf("can't load bootstrap phases journal: %v", err)
+	}
+	for _, r := range records {
+		j.records[r.Phase] = r
+	}
+	return j, nil
+}
+
+// WithResumeFrom forces execution of the phase and all next phases.
+// Previous phases are skipped if they were completed, otherwise they are executed as usual.
+func (j *PhaseJournal) WithResumeFrom(phase Phase) (*PhaseJournal, error) {
+	if phase == "" {
+		return j, nil
+	}
+
+	if !IsValidPhase(phase) {
+		return nil, fmt.Errorf("unknown bootstrap phase '%s', use one of: %s", phase, strings.Join(PhasesNames(), ", "))
+	}
+
+	j.resumeFrom = phase
+	return j, nil
+}
+
+func (j *PhaseJournal) Record(phase Phase) *PhaseRecord {
+	return j.records[phase]
+}
+
+// Run executes the phase or skips it if it was completed. Outputs is a pointer to the struct which the action fills.
+// It is saved into the journal after the action succeeded and restored from the journal if the phase is skipped.
+// Outputs are saved as is, so they must not contain secrets (e.g. Terraform states), keep references to the state cache instead.
+func (j *PhaseJournal) Run(phase Phase, inputs PhaseInputs, outputs interface{}, action func() error) error {
+	digests, checksum, err := hashInputs(inputs)
+	if err != nil {
+		return fmt.Errorf("can't calculate inputs checksum for phase '%s': %v", phase, err)
+	}
+
+	if skip, reason := j.shouldSkip(phase, digests, checksum); skip {
+		log.InfoF("Phase '%s' is skipped: %s\n", phase, reason)
+		if outputs != nil && len(j.records[phase].Outputs) > 0 {
+			if err := json.Unmarshal(j.records[phase].Outputs, outputs); err != nil {
+				return fmt.Errorf("can't restore outputs of phase '%s': %v", phase, err)
+			}
+		}
+		return nil
+	}
+
+	j.executing = true
+
+	record := &PhaseRecord{
+		Phase:     phase,
+		Inputs:    digests,
+		Checksum:  checksum,
+		Result:    PhaseResultRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	j.records[phase] = record
+	if err := j.save(); err != nil {
+		return err
+	}
+
+	actionErr := action()
+
+	finishedAt := time.Now().UTC()
+	record.FinishedAt = &finishedAt
+	if actionErr != nil {
+		record.Result = PhaseResultFailed
+		record.Error = actionErr.Error()
+	} else {
+		record.Result = PhaseResultCompleted
+		if outputs != nil {
+			record.Outputs, err = json.Marshal(outputs)
+			if err != nil {
+				return fmt.Errorf("can't save outputs of phase '%s': %v", phase, err)
+			}
+		}
+	}
+
+	if err := j.save(); err != nil {
+		log.ErrorF("Can't save bootstrap phases journal: %v\n", err)
+	}
+	return actionErr
+}
+
+func (j *PhaseJournal) shouldSkip(phase Phase, digests map[string]string, checksum string) (bool, string) {
+	if j.executing {
+		return false, ""
+	}
+
+	record, ok := j.records[phase]
+	if !ok || record.Result != PhaseResultCompleted {
+		if j.resumeFrom != "" && phaseIndex(phase) < phaseIndex(j.resumeFrom) {
+			log.WarnF("Phase '%s' was not completed before, it will be executed despite --resume-from\n", phase)
+		}
+		return false, ""
+	}
+
+	if j.resumeFrom != "" {
+		if phaseIndex(phase) >= phaseIndex(j.resumeFrom) {
+			return false, ""
+		}
+		if record.Checksum != checksum {
+			log.WarnF("Inputs of phase '%s' were changed (%s), but it is skipped because of --resume-from\n",
+				phase, strings.Join(changedInputs(record.Inputs, digests), ", "))
+		}
+		return true, fmt.Sprintf("resume from '%s'", j.resumeFrom)
+	}
+
+	if record.Checksum != checksum {
+		log.InfoF("Inputs of phase '%s' were changed: %s\n", phase, strings.Join(changedInputs(record.Inputs, digests), ", "))
+		return false, ""
+	}
+
+	return true, fmt.Sprintf("completed at %s", record.FinishedAt.Format(time.RFC3339))
+}
+
+func (j *PhaseJournal) save() error {
+	records := make([]*PhaseRecord, 0, len(j.records))
+	for _, p := range Phases {
+		if r, ok := j.records[p]; ok {
+			records = append(records, r)
+		}
+	}
+	return j.cache.SaveStruct(PhaseJournalCacheKey, records)
+}
+
+func hashInputs(inputs PhaseInputs) (map[string]string, string, error) {
+	digests := make(map[string]string, len(inputs))
+	names := make([]string, 0, len(inputs))
+
+	for name, value := range inputs {
+		var data []byte
+		switch v := value.(type) {
+		case []byte:
+			data = v
+		default:
+			var err error
+			data, err = json.Marshal(v)
+			if err != nil {
+				return nil, "", fmt.Errorf("input %s: %v", name, err)
+			}
+		}
+
+		sum := sha256.Sum256(data)
+		digests[name] = hex.EncodeToString(sum[:])
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	checksum := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(checksum, "%s=%s\n", name, digests[name])
+	}
+
+	return digests, hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+func changedInputs(previous, current map[string]string) []string {
+	changed := make([]string, 0)
+	for name, digest := range current {
+		if previous[name] != digest {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/cache"
+)
+
+type testOutputs struct {
+	MasterIP string `json:"masterIP"`
+}
+
+// runAll runs all phases like the bootstrap command does and returns executed phases
+func runAll(t *testing.T, stateCache state.Cache, resumeFrom Phase, inputs map[Phase]string, failOn Phase) ([]Phase, testOutputs, error) {
+	journal, err := NewPhaseJournal(stateCache)
+	require.NoError(t, err)
+
+	journal, err = journal.WithResumeFrom(resumeFrom)
+	require.NoError(t, err)
+
+	var executed []Phase
+	var outputs testOutputs
+
+	for _, phase := range Phases {
+		phase := phase
+		err := journal.Run(phase, PhaseInputs{"input": inputs[phase]}, &outputs, func() error {
+			executed = append(executed, phase)
+			if phase == failOn {
+				return fmt.Errorf("phase %s failed", phase)
+			}
+			outputs.MasterIP = "10.0.0.1"
+			return nil
+		})
+		if err != nil {
+			return executed, outputs, err
+		}
+	}
+
+	return executed, outputs, nil
+}
+
+func TestPhaseJournal(t *testing.T) {
+	log.InitLogger("simple")
+
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-journal-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	newCache := func(name string) state.Cache {
+		stateCache, err := cache.NewStateCache(dir + "/" + name)
+		require.NoError(t, err)
+		return stateCache
+	}
+
+	inputs := map[Phase]string{
+		BaseInfraPhase:         "config",
+		ExecBashiblePhase:      "10.0.0.1",
+		InstallDeckhousePhase:  "deckhouse",
+		CreateResourcesPhase:   "resources",
+		ExecPostBootstrapPhase: "script",
+	}
+
+	t.Run("Resume from failed phase", func(t *testing.T) {
+		stateCache := newCache("failed")
+
+		executed, _, err := runAll(t, stateCache, "", inputs, InstallDeckhousePhase)
+		require.Error(t, err)
+		require.Equal(t, []Phase{BaseInfraPhase, ExecBashiblePhase, InstallDeckhousePhase}, executed)
+
+		journal, err := NewPhaseJournal(stateCache)
+		require.NoError(t, err)
+		require.Equal(t, PhaseResultCompleted, journal.Record(ExecBashiblePhase).Result)
+		require.Equal(t, PhaseResultFailed, journal.Record(InstallDeckhousePhase).Result)
+		require.Equal(t, "phase install-deckhouse failed", journal.Record(InstallDeckhousePhase).Error)
+
+		executed, outputs, err := runAll(t, stateCache, "", inputs, "")
+		require.NoError(t, err)
+		require.Equal(t, []Phase{InstallDeckhousePhase, CreateResourcesPhase, ExecPostBootstrapPhase}, executed)
+		require.Equal(t, "10.0.0.1", outputs.MasterIP, "outputs should be restored from skipped phases")
+	})
+
+	t.Run("Changed inputs", func(t *testing.T) {
+		stateCache := newCache("changed")
+
+		_, _, err := runAll(t, stateCache, "", inputs, "")
+		require.NoError(t, err)
+
+		executed, _, err := runAll(t, stateCache, "", inputs, "")
+		require.NoError(t, err)
+		require.Empty(t, executed)
+
+		changed := make(map[Phase]string)
+		for k, v := range inputs {
+			changed[k] = v
+		}
+		changed[CreateResourcesPhase] = "new resources"
+
+		executed, _, err = runAll(t, stateCache, "", changed, "")
+		require.NoError(t, err)
+		require.Equal(t, []Phase{CreateResourcesPhase, ExecPostBootstrapPhase}, executed)
+	})
+
+	t.Run("Resume from phase", func(t *testing.T) {
+		stateCache := newCache("resume")
+
+		_, _, err := runAll(t, stateCache, "", inputs, "")
+		require.NoError(t, err)
+
+		executed, _, err := runAll(t, stateCache, ExecBashiblePhase, inputs, "")
+		require.NoError(t, err)
+		require.Equal(t, []Phase{ExecBashiblePhase, InstallDeckhousePhase, CreateResourcesPhase, ExecPostBootstrapPhase}, executed)
+	})
+
+	t.Run("Resume from phase without previous results", func(t *testing.T) {
+		stateCache := newCache("empty")
+
+		executed, _, err := runAll(t, stateCache, CreateResourcesPhase, inputs, "")
+		require.NoError(t, err)
+		require.Equal(t, Phases, executed)
+	})
+
+	t.Run("Unknown phase", func(t *testing.T) {
+		journal, err := NewPhaseJournal(newCache("unknown"))
+		require.NoError(t, err)
+
+		_, err = journal.WithResumeFrom("deploy")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh"
+)
+
+const (
+	etcdRestoreScript  = "/deckhouse/candi/bashible/etcd_restore.sh"
+	etcdRestoreTimeout = 20 * time.Minute
+
+	remoteSnapshotPath = "/tmp/dhctl-etcd-restore.snapshot"
+)
+
+// Paths are passed to the restore script through the shell, so only safe characters are allowed.
+var safePathRegexp = regexp.MustCompile(`^/[A-Za-z0-9_./-]+$`)
+
+type EtcdParams struct {
+	SSHClient *ssh.Client
+
+	// LocalSnapshot is verified and uploaded to the control-plane node before the restore.
+	LocalSnapshot string
+	// SnapshotOnHost is the snapshot already stored on the control-plane node.
+	SnapshotOnHost string
+}
+
+// RestoreEtcd restores etcd on the control-plane node from the snapshot as a new single-member cluster.
+func RestoreEtcd(params *EtcdParams) error {
+	if (params.LocalSnapshot == "") == (params.SnapshotOnHost == "") {
+		return fmt.Errorf("exactly one of the local snapshot or the snapshot on host should be set")
+	}
+
+	envs := map[string]string{}
+
+	if params.LocalSnapshot != "" {
+		err := log.Process("restore", "Upload etcd snapshot", func() error {
+			sum, err := VerifyEtcdSnapshot(params.LocalSnapshot)
+			if err != nil {
+				return err
+			}
+			log.InfoF("Snapshot %s is verified, sha256 %s\n", params.LocalSnapshot, sum)
+
+			if err := params.SSHClient.File().Upload(params.LocalSnapshot, remoteSnapshotPath); err != nil {
+				return err
+			}
+
+			envs["SNAPSHOT"] = remoteSnapshotPath
+			// checked on the node to catch corruption during the upload
+			envs["SNAPSHOT_SHA256"] = sum
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			err := params.SSHClient.Command("rm", "-f", remoteSnapshotPath).Sudo().Run()
+			if err != nil {
+				log.WarnF("Snapshot %s was not removed from the node: %v\n", remoteSnapshotPath, err)
+			}
+		}()
+	} else {
+		if !safePathRegexp.MatchString(params.SnapshotOnHost) {
+			return fmt.Errorf("snapshot path on host %q should be absolute and contain only letters, digits and _./- characters", params.SnapshotOnHost)
+		}
+		envs["SNAPSHOT"] = params.SnapshotOnHost
+	}
+
+	return log.Process("restore", "Restore etcd from snapshot", func() error {
+		_, err := params.SSHClient.UploadScript(etcdRestoreScript).
+			Sudo().
+			WithEnvs(envs).
+			WithTimeout(etcdRestoreTimeout).
+			WithStdoutHandler(func(l string) { log.InfoLn(l) }).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(etcdRestoreScript), err)
+		}
+		return nil
+	})
+}
+
+// VerifyEtcdSnapshot checks the sha256 of the database appended by etcd to the snapshot and returns
+// the sha256 of the whole file. If the snapshot was taken by the EtcdBackup, the checksum is also
+// compared with the one from <name>.json next to the snapshot.
+func VerifyEtcdSnapshot(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := st.Size()
+
+	// the database consists of 512 bytes aligned pages, so the checksum is the remainder
+	if size < sha256.Size || size%512 != sha256.Size {
+		return "", fmt.Errorf("snapshot %s: the sha256 checksum is missing, size %d", path, size)
+	}
+
+	dbHash := sha256.New()
+	fileHash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(dbHash, fileHash), f, size-sha256.Size); err != nil {
+		return "", err
+	}
+
+	trailer := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(f, trailer); err != nil {
+		return "", err
+	}
+	fileHash.Write(trailer)
+
+	if !bytes.Equal(dbHash.Sum(nil), trailer) {
+		return "", fmt.Errorf("snapshot %s is corrupted: checksum mismatch", path)
+	}
+	sum := hex.EncodeToString(fileHash.Sum(nil))
+
+	infoPath := strings.TrimSuffix(path, ".snapshot") + ".json"
+	if infoPath == path {
+		return sum, nil
+	}
+
+	content, err := ioutil.ReadFile(infoPath)
+	if os.IsNotExist(err) {
+		return sum, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var info struct {
+		SHA256 string `json:"sha256"`
+	}
+	if err := json.Unmarshal(content, &info); err != nil {
+		return "", fmt.Errorf("parse %s: %v", infoPath, err)
+	}
+	if info.SHA256 != "" && info.SHA256 != sum {
+		return "", fmt.Errorf("snapshot %s checksum %s does not match %s from %s", path, sum, info.SHA256, infoPath)
+	}
+
+	return sum, nil
+}
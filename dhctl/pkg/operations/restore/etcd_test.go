@@ -0,0 +1,93 @@
+// Copyright 2022 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeSnapshot(t *testing.T, dir, name string, corrupt bool) (string, string) {
+	db := make([]byte, 4096)
+	for i := range db {
+		db[i] = byte(i)
+	}
+	dbSum := sha256.Sum256(db)
+	if corrupt {
+		db[100]++
+	}
+
+	content := append(db, dbSum[:]...)
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, content, 0600))
+
+	fileSum := sha256.Sum256(content)
+	return path, hex.EncodeToString(fileSum[:])
+}
+
+func TestVerifyEtcdSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dhctl-etcd-restore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Valid snapshot", func(t *testing.T) {
+		path, sum := writeSnapshot(t, dir, "valid.db", false)
+
+		got, err := VerifyEtcdSnapshot(path)
+		require.NoError(t, err)
+		require.Equal(t, sum, got)
+	})
+
+	t.Run("Corrupted snapshot", func(t *testing.T) {
+		path, _ := writeSnapshot(t, dir, "corrupted.db", true)
+
+		_, err := VerifyEtcdSnapshot(path)
+		require.Error(t, err)
+	})
+
+	t.Run("Snapshot without checksum", func(t *testing.T) {
+		path := filepath.Join(dir, "no-checksum.db")
+		require.NoError(t, ioutil.WriteFile(path, make([]byte, 4096), 0600))
+
+		_, err := VerifyEtcdSnapshot(path)
+		require.Error(t, err)
+	})
+
+	t.Run("EtcdBackup snapshot with matching info", func(t *testing.T) {
+		path, sum := writeSnapshot(t, dir, "main_20220801T000000Z.snapshot", false)
+		info := fmt.Sprintf(`{"revision":10,"sha256":%q}`, sum)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main_20220801T000000Z.json"), []byte(info), 0600))
+
+		got, err := VerifyEtcdSnapshot(path)
+		require.NoError(t, err)
+		require.Equal(t, sum, got)
+	})
+
+	t.Run("EtcdBackup snapshot with another checksum in info", func(t *testing.T) {
+		path, _ := writeSnapshot(t, dir, "main_20220802T000000Z.snapshot", false)
+		info := fmt.Sprintf(`{"revision":10,"sha256":%q}`, hex.EncodeToString(make([]byte, sha256.Size)))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main_20220802T000000Z.json"), []byte(info), 0600))
+
+		_, err := VerifyEtcdSnapshot(path)
+		require.Error(t, err)
+	})
+}
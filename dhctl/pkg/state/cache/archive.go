@@ -0,0 +1,256 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+)
+
+const (
+	ArchiveFormatTar  = "tar"
+	ArchiveFormatJSON = "json"
+
+	archiveVersion = 1
+	// archiveManifest is stored as the first file of tar archive
+	archiveManifest = "dhctl-cache-manifest.json"
+)
+
+type ArchiveEntry struct {
+	Key     string `json:"key"`
+	Content []byte `json:"content"`
+}
+
+// Archive contains every key of the cache including terraform states and tombstone.
+type Archive struct {
+	Version   int            `json:"version"`
+	Identity  string         `json:"identity"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Entries   []ArchiveEntry `json:"entries,omitempty"`
+}
+
+func NewArchive(identity string, stateCache state.Cache) (*Archive, error) {
+	archive := &Archive{
+		Version:   archiveVersion,
+		Identity:  identity,
+		CreatedAt: time.Now().UTC(),
+		Entries:   make([]ArchiveEntry, 0),
+	}
+
+	err := stateCache.Iterate(func(key string, content []byte) error {
+		archive.Entries = append(archive.Entries, ArchiveEntry{Key: key, Content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// Write serializes the archive as JSON document or as tar with the manifest and one file per key.
+func (a *Archive) Write(w io.Writer, format string) error {
+	switch format {
+	case ArchiveFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(a)
+	case ArchiveFormatTar:
+		return a.writeTar(w)
+	default:
+		return fmt.Errorf("unknown archive format '%s'", format)
+	}
+}
+
+func (a *Archive) writeTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	manifest, err := json.Marshal(Archive{Version: a.Version, Identity: a.Identity, CreatedAt: a.CreatedAt})
+	if err != nil {
+		return err
+	}
+
+	files := append([]ArchiveEntry{{Key: archiveManifest, Content: manifest}}, a.Entries...)
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    f.Key,
+			Mode:    0o600,
+			Size:    int64(len(f.Content)),
+			ModTime: a.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// ReadArchive detects the format of the archive and parses it.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("can't read archive: %v", err)
+	}
+
+	if first[0] == '{' {
+		var archive Archive
+		if err := json.NewDecoder(br).Decode(&archive); err != nil {
+			return nil, fmt.Errorf("can't parse archive: %v", err)
+		}
+		return &archive, archive.validate()
+	}
+
+	return readTar(br)
+}
+
+func readTar(r io.Reader) (*Archive, error) {
+	var archive *Archive
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't read archive: %v", err)
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("can't read %s from archive: %v", header.Name, err)
+		}
+
+		if archive == nil {
+			if header.Name != archiveManifest {
+				return nil, fmt.Errorf("archive should start with %s", archiveManifest)
+			}
+			archive = &Archive{}
+			if err := json.Unmarshal(content, archive); err != nil {
+				return nil, fmt.Errorf("can't parse archive manifest: %v", err)
+			}
+			archive.Entries = make([]ArchiveEntry, 0)
+			continue
+		}
+
+		archive.Entries = append(archive.Entries, ArchiveEntry{Key: header.Name, Content: content})
+	}
+
+	if archive == nil {
+		return nil, fmt.Errorf("archive is empty")
+	}
+	return archive, archive.validate()
+}
+
+func (a *Archive) validate() error {
+	if a.Version != archiveVersion {
+		return fmt.Errorf("unsupported archive version %d", a.Version)
+	}
+
+	for _, e := range a.Entries {
+		if e.Key == "" || strings.ContainsAny(e.Key, `/\`) || e.Key == "." || e.Key == ".." {
+			return fmt.Errorf("invalid key '%s' in archive", e.Key)
+		}
+	}
+	return nil
+}
+
+func (a *Archive) HasTombstone() bool {
+	for _, e := range a.Entries {
+		if e.Key == state.TombstoneKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore saves all keys of the archive into the cache. It is the same as Migrate from the archive.
+func (a *Archive) Restore(stateCache state.Cache, force bool) ([]string, error) {
+	return Migrate(&archiveCache{archive: a}, stateCache, force)
+}
+
+// archiveCache is a read-only view to the archive that is enough to migrate keys.
+type archiveCache struct {
+	state.Cache
+	archive *Archive
+}
+
+func (c *archiveCache) Iterate(iterFunc func(string, []byte) error) error {
+	for _, e := range c.archive.Entries {
+		if err := iterFunc(e.Key, e.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KeyInfo describes the key of the cache for listing.
+type KeyInfo struct {
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	Size int    `json:"size"`
+	// Serial is a serial of terraform state, it is set for tfstate keys only.
+	Serial *int64 `json:"serial,omitempty"`
+}
+
+// DescribeKey detects the kind of the key by its name.
+func DescribeKey(key string, content []byte) KeyInfo {
+	info := KeyInfo{Key: key, Size: len(content), Kind: "data"}
+
+	switch {
+	case key == state.TombstoneKey:
+		info.Kind = "tombstone"
+	case strings.HasPrefix(key, "base-infrastructure") && strings.HasSuffix(key, ".tfstate"):
+		info.Kind = "base-infrastructure-state"
+	case strings.HasSuffix(key, ".tfstate"):
+		info.Kind = "node-state"
+	case strings.HasSuffix(key, ".backup"):
+		info.Kind = "state-backup"
+	}
+
+	if strings.HasSuffix(key, ".tfstate") {
+		var tfState struct {
+			Serial int64 `json:"serial"`
+		}
+		if err := json.Unmarshal(content, &tfState); err == nil {
+			info.Serial = &tfState.Serial
+		}
+	}
+
+	return info
+}
+
+// ListKeys returns description of all keys of the cache.
+func ListKeys(stateCache state.Cache) ([]KeyInfo, error) {
+	keys := make([]KeyInfo, 0)
+	err := stateCache.Iterate(func(key string, content []byte) error {
+		keys = append(keys, DescribeKey(key, content))
+		return nil
+	})
+	return keys, err
+}
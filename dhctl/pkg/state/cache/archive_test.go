@@ -0,0 +1,84 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/cache"
+)
+
+func TestArchive(t *testing.T) {
+	log.InitLogger("simple")
+
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-archive-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source, err := cache.NewStateCache(dir + "/source")
+	require.NoError(t, err)
+	require.NoError(t, source.Save("base-infrastructure.tfstate", []byte(`{"serial": 5}`)))
+	require.NoError(t, source.Save("test-master-0.tfstate", []byte(`{"serial": 2}`)))
+	require.NoError(t, source.Save(state.TombstoneKey, []byte{}))
+
+	for _, format := range []string{ArchiveFormatTar, ArchiveFormatJSON} {
+		t.Run("Export and import "+format, func(t *testing.T) {
+			archive, err := NewArchive("test", source)
+			require.NoError(t, err)
+			require.True(t, archive.HasTombstone())
+
+			buf := new(bytes.Buffer)
+			require.NoError(t, archive.Write(buf, format))
+
+			restored, err := ReadArchive(buf)
+			require.NoError(t, err)
+			require.Equal(t, "test", restored.Identity)
+
+			destination, err := cache.OpenStateCache(dir + "/" + format)
+			require.NoError(t, err)
+
+			keys, err := restored.Restore(destination, false)
+			require.NoError(t, err)
+			require.Equal(t, []string{state.TombstoneKey, "base-infrastructure.tfstate", "test-master-0.tfstate"}, keys)
+
+			content, err := destination.Load("test-master-0.tfstate")
+			require.NoError(t, err)
+			require.Equal(t, `{"serial": 2}`, string(content))
+		})
+	}
+
+	t.Run("Keys with path are rejected", func(t *testing.T) {
+		_, err := ReadArchive(bytes.NewBufferString(`{"version": 1, "entries": [{"key": "../passwd", "content": ""}]}`))
+		require.Error(t, err)
+	})
+
+	t.Run("List keys", func(t *testing.T) {
+		keys, err := ListKeys(source)
+		require.NoError(t, err)
+		require.Len(t, keys, 3)
+
+		require.Equal(t, "tombstone", keys[0].Kind)
+		require.Equal(t, "base-infrastructure-state", keys[1].Kind)
+		require.Equal(t, int64(5), *keys[1].Serial)
+		require.Equal(t, "node-state", keys[2].Kind)
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/client"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/cache"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/etcd"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/s3"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/stringsutil"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/tomb"
+)
+
+// Locker is implemented by the shared backends to prevent simultaneous usage of the cache.
+type Locker interface {
+	Lock(owner string) error
+	Unlock()
+}
+
+type BackendParams struct {
+	// Identity is a unique name of the cache, e.g. cluster prefix or ssh host.
+	Identity string
+	// URL is a backend specific location of the cache.
+	URL string
+	// ReadOnly allows to open exhausted cache and does not lock it. Use it to inspect the cache only.
+	ReadOnly bool
+}
+
+func (p BackendParams) hash() string {
+	return stringsutil.Sha256Encode(p.Identity)
+}
+
+// workDir is a local directory for files that terraform reads and writes.
+func (p BackendParams) workDir() string {
+	return filepath.Join(app.CacheDir, p.hash())
+}
+
+type BackendFactory func(params BackendParams) (state.Cache, error)
+
+var backends = map[string]BackendFactory{
+	app.CacheBackendLocal:          newLocalCache,
+	app.CacheBackendLocalEncrypted: newLocalEncryptedCache,
+	app.CacheBackendKubernetes:     newKubernetesCache,
+	app.CacheBackendS3:             newS3Cache,
+	app.CacheBackendEtcd:           newEtcdCache,
+}
+
+// RegisterBackend adds or replaces the cache backend.
+func RegisterBackend(name string, factory BackendFactory) {
+	backends[name] = factory
+}
+
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultBackend returns backend from flags. Kubernetes backend is used if only --kube-cachestore-namespace is set.
+func DefaultBackend() string {
+	switch {
+	case app.CacheBackend != "":
+		return app.CacheBackend
+	case app.CacheKubeNamespace != "":
+		return app.CacheBackendKubernetes
+	default:
+		return app.CacheBackendLocal
+	}
+}
+
+// NewCache creates the cache and locks it if backend supports locking. Lock is released on shutdown.
+func NewCache(backend string, params BackendParams) (state.Cache, error) {
+	factory, ok := backends[backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache backend '%s', available backends: %s", backend, strings.Join(Backends(), ", "))
+	}
+
+	stateCache, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("%s cache backend: %v", backend, err)
+	}
+
+	if locker, ok := stateCache.(Locker); ok && !params.ReadOnly {
+		if err := locker.Lock(lockOwner()); err != nil {
+			return nil, err
+		}
+		tomb.RegisterOnShutdown("Unlock state cache", locker.Unlock)
+	}
+
+	return stateCache, nil
+}
+
+func lockOwner() string {
+	hostname, _ := os.Hostname()
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	return fmt.Sprintf("%s@%s (pid %d)", username, hostname, os.Getpid())
+}
+
+func newLocalCache(params BackendParams) (state.Cache, error) {
+	dir := params.URL
+	if dir == "" {
+		dir = params.workDir()
+	}
+	if params.ReadOnly {
+		return cache.OpenStateCache(dir)
+	}
+	return cache.NewStateCache(dir)
+}
+
+func newLocalEncryptedCache(params BackendParams) (state.Cache, error) {
+	dir := params.URL
+	if dir == "" {
+		dir = params.workDir()
+	}
+
+	// decrypted states should not live next to the encrypted ones
+	tmpDir := filepath.Join(app.TmpDirName, "decrypted-"+params.hash())
+	tomb.RegisterOnShutdown("Remove decrypted state cache", func() {
+		if !app.IsDebug {
+			_ = os.RemoveAll(tmpDir)
+		}
+	})
+
+	return cache.NewEncryptedStateCache(dir, tmpDir, app.CacheEncryptionKey)
+}
+
+func newKubernetesCache(params BackendParams) (state.Cache, error) {
+	namespace := app.CacheKubeNamespace
+	secretName := params.Identity
+	if app.CacheKubeName != "" {
+		secretName = app.CacheKubeName
+	}
+
+	if params.URL != "" {
+		parts := strings.SplitN(params.URL, "/", 2)
+		namespace = parts[0]
+		if len(parts) == 2 && parts[1] != "" {
+			secretName = parts[1]
+		}
+	}
+
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace is required, use --cache-url=namespace/name or --kube-cachestore-namespace")
+	}
+
+	if err := os.MkdirAll(params.workDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("can't create cache directory: %w", err)
+	}
+
+	kubeCl := client.NewKubernetesClient()
+	err := kubeCl.Init(&client.KubernetesInitParams{
+		KubeConfig:          app.CacheKubeConfig,
+		KubeConfigContext:   app.CacheKubeConfigContext,
+		KubeConfigInCluster: app.CacheKubeConfigInCluster,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	k8sCache := client.NewK8sStateCache(kubeCl, namespace, secretName, params.workDir()).
+		WithLabels(app.CacheKubeLabels)
+
+	if err := k8sCache.Init(); err != nil {
+		return nil, err
+	}
+
+	return k8sCache, nil
+}
+
+func newS3Cache(params BackendParams) (state.Cache, error) {
+	u, err := url.Parse(params.URL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("url should be s3://bucket/prefix, got '%s'", params.URL)
+	}
+
+	s3Client, err := s3.NewClient(s3.Config{
+		Endpoint:    u.Query().Get("endpoint"),
+		Region:      u.Query().Get("region"),
+		Bucket:      u.Host,
+		Credentials: s3.CredentialsFromEnv(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(path.Join(u.Path, params.hash()), "/")
+	return cache.NewS3StateCache(s3Client, prefix, params.workDir())
+}
+
+func newEtcdCache(params BackendParams) (state.Cache, error) {
+	u, err := url.Parse(params.URL)
+	if err != nil || u.Scheme != "etcd" || u.Host == "" {
+		return nil, fmt.Errorf("url should be etcd://host:port[,host:port]/prefix, got '%s'", params.URL)
+	}
+
+	scheme := u.Query().Get("scheme")
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	config := etcd.Config{CAFile: u.Query().Get("ca")}
+	for _, host := range strings.Split(u.Host, ",") {
+		config.Endpoints = append(config.Endpoints, fmt.Sprintf("%s://%s", scheme, host))
+	}
+	if u.User != nil {
+		config.Username = u.User.Username()
+		config.Password, _ = u.User.Password()
+	}
+
+	etcdClient, err := etcd.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := path.Join("/", u.Path, params.hash())
+	return cache.NewEtcdStateCache(etcdClient, prefix, params.workDir())
+}
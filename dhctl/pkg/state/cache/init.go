@@ -16,8 +16,6 @@ package cache
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"sync"
 
 	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
@@ -25,7 +23,6 @@ import (
 	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/util/cache"
-	"github.com/deckhouse/deckhouse/dhctl/pkg/util/stringsutil"
 )
 
 var once sync.Once
@@ -34,45 +31,26 @@ var (
 	_ state.Cache = &cache.StateCache{}
 	_ state.Cache = &cache.DummyCache{}
 	_ state.Cache = &client.StateCache{}
+	_ state.Cache = &cache.EncryptedStateCache{}
+	_ state.Cache = &cache.S3StateCache{}
+	_ state.Cache = &cache.EtcdStateCache{}
+
+	_ Locker = &cache.S3StateCache{}
+	_ Locker = &cache.EtcdStateCache{}
 )
 
 var globalCache state.Cache = &cache.DummyCache{}
 
 func choiceCache(identity string) (state.Cache, error) {
-	tmpDir := filepath.Join(app.CacheDir, stringsutil.Sha256Encode(identity))
-	log.DebugF("Cache dir %s\n", tmpDir)
-	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
-		return nil, fmt.Errorf("can't create cache directory: %w", err)
-	}
-
-	if app.CacheKubeNamespace == "" {
-		return cache.NewStateCache(tmpDir)
-	}
-
-	kubeCl := client.NewKubernetesClient()
-	err := kubeCl.Init(&client.KubernetesInitParams{
-		KubeConfig:          app.CacheKubeConfig,
-		KubeConfigContext:   app.CacheKubeConfigContext,
-		KubeConfigInCluster: app.CacheKubeConfigInCluster,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	secretName := identity
-	if app.CacheKubeName != "" {
-		secretName = app.CacheKubeName
-	}
-
-	k8sCache := client.NewK8sStateCache(kubeCl, app.CacheKubeNamespace, secretName, tmpDir).
-		WithLabels(app.CacheKubeLabels)
+	backend := DefaultBackend()
+	log.DebugF("Cache backend %s, identity %s\n", backend, identity)
 
-	err = k8sCache.Init()
+	stateCache, err := NewCache(backend, BackendParams{Identity: identity, URL: app.CacheURL})
 	if err != nil {
 		return nil, err
 	}
 
-	hasTombstone, err := k8sCache.InCache(state.TombstoneKey)
+	hasTombstone, err := stateCache.InCache(state.TombstoneKey)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +59,7 @@ func choiceCache(identity string) (state.Cache, error) {
 		return nil, fmt.Errorf("Cache exchaused")
 	}
 
-	return k8sCache, nil
+	return stateCache, nil
 }
 
 func initCache(identity string) error {
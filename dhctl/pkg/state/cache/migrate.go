@@ -0,0 +1,64 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+)
+
+// Migrate copies all keys from one cache to another and checks that they were saved.
+// Destination cache should be empty unless force is set. Returns copied keys.
+func Migrate(from, to state.Cache, force bool) ([]string, error) {
+	existingKeys := make([]string, 0)
+	err := to.Iterate(func(key string, _ []byte) error {
+		existingKeys = append(existingKeys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't read destination cache: %v", err)
+	}
+
+	if len(existingKeys) > 0 && !force {
+		return nil, fmt.Errorf("destination cache is not empty, it contains keys: %v", existingKeys)
+	}
+
+	copied := make([]string, 0)
+	err = from.Iterate(func(key string, content []byte) error {
+		log.DebugF("Migrate key %s\n", key)
+		if err := to.Save(key, content); err != nil {
+			return fmt.Errorf("can't save %s: %v", key, err)
+		}
+
+		saved, err := to.Load(key)
+		if err != nil {
+			return fmt.Errorf("can't load saved %s: %v", key, err)
+		}
+		if !bytes.Equal(saved, content) {
+			return fmt.Errorf("key %s was saved with different content", key)
+		}
+
+		copied = append(copied, key)
+		return nil
+	})
+	if err != nil {
+		return copied, fmt.Errorf("migration failed: %v", err)
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+)
+
+func TestMigrate(t *testing.T) {
+	log.InitLogger("simple")
+
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-migrate-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	app.CacheDir = dir
+	app.TmpDirName = dir
+	app.CacheEncryptionKey = "secret"
+
+	from, err := NewCache(app.CacheBackendLocal, BackendParams{Identity: "test-identity"})
+	require.NoError(t, err)
+	require.NoError(t, from.Save("cluster-state", []byte("cluster")))
+	require.NoError(t, from.Save("node-master-0.tfstate", []byte("node")))
+
+	to, err := NewCache(app.CacheBackendLocalEncrypted, BackendParams{Identity: "test-identity", URL: dir + "/encrypted"})
+	require.NoError(t, err)
+
+	keys, err := Migrate(from, to, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cluster-state", "node-master-0.tfstate"}, keys)
+
+	content, err := to.Load("node-master-0.tfstate")
+	require.NoError(t, err)
+	require.Equal(t, "node", string(content))
+
+	t.Run("Not empty destination is not overwritten without force", func(t *testing.T) {
+		_, err := Migrate(from, to, false)
+		require.Error(t, err)
+
+		_, err = Migrate(from, to, true)
+		require.NoError(t, err)
+	})
+
+	t.Run("Unknown backend", func(t *testing.T) {
+		_, err := NewCache("unknown", BackendParams{Identity: "test-identity"})
+		require.Error(t, err)
+	})
+}
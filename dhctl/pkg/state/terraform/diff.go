@@ -0,0 +1,141 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+)
+
+const baseInfrastructureStateKey = "base-infrastructure.tfstate"
+
+const (
+	StateDiffEqual         = "Equal"
+	StateDiffChanged       = "Changed"
+	StateDiffOnlyInCache   = "OnlyInCache"
+	StateDiffOnlyInCluster = "OnlyInCluster"
+)
+
+type TerraformStateSummary struct {
+	Serial    int64  `json:"serial"`
+	Lineage   string `json:"lineage,omitempty"`
+	Resources int    `json:"resources"`
+}
+
+type StateDiff struct {
+	// Name is a node name or "base-infrastructure"
+	Name      string                 `json:"name"`
+	NodeGroup string                 `json:"nodeGroup,omitempty"`
+	Status    string                 `json:"status"`
+	Cache     *TerraformStateSummary `json:"cache,omitempty"`
+	Cluster   *TerraformStateSummary `json:"cluster,omitempty"`
+}
+
+func summarizeState(content []byte) *TerraformStateSummary {
+	if len(content) == 0 {
+		return nil
+	}
+
+	var tfState struct {
+		Serial    int64         `json:"serial"`
+		Lineage   string        `json:"lineage"`
+		Resources []interface{} `json:"resources"`
+	}
+	// not parsable state is still shown as existing
+	_ = json.Unmarshal(content, &tfState)
+
+	return &TerraformStateSummary{Serial: tfState.Serial, Lineage: tfState.Lineage, Resources: len(tfState.Resources)}
+}
+
+func compareStates(name, nodeGroup string, inCache, inCluster []byte) StateDiff {
+	diff := StateDiff{
+		Name:      name,
+		NodeGroup: nodeGroup,
+		Cache:     summarizeState(inCache),
+		Cluster:   summarizeState(inCluster),
+	}
+
+	switch {
+	case diff.Cluster == nil:
+		diff.Status = StateDiffOnlyInCache
+	case diff.Cache == nil:
+		diff.Status = StateDiffOnlyInCluster
+	case bytes.Equal(bytes.TrimSpace(inCache), bytes.TrimSpace(inCluster)):
+		diff.Status = StateDiffEqual
+	default:
+		diff.Status = StateDiffChanged
+	}
+
+	return diff
+}
+
+// DiffCacheWithCluster compares terraform states from the cache with the states from the loader.
+// Use KubeTerraStateLoader with the dummy cache to get states from d8-cluster-terraform-state and nodes Secrets.
+func DiffCacheWithCluster(stateCache state.Cache, clusterLoader StateLoader) ([]StateDiff, error) {
+	clusterState, nodesState, err := clusterLoader.PopulateClusterState()
+	if err != nil {
+		return nil, err
+	}
+
+	cachedStates := make(map[string][]byte)
+	err = stateCache.Iterate(func(name string, content []byte) error {
+		if strings.HasSuffix(name, ".tfstate") {
+			cachedStates[strings.TrimSuffix(name, ".tfstate")] = content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	baseInfraName := strings.TrimSuffix(baseInfrastructureStateKey, ".tfstate")
+	result := []StateDiff{compareStates(baseInfraName, "", cachedStates[baseInfraName], clusterState)}
+	delete(cachedStates, baseInfraName)
+
+	nodeGroups := make([]string, 0, len(nodesState))
+	for nodeGroup := range nodesState {
+		nodeGroups = append(nodeGroups, nodeGroup)
+	}
+	sort.Strings(nodeGroups)
+
+	for _, nodeGroup := range nodeGroups {
+		nodeNames := make([]string, 0, len(nodesState[nodeGroup].State))
+		for nodeName := range nodesState[nodeGroup].State {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		sort.Strings(nodeNames)
+
+		for _, nodeName := range nodeNames {
+			result = append(result, compareStates(nodeName, nodeGroup, cachedStates[nodeName], nodesState[nodeGroup].State[nodeName]))
+			delete(cachedStates, nodeName)
+		}
+	}
+
+	onlyInCache := make([]string, 0, len(cachedStates))
+	for name := range cachedStates {
+		onlyInCache = append(onlyInCache, name)
+	}
+	sort.Strings(onlyInCache)
+
+	for _, name := range onlyInCache {
+		result = append(result, compareStates(name, "", cachedStates[name], nil))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terraform
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/config"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/kubernetes/actions/converge"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/cache"
+)
+
+type fakeStateLoader struct {
+	clusterState []byte
+	nodesState   map[string]converge.NodeGroupTerraformState
+}
+
+func (f *fakeStateLoader) PopulateMetaConfig() (*config.MetaConfig, error) {
+	return nil, nil
+}
+
+func (f *fakeStateLoader) PopulateClusterState() ([]byte, map[string]converge.NodeGroupTerraformState, error) {
+	return f.clusterState, f.nodesState, nil
+}
+
+func TestDiffCacheWithCluster(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-diff-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stateCache, err := cache.NewStateCache(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, stateCache.Save("base-infrastructure.tfstate", []byte(`{"serial": 3, "lineage": "a", "resources": [{}, {}]}`)))
+	require.NoError(t, stateCache.Save("test-master-0.tfstate", []byte(`{"serial": 1}`)))
+	require.NoError(t, stateCache.Save("test-master-1.tfstate", []byte(`{"serial": 1}`)))
+	require.NoError(t, stateCache.Save("cluster-config", []byte(`not a state`)))
+
+	loader := &fakeStateLoader{
+		clusterState: []byte(`{"serial": 4, "lineage": "a", "resources": [{}, {}, {}]}`),
+		nodesState: map[string]converge.NodeGroupTerraformState{
+			"master": {State: map[string][]byte{
+				"test-master-0": []byte(`{"serial": 1}`),
+			}},
+			"worker": {State: map[string][]byte{
+				"test-worker-0": []byte(`{"serial": 7}`),
+			}},
+		},
+	}
+
+	diff, err := DiffCacheWithCluster(stateCache, loader)
+	require.NoError(t, err)
+	require.Len(t, diff, 4)
+
+	require.Equal(t, "base-infrastructure", diff[0].Name)
+	require.Equal(t, StateDiffChanged, diff[0].Status)
+	require.Equal(t, int64(3), diff[0].Cache.Serial)
+	require.Equal(t, 3, diff[0].Cluster.Resources)
+
+	require.Equal(t, "test-master-0", diff[1].Name)
+	require.Equal(t, "master", diff[1].NodeGroup)
+	require.Equal(t, StateDiffEqual, diff[1].Status)
+
+	require.Equal(t, "test-worker-0", diff[2].Name)
+	require.Equal(t, StateDiffOnlyInCluster, diff[2].Status)
+
+	require.Equal(t, "test-master-1", diff[3].Name)
+	require.Equal(t, StateDiffOnlyInCache, diff[3].Status)
+}
@@ -22,7 +22,6 @@ import (
 	"os"
 	"os/exec"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
@@ -94,7 +93,7 @@ err := proxyCmd.Start()
 */
 
 type Executor struct {
-	cmd *exec.Cmd
+	cmd Process
 
 	Session *Session
 
@@ -134,9 +133,17 @@ func NewDefaultExecutor(cmd *exec.Cmd) *Executor {
 }
 
 func NewExecutor(sess *Session, cmd *exec.Cmd) *Executor {
+	return NewProcessExecutor(sess, NewLocalProcess(cmd))
+}
+
+func NewDefaultProcessExecutor(p Process) *Executor {
+	return NewProcessExecutor(DefaultSession, p)
+}
+
+func NewProcessExecutor(sess *Session, p Process) *Executor {
 	return &Executor{
 		Session: sess,
-		cmd:     cmd,
+		cmd:     p,
 	}
 }
 
@@ -231,7 +238,7 @@ func (e *Executor) SetupStreamHandlers() (err error) {
 
 	// setup stdout stream handlers
 	if e.Live && e.StdoutBuffer == nil && e.StdoutHandler == nil && len(e.Matchers) == 0 {
-		e.cmd.Stdout = os.Stdout
+		e.cmd.SetStdout(os.Stdout)
 		return
 	}
 
@@ -245,7 +252,7 @@ func (e *Executor) SetupStreamHandlers() (err error) {
 		if err != nil {
 			return fmt.Errorf("unable to create os pipe for stdout: %s", err)
 		}
-		e.cmd.Stdout = stdoutWritePipe
+		e.cmd.SetStdout(stdoutWritePipe)
 
 		// create pipe for StdoutHandler
 		if e.StdoutHandler != nil {
@@ -266,7 +273,7 @@ func (e *Executor) SetupStreamHandlers() (err error) {
 		if err != nil {
 			return fmt.Errorf("unable to create os pipe for stderr: %s", err)
 		}
-		e.cmd.Stderr = stderrWritePipe
+		e.cmd.SetStderr(stderrWritePipe)
 
 		// create pipe for StderrHandler
 		if e.StderrHandler != nil {
@@ -298,7 +305,7 @@ func (e *Executor) SetupStreamHandlers() (err error) {
 			return
 		}
 		e.ConsumeLines(stdoutHandlerReadPipe, e.StdoutHandler)
-		log.DebugF("stop line consumer for '%s'\n", e.cmd.Args[0])
+		log.DebugF("stop line consumer for '%s'\n", e.cmd.Name())
 	}()
 
 	// Start reading from stderr of a command.
@@ -336,7 +343,7 @@ func (e *Executor) SetupStreamHandlers() (err error) {
 			return
 		}
 		e.ConsumeLines(stderrHandlerReadPipe, e.StderrHandler)
-		log.DebugF("stop sdterr line consumer for '%s'\n", e.cmd.Args[0])
+		log.DebugF("stop sdterr line consumer for '%s'\n", e.cmd.Name())
 	}()
 
 	return nil
@@ -413,7 +420,7 @@ func (e *Executor) ConsumeLines(r io.Reader, fn func(l string)) {
 		}
 
 		if text != "" {
-			log.DebugF("%s: %s\n", e.cmd.Args[0], text)
+			log.DebugF("%s: %s\n", e.cmd.Name(), text)
 		}
 	}
 }
@@ -484,10 +491,7 @@ func (e *Executor) ProcessWait() {
 				e.stop = true
 				// Prevent next readings from the closed channel.
 				e.stopCh = nil
-				// The usual e.cmd.Process.Kill() is not working for the process
-				// started with the new process group (Setpgid: true).
-				// Negative pid number is used to send a signal to all processes in the group.
-				err := syscall.Kill(-e.cmd.Process.Pid, syscall.SIGKILL)
+				err := e.cmd.Kill()
 				if err != nil {
 					e.killError = err
 				}
@@ -517,7 +521,7 @@ func (e *Executor) Stop() {
 	}
 	<-e.waitCh
 
-	log.DebugF("Stopped '%s': %d\n", e.cmd.String(), e.cmd.ProcessState.ExitCode())
+	log.DebugF("Stopped '%s': %d\n", e.cmd.String(), e.cmd.ExitCode())
 }
 
 // Run executes a command and blocks until it is finished or stopped.
@@ -533,7 +537,15 @@ func (e *Executor) Run() error {
 	return e.WaitError()
 }
 
+// Cmd returns underlying exec.Cmd or nil if the executor runs a remote process.
 func (e *Executor) Cmd() *exec.Cmd {
+	if p, ok := e.cmd.(*LocalProcess); ok {
+		return p.Cmd
+	}
+	return nil
+}
+
+func (e *Executor) Process() Process {
 	return e.cmd
 }
 
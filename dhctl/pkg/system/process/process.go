@@ -0,0 +1,87 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// Process is something that Executor can start, wait for and kill.
+// It is a local process (exec.Cmd) or a command running on a remote host.
+type Process interface {
+	SetStdout(w io.Writer)
+	SetStderr(w io.Writer)
+	StdinPipe() (io.WriteCloser, error)
+
+	Start() error
+	Wait() error
+	Kill() error
+	ExitCode() int
+
+	// Name is a short name of the process for log messages.
+	Name() string
+	String() string
+}
+
+// LocalProcess adapts exec.Cmd to the Process interface.
+type LocalProcess struct {
+	Cmd *exec.Cmd
+}
+
+func NewLocalProcess(cmd *exec.Cmd) *LocalProcess {
+	return &LocalProcess{Cmd: cmd}
+}
+
+func (p *LocalProcess) SetStdout(w io.Writer) {
+	p.Cmd.Stdout = w
+}
+
+func (p *LocalProcess) SetStderr(w io.Writer) {
+	p.Cmd.Stderr = w
+}
+
+func (p *LocalProcess) StdinPipe() (io.WriteCloser, error) {
+	return p.Cmd.StdinPipe()
+}
+
+func (p *LocalProcess) Start() error {
+	return p.Cmd.Start()
+}
+
+func (p *LocalProcess) Wait() error {
+	return p.Cmd.Wait()
+}
+
+// Kill sends SIGKILL to the process group.
+// The usual Cmd.Process.Kill() is not working for the process
+// started with the new process group (Setpgid: true).
+// Negative pid number is used to send a signal to all processes in the group.
+func (p *LocalProcess) Kill() error {
+	return syscall.Kill(-p.Cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func (p *LocalProcess) ExitCode() int {
+	return p.Cmd.ProcessState.ExitCode()
+}
+
+func (p *LocalProcess) Name() string {
+	return p.Cmd.Args[0]
+}
+
+func (p *LocalProcess) String() string {
+	return p.Cmd.String()
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/cmd"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/gossh"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
 )
 
@@ -35,6 +36,19 @@ func NewAgent(sess *session.AgentSettings) *Agent {
 }
 
 func (a *Agent) Start() error {
+	if app.IsNativeSSHTransport() {
+		// There is no ssh-agent process for native transport: keys are kept in memory
+		// and keys from the user's ssh-agent are used if it is available.
+		a.AgentSettings.AuthSock = os.Getenv("SSH_AUTH_SOCK")
+
+		log.DebugLn("agent: add keys to built-in keyring")
+		err := gossh.AddKeys(a.AgentSettings.PrivateKeys)
+		if err != nil {
+			return fmt.Errorf("add keys: %v", err)
+		}
+		return nil
+	}
+
 	if len(a.AgentSettings.PrivateKeys) == 0 {
 		a.Agent = &cmd.SSHAgent{
 			AgentSettings: a.AgentSettings,
@@ -101,5 +115,8 @@ func (a *Agent) AddKeys() error {
 }
 
 func (a *Agent) Stop() {
+	if a.Agent == nil {
+		return
+	}
 	a.Agent.Stop()
 }
@@ -17,7 +17,6 @@ package frontend
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -25,6 +24,7 @@ import (
 	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/process"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/cmd"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/gossh"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
 )
 
@@ -41,7 +41,7 @@ type Command struct {
 
 	onCommandStart func()
 
-	cmd *exec.Cmd
+	cmd process.Process
 }
 
 func NewCommand(sess *session.Session, name string, arg ...string) *Command {
@@ -73,11 +73,15 @@ func (c *Command) Sudo() *Command {
 		"-t", // need to force tty allocation because of stdin is pipe!
 	}...)
 
-	c.cmd = cmd.NewSSH(c.Session).
-		WithArgs(args...).
-		WithCommand(sudoCmdLine).Cmd()
+	if app.IsNativeSSHTransport() {
+		c.cmd = gossh.NewCommand(c.Session, sudoCmdLine).WithPty(true)
+	} else {
+		c.cmd = process.NewLocalProcess(cmd.NewSSH(c.Session).
+			WithArgs(args...).
+			WithCommand(sudoCmdLine).Cmd())
+	}
 
-	c.Executor = process.NewDefaultExecutor(c.cmd)
+	c.Executor = process.NewDefaultProcessExecutor(c.cmd)
 
 	c.WithMatchers(
 		process.NewByteSequenceMatcher("SudoPassword"),
@@ -113,24 +117,44 @@ func (c *Command) Sudo() *Command {
 }
 
 func (c *Command) Cmd() *Command {
-	c.cmd = cmd.NewSSH(c.Session).
-		WithArgs(c.SSHArgs...).
-		WithCommand(c.Name, c.Args...).Cmd()
+	if app.IsNativeSSHTransport() {
+		c.cmd = gossh.NewCommand(c.Session, c.Name, c.Args...)
+	} else {
+		c.cmd = process.NewLocalProcess(cmd.NewSSH(c.Session).
+			WithArgs(c.SSHArgs...).
+			WithCommand(c.Name, c.Args...).Cmd())
+	}
 
-	c.Executor = process.NewDefaultExecutor(c.cmd)
+	c.Executor = process.NewDefaultProcessExecutor(c.cmd)
 	return c
 }
 
+// Kill stops the command without waiting for its output handlers.
+func (c *Command) Kill() error {
+	if c.cmd == nil {
+		return nil
+	}
+	return c.cmd.Kill()
+}
+
 func (c *Command) Output() ([]byte, []byte, error) {
 	if c.Session == nil {
 		return nil, nil, fmt.Errorf("execute command %s: SSH client is undefined", c.Name)
 	}
 
-	c.cmd = cmd.NewSSH(c.Session).
-		WithArgs(c.SSHArgs...).
-		WithCommand(c.Name, c.Args...).Cmd()
-
-	output, err := c.cmd.Output()
+	var output []byte
+	var err error
+	if app.IsNativeSSHTransport() {
+		nativeCmd := gossh.NewCommand(c.Session, c.Name, c.Args...)
+		c.cmd = nativeCmd
+		output, err = nativeCmd.Output()
+	} else {
+		sshCmd := cmd.NewSSH(c.Session).
+			WithArgs(c.SSHArgs...).
+			WithCommand(c.Name, c.Args...).Cmd()
+		c.cmd = process.NewLocalProcess(sshCmd)
+		output, err = sshCmd.Output()
+	}
 	if err != nil {
 		return output, nil, fmt.Errorf("execute command '%s': %v", c.Name, err)
 	}
@@ -142,11 +166,19 @@ func (c *Command) CombinedOutput() ([]byte, error) {
 		return nil, fmt.Errorf("execute command %s: sshClient is undefined", c.Name)
 	}
 
-	c.cmd = cmd.NewSSH(c.Session).
-		//	//WithArgs().
-		WithCommand(c.Name, c.Args...).Cmd()
-
-	output, err := c.cmd.CombinedOutput()
+	var output []byte
+	var err error
+	if app.IsNativeSSHTransport() {
+		nativeCmd := gossh.NewCommand(c.Session, c.Name, c.Args...)
+		c.cmd = nativeCmd
+		output, err = nativeCmd.CombinedOutput()
+	} else {
+		sshCmd := cmd.NewSSH(c.Session).
+			//	//WithArgs().
+			WithCommand(c.Name, c.Args...).Cmd()
+		c.cmd = process.NewLocalProcess(sshCmd)
+		output, err = sshCmd.CombinedOutput()
+	}
 	if err != nil {
 		return output, fmt.Errorf("execute command '%s': %v", c.Name, err)
 	}
@@ -22,8 +22,10 @@ import (
 
 	uuid "gopkg.in/satori/go.uuid.v1"
 
+	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/cmd"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/gossh"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
 )
 
@@ -40,6 +42,15 @@ func (f *File) Upload(srcPath, remotePath string) error {
 	if err != nil {
 		return err
 	}
+
+	if app.IsNativeSSHTransport() {
+		err = gossh.NewSCP(f.Session).WithRecursive(fType == "DIR").Upload(srcPath, remotePath)
+		if err != nil {
+			return fmt.Errorf("upload file '%s': %v", srcPath, err)
+		}
+		return nil
+	}
+
 	scp := cmd.NewSCP(f.Session)
 	if fType == "DIR" {
 		scp.WithRecursive(true)
@@ -59,6 +70,14 @@ func (f *File) Upload(srcPath, remotePath string) error {
 
 // UploadBytes creates a tmp file and upload it to remote dstPath
 func (f *File) UploadBytes(data []byte, remotePath string) error {
+	if app.IsNativeSSHTransport() {
+		err := gossh.NewSCP(f.Session).UploadBytes(data, remotePath)
+		if err != nil {
+			return fmt.Errorf("upload file '%s': %v", remotePath, err)
+		}
+		return nil
+	}
+
 	srcPath, err := CreateEmptyTmpFile()
 	if err != nil {
 		return fmt.Errorf("create source tmp file: %v", err)
@@ -93,6 +112,14 @@ func (f *File) UploadBytes(data []byte, remotePath string) error {
 }
 
 func (f *File) Download(remotePath, dstPath string) error {
+	if app.IsNativeSSHTransport() {
+		err := gossh.NewSCP(f.Session).WithRecursive(true).Download(remotePath, dstPath)
+		if err != nil {
+			return fmt.Errorf("download file '%s': %v", remotePath, err)
+		}
+		return nil
+	}
+
 	scp := cmd.NewSCP(f.Session)
 	scp.WithRecursive(true)
 	scpCmd := scp.WithRemoteSrc(remotePath).WithDst(dstPath).SCP()
@@ -111,6 +138,14 @@ func (f *File) Download(remotePath, dstPath string) error {
 
 // Download remote file and returns its content as an array of bytes.
 func (f *File) DownloadBytes(remotePath string) ([]byte, error) {
+	if app.IsNativeSSHTransport() {
+		data, err := gossh.NewSCP(f.Session).DownloadBytes(remotePath)
+		if err != nil {
+			return nil, fmt.Errorf("download file '%s': %v", remotePath, err)
+		}
+		return data, nil
+	}
+
 	dstPath, err := CreateEmptyTmpFile()
 	if err != nil {
 		return nil, fmt.Errorf("create target tmp file: %v", err)
@@ -21,8 +21,10 @@ import (
 	"os"
 	"os/exec"
 
+	"github.com/deckhouse/deckhouse/dhctl/pkg/app"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/cmd"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/gossh"
 	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
 )
 
@@ -31,6 +33,7 @@ type Tunnel struct {
 	Type    string // Remote or Local
 	Address string
 	sshCmd  *exec.Cmd
+	native  *gossh.Tunnel
 
 	stopCh  chan struct{}
 	errorCh chan error
@@ -50,6 +53,15 @@ func (t *Tunnel) Up() error {
 		return fmt.Errorf("up tunnel '%s': SSH client is undefined", t.String())
 	}
 
+	if app.IsNativeSSHTransport() {
+		t.native = gossh.NewTunnel(t.Session, t.Type, t.Address)
+		err := t.native.Up()
+		if err != nil {
+			return fmt.Errorf("cannot open tunnel '%s': %v", t.String(), err)
+		}
+		return nil
+	}
+
 	t.sshCmd = cmd.NewSSH(t.Session).
 		WithArgs(
 			// "-f", // start in background - good for scripts, but here we need to do cmd.Process.Kill()
@@ -109,11 +121,22 @@ func (t *Tunnel) HealthMonitor(errorOutCh chan<- error) {
 
 	t.stopCh = make(chan struct{}, 1)
 
+	var nativeErrorCh <-chan error
+	if t.native != nil {
+		nativeErrorCh = t.native.Errors()
+	}
+
 	for {
 		select {
 		case err := <-t.errorCh:
 			errorOutCh <- err
+		case err := <-nativeErrorCh:
+			errorOutCh <- err
 		case <-t.stopCh:
+			if t.native != nil {
+				t.native.Stop()
+				return
+			}
 			_ = t.sshCmd.Process.Kill()
 			return
 		}
@@ -129,7 +152,12 @@ func (t *Tunnel) Stop() {
 		return
 	}
 
-	if t.sshCmd != nil && t.stopCh != nil {
+	if t.native != nil && t.stopCh == nil {
+		t.native.Stop()
+		return
+	}
+
+	if (t.sshCmd != nil || t.native != nil) && t.stopCh != nil {
 		t.stopCh <- struct{}{}
 	}
 }
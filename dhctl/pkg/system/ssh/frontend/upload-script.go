@@ -188,7 +188,7 @@ func bundleOutputHandler(cmd *Command, processLogger log.ProcessLogger, lastStep
 				if *failsCounter > 10 {
 					if cmd != nil {
 						// Force kill bashible
-						_ = cmd.cmd.Process.Kill()
+						_ = cmd.Kill()
 					}
 					return
 				}
@@ -0,0 +1,121 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/terminal"
+)
+
+var (
+	agentClientsLock sync.Mutex
+	agentClients     = make(map[string]agent.ExtendedAgent)
+)
+
+// keyring is an in-process replacement for ssh-agent: keys passed with --ssh-agent-private-keys are added here.
+var keyring = agent.NewKeyring()
+
+// AddKeys parses private keys and adds them to the in-process keyring.
+// Passphrase is asked for encrypted keys.
+func AddKeys(paths []string) error {
+	for _, path := range paths {
+		log.DebugF("add key %s\n", path)
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read private key '%s': %v", path, err)
+		}
+
+		key, err := ssh.ParseRawPrivateKey(data)
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			var passphrase []byte
+			passphrase, err = terminal.AskPassphrase(fmt.Sprintf("Enter passphrase for %s: ", path))
+			if err != nil {
+				return err
+			}
+			key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+		}
+		if err != nil {
+			return fmt.Errorf("parse private key '%s': %v", path, err)
+		}
+
+		err = keyring.Add(agent.AddedKey{PrivateKey: key, Comment: path})
+		if err != nil {
+			return fmt.Errorf("add private key '%s': %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// externalAgent returns a client for ssh-agent listening on socket.
+// Connection is kept open because signers from the agent use it to sign.
+func externalAgent(sock string) (agent.ExtendedAgent, error) {
+	agentClientsLock.Lock()
+	defer agentClientsLock.Unlock()
+
+	if c, ok := agentClients[sock]; ok {
+		return c, nil
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	c := agent.NewClient(conn)
+	agentClients[sock] = c
+	return c, nil
+}
+
+// authMethods returns public key auth with keys from the in-process keyring
+// and keys from the external ssh-agent if SSH_AUTH_SOCK is set.
+func authMethods(settings *session.AgentSettings) []ssh.AuthMethod {
+	return []ssh.AuthMethod{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signers, err := keyring.Signers()
+			if err != nil {
+				return nil, err
+			}
+
+			if settings == nil || settings.AuthSock == "" {
+				return signers, nil
+			}
+
+			agentClient, err := externalAgent(settings.AuthSock)
+			if err != nil {
+				log.DebugF("Cannot connect to ssh-agent '%s': %v\n", settings.AuthSock, err)
+				return signers, nil
+			}
+
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				log.DebugF("Cannot get keys from ssh-agent '%s': %v\n", settings.AuthSock, err)
+				return signers, nil
+			}
+
+			return append(signers, agentSigners...), nil
+		}),
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/tomb"
+)
+
+const (
+	DefaultPort = "22"
+
+	// The same values as in openssh transport: ConnectTimeout=5, ServerAliveInterval=7 and ServerAliveCountMax=2.
+	connectTimeout      = 5 * time.Second
+	serverAliveInterval = 7 * time.Second
+	serverAliveCountMax = 2
+)
+
+// Client is a connection to the host through the optional bastion host.
+type Client struct {
+	Settings *session.Session
+
+	client  *ssh.Client
+	bastion *ssh.Client
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+	err    error
+}
+
+func NewClient(sess *session.Session) *Client {
+	return &Client{
+		Settings: sess,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+}
+
+// Start connects to the bastion host if it is set and then to the current host of the session.
+func (c *Client) Start() error {
+	if c.Settings.Host() == "" {
+		return fmt.Errorf("Empty host for connection received")
+	}
+
+	if c.Settings.ExtraArgs != "" {
+		log.WarnF("SSH extra args '%s' are ignored by the native ssh transport\n", c.Settings.ExtraArgs)
+	}
+
+	hostKeyCallback := AcceptNewHostKeyCallback(KnownHostsFile)
+	auth := authMethods(c.Settings.AgentSettings)
+
+	addr := net.JoinHostPort(c.Settings.Host(), portOrDefault(c.Settings.Port))
+	config := &ssh.ClientConfig{
+		User:            userOrDefault(c.Settings.User),
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         connectTimeout,
+	}
+
+	if c.Settings.BastionHost == "" {
+		log.DebugF("ssh: connect to %s\n", addr)
+		client, err := ssh.Dial("tcp", addr, config)
+		if err != nil {
+			return fmt.Errorf("connect to '%s': %v", addr, err)
+		}
+		c.client = client
+		c.runKeepalive()
+		return nil
+	}
+
+	bastionAddr := net.JoinHostPort(c.Settings.BastionHost, portOrDefault(c.Settings.BastionPort))
+	bastionConfig := &ssh.ClientConfig{
+		User:            userOrDefault(c.Settings.BastionUser),
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         connectTimeout,
+	}
+
+	log.DebugF("ssh: connect to bastion %s\n", bastionAddr)
+	bastion, err := ssh.Dial("tcp", bastionAddr, bastionConfig)
+	if err != nil {
+		return fmt.Errorf("connect to bastion '%s': %v", bastionAddr, err)
+	}
+
+	log.DebugF("ssh: connect to %s through bastion %s\n", addr, bastionAddr)
+	conn, err := dialWithTimeout(bastion, addr, connectTimeout)
+	if err != nil {
+		_ = bastion.Close()
+		return fmt.Errorf("connect to '%s' through bastion '%s': %v", addr, bastionAddr, err)
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		_ = bastion.Close()
+		return fmt.Errorf("connect to '%s' through bastion '%s': %v", addr, bastionAddr, err)
+	}
+
+	c.bastion = bastion
+	c.client = ssh.NewClient(clientConn, chans, reqs)
+	c.runKeepalive()
+	return nil
+}
+
+// Stop closes connections to the host and to the bastion.
+func (c *Client) Stop() {
+	select {
+	case <-c.stopCh:
+		return
+	default:
+		close(c.stopCh)
+	}
+
+	if c.client != nil {
+		_ = c.client.Close()
+	}
+	if c.bastion != nil {
+		_ = c.bastion.Close()
+	}
+}
+
+// Done is closed when the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.doneCh
+}
+
+// Err returns the reason why connection was lost.
+func (c *Client) Err() error {
+	<-c.doneCh
+	return c.err
+}
+
+func (c *Client) IsAlive() bool {
+	select {
+	case <-c.doneCh:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *Client) NewSession() (*ssh.Session, error) {
+	return c.client.NewSession()
+}
+
+// Dial opens a connection to the address from the remote host.
+func (c *Client) Dial(network, addr string) (net.Conn, error) {
+	return c.client.Dial(network, addr)
+}
+
+// Listen asks the remote host to listen on the address.
+func (c *Client) Listen(network, addr string) (net.Listener, error) {
+	return c.client.Listen(network, addr)
+}
+
+func (c *Client) String() string {
+	return c.Settings.String()
+}
+
+// runKeepalive sends keepalive requests like ServerAliveInterval option
+// and closes the connection if server does not respond.
+func (c *Client) runKeepalive() {
+	go func() {
+		err := c.client.Wait()
+		if c.bastion != nil {
+			_ = c.bastion.Close()
+		}
+		c.err = err
+		close(c.doneCh)
+	}()
+
+	go func() {
+		t := time.NewTicker(serverAliveInterval)
+		defer t.Stop()
+
+		failures := 0
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case <-c.doneCh:
+				return
+			case <-t.C:
+			}
+
+			_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+			if err == nil {
+				failures = 0
+				continue
+			}
+
+			failures++
+			log.DebugF("ssh: keepalive to %s failed (%d/%d): %v\n", c.String(), failures, serverAliveCountMax, err)
+			if failures >= serverAliveCountMax {
+				_ = c.client.Close()
+				return
+			}
+		}
+	}()
+}
+
+func dialWithTimeout(client *ssh.Client, addr string, timeout time.Duration) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	resCh := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial("tcp", addr)
+		resCh <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case res := <-resCh:
+		return res.conn, res.err
+	case <-time.After(timeout):
+		go func() {
+			if res := <-resCh; res.conn != nil {
+				_ = res.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timeout %s", timeout)
+	}
+}
+
+func portOrDefault(port string) string {
+	if port == "" {
+		return DefaultPort
+	}
+	return port
+}
+
+func userOrDefault(user string) string {
+	if user == "" {
+		return os.Getenv("USER")
+	}
+	return user
+}
+
+// Clients are shared between frontends like ControlMaster=auto does for openssh transport.
+var (
+	clientsLock sync.Mutex
+	clients     = make(map[string]*Client)
+
+	clientsShutdownOnce sync.Once
+)
+
+// ClientFor returns an established connection for the current host of the session.
+// New connection is started if there is no connection or it was lost.
+func ClientFor(sess *session.Session) (*Client, error) {
+	clientsShutdownOnce.Do(func() {
+		tomb.RegisterOnShutdown("Close ssh connections", StopAll)
+	})
+
+	key := sess.String()
+
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	if c, ok := clients[key]; ok {
+		if c.IsAlive() {
+			return c, nil
+		}
+		log.DebugF("ssh: connection to %s was lost: %v\n", key, c.Err())
+		delete(clients, key)
+	}
+
+	// Copy settings because current host of the session can be changed later.
+	c := NewClient(sess.Copy())
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	clients[key] = c
+	return c, nil
+}
+
+// StopAll closes all shared connections.
+func StopAll() {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	for key, c := range clients {
+		c.Stop()
+		delete(clients, key)
+	}
+}
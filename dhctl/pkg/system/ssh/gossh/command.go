@@ -0,0 +1,232 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
+)
+
+// Command runs a command line on the remote host. It implements process.Process,
+// so it can be used with process.Executor the same way as the ssh binary.
+// Connection is established on Start, so connection errors are returned from Start or Run.
+type Command struct {
+	Settings *session.Session
+
+	name string
+	args []string
+
+	pty bool
+
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.WriteCloser
+
+	lock    sync.Mutex
+	session *ssh.Session
+
+	exitCode int
+}
+
+func NewCommand(sess *session.Session, name string, arg ...string) *Command {
+	return &Command{
+		Settings: sess,
+		name:     name,
+		args:     arg,
+		exitCode: -1,
+	}
+}
+
+// WithPty requests pseudo terminal like ssh -t -t does: remote process is killed when connection is closed.
+func (c *Command) WithPty(pty bool) *Command {
+	c.pty = pty
+	return c
+}
+
+func (c *Command) CommandLine() string {
+	if len(c.args) == 0 {
+		return c.name
+	}
+	return c.name + " " + strings.Join(c.args, " ")
+}
+
+func (c *Command) SetStdout(w io.Writer) {
+	c.stdout = w
+}
+
+func (c *Command) SetStderr(w io.Writer) {
+	c.stderr = w
+}
+
+// StdinPipe returns a pipe connected to the remote command stdin. It should be called before Start.
+func (c *Command) StdinPipe() (io.WriteCloser, error) {
+	if c.stdin != nil {
+		return nil, fmt.Errorf("stdin pipe already opened")
+	}
+	r, w := io.Pipe()
+	c.stdin = &stdinPipe{PipeWriter: w, reader: r}
+	return c.stdin, nil
+}
+
+func (c *Command) Start() error {
+	client, err := ClientFor(c.Settings)
+	if err != nil {
+		return err
+	}
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("open ssh session to '%s': %v", client.String(), err)
+	}
+
+	if c.pty {
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		err = sess.RequestPty("xterm", 40, 200, modes)
+		if err != nil {
+			_ = sess.Close()
+			return fmt.Errorf("request pty on '%s': %v", client.String(), err)
+		}
+	}
+
+	sess.Stdout = c.stdout
+	sess.Stderr = c.stderr
+	if p, ok := c.stdin.(*stdinPipe); ok {
+		sess.Stdin = p.reader
+	}
+
+	log.DebugF("ssh: run '%s' on %s\n", c.CommandLine(), client.String())
+	err = sess.Start(c.CommandLine())
+	if err != nil {
+		_ = sess.Close()
+		return fmt.Errorf("start '%s' on '%s': %v", c.name, client.String(), err)
+	}
+
+	c.lock.Lock()
+	c.session = sess
+	c.lock.Unlock()
+
+	return nil
+}
+
+func (c *Command) Wait() error {
+	c.lock.Lock()
+	sess := c.session
+	c.lock.Unlock()
+
+	if sess == nil {
+		return fmt.Errorf("command '%s' is not started", c.name)
+	}
+
+	err := sess.Wait()
+	_ = sess.Close()
+	if c.stdin != nil {
+		_ = c.stdin.Close()
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		c.exitCode = 0
+	case errors.As(err, &exitErr):
+		c.exitCode = exitErr.ExitStatus()
+	}
+
+	return err
+}
+
+// Kill sends KILL signal to the remote process and closes the session.
+// Session close is enough to stop a process started with pty.
+func (c *Command) Kill() error {
+	c.lock.Lock()
+	sess := c.session
+	c.lock.Unlock()
+
+	if sess == nil {
+		return nil
+	}
+
+	_ = sess.Signal(ssh.SIGKILL)
+	err := sess.Close()
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (c *Command) ExitCode() int {
+	return c.exitCode
+}
+
+func (c *Command) Name() string {
+	return c.name
+}
+
+func (c *Command) String() string {
+	return fmt.Sprintf("%s -- %s", c.Settings.String(), c.CommandLine())
+}
+
+// Output runs the command and returns its stdout.
+func (c *Command) Output() ([]byte, error) {
+	var stdout bytes.Buffer
+	c.SetStdout(&stdout)
+	err := c.Run()
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its stdout and stderr.
+func (c *Command) CombinedOutput() ([]byte, error) {
+	var output bytes.Buffer
+	w := &syncWriter{w: &output}
+	c.SetStdout(w)
+	c.SetStderr(w)
+	err := c.Run()
+	return output.Bytes(), err
+}
+
+func (c *Command) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+type stdinPipe struct {
+	*io.PipeWriter
+	reader *io.PipeReader
+}
+
+type syncWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.w.Write(p)
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+)
+
+// KnownHostsFile is the same file that is used by openssh transport (UserKnownHostsFile=.ssh_known_hosts).
+const KnownHostsFile = ".ssh_known_hosts"
+
+var knownHostsLock sync.Mutex
+
+// AcceptNewHostKeyCallback works like StrictHostKeyChecking=accept-new:
+// keys of unknown hosts are added to the file, changed keys are rejected.
+func AcceptNewHostKeyCallback(path string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsLock.Lock()
+		defer knownHostsLock.Unlock()
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("open known hosts file '%s': %v", path, err)
+		}
+		_ = f.Close()
+
+		check, err := knownhosts.New(path)
+		if err != nil {
+			return fmt.Errorf("read known hosts file '%s': %v", path, err)
+		}
+
+		err = check(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key verification failed for '%s' (see %s): %v", hostname, path, err)
+		}
+
+		log.DebugF("Add host key for '%s' to %s\n", hostname, path)
+
+		f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("open known hosts file '%s': %v", path, err)
+		}
+		defer f.Close()
+
+		_, err = f.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n")
+		if err != nil {
+			return fmt.Errorf("write known hosts file '%s': %v", path, err)
+		}
+
+		return nil
+	}
+}
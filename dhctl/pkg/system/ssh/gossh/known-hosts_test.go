@@ -0,0 +1,93 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return key
+}
+
+func TestAcceptNewHostKeyCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dhctl-known-hosts-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, KnownHostsFile)
+	callback := AcceptNewHostKeyCallback(path)
+
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	key := newHostKey(t)
+
+	t.Run("Unknown host is accepted and saved", func(t *testing.T) {
+		require.NoError(t, callback("10.0.0.1:22", addr, key))
+
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(content), "10.0.0.1 "+key.Type())
+	})
+
+	t.Run("Known host with the same key is accepted", func(t *testing.T) {
+		require.NoError(t, callback("10.0.0.1:22", addr, key))
+
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.Len(t, content, len(ssh.MarshalAuthorizedKey(key))+len("10.0.0.1 "))
+	})
+
+	t.Run("Known host with changed key is rejected", func(t *testing.T) {
+		err := callback("10.0.0.1:22", addr, newHostKey(t))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "host key verification failed")
+	})
+
+	t.Run("Host on non default port is saved separately", func(t *testing.T) {
+		require.NoError(t, callback("10.0.0.1:2222", addr, newHostKey(t)))
+
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(content), "[10.0.0.1]:2222 ")
+	})
+}
+
+func TestParseForwardAddress(t *testing.T) {
+	listen, target, err := ParseForwardAddress("22322:localhost:6445")
+	require.NoError(t, err)
+	require.Equal(t, "localhost:22322", listen)
+	require.Equal(t, "localhost:6445", target)
+
+	listen, target, err = ParseForwardAddress("0.0.0.0:5000:registry.local:443")
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0.0:5000", listen)
+	require.Equal(t, "registry.local:443", target)
+
+	_, _, err = ParseForwardAddress("6445")
+	require.Error(t, err)
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
+)
+
+// SCP copies files with the scp protocol: remote side runs 'scp -t' to receive files and 'scp -f' to send them.
+// Remote host should have scp installed, as for openssh transport.
+type SCP struct {
+	Settings *session.Session
+
+	Recursive bool
+}
+
+func NewSCP(sess *session.Session) *SCP {
+	return &SCP{Settings: sess}
+}
+
+func (s *SCP) WithRecursive(recursive bool) *SCP {
+	s.Recursive = recursive
+	return s
+}
+
+// Upload copies local file or directory to the remote path.
+func (s *SCP) Upload(srcPath, remotePath string) error {
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() && !s.Recursive {
+		return fmt.Errorf("'%s' is a directory, recursive upload is required", srcPath)
+	}
+
+	return s.run(scpCommandLine("-t", s.Recursive, remotePath), func(w io.Writer, r *bufio.Reader) error {
+		if err := readAck(r); err != nil {
+			return err
+		}
+		return sendEntry(w, r, srcPath, fi)
+	})
+}
+
+// UploadBytes writes data to the remote file.
+func (s *SCP) UploadBytes(data []byte, remotePath string) error {
+	return s.run(scpCommandLine("-t", false, remotePath), func(w io.Writer, r *bufio.Reader) error {
+		if err := readAck(r); err != nil {
+			return err
+		}
+		return sendFile(w, r, filepath.Base(remotePath), 0o644, int64(len(data)), bytes.NewReader(data))
+	})
+}
+
+// Download copies remote file or directory to the local path.
+func (s *SCP) Download(remotePath, dstPath string) error {
+	return s.run(scpCommandLine("-f", s.Recursive, remotePath), func(w io.Writer, r *bufio.Reader) error {
+		return receive(w, r, dstPath)
+	})
+}
+
+// DownloadBytes returns the content of the remote file.
+func (s *SCP) DownloadBytes(remotePath string) ([]byte, error) {
+	tmpDir, err := ioutil.TempDir("", "dhctl-scp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dstPath := filepath.Join(tmpDir, "content")
+	if err := s.Download(remotePath, dstPath); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(dstPath)
+}
+
+func (s *SCP) run(cmdline string, fn func(w io.Writer, r *bufio.Reader) error) error {
+	client, err := ClientFor(s.Settings)
+	if err != nil {
+		return err
+	}
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("open ssh session to '%s': %v", client.String(), err)
+	}
+	defer sess.Close()
+
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	sess.Stderr = &stderr
+
+	log.DebugF("ssh: run '%s' on %s\n", cmdline, client.String())
+	if err := sess.Start(cmdline); err != nil {
+		return fmt.Errorf("start scp on '%s': %v", client.String(), err)
+	}
+
+	protoErr := fn(stdin, bufio.NewReader(stdout))
+	_ = stdin.Close()
+	waitErr := sess.Wait()
+
+	if protoErr != nil {
+		return fmt.Errorf("scp: %v %s", protoErr, stderr.String())
+	}
+	if waitErr != nil {
+		return fmt.Errorf("scp: %v %s", waitErr, stderr.String())
+	}
+	return nil
+}
+
+func scpCommandLine(mode string, recursive bool, path string) string {
+	args := []string{"scp", mode}
+	if recursive {
+		args = append(args, "-r")
+	}
+	return strings.Join(append(args, shellescape.Quote(path)), " ")
+}
+
+func sendEntry(w io.Writer, r *bufio.Reader, path string, fi os.FileInfo) error {
+	if !fi.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return sendFile(w, r, fi.Name(), fi.Mode().Perm(), fi.Size(), f)
+	}
+
+	if _, err := fmt.Fprintf(w, "D%04o 0 %s\n", fi.Mode().Perm(), fi.Name()); err != nil {
+		return err
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && !entry.Mode().IsRegular() {
+			log.DebugF("scp: skip '%s': not a regular file\n", filepath.Join(path, entry.Name()))
+			continue
+		}
+		if err := sendEntry(w, r, filepath.Join(path, entry.Name()), entry); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprint(w, "E\n"); err != nil {
+		return err
+	}
+	return readAck(r)
+}
+
+func sendFile(w io.Writer, r *bufio.Reader, name string, mode os.FileMode, size int64, content io.Reader) error {
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", mode, size, name); err != nil {
+		return err
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, content, size); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	return readAck(r)
+}
+
+// receive handles messages from 'scp -f'. Top level entry is written to dstPath
+// or into dstPath if it is an existing directory.
+func receive(w io.Writer, r *bufio.Reader, dstPath string) error {
+	dirs := make([]string, 0)
+
+	target := func(name string) string {
+		if len(dirs) > 0 {
+			return filepath.Join(dirs[len(dirs)-1], name)
+		}
+		if fi, err := os.Stat(dstPath); err == nil && fi.IsDir() {
+			return filepath.Join(dstPath, name)
+		}
+		return dstPath
+	}
+
+	// ready to receive
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		msgType, msg := line[0], strings.TrimSuffix(line[1:], "\n")
+		switch msgType {
+		case 1, 2:
+			return fmt.Errorf("remote: %s", msg)
+		case 'T':
+			// modification times are not preserved
+		case 'E':
+			if len(dirs) == 0 {
+				return fmt.Errorf("unexpected end of directory")
+			}
+			dirs = dirs[:len(dirs)-1]
+		case 'D', 'C':
+			mode, size, name, err := parseEntryHeader(msg)
+			if err != nil {
+				return err
+			}
+			path := target(name)
+
+			if msgType == 'D' {
+				if err := os.MkdirAll(path, mode); err != nil {
+					return err
+				}
+				dirs = append(dirs, path)
+				break
+			}
+
+			if err := receiveFile(w, r, path, mode, size); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown scp message '%s'", strings.TrimSpace(line))
+		}
+
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+}
+
+func receiveFile(w io.Writer, r *bufio.Reader, path string, mode os.FileMode, size int64) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, r, size); err != nil {
+		return err
+	}
+	return readAck(r)
+}
+
+// parseEntryHeader parses "0644 123 name" from C and D messages.
+func parseEntryHeader(msg string) (os.FileMode, int64, string, error) {
+	parts := strings.SplitN(msg, " ", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", fmt.Errorf("bad scp header '%s'", msg)
+	}
+
+	mode, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("bad mode in scp header '%s': %v", msg, err)
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("bad size in scp header '%s': %v", msg, err)
+	}
+	name := parts[2]
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return 0, 0, "", fmt.Errorf("bad file name in scp header '%s'", msg)
+	}
+
+	return os.FileMode(mode).Perm(), size, name, nil
+}
+
+func readAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+
+	msg, _ := r.ReadString('\n')
+	return fmt.Errorf("remote: %s", strings.TrimSpace(msg))
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCPProtocolRoundTrip(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "dhctl-scp-src-")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "dhctl-scp-dst-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dstDir)
+
+	bundle := filepath.Join(srcDir, "bundle")
+	require.NoError(t, os.MkdirAll(filepath.Join(bundle, "steps"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bundle, "bashible.sh"), []byte("#!/bin/bash\necho ok\n"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bundle, "steps", "001.sh"), []byte("step"), 0o644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bundle, "steps", "empty"), nil, 0o600))
+
+	// source -> sink messages and sink -> source acks
+	sinkIn, sourceOut := io.Pipe()
+	sourceIn, sinkOut := io.Pipe()
+
+	sinkErr := make(chan error, 1)
+	go func() {
+		sinkErr <- receive(sinkOut, bufio.NewReader(sinkIn), dstDir)
+	}()
+
+	sourceReader := bufio.NewReader(sourceIn)
+	require.NoError(t, readAck(sourceReader))
+
+	fi, err := os.Stat(bundle)
+	require.NoError(t, err)
+	require.NoError(t, sendEntry(sourceOut, sourceReader, bundle, fi))
+	require.NoError(t, sourceOut.Close())
+
+	require.NoError(t, <-sinkErr)
+
+	content, err := ioutil.ReadFile(filepath.Join(dstDir, "bundle", "bashible.sh"))
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/bash\necho ok\n", string(content))
+
+	st, err := os.Stat(filepath.Join(dstDir, "bundle", "bashible.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), st.Mode().Perm())
+
+	content, err = ioutil.ReadFile(filepath.Join(dstDir, "bundle", "steps", "001.sh"))
+	require.NoError(t, err)
+	require.Equal(t, "step", string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(dstDir, "bundle", "steps", "empty"))
+	require.NoError(t, err)
+	require.Empty(t, content)
+}
+
+func TestSCPRemoteError(t *testing.T) {
+	sinkIn, sourceOut := io.Pipe()
+
+	go func() {
+		_, _ = sourceOut.Write([]byte("\x01scp: /etc/shadow: Permission denied\n"))
+		_ = sourceOut.Close()
+	}()
+
+	err := receive(ioutil.Discard, bufio.NewReader(sinkIn), os.TempDir())
+	require.EqualError(t, err, "remote: scp: /etc/shadow: Permission denied")
+}
+
+func TestParseEntryHeader(t *testing.T) {
+	mode, size, name, err := parseEntryHeader("0644 12 file name.txt")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), mode)
+	require.Equal(t, int64(12), size)
+	require.Equal(t, "file name.txt", name)
+
+	for _, header := range []string{"0644 12", "0644 12 ..", "0644 12 ../passwd", "0999 12 a", "0644 -a b"} {
+		_, _, _, err = parseEntryHeader(header)
+		require.Error(t, err, header)
+	}
+}
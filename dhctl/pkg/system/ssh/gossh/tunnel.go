@@ -0,0 +1,169 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gossh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/system/ssh/session"
+)
+
+// Tunnel forwards connections like ssh -L and ssh -R do.
+type Tunnel struct {
+	Settings *session.Session
+	Type     string // L or R
+	Address  string
+
+	client   *Client
+	listener net.Listener
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	errorCh  chan error
+}
+
+func NewTunnel(sess *session.Session, ttype, address string) *Tunnel {
+	return &Tunnel{
+		Settings: sess,
+		Type:     ttype,
+		Address:  address,
+		stopCh:   make(chan struct{}),
+		errorCh:  make(chan error, 1),
+	}
+}
+
+// Up starts listening on the local (L) or remote (R) side.
+func (t *Tunnel) Up() error {
+	listenAddr, targetAddr, err := ParseForwardAddress(t.Address)
+	if err != nil {
+		return err
+	}
+
+	client, err := ClientFor(t.Settings)
+	if err != nil {
+		return err
+	}
+	t.client = client
+
+	var dial func(string, string) (net.Conn, error)
+	switch t.Type {
+	case "L":
+		t.listener, err = net.Listen("tcp", listenAddr)
+		dial = client.Dial
+	case "R":
+		t.listener, err = client.Listen("tcp", listenAddr)
+		dial = net.Dial
+	default:
+		return fmt.Errorf("unknown tunnel type '%s'", t.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("listen on '%s': %v", listenAddr, err)
+	}
+
+	go t.accept(targetAddr, dial)
+
+	go func() {
+		select {
+		case <-t.stopCh:
+		case <-client.Done():
+			t.sendError(fmt.Errorf("ssh connection to '%s' lost: %v", client.String(), client.Err()))
+			_ = t.listener.Close()
+		}
+	}()
+
+	return nil
+}
+
+// Errors returns a channel to receive an error when the tunnel is broken.
+func (t *Tunnel) Errors() <-chan error {
+	return t.errorCh
+}
+
+func (t *Tunnel) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+		if t.listener != nil {
+			_ = t.listener.Close()
+		}
+	})
+}
+
+func (t *Tunnel) String() string {
+	return fmt.Sprintf("%s:%s", t.Type, t.Address)
+}
+
+func (t *Tunnel) accept(targetAddr string, dial func(string, string) (net.Conn, error)) {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.stopCh:
+			default:
+				t.sendError(fmt.Errorf("tunnel '%s' accept: %v", t.String(), err))
+			}
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			remote, err := dial("tcp", targetAddr)
+			if err != nil {
+				log.DebugF("Tunnel '%s': cannot connect to '%s': %v\n", t.String(), targetAddr, err)
+				return
+			}
+			defer remote.Close()
+
+			pipe(conn, remote)
+		}()
+	}
+}
+
+func (t *Tunnel) sendError(err error) {
+	select {
+	case t.errorCh <- err:
+	default:
+	}
+}
+
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	// Close both connections when one side is finished.
+	<-done
+}
+
+// ParseForwardAddress parses [bind_address:]port:host:hostport as ssh -L and -R do.
+func ParseForwardAddress(address string) (listenAddr string, targetAddr string, err error) {
+	parts := strings.Split(address, ":")
+	switch len(parts) {
+	case 3:
+		return net.JoinHostPort("localhost", parts[0]), net.JoinHostPort(parts[1], parts[2]), nil
+	case 4:
+		return net.JoinHostPort(parts[0], parts[1]), net.JoinHostPort(parts[2], parts[3]), nil
+	default:
+		return "", "", fmt.Errorf("bad forward address '%s', expect [bind_address:]port:host:hostport", address)
+	}
+}
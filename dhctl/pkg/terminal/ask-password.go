@@ -48,3 +48,22 @@ func AskBecomePassword() (err error) {
 	app.BecomePass = string(data)
 	return nil
 }
+
+func AskPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("stdin is not a terminal, error reading passphrase")
+	}
+
+	log.InfoF(prompt)
+
+	data, err := terminal.ReadPassword(fd)
+	log.InfoLn()
+
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %v", err)
+	}
+
+	return data, nil
+}
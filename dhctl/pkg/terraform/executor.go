@@ -56,6 +56,8 @@ func terraformCmd(args ...string) *exec.Cmd {
 // CMDExecutor straightforward cmd executor which provides convenient output and handles quit signal.
 type CMDExecutor struct {
 	cmd *exec.Cmd
+	// layer is a name of the runner for progress events
+	layer string
 }
 
 func (c *CMDExecutor) Output(args ...string) ([]byte, error) {
@@ -106,6 +108,10 @@ func (c *CMDExecutor) Exec(args ...string) (int, error) {
 	s := bufio.NewScanner(stdout)
 	for s.Scan() {
 		log.InfoLn(s.Text())
+		if info, ok := parseResourceProgress(s.Text()); ok {
+			info.Layer = c.layer
+			log.EmitTerraformResource(info)
+		}
 	}
 
 	err = <-waitCh
@@ -0,0 +1,66 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terraform
+
+import (
+	"regexp"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+)
+
+// resourceProgressRe matches terraform apply and destroy output lines, for example:
+//
+//	yandex_vpc_network.kube: Creating...
+//	yandex_compute_instance.master: Still creating... [10s elapsed]
+//	yandex_compute_instance.master: Creation complete after 42s [id=fhm2vb3b7mn]
+var resourceProgressRe = regexp.MustCompile(`^(\S+): (Creating|Modifying|Destroying|Reading|Still creating|Still modifying|Still destroying|Still reading|Creation complete|Modifications complete|Destruction complete|Read complete)(?:\.\.\.)?(?: after (\S+))?(?: \[(\S+) elapsed\])?`)
+
+var resourceProgressActions = map[string]struct {
+	action string
+	status string
+}{
+	"Creating":               {"create", log.ResourceProgressStarted},
+	"Modifying":              {"update", log.ResourceProgressStarted},
+	"Destroying":             {"delete", log.ResourceProgressStarted},
+	"Reading":                {"read", log.ResourceProgressStarted},
+	"Still creating":         {"create", log.ResourceProgressInProgress},
+	"Still modifying":        {"update", log.ResourceProgressInProgress},
+	"Still destroying":       {"delete", log.ResourceProgressInProgress},
+	"Still reading":          {"read", log.ResourceProgressInProgress},
+	"Creation complete":      {"create", log.ResourceProgressComplete},
+	"Modifications complete": {"update", log.ResourceProgressComplete},
+	"Destruction complete":   {"delete", log.ResourceProgressComplete},
+	"Read complete":          {"read", log.ResourceProgressComplete},
+}
+
+func parseResourceProgress(line string) (log.TerraformResourceInfo, bool) {
+	matches := resourceProgressRe.FindStringSubmatch(line)
+	if matches == nil {
+		return log.TerraformResourceInfo{}, false
+	}
+
+	progress := resourceProgressActions[matches[2]]
+	info := log.TerraformResourceInfo{
+		Address: matches[1],
+		Action:  progress.action,
+		Status:  progress.status,
+		Elapsed: matches[3],
+	}
+	if info.Elapsed == "" {
+		info.Elapsed = matches[4]
+	}
+
+	return info, true
+}
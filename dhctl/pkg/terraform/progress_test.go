@@ -0,0 +1,66 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+)
+
+func TestParseResourceProgress(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected *log.TerraformResourceInfo
+	}{
+		{
+			line:     "yandex_vpc_network.kube: Creating...",
+			expected: &log.TerraformResourceInfo{Address: "yandex_vpc_network.kube", Action: "create", Status: log.ResourceProgressStarted},
+		},
+		{
+			line:     "module.master.yandex_compute_instance.master: Still creating... [10s elapsed]",
+			expected: &log.TerraformResourceInfo{Address: "module.master.yandex_compute_instance.master", Action: "create", Status: log.ResourceProgressInProgress, Elapsed: "10s"},
+		},
+		{
+			line:     "yandex_compute_instance.master: Creation complete after 42s [id=fhm2vb3b7mn]",
+			expected: &log.TerraformResourceInfo{Address: "yandex_compute_instance.master", Action: "create", Status: log.ResourceProgressComplete, Elapsed: "42s"},
+		},
+		{
+			line:     "yandex_vpc_subnet.kube_a: Destroying... [id=e9b]",
+			expected: &log.TerraformResourceInfo{Address: "yandex_vpc_subnet.kube_a", Action: "delete", Status: log.ResourceProgressStarted},
+		},
+		{
+			line:     "yandex_vpc_subnet.kube_a: Modifications complete after 1m2s [id=e9b]",
+			expected: &log.TerraformResourceInfo{Address: "yandex_vpc_subnet.kube_a", Action: "update", Status: log.ResourceProgressComplete, Elapsed: "1m2s"},
+		},
+		{line: "Apply complete! Resources: 1 added, 0 changed, 0 destroyed."},
+		{line: "Error: timeout while waiting for state to become 'RUNNING'"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			info, ok := parseResourceProgress(tc.line)
+			if tc.expected == nil {
+				require.False(t, ok)
+				return
+			}
+
+			require.True(t, ok)
+			require.Equal(t, *tc.expected, info)
+		})
+	}
+}
@@ -80,6 +80,7 @@ type Runner struct {
 
 	allowedCachedState bool
 	changesInPlan      int
+	resourceChanges    []ResourceChange
 
 	stateCache state.Cache
 
@@ -233,7 +234,7 @@ func (r *Runner) Init() error {
 
 	if r.statePath == "" {
 		// Save state directly in the cache to prevent state loss
-		stateName := r.stateName()
+		stateName := r.StateName()
 		r.statePath = r.stateCache.GetPath(stateName)
 
 		hasState, err := r.stateCache.InCache(stateName)
@@ -298,7 +299,8 @@ func (r *Runner) Init() error {
 	})
 }
 
-func (r *Runner) stateName() string {
+// StateName returns the key of the runner Terraform state in the state cache.
+func (r *Runner) StateName() string {
 	return fmt.Sprintf("%s.tfstate", r.name)
 }
 
@@ -437,6 +439,7 @@ func (r *Runner) Plan() error {
 
 		args = append(args, r.workingDir)
 
+		r.resourceChanges = nil
 		exitCode, err := r.execTerraform(args...)
 		if exitCode == terraformHasChangesExitCode {
 			r.changesInPlan = PlanHasChanges
@@ -591,13 +594,44 @@ func (r *Runner) execTerraform(args ...string) (int, error) {
 	r.switchTerraformIsRunning()
 	defer r.switchTerraformIsRunning()
 
+	if executor, ok := r.terraformExecutor.(*CMDExecutor); ok {
+		executor.layer = r.name
+	}
+
 	exitCode, err := r.terraformExecutor.Exec(args...)
 	log.InfoF("Terraform runner %q process exited.\n", r.step)
 
 	return exitCode, err
 }
 
+// ResourceChange is a change of one resource from the terraform plan.
+type ResourceChange struct {
+	Address     string   `json:"address"`
+	Type        string   `json:"type"`
+	Name        string   `json:"name"`
+	Actions     []string `json:"actions"`
+	Destructive bool     `json:"destructive"`
+}
+
 func (r *Runner) checkPlanDestructiveChanges(planFile string) (bool, error) {
+	changes, err := r.getPlanResourceChanges(planFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.resourceChanges = changes
+
+	for _, change := range changes {
+		if change.Destructive {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getPlanResourceChanges returns all resource changes from the plan except no-op.
+func (r *Runner) getPlanResourceChanges(planFile string) ([]ResourceChange, error) {
 	args := []string{
 		"show",
 		"-json",
@@ -610,12 +644,15 @@ func (r *Runner) checkPlanDestructiveChanges(planFile string) (bool, error) {
 		if ok := errors.As(err, &ee); ok {
 			err = fmt.Errorf("%s\n%v", string(ee.Stderr), err)
 		}
-		return false, fmt.Errorf("can't get terraform plan for %q\n%v", planFile, err)
+		return nil, fmt.Errorf("can't get terraform plan for %q\n%v", planFile, err)
 	}
 
 	var changes struct {
 		ResourcesChanges []struct {
-			Change struct {
+			Address string `json:"address"`
+			Type    string `json:"type"`
+			Name    string `json:"name"`
+			Change  struct {
 				Actions []string `json:"actions"`
 			} `json:"change"`
 		} `json:"resource_changes"`
@@ -623,18 +660,39 @@ func (r *Runner) checkPlanDestructiveChanges(planFile string) (bool, error) {
 
 	err = json.Unmarshal(result, &changes)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
+	resourceChanges := make([]ResourceChange, 0)
 	for _, resource := range changes.ResourcesChanges {
+		change := ResourceChange{
+			Address: resource.Address,
+			Type:    resource.Type,
+			Name:    resource.Name,
+			Actions: resource.Change.Actions,
+		}
+
+		noop := true
 		for _, action := range resource.Change.Actions {
 			if action == "delete" {
-				return true, nil
+				change.Destructive = true
 			}
+			if action != "no-op" && action != "read" {
+				noop = false
+			}
+		}
+
+		if !noop {
+			resourceChanges = append(resourceChanges, change)
 		}
 	}
 
-	return false, nil
+	return resourceChanges, nil
+}
+
+// ResourceChanges returns changes from the last plan.
+func (r *Runner) ResourceChanges() []ResourceChange {
+	return r.resourceChanges
 }
 
 func buildTerraformPath(provider, layout, step string) string {
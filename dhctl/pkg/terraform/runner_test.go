@@ -76,6 +76,29 @@ func TestCheckPlanDestructiveChanges(t *testing.T) {
 	}
 }
 
+func TestPlanResourceChanges(t *testing.T) {
+	data, err := os.ReadFile("./mocks/checkplan/destructively_changed.json")
+	require.NoError(t, err)
+
+	executor := &fakeExecutor{data: map[string]fakeResponse{
+		"show": {code: 0, resp: data},
+	}}
+
+	runner := newTestRunner().withTerraformExecutor(executor)
+
+	destructive, err := runner.checkPlanDestructiveChanges("")
+	require.NoError(t, err)
+	require.True(t, destructive)
+
+	require.Equal(t, []ResourceChange{{
+		Address:     "yandex_compute_instance.master",
+		Type:        "yandex_compute_instance",
+		Name:        "master",
+		Actions:     []string{"delete", "create"},
+		Destructive: true,
+	}}, runner.ResourceChanges())
+}
+
 func newTestRunnerWithChanges() *Runner {
 	r := NewRunner("a", "b", "c", "d", &cache.DummyCache{})
 	r.changesInPlan = PlanHasChanges
@@ -178,7 +178,7 @@ func (d *cacheDestination) SaveState(outputs *PipelineOutputs) error {
 		log.DebugF("state is empty. Skip\n")
 		return nil
 	}
-	name := d.runner.stateName()
+	name := d.runner.StateName()
 	log.DebugF("Intermediate save state %s in cache...\n", name)
 	err := d.runner.stateCache.Save(name, outputs.TerraformState)
 	msg := fmt.Sprintf("Intermediate state %s in cache was saved\n", name)
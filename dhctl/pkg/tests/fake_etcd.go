@@ -0,0 +1,189 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type fakeEtcdValue struct {
+	value       []byte
+	modRevision int64
+	lease       int64
+}
+
+// FakeEtcd is an in-memory etcd v3 JSON gateway with kv, txn and lease methods.
+type FakeEtcd struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	revision  int64
+	lastLease int64
+	leases    map[int64]struct{}
+	kvs       map[string]fakeEtcdValue
+}
+
+func NewFakeEtcd() *FakeEtcd {
+	f := &FakeEtcd{kvs: make(map[string]fakeEtcdValue), leases: make(map[int64]struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/kv/put", f.handler(f.put))
+	mux.HandleFunc("/v3/kv/range", f.handler(f.rangeKeys))
+	mux.HandleFunc("/v3/kv/deleterange", f.handler(f.deleteRange))
+	mux.HandleFunc("/v3/kv/txn", f.handler(f.txn))
+	mux.HandleFunc("/v3/lease/grant", f.handler(f.grant))
+	mux.HandleFunc("/v3/lease/keepalive", f.handler(f.keepAlive))
+	mux.HandleFunc("/v3/lease/revoke", f.handler(f.revoke))
+
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+// ExpireLeases drops all leases and attached keys as if dhctl was killed.
+func (f *FakeEtcd) ExpireLeases() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id := range f.leases {
+		f.dropLease(id)
+	}
+}
+
+type fakeEtcdRequest map[string]interface{}
+
+func (r fakeEtcdRequest) bytes(key string) []byte {
+	s, _ := r[key].(string)
+	b, _ := base64.StdEncoding.DecodeString(s)
+	return b
+}
+
+func (r fakeEtcdRequest) int(key string) int64 {
+	s, _ := r[key].(string)
+	i, _ := strconv.ParseInt(s, 10, 64)
+	return i
+}
+
+func (f *FakeEtcd) handler(fn func(req fakeEtcdRequest) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req fakeEtcdRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		resp := fn(req)
+		f.mu.Unlock()
+
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (f *FakeEtcd) put(req fakeEtcdRequest) interface{} {
+	f.revision++
+	f.kvs[string(req.bytes("key"))] = fakeEtcdValue{value: req.bytes("value"), modRevision: f.revision, lease: req.int("lease")}
+	return map[string]interface{}{}
+}
+
+func (f *FakeEtcd) keys(req fakeEtcdRequest) []string {
+	key := string(req.bytes("key"))
+	rangeEnd := string(req.bytes("range_end"))
+
+	keys := make([]string, 0)
+	for k := range f.kvs {
+		if (rangeEnd == "" && k == key) || (rangeEnd != "" && k >= key && k < rangeEnd) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *FakeEtcd) rangeKeys(req fakeEtcdRequest) interface{} {
+	kvs := make([]map[string]string, 0)
+	for _, k := range f.keys(req) {
+		v := f.kvs[k]
+		kvs = append(kvs, map[string]string{
+			"key":          base64.StdEncoding.EncodeToString([]byte(k)),
+			"value":        base64.StdEncoding.EncodeToString(v.value),
+			"mod_revision": strconv.FormatInt(v.modRevision, 10),
+		})
+	}
+	return map[string]interface{}{"kvs": kvs, "count": strconv.Itoa(len(kvs))}
+}
+
+func (f *FakeEtcd) deleteRange(req fakeEtcdRequest) interface{} {
+	for _, k := range f.keys(req) {
+		delete(f.kvs, k)
+	}
+	return map[string]interface{}{}
+}
+
+func (f *FakeEtcd) txn(req fakeEtcdRequest) interface{} {
+	compares, _ := req["compare"].([]interface{})
+	for _, c := range compares {
+		cmp := fakeEtcdRequest(c.(map[string]interface{}))
+		if f.kvs[string(cmp.bytes("key"))].modRevision != cmp.int("mod_revision") {
+			return map[string]interface{}{"succeeded": false}
+		}
+	}
+
+	success, _ := req["success"].([]interface{})
+	for _, op := range success {
+		op := op.(map[string]interface{})
+		if put, ok := op["request_put"]; ok {
+			f.put(put.(map[string]interface{}))
+		}
+		if del, ok := op["request_delete_range"]; ok {
+			f.deleteRange(del.(map[string]interface{}))
+		}
+	}
+	return map[string]interface{}{"succeeded": true}
+}
+
+func (f *FakeEtcd) grant(req fakeEtcdRequest) interface{} {
+	f.lastLease++
+	f.leases[f.lastLease] = struct{}{}
+	return map[string]string{"ID": strconv.FormatInt(f.lastLease, 10), "TTL": req["TTL"].(string)}
+}
+
+func (f *FakeEtcd) keepAlive(req fakeEtcdRequest) interface{} {
+	id := req.int("ID")
+	ttl := "0"
+	if _, ok := f.leases[id]; ok {
+		ttl = "60"
+	}
+	return map[string]interface{}{"result": map[string]string{"ID": strconv.FormatInt(id, 10), "TTL": ttl}}
+}
+
+func (f *FakeEtcd) revoke(req fakeEtcdRequest) interface{} {
+	f.dropLease(req.int("ID"))
+	return map[string]interface{}{}
+}
+
+func (f *FakeEtcd) dropLease(id int64) {
+	delete(f.leases, id)
+	for k, v := range f.kvs {
+		if v.lease == id {
+			delete(f.kvs, k)
+		}
+	}
+}
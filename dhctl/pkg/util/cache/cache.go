@@ -52,6 +52,15 @@ func NewStateCache(dir string) (*StateCache, error) {
 	return nil, fmt.Errorf("cache %s marked as exhausted", dir)
 }
 
+// OpenStateCache opens cache in specified directory even if it is marked as exhausted
+func OpenStateCache(dir string) (*StateCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("can't create cache directory: %w", err)
+	}
+
+	return &StateCache{dir: dir}, nil
+}
+
 // SaveStruct saves bytes to a file
 func (s *StateCache) Save(name string, content []byte) error {
 	if err := ioutil.WriteFile(s.GetPath(name), content, 0o600); err != nil {
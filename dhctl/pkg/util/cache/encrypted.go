@@ -0,0 +1,237 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	encryptedFormatVersion = 1
+	encryptionSaltFile     = "salt"
+	encryptionCheckFile    = "key-check"
+	encryptionCheckValue   = "dhctl"
+)
+
+// EncryptedStateCache keeps every key encrypted with AES-256-GCM in the local directory.
+// The key is derived from the passphrase with scrypt, salt is stored next to the state.
+// Terraform works with decrypted copies of the states in the tmpDir.
+type EncryptedStateCache struct {
+	dir    string
+	tmpDir string
+	store  *StateCache
+	aead   cipher.AEAD
+}
+
+func NewEncryptedStateCache(dir, tmpDir, passphrase string) (*EncryptedStateCache, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("encryption key for the cache is empty")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create cache directory: %w", err)
+	}
+	if err := os.MkdirAll(tmpDir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create cache directory: %w", err)
+	}
+
+	salt, err := loadOrCreateSalt(filepath.Join(dir, encryptionSaltFile))
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("can't derive encryption key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := OpenStateCache(filepath.Join(dir, "state"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &EncryptedStateCache{dir: dir, tmpDir: tmpDir, store: store, aead: aead}
+	if err := c.checkKey(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func loadOrCreateSalt(path string) ([]byte, error) {
+	salt, err := ioutil.ReadFile(path)
+	if err == nil {
+		return salt, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("can't read cache salt: %v", err)
+	}
+
+	salt = make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, salt, 0o600); err != nil {
+		return nil, fmt.Errorf("can't save cache salt: %v", err)
+	}
+	return salt, nil
+}
+
+// checkKey prevents mixing states encrypted with different keys in one cache.
+func (c *EncryptedStateCache) checkKey() error {
+	path := filepath.Join(c.dir, encryptionCheckFile)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		encrypted, err := c.encrypt([]byte(encryptionCheckValue))
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, encrypted, 0o600)
+	}
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := c.decrypt(content)
+	if err != nil || string(decrypted) != encryptionCheckValue {
+		return fmt.Errorf("cache %s was encrypted with another key", c.dir)
+	}
+	return nil
+}
+
+func (c *EncryptedStateCache) encrypt(content []byte) ([]byte, error) {
+	// empty values are markers (e.g. tombstone), keep them as is
+	if len(content) == 0 {
+		return content, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{encryptedFormatVersion}, nonce...)
+	return c.aead.Seal(out, nonce, content, nil), nil
+}
+
+func (c *EncryptedStateCache) decrypt(content []byte) ([]byte, error) {
+	if len(content) == 0 {
+		return content, nil
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if content[0] != encryptedFormatVersion || len(content) < 1+nonceSize {
+		return nil, fmt.Errorf("unknown format of the encrypted value")
+	}
+
+	nonce := content[1 : 1+nonceSize]
+	return c.aead.Open(nil, nonce, content[1+nonceSize:], nil)
+}
+
+func (c *EncryptedStateCache) Save(name string, content []byte) error {
+	encrypted, err := c.encrypt(content)
+	if err != nil {
+		return fmt.Errorf("can't encrypt %s: %v", name, err)
+	}
+	return c.store.Save(name, encrypted)
+}
+
+func (c *EncryptedStateCache) SaveStruct(name string, v interface{}) error {
+	b := new(bytes.Buffer)
+	err := gob.NewEncoder(b).Encode(v)
+	if err != nil {
+		return err
+	}
+
+	return c.Save(name, b.Bytes())
+}
+
+func (c *EncryptedStateCache) Load(name string) ([]byte, error) {
+	content, err := c.store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := c.decrypt(content)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt %s: %v", name, err)
+	}
+	return decrypted, nil
+}
+
+func (c *EncryptedStateCache) LoadStruct(name string, v interface{}) error {
+	d, err := c.Load(name)
+	if err != nil {
+		return fmt.Errorf("can't load struct for key %s: %v", name, err)
+	}
+
+	return gob.NewDecoder(bytes.NewBuffer(d)).Decode(v)
+}
+
+func (c *EncryptedStateCache) InCache(name string) (bool, error) {
+	return c.store.InCache(name)
+}
+
+func (c *EncryptedStateCache) Delete(name string) {
+	c.store.Delete(name)
+	_ = os.Remove(c.GetPath(name))
+}
+
+func (c *EncryptedStateCache) Clean() {
+	c.store.Clean()
+}
+
+func (c *EncryptedStateCache) CleanWithExceptions(excludeKeys ...string) {
+	c.store.CleanWithExceptions(excludeKeys...)
+}
+
+func (c *EncryptedStateCache) GetPath(name string) string {
+	return filepath.Join(c.tmpDir, name)
+}
+
+func (c *EncryptedStateCache) Iterate(iterFunc func(string, []byte) error) error {
+	return c.store.Iterate(func(name string, content []byte) error {
+		decrypted, err := c.decrypt(content)
+		if err != nil {
+			return fmt.Errorf("can't decrypt %s: %v", name, err)
+		}
+		return iterFunc(name, decrypted)
+	})
+}
+
+func (c *EncryptedStateCache) NeedIntermediateSave() bool {
+	// terraform writes decrypted state into the tmp dir, it should be encrypted after every change
+	return true
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/tests"
+)
+
+func TestEncryptedStateCache(t *testing.T) {
+	log.InitLogger("simple")
+
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-encrypted-cache-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheDir := filepath.Join(dir, "cache")
+	tmpDir := filepath.Join(dir, "tmp")
+
+	t.Run("Save load delete operations", func(t *testing.T) {
+		stateCache, err := NewEncryptedStateCache(cacheDir, tmpDir, "secret")
+		require.NoError(t, err)
+
+		tests.RunStateCacheTests(t, stateCache)
+		stateCache.Delete(".tombstone")
+	})
+
+	t.Run("Values are encrypted on disk", func(t *testing.T) {
+		stateCache, err := NewEncryptedStateCache(cacheDir, tmpDir, "secret")
+		require.NoError(t, err)
+
+		require.NoError(t, stateCache.Save("base-infrastructure.tfstate", []byte(`{"secret": "value"}`)))
+
+		content, err := ioutil.ReadFile(filepath.Join(cacheDir, "state", "base-infrastructure.tfstate"))
+		require.NoError(t, err)
+		require.NotContains(t, string(content), "secret")
+
+		loaded, err := stateCache.Load("base-infrastructure.tfstate")
+		require.NoError(t, err)
+		require.Equal(t, `{"secret": "value"}`, string(loaded))
+	})
+
+	t.Run("Wrong key is rejected", func(t *testing.T) {
+		_, err := NewEncryptedStateCache(cacheDir, tmpDir, "another")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "encrypted with another key")
+	})
+
+	t.Run("Empty key is rejected", func(t *testing.T) {
+		_, err := NewEncryptedStateCache(cacheDir, tmpDir, "")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,263 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/etcd"
+)
+
+const (
+	EtcdLockLeaseTTL       = 60 * time.Second
+	EtcdLockRenewInterval  = 20 * time.Second
+	etcdLockKeySuffix      = ".lock"
+	etcdKeySeparator       = "/"
+	etcdLockDescriptionFmt = "locked by '%s' since %s"
+)
+
+// EtcdStateCache stores every key as <prefix>/<key> in etcd.
+// Lock key <prefix>.lock is attached to the lease, so it disappears if dhctl dies.
+type EtcdStateCache struct {
+	client  *etcd.Client
+	prefix  string
+	lockKey string
+	tmpDir  string
+
+	lockMutex   sync.Mutex
+	leaseID     int64
+	stopRenewCh chan struct{}
+}
+
+type etcdLockInfo struct {
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+}
+
+func NewEtcdStateCache(client *etcd.Client, prefix, tmpDir string) (*EtcdStateCache, error) {
+	if err := os.MkdirAll(tmpDir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create cache directory: %w", err)
+	}
+
+	prefix = strings.TrimSuffix(prefix, etcdKeySeparator)
+
+	return &EtcdStateCache{
+		client:  client,
+		prefix:  prefix + etcdKeySeparator,
+		lockKey: prefix + etcdLockKeySuffix,
+		tmpDir:  tmpDir,
+	}, nil
+}
+
+// Lock creates lock key only if it does not exist and keeps its lease alive in background.
+func (s *EtcdStateCache) Lock(owner string) error {
+	s.lockMutex.Lock()
+	defer s.lockMutex.Unlock()
+
+	content, err := json.Marshal(etcdLockInfo{Owner: owner, AcquiredAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	leaseID, err := s.client.GrantLease(EtcdLockLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("lock state cache %s: %v", s.lockKey, err)
+	}
+
+	ok, err := s.client.PutIfModRevision(s.lockKey, content, 0, leaseID)
+	if err != nil || !ok {
+		_ = s.client.RevokeLease(leaseID)
+	}
+	if err != nil {
+		return fmt.Errorf("lock state cache %s: %v", s.lockKey, err)
+	}
+	if !ok {
+		return fmt.Errorf("lock state cache %s: %s", s.lockKey, s.lockDescription())
+	}
+
+	log.DebugF("State cache %s locked by %s\n", s.lockKey, owner)
+
+	s.leaseID = leaseID
+	s.stopRenewCh = make(chan struct{})
+	go s.renewLock(leaseID, s.stopRenewCh)
+
+	return nil
+}
+
+func (s *EtcdStateCache) lockDescription() string {
+	kv, err := s.client.Get(s.lockKey)
+	if err != nil || kv == nil {
+		return "locked"
+	}
+
+	var info etcdLockInfo
+	if err := json.Unmarshal(kv.Value, &info); err != nil {
+		return "locked"
+	}
+	return fmt.Sprintf(etcdLockDescriptionFmt, info.Owner, info.AcquiredAt.Format(time.RFC3339))
+}
+
+func (s *EtcdStateCache) renewLock(leaseID int64, stopCh chan struct{}) {
+	t := time.NewTicker(EtcdLockRenewInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-t.C:
+		}
+
+		if err := s.client.KeepAliveLease(leaseID); err != nil {
+			log.WarnF("Cannot renew state cache lock: %v\n", err)
+		}
+	}
+}
+
+// Unlock revokes the lease, lock key is deleted by etcd.
+func (s *EtcdStateCache) Unlock() {
+	s.lockMutex.Lock()
+	defer s.lockMutex.Unlock()
+
+	if s.stopRenewCh == nil {
+		return
+	}
+	close(s.stopRenewCh)
+	s.stopRenewCh = nil
+
+	if err := s.client.RevokeLease(s.leaseID); err != nil {
+		log.WarnF("Cannot unlock state cache: %v\n", err)
+	}
+}
+
+func (s *EtcdStateCache) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *EtcdStateCache) Save(name string, content []byte) error {
+	return s.client.Put(s.key(name), content)
+}
+
+func (s *EtcdStateCache) SaveStruct(name string, v interface{}) error {
+	b := new(bytes.Buffer)
+	err := gob.NewEncoder(b).Encode(v)
+	if err != nil {
+		return err
+	}
+
+	return s.Save(name, b.Bytes())
+}
+
+func (s *EtcdStateCache) Load(name string) ([]byte, error) {
+	kv, err := s.client.Get(s.key(name))
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, fmt.Errorf("key %s not found in cache", name)
+	}
+	return kv.Value, nil
+}
+
+func (s *EtcdStateCache) LoadStruct(name string, v interface{}) error {
+	d, err := s.Load(name)
+	if err != nil {
+		return fmt.Errorf("can't load struct for key %s: %v", name, err)
+	}
+
+	return gob.NewDecoder(bytes.NewBuffer(d)).Decode(v)
+}
+
+func (s *EtcdStateCache) InCache(name string) (bool, error) {
+	kv, err := s.client.Get(s.key(name))
+	if err != nil {
+		return false, err
+	}
+	return kv != nil, nil
+}
+
+func (s *EtcdStateCache) Delete(name string) {
+	if err := s.client.Delete(s.key(name)); err != nil {
+		log.ErrorF("Cannot delete cache %s val %v\n", name, err)
+	}
+}
+
+func (s *EtcdStateCache) Clean() {
+	s.CleanWithExceptions()
+}
+
+func (s *EtcdStateCache) CleanWithExceptions(excludeKeys ...string) {
+	excludeKeysSet := map[string]struct{}{}
+	for _, k := range excludeKeys {
+		excludeKeysSet[k] = struct{}{}
+	}
+
+	kvs, err := s.client.List(s.prefix)
+	if err != nil {
+		log.WarnF("Can't getting keys to remove: %s ...\n", err)
+		return
+	}
+
+	// yes first write tombstone that is idempotent
+	if err := s.Save(state.TombstoneKey, []byte("yes")); err != nil {
+		log.WarnF("Can't mark the cache as exhausted: %s ...\n", err)
+	}
+
+	for _, kv := range kvs {
+		key := strings.TrimPrefix(kv.Key, s.prefix)
+		if _, ok := excludeKeysSet[key]; ok || key == state.TombstoneKey {
+			continue
+		}
+		s.Delete(key)
+	}
+}
+
+func (s *EtcdStateCache) GetPath(name string) string {
+	return filepath.Join(s.tmpDir, name)
+}
+
+func (s *EtcdStateCache) Iterate(iterFunc func(string, []byte) error) error {
+	kvs, err := s.client.List(s.prefix)
+	if err != nil {
+		return fmt.Errorf("can't iterate the cache: %w", err)
+	}
+
+	for _, kv := range kvs {
+		key := strings.TrimPrefix(kv.Key, s.prefix)
+		if strings.Contains(key, etcdKeySeparator) {
+			continue
+		}
+		if err := iterFunc(key, kv.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *EtcdStateCache) NeedIntermediateSave() bool {
+	// terraform works with the local copy of the state in the tmp dir
+	return true
+}
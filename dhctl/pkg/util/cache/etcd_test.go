@@ -0,0 +1,88 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/tests"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/etcd"
+)
+
+func newTestEtcdCache(t *testing.T, server *tests.FakeEtcd, prefix string) *EtcdStateCache {
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-etcd-cache-*")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	client, err := etcd.NewClient(etcd.Config{Endpoints: []string{server.URL}})
+	require.NoError(t, err)
+
+	stateCache, err := NewEtcdStateCache(client, prefix, dir)
+	require.NoError(t, err)
+	return stateCache
+}
+
+func TestEtcdStateCache(t *testing.T) {
+	log.InitLogger("simple")
+
+	server := tests.NewFakeEtcd()
+	defer server.Close()
+
+	t.Run("Save load delete operations", func(t *testing.T) {
+		stateCache := newTestEtcdCache(t, server, "/dhctl/test")
+
+		// keys of the cache with the same prefix should not be visible
+		neighbour := newTestEtcdCache(t, server, "/dhctl/test-2")
+		require.NoError(t, neighbour.Save("neighbour", []byte("value")))
+
+		tests.RunStateCacheTests(t, stateCache)
+
+		ok, err := neighbour.InCache("neighbour")
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("Lock prevents simultaneous usage", func(t *testing.T) {
+		first := newTestEtcdCache(t, server, "/dhctl/lock")
+		second := newTestEtcdCache(t, server, "/dhctl/lock")
+
+		require.NoError(t, first.Lock("first"))
+
+		err := second.Lock("second")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "locked by 'first'")
+
+		first.Unlock()
+
+		require.NoError(t, second.Lock("second"))
+		second.Unlock()
+	})
+
+	t.Run("Lock is released when lease expires", func(t *testing.T) {
+		first := newTestEtcdCache(t, server, "/dhctl/lease")
+		second := newTestEtcdCache(t, server, "/dhctl/lease")
+
+		require.NoError(t, first.Lock("first"))
+		server.ExpireLeases()
+
+		require.NoError(t, second.Lock("second"))
+		second.Unlock()
+	})
+}
@@ -0,0 +1,295 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/state"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/s3"
+)
+
+const (
+	S3LockLeaseDuration = 5 * time.Minute
+	S3LockRenewInterval = 1 * time.Minute
+)
+
+// S3StateCache stores every key as an object <prefix>/<key> in the S3-compatible bucket.
+// Lock object <prefix>.lock is created with conditional writes to prevent simultaneous usage of the cache.
+type S3StateCache struct {
+	client  *s3.Client
+	prefix  string
+	lockKey string
+	tmpDir  string
+
+	lockMutex    sync.Mutex
+	lockETag     string
+	lockOwner    string
+	stopRenewCh  chan struct{}
+	leaseTimeout time.Duration
+}
+
+type s3LockInfo struct {
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+func NewS3StateCache(client *s3.Client, prefix, tmpDir string) (*S3StateCache, error) {
+	if err := os.MkdirAll(tmpDir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create cache directory: %w", err)
+	}
+
+	prefix = strings.Trim(prefix, "/")
+
+	return &S3StateCache{
+		client:       client,
+		prefix:       prefix + "/",
+		lockKey:      prefix + ".lock",
+		tmpDir:       tmpDir,
+		leaseTimeout: S3LockLeaseDuration,
+	}, nil
+}
+
+// Lock creates lock object only if it does not exist or is expired and renews it in background.
+func (s *S3StateCache) Lock(owner string) error {
+	s.lockMutex.Lock()
+	defer s.lockMutex.Unlock()
+
+	info := s3LockInfo{Owner: owner, AcquiredAt: time.Now().UTC()}
+	info.ExpiresAt = info.AcquiredAt.Add(s.leaseTimeout)
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	etag, err := s.client.Put(s.lockKey, content, s3.Conditions{IfNoneMatch: "*"})
+	if errors.Is(err, s3.ErrPreconditionFailed) {
+		etag, err = s.takeOverLock(owner, content)
+	}
+	if err != nil {
+		return fmt.Errorf("lock state cache s3://%s/%s: %w", s.client.Bucket(), s.lockKey, err)
+	}
+
+	log.DebugF("State cache s3://%s/%s locked by %s\n", s.client.Bucket(), s.lockKey, owner)
+
+	s.lockETag = etag
+	s.lockOwner = owner
+	s.stopRenewCh = make(chan struct{})
+	go s.renewLock(s.stopRenewCh)
+
+	return nil
+}
+
+// takeOverLock replaces lock object if it is expired. If-Match guarantees that nobody did it at the same time.
+func (s *S3StateCache) takeOverLock(owner string, content []byte) (string, error) {
+	current, etag, err := s.client.Get(s.lockKey)
+	if errors.Is(err, s3.ErrNotFound) {
+		// lock was released right now
+		return s.client.Put(s.lockKey, content, s3.Conditions{IfNoneMatch: "*"})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var info s3LockInfo
+	if err := json.Unmarshal(current, &info); err != nil {
+		return "", fmt.Errorf("cannot parse lock: %v", err)
+	}
+
+	if info.Owner != owner && time.Now().Before(info.ExpiresAt) {
+		return "", fmt.Errorf("locked by '%s' since %s until %s", info.Owner, info.AcquiredAt.Format(time.RFC3339), info.ExpiresAt.Format(time.RFC3339))
+	}
+
+	log.WarnF("Take over expired state cache lock of '%s'\n", info.Owner)
+	newETag, err := s.client.Put(s.lockKey, content, s3.Conditions{IfMatch: etag})
+	if errors.Is(err, s3.ErrPreconditionFailed) {
+		return "", fmt.Errorf("lock was taken by someone else")
+	}
+	return newETag, err
+}
+
+func (s *S3StateCache) renewLock(stopCh chan struct{}) {
+	t := time.NewTicker(S3LockRenewInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-t.C:
+		}
+
+		s.lockMutex.Lock()
+		now := time.Now().UTC()
+		content, _ := json.Marshal(s3LockInfo{Owner: s.lockOwner, AcquiredAt: now, ExpiresAt: now.Add(s.leaseTimeout)})
+		etag, err := s.client.Put(s.lockKey, content, s3.Conditions{IfMatch: s.lockETag})
+		if err != nil {
+			log.WarnF("Cannot renew state cache lock: %v\n", err)
+		} else {
+			s.lockETag = etag
+		}
+		s.lockMutex.Unlock()
+	}
+}
+
+// Unlock deletes lock object if it is still owned.
+func (s *S3StateCache) Unlock() {
+	s.lockMutex.Lock()
+	defer s.lockMutex.Unlock()
+
+	if s.stopRenewCh == nil {
+		return
+	}
+	close(s.stopRenewCh)
+	s.stopRenewCh = nil
+
+	_, etag, err := s.client.Get(s.lockKey)
+	if err != nil || etag != s.lockETag {
+		log.WarnF("State cache lock was lost, skip unlocking: %v\n", err)
+		return
+	}
+
+	if err := s.client.Delete(s.lockKey); err != nil {
+		log.WarnF("Cannot unlock state cache: %v\n", err)
+	}
+}
+
+func (s *S3StateCache) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *S3StateCache) Save(name string, content []byte) error {
+	_, err := s.client.Put(s.key(name), content, s3.Conditions{})
+	return err
+}
+
+func (s *S3StateCache) SaveStruct(name string, v interface{}) error {
+	b := new(bytes.Buffer)
+	err := gob.NewEncoder(b).Encode(v)
+	if err != nil {
+		return err
+	}
+
+	return s.Save(name, b.Bytes())
+}
+
+func (s *S3StateCache) Load(name string) ([]byte, error) {
+	content, _, err := s.client.Get(s.key(name))
+	return content, err
+}
+
+func (s *S3StateCache) LoadStruct(name string, v interface{}) error {
+	d, err := s.Load(name)
+	if err != nil {
+		return fmt.Errorf("can't load struct for key %s: %v", name, err)
+	}
+
+	return gob.NewDecoder(bytes.NewBuffer(d)).Decode(v)
+}
+
+func (s *S3StateCache) InCache(name string) (bool, error) {
+	return s.client.Exists(s.key(name))
+}
+
+func (s *S3StateCache) Delete(name string) {
+	if err := s.client.Delete(s.key(name)); err != nil {
+		log.ErrorF("Cannot delete cache %s val %v\n", name, err)
+	}
+}
+
+func (s *S3StateCache) Clean() {
+	s.CleanWithExceptions()
+}
+
+func (s *S3StateCache) CleanWithExceptions(excludeKeys ...string) {
+	excludeKeysSet := map[string]struct{}{}
+	for _, k := range excludeKeys {
+		excludeKeysSet[k] = struct{}{}
+	}
+
+	keys, err := s.keys()
+	if err != nil {
+		log.WarnF("Can't getting keys to remove: %s ...\n", err)
+		return
+	}
+
+	// yes first write tombstone that is idempotent
+	if err := s.Save(state.TombstoneKey, []byte("yes")); err != nil {
+		log.WarnF("Can't mark the cache as exhausted: %s ...\n", err)
+	}
+
+	for _, key := range keys {
+		if _, ok := excludeKeysSet[key]; ok || key == state.TombstoneKey {
+			continue
+		}
+		s.Delete(key)
+	}
+}
+
+func (s *S3StateCache) GetPath(name string) string {
+	return filepath.Join(s.tmpDir, name)
+}
+
+func (s *S3StateCache) Iterate(iterFunc func(string, []byte) error) error {
+	keys, err := s.keys()
+	if err != nil {
+		return fmt.Errorf("can't iterate the cache: %w", err)
+	}
+
+	for _, key := range keys {
+		content, err := s.Load(key)
+		if err != nil {
+			return fmt.Errorf("can't load %s: %w", key, err)
+		}
+		if err := iterFunc(key, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *S3StateCache) NeedIntermediateSave() bool {
+	// terraform works with the local copy of the state in the tmp dir
+	return true
+}
+
+func (s *S3StateCache) keys() ([]string, error) {
+	objects, err := s.client.List(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		key := strings.TrimPrefix(obj, s.prefix)
+		if key == "" || strings.Contains(key, "/") {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/dhctl/pkg/log"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/tests"
+	"github.com/deckhouse/deckhouse/dhctl/pkg/util/s3"
+)
+
+func newTestS3Cache(t *testing.T, server *tests.FakeS3) *S3StateCache {
+	dir, err := ioutil.TempDir(os.TempDir(), "dhctl-test-s3-cache-*")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	client, err := s3.NewClient(s3.Config{Endpoint: server.URL, Bucket: "states"})
+	require.NoError(t, err)
+
+	stateCache, err := NewS3StateCache(client, "/clusters/test/", dir)
+	require.NoError(t, err)
+	return stateCache
+}
+
+func TestS3StateCache(t *testing.T) {
+	log.InitLogger("simple")
+
+	server := tests.NewFakeS3()
+	defer server.Close()
+
+	t.Run("Save load delete operations", func(t *testing.T) {
+		stateCache := newTestS3Cache(t, server)
+
+		tests.RunStateCacheTests(t, stateCache)
+
+		content, ok := server.Object("states", "clusters/test/b")
+		require.True(t, ok)
+		require.Equal(t, "b-test", string(content))
+	})
+
+	t.Run("Lock prevents simultaneous usage", func(t *testing.T) {
+		first := newTestS3Cache(t, server)
+		second := newTestS3Cache(t, server)
+
+		require.NoError(t, first.Lock("first"))
+
+		err := second.Lock("second")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "locked by 'first'")
+
+		first.Unlock()
+		_, ok := server.Object("states", "clusters/test.lock")
+		require.False(t, ok)
+
+		require.NoError(t, second.Lock("second"))
+		second.Unlock()
+	})
+
+	t.Run("Expired lock is taken over", func(t *testing.T) {
+		first := newTestS3Cache(t, server)
+		first.leaseTimeout = -time.Minute
+		second := newTestS3Cache(t, server)
+
+		require.NoError(t, first.Lock("first"))
+		require.NoError(t, second.Lock("second"))
+
+		// first lost the lock and should not remove lock of the second
+		first.Unlock()
+		_, ok := server.Object("states", "clusters/test.lock")
+		require.True(t, ok)
+
+		second.Unlock()
+	})
+}
@@ -0,0 +1,331 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Endpoints are base URLs of etcd members, e.g. https://10.0.0.1:2379.
+	Endpoints []string
+	Username  string
+	Password  string
+	// CAFile is used to verify etcd members certificates.
+	CAFile string
+}
+
+// Client talks to etcd via its v3 JSON gateway.
+// It supports only operations that are needed to store small values.
+type Client struct {
+	config Config
+	http   *http.Client
+
+	tokenMutex sync.Mutex
+	token      string
+}
+
+type KeyValue struct {
+	Key            string
+	Value          []byte
+	CreateRevision int64
+	ModRevision    int64
+}
+
+func NewClient(config Config) (*Client, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd endpoints are required")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		ca, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read etcd CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	for i, e := range config.Endpoints {
+		config.Endpoints[i] = strings.TrimSuffix(e, "/")
+	}
+
+	return &Client{
+		config: config,
+		http:   &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// Get returns value of the key or nil if the key does not exist.
+func (c *Client) Get(key string) (*KeyValue, error) {
+	kvs, err := c.rangeKeys(key, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	return &kvs[0], nil
+}
+
+// List returns all keys with the prefix sorted by key.
+func (c *Client) List(prefix string) ([]KeyValue, error) {
+	return c.rangeKeys(prefix, prefixRangeEnd(prefix))
+}
+
+func (c *Client) Put(key string, value []byte) error {
+	return c.call("/v3/kv/put", map[string]interface{}{
+		"key":   encode(key),
+		"value": base64.StdEncoding.EncodeToString(value),
+	}, nil)
+}
+
+func (c *Client) Delete(key string) error {
+	return c.call("/v3/kv/deleterange", map[string]interface{}{
+		"key": encode(key),
+	}, nil)
+}
+
+// PutIfModRevision writes the key only if its mod revision is equal to modRevision.
+// Zero revision means that the key should not exist. Lease is attached to the key if it is not zero.
+// Returns false if the condition is not met.
+func (c *Client) PutIfModRevision(key string, value []byte, modRevision, lease int64) (bool, error) {
+	put := map[string]interface{}{
+		"key":   encode(key),
+		"value": base64.StdEncoding.EncodeToString(value),
+	}
+	if lease != 0 {
+		put["lease"] = strconv.FormatInt(lease, 10)
+	}
+
+	var resp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err := c.call("/v3/kv/txn", map[string]interface{}{
+		"compare": []map[string]interface{}{{
+			"key":          encode(key),
+			"target":       "MOD",
+			"result":       "EQUAL",
+			"mod_revision": strconv.FormatInt(modRevision, 10),
+		}},
+		"success": []map[string]interface{}{{"request_put": put}},
+	}, &resp)
+	return resp.Succeeded, err
+}
+
+// GrantLease creates lease with ttl and returns its id.
+func (c *Client) GrantLease(ttl time.Duration) (int64, error) {
+	var resp struct {
+		ID string `json:"ID"`
+	}
+	err := c.call("/v3/lease/grant", map[string]interface{}{"TTL": strconv.Itoa(int(ttl.Seconds()))}, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(resp.ID, 10, 64)
+}
+
+// KeepAliveLease renews lease once.
+func (c *Client) KeepAliveLease(id int64) error {
+	var resp struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	err := c.call("/v3/lease/keepalive", map[string]interface{}{"ID": strconv.FormatInt(id, 10)}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Result.TTL == "" || resp.Result.TTL == "0" {
+		return fmt.Errorf("lease %d expired", id)
+	}
+	return nil
+}
+
+func (c *Client) RevokeLease(id int64) error {
+	return c.call("/v3/lease/revoke", map[string]interface{}{"ID": strconv.FormatInt(id, 10)}, nil)
+}
+
+func (c *Client) rangeKeys(key, rangeEnd string) ([]KeyValue, error) {
+	req := map[string]interface{}{
+		"key":         encode(key),
+		"sort_order":  "ASCEND",
+		"sort_target": "KEY",
+	}
+	if rangeEnd != "" {
+		req["range_end"] = encode(rangeEnd)
+	}
+
+	var resp struct {
+		Kvs []struct {
+			Key            string `json:"key"`
+			Value          string `json:"value"`
+			CreateRevision string `json:"create_revision"`
+			ModRevision    string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	if err := c.call("/v3/kv/range", req, &resp); err != nil {
+		return nil, err
+	}
+
+	result := make([]KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		k, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		createRev, _ := strconv.ParseInt(kv.CreateRevision, 10, 64)
+		modRev, _ := strconv.ParseInt(kv.ModRevision, 10, 64)
+		result = append(result, KeyValue{Key: string(k), Value: v, CreateRevision: createRev, ModRevision: modRev})
+	}
+	return result, nil
+}
+
+// call sends request to the endpoints one by one until one of them answers.
+func (c *Client) call(path string, req interface{}, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, endpoint := range c.config.Endpoints {
+		var data []byte
+		data, lastErr = c.post(endpoint, path, body)
+		if lastErr != nil {
+			continue
+		}
+		if resp == nil {
+			return nil
+		}
+		return json.Unmarshal(data, resp)
+	}
+	return lastErr
+}
+
+func (c *Client) post(endpoint, path string, body []byte) ([]byte, error) {
+	token, err := c.authToken(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("POST %s%s: %v", endpoint, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		_ = json.Unmarshal(data, &errResp)
+		msg := errResp.Message
+		if msg == "" {
+			msg = errResp.Error
+		}
+		if msg == "" {
+			msg = resp.Status
+		}
+		return nil, fmt.Errorf("POST %s%s: %s", endpoint, path, msg)
+	}
+
+	return bytes.TrimSpace(data), nil
+}
+
+func (c *Client) authToken(endpoint string) (string, error) {
+	if c.config.Username == "" {
+		return "", nil
+	}
+
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	if c.token != "" {
+		return c.token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"name": c.config.Username, "password": c.config.Password})
+	resp, err := c.http.Post(endpoint+"/v3/auth/authenticate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("authenticate in etcd: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("authenticate in etcd: %s", resp.Status)
+	}
+
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return "", err
+	}
+	c.token = auth.Token
+	return c.token, nil
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// prefixRangeEnd returns the key following the last key with the prefix.
+func prefixRangeEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	// all keys after prefix
+	return "\x00"
+}
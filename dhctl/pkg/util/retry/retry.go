@@ -117,6 +117,7 @@ func (l *Loop) Run(task func() error) error {
 
 			l.logger.LogFail(fmt.Sprintf(attemptMessage, i, l.attemptsQuantity, l.name, l.waitTime))
 			l.logger.LogInfoF("\tError: %v\n\n", err)
+			log.EmitRetryAttempt(l.name, i, l.attemptsQuantity, l.waitTime, err)
 
 			// Do not waitTime after the last iteration.
 			if i < l.attemptsQuantity {
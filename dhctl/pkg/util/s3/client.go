@@ -0,0 +1,284 @@
+// Copyright 2021 Flant JSC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultRegion = "us-east-1"
+
+var (
+	ErrNotFound           = errors.New("object not found")
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads credentials from the standard AWS environment variables.
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+type Config struct {
+	// Endpoint is a base URL of the S3-compatible storage, e.g. https://storage.yandexcloud.net.
+	Endpoint    string
+	Region      string
+	Bucket      string
+	Credentials Credentials
+}
+
+// Client is a minimal S3 client with path-style addressing.
+// It supports only operations that are needed to store small objects.
+type Client struct {
+	config   Config
+	endpoint *url.URL
+	http     *http.Client
+}
+
+func NewClient(config Config) (*Client, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = DefaultRegion
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint '%s': %v", config.Endpoint, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("endpoint '%s' should be http or https URL", config.Endpoint)
+	}
+
+	return &Client{
+		config:   config,
+		endpoint: endpoint,
+		http:     &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (c *Client) Bucket() string {
+	return c.config.Bucket
+}
+
+// Conditions are sent as If-Match and If-None-Match headers.
+// Use IfNoneMatch: "*" to create an object only if it does not exist.
+type Conditions struct {
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// Get returns object content and its ETag.
+func (c *Client) Get(key string) ([]byte, string, error) {
+	resp, err := c.do(http.MethodGet, key, nil, nil, Conditions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, key); err != nil {
+		return nil, "", err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("read object '%s': %v", key, err)
+	}
+
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// Exists checks if object exists.
+func (c *Client) Exists(key string) (bool, error) {
+	resp, err := c.do(http.MethodHead, key, nil, nil, Conditions{})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Put uploads the object and returns its new ETag.
+// ErrPreconditionFailed is returned if conditions are not met.
+func (c *Client) Put(key string, data []byte, cond Conditions) (string, error) {
+	resp, err := c.do(http.MethodPut, key, nil, data, cond)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, key); err != nil {
+		return "", err
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// Delete removes the object. Removing of non-existent object is not an error.
+func (c *Client) Delete(key string) error {
+	resp, err := c.do(http.MethodDelete, key, nil, nil, Conditions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns keys of all objects with the prefix in lexicographical order.
+func (c *Client) List(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := c.do(http.MethodGet, "", query, nil, Conditions{})
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = checkResponse(resp, prefix)
+		if err == nil {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list objects with prefix '%s': %v", prefix, err)
+		}
+
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (c *Client) do(method, key string, query url.Values, body []byte, cond Conditions) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.config.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = encodePath(u.Path)
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if cond.IfMatch != "" {
+		req.Header.Set("If-Match", cond.IfMatch)
+	}
+	if cond.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", cond.IfNoneMatch)
+	}
+
+	signRequest(req, c.config.Credentials, c.config.Region, hashHex(body), time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v", method, u.Path, err)
+	}
+	return resp, nil
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func checkResponse(resp *http.Response, key string) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("'%s': %w", key, ErrNotFound)
+	case resp.StatusCode == http.StatusPreconditionFailed, resp.StatusCode == http.StatusConflict:
+		// 409 is returned by some storages on concurrent conditional writes
+		return fmt.Errorf("'%s': %w", key, ErrPreconditionFailed)
+	}
+
+	var errResp errorResponse
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := xml.Unmarshal(body, &errResp); err == nil && errResp.Code != "" {
+		return fmt.Errorf("'%s': %s: %s", key, errResp.Code, errResp.Message)
+	}
+	return fmt.Errorf("'%s': unexpected status %s", key, resp.Status)
+}
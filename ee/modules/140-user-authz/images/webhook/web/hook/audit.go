@@ -0,0 +1,132 @@
+/*
+Copyright 2022 Flant JSC
+Licensed under the Deckhouse Platform Enterprise Edition (EE) license. See https://github.com/deckhouse/deckhouse/blob/main/ee/LICENSE
+*/
+
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Checks of the webhook that can decide on a request
+const (
+	decidedByNoRules               = "NoRules"
+	decidedByNonResourceRequest    = "NonResourceRequest"
+	decidedByNoNamespaceLimits     = "NoNamespaceLimits"
+	decidedBySystemNamespaces      = "SystemNamespaces"
+	decidedByLimitNamespaces       = "LimitNamespaces"
+	decidedByClusterScopedResource = "ClusterScopedResource"
+	decidedByNamespacedResource    = "NamespacedResource"
+	decidedByDiscoveryError        = "DiscoveryError"
+)
+
+// Trace describes how the webhook came to the decision
+type Trace struct {
+	// Entries are directory entries matching the user, groups or service account from the request.
+	Entries []TraceEntry `json:"entries"`
+	// Steps are human-readable evaluation steps in order.
+	Steps []string `json:"steps"`
+	// DecidedBy is the check that made the decision.
+	DecidedBy string `json:"decidedBy"`
+	// Rules are names of ClusterAuthorizationRules that caused the decision.
+	Rules []string `json:"rules,omitempty"`
+}
+
+// TraceEntry is a directory entry matching the request subject
+type TraceEntry struct {
+	Kind  string    `json:"kind"`
+	Name  string    `json:"name"`
+	Rules []RuleRef `json:"rules"`
+}
+
+func (t *Trace) step(format string, args ...interface{}) {
+	t.Steps = append(t.Steps, fmt.Sprintf(format, args...))
+}
+
+func (t *Trace) decide(decidedBy string, rules []RuleRef) {
+	t.DecidedBy = decidedBy
+
+	names := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		names[rule.Name] = struct{}{}
+	}
+
+	t.Rules = make([]string, 0, len(names))
+	for name := range names {
+		t.Rules = append(t.Rules, name)
+	}
+	sort.Strings(t.Rules)
+}
+
+// AuditRecord is a structured log record written for every authorization decision
+type AuditRecord struct {
+	Time               time.Time                 `json:"time"`
+	User               string                    `json:"user"`
+	Groups             []string                  `json:"groups,omitempty"`
+	ResourceAttributes WebhookResourceAttributes `json:"resourceAttributes"`
+	Denied             bool                      `json:"denied"`
+	Reason             string                    `json:"reason,omitempty"`
+	Entries            []TraceEntry              `json:"entries,omitempty"`
+	DecidedBy          string                    `json:"decidedBy"`
+	Rules              []string                  `json:"rules,omitempty"`
+}
+
+func (h *Handler) audit(request *WebhookRequest, trace *Trace) {
+	record := AuditRecord{
+		Time:               time.Now().UTC(),
+		User:               request.Spec.User,
+		Groups:             request.Spec.Group,
+		ResourceAttributes: request.Spec.ResourceAttributes,
+		Denied:             request.Status.Denied,
+		Reason:             request.Status.Reason,
+		Entries:            trace.Entries,
+		DecidedBy:          trace.DecidedBy,
+		Rules:              trace.Rules,
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		h.logger.Printf("cannot marshal audit record: %v", err)
+		return
+	}
+
+	h.auditLogger.Println(string(data))
+}
+
+// ExplainResponse is the SubjectAccessReview with the webhook decision and its evaluation trace
+type ExplainResponse struct {
+	WebhookRequest
+	Trace *Trace `json:"trace"`
+}
+
+// Explain evaluates the SubjectAccessReview the same way as the webhook does and returns the evaluation trace.
+// It is a dry-run, decisions are not written to the audit log.
+func (h *Handler) Explain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is supported.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("cannot unmarshal SubjectAccessReview: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	trace := h.authorizeRequest(&request)
+
+	respData, err := json.MarshalIndent(ExplainResponse{WebhookRequest: request, Trace: trace}, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respData)
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2022 Flant JSC
+Licensed under the Deckhouse Platform Enterprise Edition (EE) license. See https://github.com/deckhouse/deckhouse/blob/main/ee/LICENSE
+*/
+
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newTraceTestHandler(auditOutput *bytes.Buffer) *Handler {
+	devRegex := regexp.MustCompile("^dev-.*$")
+
+	return &Handler{
+		logger:      log.New(ioutil.Discard, "", 0),
+		auditLogger: log.New(auditOutput, "", 0),
+		cache: &dummyCache{
+			data: map[string]map[string]bool{
+				"v1": {
+					"pods":       true,
+					"namespaces": false,
+				},
+			},
+		},
+		directory: map[string]map[string]DirectoryEntry{
+			"User": {
+				"alice": {
+					LimitNamespaces: []*regexp.Regexp{devRegex},
+					Rules: []RuleRef{
+						{Name: "developers", LimitNamespaces: []string{"^dev-.*$"}},
+					},
+				},
+			},
+			"ServiceAccount": {},
+			"Group": {
+				"admins": {
+					LimitNamespacesAbsent: true,
+					Rules: []RuleRef{
+						{Name: "admins"},
+					},
+				},
+				"ops": {
+					LimitNamespacesAbsent:         true,
+					AllowAccessToSystemNamespaces: true,
+					Rules: []RuleRef{
+						{Name: "ops", AllowAccessToSystemNamespaces: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestAuthorizeRequestTrace(t *testing.T) {
+	tc := []struct {
+		Name       string
+		User       string
+		Group      []string
+		Attributes WebhookResourceAttributes
+		Denied     bool
+		DecidedBy  string
+		Rules      []string
+	}{
+		{
+			Name:       "No rules",
+			User:       "bob",
+			Attributes: WebhookResourceAttributes{Resource: "pods", Namespace: "default"},
+			DecidedBy:  decidedByNoRules,
+		},
+		{
+			Name:       "Allowed by limitNamespaces",
+			User:       "alice",
+			Attributes: WebhookResourceAttributes{Resource: "pods", Namespace: "dev-frontend"},
+			DecidedBy:  decidedByLimitNamespaces,
+			Rules:      []string{"developers"},
+		},
+		{
+			Name:       "Denied by limitNamespaces",
+			User:       "alice",
+			Attributes: WebhookResourceAttributes{Resource: "pods", Namespace: "prod"},
+			Denied:     true,
+			DecidedBy:  decidedByLimitNamespaces,
+			Rules:      []string{"developers"},
+		},
+		{
+			Name:       "Denied system namespace",
+			User:       "alice",
+			Group:      []string{"admins"},
+			Attributes: WebhookResourceAttributes{Resource: "pods", Namespace: "kube-system"},
+			Denied:     true,
+			DecidedBy:  decidedBySystemNamespaces,
+			Rules:      []string{"admins", "developers"},
+		},
+		{
+			Name:       "Allowed not system namespace",
+			User:       "alice",
+			Group:      []string{"admins"},
+			Attributes: WebhookResourceAttributes{Resource: "pods", Namespace: "prod"},
+			DecidedBy:  decidedBySystemNamespaces,
+			Rules:      []string{"admins"},
+		},
+		{
+			Name:       "Allowed by unlimited rule",
+			User:       "alice",
+			Group:      []string{"ops"},
+			Attributes: WebhookResourceAttributes{Resource: "pods", Namespace: "kube-system"},
+			DecidedBy:  decidedByNoNamespaceLimits,
+			Rules:      []string{"ops"},
+		},
+		{
+			Name:       "Denied cluster scoped request for namespaced resource",
+			User:       "alice",
+			Attributes: WebhookResourceAttributes{Resource: "pods"},
+			Denied:     true,
+			DecidedBy:  decidedByNamespacedResource,
+			Rules:      []string{"developers"},
+		},
+		{
+			Name:       "Allowed cluster scoped resource",
+			User:       "alice",
+			Attributes: WebhookResourceAttributes{Resource: "namespaces"},
+			DecidedBy:  decidedByClusterScopedResource,
+		},
+		{
+			Name:      "Non resource request",
+			User:      "alice",
+			DecidedBy: decidedByNonResourceRequest,
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.Name, func(t *testing.T) {
+			handler := newTraceTestHandler(&bytes.Buffer{})
+
+			req := &WebhookRequest{
+				Spec: WebhookResourceSpec{
+					User:               testCase.User,
+					Group:              testCase.Group,
+					ResourceAttributes: testCase.Attributes,
+				},
+			}
+
+			trace := handler.authorizeRequest(req)
+			if req.Status.Denied != testCase.Denied {
+				t.Errorf("denied: got %v | expected %v", req.Status.Denied, testCase.Denied)
+			}
+
+			if trace.DecidedBy != testCase.DecidedBy {
+				t.Errorf("decidedBy: got %q | expected %q", trace.DecidedBy, testCase.DecidedBy)
+			}
+
+			if len(trace.Rules) != 0 || len(testCase.Rules) != 0 {
+				if !reflect.DeepEqual(trace.Rules, testCase.Rules) {
+					t.Errorf("rules: got %v | expected %v", trace.Rules, testCase.Rules)
+				}
+			}
+
+			if len(trace.Steps) == 0 {
+				t.Errorf("trace has no steps")
+			}
+		})
+	}
+}
+
+func TestServeHTTPAudit(t *testing.T) {
+	var auditOutput bytes.Buffer
+	handler := newTraceTestHandler(&auditOutput)
+
+	body := `{"apiVersion":"authorization.k8s.io/v1","kind":"SubjectAccessReview","spec":{"user":"alice","groups":["system:authenticated"],"resourceAttributes":{"namespace":"prod","verb":"get","resource":"pods"}}}`
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	var record AuditRecord
+	if err := json.Unmarshal(auditOutput.Bytes(), &record); err != nil {
+		t.Fatalf("cannot unmarshal audit record %q: %v", auditOutput.String(), err)
+	}
+
+	if record.User != "alice" || !reflect.DeepEqual(record.Groups, []string{"system:authenticated"}) {
+		t.Errorf("unexpected subject in the audit record: %+v", record)
+	}
+
+	if !record.Denied || record.DecidedBy != decidedByLimitNamespaces || record.ResourceAttributes.Namespace != "prod" {
+		t.Errorf("unexpected decision in the audit record: %+v", record)
+	}
+
+	if len(record.Entries) != 1 || record.Entries[0].Kind != "User" || record.Entries[0].Name != "alice" {
+		t.Errorf("unexpected directory entries in the audit record: %+v", record.Entries)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	var auditOutput bytes.Buffer
+	handler := newTraceTestHandler(&auditOutput)
+
+	body := `{"apiVersion":"authorization.k8s.io/v1","kind":"SubjectAccessReview","spec":{"user":"alice","groups":["admins"],"resourceAttributes":{"namespace":"kube-system","verb":"get","resource":"pods"}}}`
+
+	w := httptest.NewRecorder()
+	handler.Explain(w, httptest.NewRequest(http.MethodPost, "/explain", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp ExplainResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !resp.Status.Denied || resp.Status.Reason != noNamespaceAccessReason {
+		t.Errorf("unexpected status: %+v", resp.Status)
+	}
+
+	if resp.Trace == nil || resp.Trace.DecidedBy != decidedBySystemNamespaces || len(resp.Trace.Entries) != 2 {
+		t.Errorf("unexpected trace: %+v", resp.Trace)
+	}
+
+	if auditOutput.Len() != 0 {
+		t.Errorf("explain requests must not be audited, got %q", auditOutput.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.Explain(w, httptest.NewRequest(http.MethodPost, "/explain", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for malformed body, got %d", w.Code)
+	}
+}
@@ -32,6 +32,8 @@ var _ http.Handler = (*Handler)(nil)
 // Handler is a main entrypoint for the webhook
 type Handler struct {
 	logger *log.Logger
+	// auditLogger writes a structured record for every authorization decision.
+	auditLogger *log.Logger
 
 	lastAppliedStat os.FileInfo
 
@@ -44,8 +46,9 @@ type Handler struct {
 
 func NewHandler(logger *log.Logger, discoveryCache cache.Cache) *Handler {
 	return &Handler{
-		logger: logger,
-		cache:  discoveryCache,
+		logger:      logger,
+		auditLogger: log.New(logger.Writer(), "", 0),
+		cache:       discoveryCache,
 	}
 }
 
@@ -61,7 +64,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.logger.Fatalf("cannot unmarshal kubernetes request: %v", err)
 	}
 
-	h.authorizeRequest(&request)
+	trace := h.authorizeRequest(&request)
 
 	respData, err := json.Marshal(request)
 	if err != nil {
@@ -72,12 +75,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(respData)
 
-	h.logger.Printf("response body: %s", respData)
+	h.audit(&request, trace)
 }
 
-func (h *Handler) authorizeNamespacedRequest(request *WebhookRequest, entry *DirectoryEntry) *WebhookRequest {
+func (h *Handler) authorizeNamespacedRequest(request *WebhookRequest, entry *DirectoryEntry, trace *Trace) *WebhookRequest {
+	namespace := request.Spec.ResourceAttributes.Namespace
+
 	if !hasLimitedNamespaces(entry) {
 		// User has no namespaces restriction.
+		trace.step("access to namespaces is not limited")
+		trace.decide(decidedByNoNamespaceLimits, filterRules(entry.Rules, isUnlimitedRule))
 		return request
 	}
 
@@ -89,14 +96,19 @@ func (h *Handler) authorizeNamespacedRequest(request *WebhookRequest, entry *Dir
 		if !entry.AllowAccessToSystemNamespaces {
 			for _, pattern := range systemNamespacesRegex {
 				// Deny if matching one of system namespaces regexps
-				if pattern.MatchString(request.Spec.ResourceAttributes.Namespace) {
+				if pattern.MatchString(namespace) {
 					request.Status.Denied = true
 					request.Status.Reason = noNamespaceAccessReason
-					break
+
+					trace.step("namespace %q matches the system namespace pattern %q and no rule allows access to system namespaces", namespace, pattern)
+					trace.decide(decidedBySystemNamespaces, entry.Rules)
+					return request
 				}
 			}
 		}
 
+		trace.step("limitNamespaces is not set in at least one rule, namespace %q is not a system namespace", namespace)
+		trace.decide(decidedBySystemNamespaces, filterRules(entry.Rules, func(r RuleRef) bool { return len(r.LimitNamespaces) == 0 }))
 		return request
 	}
 
@@ -111,13 +123,23 @@ func (h *Handler) authorizeNamespacedRequest(request *WebhookRequest, entry *Dir
 	request.Status.Reason = noNamespaceAccessReason
 
 	for _, pattern := range entry.LimitNamespaces {
-		if pattern.MatchString(request.Spec.ResourceAttributes.Namespace) {
+		if pattern.MatchString(namespace) {
 			request.Status.Denied = false
 			request.Status.Reason = ""
-			break
+
+			trace.step("namespace %q matches the allowed namespace pattern %q", namespace, pattern)
+			trace.decide(decidedByLimitNamespaces, rulesWithPattern(entry.Rules, pattern))
+			return request
 		}
 	}
 
+	patterns := make([]string, 0, len(entry.LimitNamespaces))
+	for _, pattern := range entry.LimitNamespaces {
+		patterns = append(patterns, pattern.String())
+	}
+	trace.step("namespace %q does not match any of the allowed namespace patterns %q", namespace, patterns)
+	trace.decide(decidedByLimitNamespaces, entry.Rules)
+
 	return request
 }
 
@@ -132,7 +154,7 @@ func (h *Handler) fillDenyRequest(request *WebhookRequest, reason, logEntry stri
 	return request
 }
 
-func (h *Handler) authorizeClusterScopedRequest(request *WebhookRequest, entry *DirectoryEntry) *WebhookRequest {
+func (h *Handler) authorizeClusterScopedRequest(request *WebhookRequest, entry *DirectoryEntry, trace *Trace) *WebhookRequest {
 	// if resource is not nil and namespace is nil
 	apiGroup := request.Spec.ResourceAttributes.Version
 	group := request.Spec.ResourceAttributes.Group
@@ -143,6 +165,8 @@ func (h *Handler) authorizeClusterScopedRequest(request *WebhookRequest, entry *
 			apiGroup, err = h.cache.GetPreferredVersion(group)
 			if err != nil {
 				// could not check whether resource is namespaced or not (from cache) - deny access
+				trace.step("cannot get the preferred version of the %q API group: %v", group, err)
+				trace.decide(decidedByDiscoveryError, nil)
 				return h.fillDenyRequest(request, internalErrorReason, err.Error())
 			}
 		} else {
@@ -155,23 +179,43 @@ func (h *Handler) authorizeClusterScopedRequest(request *WebhookRequest, entry *
 		apiGroup = group + "/" + apiGroup
 	}
 
-	namespaced, err := h.cache.Get(apiGroup, request.Spec.ResourceAttributes.Resource)
-	if err != nil {
+	resource := request.Spec.ResourceAttributes.Resource
+
+	namespaced, err := h.cache.Get(apiGroup, resource)
+	switch {
+	case err != nil:
 		// could not check whether resource is namespaced or not (from cache) - deny access
+		trace.step("cannot check whether the %q resource of %q is namespaced: %v", resource, apiGroup, err)
+		trace.decide(decidedByDiscoveryError, nil)
 		h.fillDenyRequest(request, internalErrorReason, err.Error())
 
-	} else if namespaced && hasLimitedNamespaces(entry) {
+	case !namespaced:
+		trace.step("the %q resource of %q is cluster scoped", resource, apiGroup)
+		trace.decide(decidedByClusterScopedResource, nil)
+
+	case hasLimitedNamespaces(entry):
 		// we should not allow cluster scoped requests for namespaced objects if namespaces access is limited
+		trace.step("the %q resource of %q is namespaced, cluster scoped requests are not allowed if access to namespaces is limited", resource, apiGroup)
+		trace.decide(decidedByNamespacedResource, filterRules(entry.Rules, func(r RuleRef) bool { return !isUnlimitedRule(r) }))
 		h.fillDenyRequest(request, namespaceLimitedAccessReason, "")
+
+	default:
+		trace.step("the %q resource of %q is namespaced, access to namespaces is not limited", resource, apiGroup)
+		trace.decide(decidedByNoNamespaceLimits, filterRules(entry.Rules, isUnlimitedRule))
 	}
 
 	return request
 }
 
-func (h *Handler) authorizeRequest(request *WebhookRequest) *WebhookRequest {
-	dirEntriesAffected := h.affectedDirs(request)
+// authorizeRequest fills the request status and returns the evaluation trace.
+func (h *Handler) authorizeRequest(request *WebhookRequest) *Trace {
+	trace := &Trace{Entries: []TraceEntry{}}
+
+	dirEntriesAffected := h.affectedDirs(request, trace)
 	if len(dirEntriesAffected) == 0 {
-		return request
+		trace.step("there are no rules for the user, its groups or service account, the decision is left to RBAC")
+		trace.decide(decidedByNoRules, nil)
+		return trace
 	}
 
 	var combinedDir DirectoryEntry
@@ -184,17 +228,20 @@ func (h *Handler) authorizeRequest(request *WebhookRequest) *WebhookRequest {
 
 		combinedDir.LimitNamespaces = append(combinedDir.LimitNamespaces, dirEntry.LimitNamespaces...)
 		combinedDir.LimitNamespacesAbsent = combinedDir.LimitNamespacesAbsent || dirEntry.LimitNamespacesAbsent
+		combinedDir.Rules = append(combinedDir.Rules, dirEntry.Rules...)
 	}
 
-	if request.Spec.ResourceAttributes.Namespace != "" {
-		return h.authorizeNamespacedRequest(request, &combinedDir)
-	}
-
-	if request.Spec.ResourceAttributes.Resource != "" {
-		return h.authorizeClusterScopedRequest(request, &combinedDir)
+	switch {
+	case request.Spec.ResourceAttributes.Namespace != "":
+		h.authorizeNamespacedRequest(request, &combinedDir, trace)
+	case request.Spec.ResourceAttributes.Resource != "":
+		h.authorizeClusterScopedRequest(request, &combinedDir, trace)
+	default:
+		trace.step("non-resource requests are not limited")
+		trace.decide(decidedByNonResourceRequest, nil)
 	}
 
-	return request
+	return trace
 }
 
 // renewDirectories reads a configuration file (actually it is a json file with all CRs from the cluster) and composes
@@ -251,12 +298,20 @@ func (h *Handler) renewDirectories() {
 			// We need to know whether we have at least one such CR for the user in a cluster.
 			dirEntry.LimitNamespacesAbsent = dirEntry.LimitNamespacesAbsent || len(crd.Spec.LimitNamespaces) == 0
 
+			rule := RuleRef{
+				Name:                          crd.Name,
+				AllowAccessToSystemNamespaces: crd.Spec.AllowAccessToSystemNamespaces,
+			}
+
 			// This is an important thing! All regular expressions is wrapped in the ^...$
 			for _, ln := range crd.Spec.LimitNamespaces {
 				r, _ := regexp.Compile(wrapRegex(ln))
 				dirEntry.LimitNamespaces = append(dirEntry.LimitNamespaces, r)
+				rule.LimitNamespaces = append(rule.LimitNamespaces, r.String())
 			}
 
+			dirEntry.Rules = append(dirEntry.Rules, rule)
+
 			if !dirEntry.AllowAccessToSystemNamespaces {
 				dirEntry.AllowAccessToSystemNamespaces = crd.Spec.AllowAccessToSystemNamespaces
 			}
@@ -291,24 +346,24 @@ func (h *Handler) StartRenewConfigLoop(stopCh <-chan struct{}) {
 }
 
 // affectedDirs checks that User/Group/ServiceAccount from the review request has corresponding ClusterAuthorizationRules
-func (h *Handler) affectedDirs(r *WebhookRequest) []DirectoryEntry {
+func (h *Handler) affectedDirs(r *WebhookRequest, trace *Trace) []DirectoryEntry {
 	var dirEntriesAffected []DirectoryEntry
 
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if dirEntry, ok := h.directory["User"][r.Spec.User]; ok {
-		dirEntriesAffected = append(dirEntriesAffected, dirEntry)
+	add := func(kind, name string) {
+		if dirEntry, ok := h.directory[kind][name]; ok {
+			dirEntriesAffected = append(dirEntriesAffected, dirEntry)
+			trace.Entries = append(trace.Entries, TraceEntry{Kind: kind, Name: name, Rules: dirEntry.Rules})
+		}
 	}
 
-	if dirEntry, ok := h.directory["ServiceAccount"][r.Spec.User]; ok {
-		dirEntriesAffected = append(dirEntriesAffected, dirEntry)
-	}
+	add("User", r.Spec.User)
+	add("ServiceAccount", r.Spec.User)
 
 	for _, group := range r.Spec.Group {
-		if dirEntry, ok := h.directory["Group"][group]; ok {
-			dirEntriesAffected = append(dirEntriesAffected, dirEntry)
-		}
+		add("Group", group)
 	}
 
 	return dirEntriesAffected
@@ -333,6 +388,50 @@ func hasLimitedNamespaces(entry *DirectoryEntry) bool {
 	return true
 }
 
+// isUnlimitedRule returns true if the rule alone gives access to all namespaces.
+func isUnlimitedRule(rule RuleRef) bool {
+	if len(rule.LimitNamespaces) == 0 {
+		return rule.AllowAccessToSystemNamespaces
+	}
+
+	for _, ln := range rule.LimitNamespaces {
+		switch ln {
+		case "^.*$", "^.+$":
+			return true
+		}
+	}
+
+	return false
+}
+
+// rulesWithPattern returns rules which allowed namespaces are matched by the pattern.
+func rulesWithPattern(rules []RuleRef, pattern *regexp.Regexp) []RuleRef {
+	for _, systemPattern := range systemNamespacesRegex {
+		if pattern == systemPattern {
+			return filterRules(rules, func(r RuleRef) bool { return r.AllowAccessToSystemNamespaces })
+		}
+	}
+
+	return filterRules(rules, func(r RuleRef) bool {
+		for _, ln := range r.LimitNamespaces {
+			if ln == pattern.String() {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func filterRules(rules []RuleRef, filter func(RuleRef) bool) []RuleRef {
+	var result []RuleRef
+	for _, rule := range rules {
+		if filter(rule) {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
 func wrapRegex(ln string) string {
 	if !strings.HasPrefix(ln, "^") {
 		ln = "^" + ln
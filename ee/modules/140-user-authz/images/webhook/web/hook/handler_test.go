@@ -6,10 +6,15 @@ Licensed under the Deckhouse Platform Enterprise Edition (EE) license. See https
 package hook
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -296,7 +301,7 @@ func TestAuthorizeRequest(t *testing.T) {
 				Status: WebhookRequestStatus{},
 			}
 
-			req = handler.authorizeRequest(req)
+			handler.authorizeRequest(req)
 			if req.Status.Denied != testCase.ResultStatus.Denied {
 				t.Errorf("denied: got %v | expected %v", req.Status.Denied, testCase.ResultStatus.Denied)
 			}
@@ -308,6 +313,54 @@ func TestAuthorizeRequest(t *testing.T) {
 	}
 }
 
+func TestServeHTTPGroupSubjects(t *testing.T) {
+	tc := []struct {
+		Name         string
+		Body         string
+		ResultStatus WebhookRequestStatus
+	}{
+		{
+			Name: "Group rule allows system namespaces",
+			Body: `{"apiVersion":"authorization.k8s.io/v1","kind":"SubjectAccessReview","spec":{"user":"carol","groups":["ops","system:authenticated"],"resourceAttributes":{"namespace":"kube-system","verb":"get","resource":"pods"}}}`,
+		},
+		{
+			Name: "Group rule denies system namespaces",
+			Body: `{"apiVersion":"authorization.k8s.io/v1","kind":"SubjectAccessReview","spec":{"user":"carol","groups":["admins"],"resourceAttributes":{"namespace":"kube-system","verb":"get","resource":"pods"}}}`,
+			ResultStatus: WebhookRequestStatus{
+				Denied: true,
+				Reason: noNamespaceAccessReason,
+			},
+		},
+		{
+			Name:         "No group rules",
+			Body:         `{"apiVersion":"authorization.k8s.io/v1","kind":"SubjectAccessReview","spec":{"user":"carol","groups":["system:authenticated"],"resourceAttributes":{"namespace":"kube-system","verb":"get","resource":"pods"}}}`,
+			ResultStatus: WebhookRequestStatus{},
+		},
+	}
+
+	for _, testCase := range tc {
+		t.Run(testCase.Name, func(t *testing.T) {
+			handler := newTraceTestHandler(&bytes.Buffer{})
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testCase.Body)))
+
+			var resp WebhookRequest
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("cannot unmarshal response %q: %v", w.Body.String(), err)
+			}
+
+			if len(resp.Spec.Group) == 0 {
+				t.Errorf("groups are not read from the request: %+v", resp.Spec)
+			}
+
+			if resp.Status != testCase.ResultStatus {
+				t.Errorf("status: got %+v | expected %+v", resp.Status, testCase.ResultStatus)
+			}
+		})
+	}
+}
+
 type dummyCache struct {
 	data              map[string]map[string]bool
 	preferredVersions map[string]string
@@ -15,6 +15,15 @@ type DirectoryEntry struct {
 	// If LimitNamespaces is present, we do not need to mind about allowed access to system namespaces.
 	// Thus presence of  LimitNamespaces matters when we summarise rules from all CRs to get the allowed namespaces.
 	LimitNamespacesAbsent bool
+	// Rules are ClusterAuthorizationRules the entry is composed from. They are used to explain decisions.
+	Rules []RuleRef
+}
+
+// RuleRef describes the namespaces options of a single ClusterAuthorizationRule
+type RuleRef struct {
+	Name                          string   `json:"name"`
+	AllowAccessToSystemNamespaces bool     `json:"allowAccessToSystemNamespaces,omitempty"`
+	LimitNamespaces               []string `json:"limitNamespaces,omitempty"`
 }
 
 // UserAuthzConfig is a config composed from ClusterAuthorizationRules collected from Kubernetes cluster
@@ -52,7 +61,7 @@ type WebhookRequest struct {
 type WebhookResourceSpec struct {
 	ResourceAttributes WebhookResourceAttributes `json:"resourceAttributes"`
 
-	Group []string `json:"group"`
+	Group []string `json:"groups"`
 	User  string   `json:"user"`
 }
 
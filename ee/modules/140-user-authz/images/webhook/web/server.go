@@ -70,6 +70,7 @@ func (s *Server) prepareHTTPServer() (*http.Server, error) {
 	router := http.NewServeMux()
 
 	router.Handle("/", s.handler)
+	router.HandleFunc("/explain", s.handler.Explain)
 	router.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		err := s.cache.Check()
 		if err == nil {
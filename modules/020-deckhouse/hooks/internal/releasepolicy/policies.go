@@ -0,0 +1,281 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package releasepolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	d8http "github.com/deckhouse/deckhouse/go_lib/dependency/http"
+	"github.com/deckhouse/deckhouse/modules/020-deckhouse/hooks/internal/v1alpha1"
+)
+
+const (
+	upmeterStatusURL         = "https://upmeter.d8-upmeter/api/status/range"
+	upmeterStatusStep        = 5 * time.Minute
+	upmeterGroupAggregation  = "__total__"
+	defaultUpmeterSLAWindow  = 24 * time.Hour
+	releasePolicyHTTPTimeout = 10 * time.Second
+)
+
+// Policies evaluates DeckhouseReleasePolicies for the release predicted to be deployed.
+// External data is fetched once per hook run. Any error blocks the release, a rollout should not proceed blindly.
+type Policies struct {
+	policies []v1alpha1.DeckhouseReleasePolicy
+	dc       dependency.Container
+	now      time.Time
+
+	fleets map[string]*v1alpha1.FleetStatus
+}
+
+// New returns Policies for the snapshot of DeckhouseReleasePolicy objects.
+func New(snap []go_hook.FilterResult, dc dependency.Container, now time.Time) *Policies {
+	policies := make([]v1alpha1.DeckhouseReleasePolicy, 0, len(snap))
+	for _, s := range snap {
+		policies = append(policies, s.(v1alpha1.DeckhouseReleasePolicy))
+	}
+	// evaluate policies in the stable order to report the same blocking rule every time
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+
+	return &Policies{
+		policies: policies,
+		dc:       dc,
+		now:      now,
+		fleets:   make(map[string]*v1alpha1.FleetStatus),
+	}
+}
+
+// Check returns the message about the first rule blocking the release or an empty string if all rules are passed.
+func (rp *Policies) Check(version *semver.Version) string {
+	for _, policy := range rp.policies {
+		for _, rule := range policy.Spec.Rules {
+			var (
+				passed bool
+				reason string
+			)
+
+			switch {
+			case rule.DeployedInClusters != nil:
+				passed, reason = rp.checkDeployedInClusters(rule.DeployedInClusters, version)
+			case rule.UpmeterSLA != nil:
+				passed, reason = rp.checkUpmeterSLA(rule.UpmeterSLA)
+			default:
+				passed, reason = false, "rule has no checks"
+			}
+
+			if !passed {
+				return fmt.Sprintf("Release is blocked by rule %q of DeckhouseReleasePolicy %q: %s", rule.Name, policy.Name, reason)
+			}
+		}
+	}
+
+	return ""
+}
+
+// AutoApproval reports if approval is defined by policies and if the release is approved by them.
+func (rp *Policies) AutoApproval(isPatch bool) (defined, approved bool) {
+	for _, policy := range rp.policies {
+		switch policy.Spec.AutoApprove {
+		case v1alpha1.AutoApproveAll:
+			return true, true
+		case v1alpha1.AutoApprovePatch:
+			defined = true
+			if isPatch {
+				approved = true
+			}
+		}
+	}
+
+	return defined, approved
+}
+
+func (rp *Policies) checkDeployedInClusters(rule *v1alpha1.DeployedInClustersRule, version *semver.Version) (bool, string) {
+	selector, err := v1.LabelSelectorAsSelector(&rule.ClusterSelector)
+	if err != nil {
+		return false, fmt.Sprintf("invalid cluster selector: %v", err)
+	}
+
+	fleet, err := rp.fleetStatus(rule.FleetStatusURL)
+	if err != nil {
+		return false, fmt.Sprintf("cannot get fleet status: %v", err)
+	}
+
+	var matched int
+	notReady := make([]string, 0)
+
+	for _, cluster := range fleet.Clusters {
+		if !selector.Matches(labels.Set(cluster.Labels)) {
+			continue
+		}
+		matched++
+
+		if !deployedFor(cluster, version, rp.now.Add(-rule.MinimumTime.Duration)) {
+			notReady = append(notReady, cluster.Name)
+		}
+	}
+
+	if matched == 0 {
+		return false, fmt.Sprintf("no clusters match the selector %q", selector.String())
+	}
+
+	if len(notReady) > 0 {
+		return false, fmt.Sprintf("version %s is not deployed for %s in %d of %d clusters: %v",
+			version.Original(), rule.MinimumTime.Duration, len(notReady), matched, notReady)
+	}
+
+	return true, ""
+}
+
+// deployedFor checks that the Deployed release of the cluster is not older than the version
+// and it was deployed before the time.
+func deployedFor(cluster v1alpha1.FleetCluster, version *semver.Version, before time.Time) bool {
+	for _, release := range cluster.Releases {
+		if release.Phase != v1alpha1.PhaseDeployed {
+			continue
+		}
+
+		deployed, err := semver.NewVersion(release.Version)
+		if err != nil || deployed.LessThan(version) {
+			return false
+		}
+
+		return !release.TransitionTime.Time.After(before)
+	}
+
+	return false
+}
+
+func (rp *Policies) fleetStatus(fleetURL string) (*v1alpha1.FleetStatus, error) {
+	if fleet, ok := rp.fleets[fleetURL]; ok {
+		return fleet, nil
+	}
+
+	var fleet v1alpha1.FleetStatus
+	err := rp.getJSON(fleetURL, false, &fleet)
+	if err != nil {
+		return nil, err
+	}
+
+	rp.fleets[fleetURL] = &fleet
+	return &fleet, nil
+}
+
+func (rp *Policies) checkUpmeterSLA(rule *v1alpha1.UpmeterSLARule) (bool, string) {
+	window := rule.Window.Duration
+	if window == 0 {
+		window = defaultUpmeterSLAWindow
+	}
+
+	probe := rule.Probe
+	if probe == "" {
+		probe = upmeterGroupAggregation
+	}
+
+	// Reports are built for calendar months, so the status of the exact range is requested.
+	// Upmeter aligns the range to the step, the range ends with the last complete episode.
+	to := rp.now.Truncate(upmeterStatusStep)
+	query := url.Values{}
+	query.Set("group", rule.Group)
+	query.Set("probe", probe)
+	query.Set("from", strconv.FormatInt(to.Add(-window).Unix(), 10))
+	query.Set("to", strconv.FormatInt(to.Unix(), 10))
+	query.Set("step", upmeterStatusStep.String())
+
+	var status upmeterStatus
+	err := rp.getJSON(upmeterStatusURL+"?"+query.Encode(), true, &status)
+	if err != nil {
+		return false, fmt.Sprintf("cannot get upmeter status: %v", err)
+	}
+
+	// The summary for the whole range has the -1 timeslot.
+	var up, down time.Duration
+	for _, summary := range status.Statuses[rule.Group][probe] {
+		if summary.TimeSlot == -1 {
+			up, down = summary.Up, summary.Down
+			break
+		}
+	}
+
+	name := rule.Group
+	if rule.Probe != "" {
+		name += "/" + rule.Probe
+	}
+
+	if up+down == 0 {
+		return false, fmt.Sprintf("upmeter has no availability data for %s", name)
+	}
+
+	availability := float64(up) / float64(up+down) * 100
+	if availability < rule.MinimumAvailability {
+		return false, fmt.Sprintf("availability of %s is %.3f%% for the last %s, the minimum is %g%%",
+			name, availability, window, rule.MinimumAvailability)
+	}
+
+	return true, ""
+}
+
+func (rp *Policies) getJSON(target string, inCluster bool, out interface{}) error {
+	options := []d8http.Option{d8http.WithTimeout(releasePolicyHTTPTimeout)}
+	if inCluster {
+		options = append(options, d8http.WithInsecureSkipVerify())
+	}
+	cl := rp.dc.GetHTTPClient(options...)
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	if inCluster {
+		err = d8http.SetKubeAuthToken(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+type upmeterStatus struct {
+	Statuses map[string]map[string][]struct {
+		TimeSlot int64         `json:"ts"`
+		Up       time.Duration `json:"up"`
+		Down     time.Duration `json:"down"`
+	} `json:"statuses"`
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package releasepolicy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	"github.com/deckhouse/deckhouse/modules/020-deckhouse/hooks/internal/v1alpha1"
+)
+
+const upmeterStatusResponse = `{"step": 300, "from": 1615788000, "to": 1615809600, "statuses": {"control-plane": {
+  "__total__": [
+    {"ts": -1, "up": 21384000000000, "down": 216000000000},
+    {"ts": 1615788000, "up": 84000000000, "down": 216000000000}
+  ],
+  "apiserver": [
+    {"ts": -1, "up": 21600000000000, "down": 0}
+  ]
+}}}`
+
+func TestCheckUpmeterSLA(t *testing.T) {
+	require.NoError(t, os.Setenv("D8_IS_TESTS_ENVIRONMENT", "true"))
+	defer os.Unsetenv("D8_IS_TESTS_ENVIRONMENT")
+
+	var requested *url.URL
+	dependency.TestDC.HTTPClient.DoMock.Set(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(upmeterStatusResponse)),
+		}, nil
+	})
+
+	// The window is in the middle of the month, the calendar report would cover the whole month.
+	now := time.Date(2021, 3, 15, 12, 3, 20, 0, time.UTC)
+	rp := New(nil, dependency.NewDependencyContainer(), now)
+	window := v1alpha1.Duration{Duration: 6 * time.Hour}
+
+	t.Run("Group availability is below the minimum", func(t *testing.T) {
+		passed, reason := rp.checkUpmeterSLA(&v1alpha1.UpmeterSLARule{Group: "control-plane", MinimumAvailability: 99.9, Window: window})
+		assert.False(t, passed)
+		assert.Equal(t, "availability of control-plane is 99.000% for the last 6h0m0s, the minimum is 99.9%", reason)
+
+		query := requested.Query()
+		assert.Equal(t, "/api/status/range", requested.Path)
+		assert.Equal(t, "control-plane", query.Get("group"))
+		assert.Equal(t, "__total__", query.Get("probe"))
+		assert.Equal(t, strconv.FormatInt(time.Date(2021, 3, 15, 6, 0, 0, 0, time.UTC).Unix(), 10), query.Get("from"))
+		assert.Equal(t, strconv.FormatInt(time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC).Unix(), 10), query.Get("to"))
+		assert.Equal(t, "5m0s", query.Get("step"))
+	})
+
+	t.Run("Probe availability is enough", func(t *testing.T) {
+		passed, reason := rp.checkUpmeterSLA(&v1alpha1.UpmeterSLARule{Group: "control-plane", Probe: "apiserver", MinimumAvailability: 99.9, Window: window})
+		assert.True(t, passed, reason)
+		assert.Equal(t, "apiserver", requested.Query().Get("probe"))
+	})
+
+	t.Run("No data for the probe", func(t *testing.T) {
+		passed, reason := rp.checkUpmeterSLA(&v1alpha1.UpmeterSLARule{Group: "control-plane", Probe: "scheduler", MinimumAvailability: 99.9, Window: window})
+		assert.False(t, passed)
+		assert.Equal(t, "upmeter has no availability data for control-plane/scheduler", reason)
+	})
+}
@@ -34,6 +34,7 @@ const (
 	PhaseDeployed  = "Deployed"
 	PhaseOutdated  = "Outdated"
 	PhaseSuspended = "Suspended"
+	PhaseFailed    = "Failed"
 )
 
 // DeckhouseRelease is a deckhouse release object.
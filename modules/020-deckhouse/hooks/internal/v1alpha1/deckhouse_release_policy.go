@@ -0,0 +1,86 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	AutoApprovePatch = "Patch"
+	AutoApproveAll   = "All"
+)
+
+// DeckhouseReleasePolicy describes rules which a release must satisfy before it is deployed.
+type DeckhouseReleasePolicy struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DeckhouseReleasePolicySpec `json:"spec"`
+}
+
+type DeckhouseReleasePolicySpec struct {
+	// AutoApprove is Patch or All. If any policy sets it, minor releases not covered by policies
+	// require manual approval regardless of the update mode.
+	AutoApprove string `json:"autoApprove,omitempty"`
+
+	Rules []ReleasePolicyRule `json:"rules,omitempty"`
+}
+
+// ReleasePolicyRule has exactly one of the checks.
+type ReleasePolicyRule struct {
+	Name string `json:"name"`
+
+	DeployedInClusters *DeployedInClustersRule `json:"deployedInClusters,omitempty"`
+	UpmeterSLA         *UpmeterSLARule         `json:"upmeterSLA,omitempty"`
+}
+
+// DeployedInClustersRule requires the release to be deployed in the selected clusters of the fleet for some time.
+type DeployedInClustersRule struct {
+	// FleetStatusURL returns the FleetStatus document
+	FleetStatusURL  string               `json:"fleetStatusURL"`
+	ClusterSelector metav1.LabelSelector `json:"clusterSelector"`
+	MinimumTime     Duration             `json:"minimumTime"`
+}
+
+// UpmeterSLARule requires the availability of the upmeter group or probe to be not lower than the minimum.
+type UpmeterSLARule struct {
+	Group               string   `json:"group"`
+	Probe               string   `json:"probe,omitempty"`
+	MinimumAvailability float64  `json:"minimumAvailability"`
+	Window              Duration `json:"window,omitempty"`
+}
+
+// FleetStatus is the document with releases of clusters in the fleet.
+type FleetStatus struct {
+	Clusters []FleetCluster `json:"clusters"`
+}
+
+type FleetCluster struct {
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Releases []FleetRelease    `json:"releases"`
+}
+
+type FleetRelease struct {
+	Version        string      `json:"version"`
+	Phase          string      `json:"phase"`
+	TransitionTime metav1.Time `json:"transitionTime"`
+}
@@ -17,10 +17,14 @@ limitations under the License.
 package hooks
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +36,7 @@ import (
 	"github.com/flant/shell-operator/pkg/kube_events_manager/types"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -39,8 +44,10 @@ import (
 
 	"github.com/deckhouse/deckhouse/go_lib/dependency"
 	"github.com/deckhouse/deckhouse/go_lib/dependency/cr"
+	d8http "github.com/deckhouse/deckhouse/go_lib/dependency/http"
 	"github.com/deckhouse/deckhouse/go_lib/dependency/requirements"
 	"github.com/deckhouse/deckhouse/go_lib/hooks/update"
+	"github.com/deckhouse/deckhouse/modules/020-deckhouse/hooks/internal/releasepolicy"
 	"github.com/deckhouse/deckhouse/modules/020-deckhouse/hooks/internal/v1alpha1"
 )
 
@@ -91,6 +98,14 @@ var _ = sdk.RegisterFunc(&go_hook.HookConfig{
 			ExecuteHookOnSynchronization: pointer.BoolPtr(false),
 			FilterFunc:                   filterDeckhouseRelease,
 		},
+		{
+			Name:                         "release_policies",
+			ApiVersion:                   "deckhouse.io/v1alpha1",
+			Kind:                         "DeckhouseReleasePolicy",
+			ExecuteHookOnEvents:          pointer.BoolPtr(false),
+			ExecuteHookOnSynchronization: pointer.BoolPtr(false),
+			FilterFunc:                   filterDeckhouseReleasePolicy,
+		},
 		{
 			Name:       "updating_cm",
 			ApiVersion: "v1",
@@ -115,6 +130,7 @@ type deckhousePodInfo struct {
 	Namespace string `json:"namespace"`
 	Image     string `json:"image"`
 	ImageID   string `json:"imageID"`
+	IP        string `json:"ip"`
 	Ready     bool   `json:"ready"`
 }
 
@@ -145,6 +161,10 @@ func (dpi deckhousePodInfo) isBootstrapImage() bool {
 const (
 	metricReleasesGroup = "d8_releases"
 	metricUpdatingGroup = "d8_updating"
+
+	defaultVerificationTimeout = 30 * time.Minute
+	// watchdogDeadlineMargin gives the watchdog Job time to roll back after the verification timeout.
+	watchdogDeadlineMargin = 15 * time.Minute
 )
 
 func updateDeckhouse(input *go_hook.HookInput, dc dependency.Container) error {
@@ -162,27 +182,36 @@ func updateDeckhouse(input *go_hook.HookInput, dc dependency.Container) error {
 	// production upgrade
 	input.MetricsCollector.Expire(metricReleasesGroup)
 
-	if deckhousePod.Ready {
+	updating := getUpdatingInfo(input.Snapshots["updating_cm"])
+	if deckhousePod.Ready && updating == nil {
 		input.MetricsCollector.Expire(metricUpdatingGroup)
-		if isUpdatingCMExists(input) {
-			deleteUpdatingCM(input)
-		}
-	} else if isUpdatingCMExists(input) {
-		input.MetricsCollector.Set("d8_is_updating", 1, nil, metrics.WithGroup(metricUpdatingGroup))
 	}
 
 	// initialize updater
 	approvalMode := input.Values.Get("deckhouse.update.mode").String()
 	updater := newDeckhouseUpdater(approvalMode, deckhousePod.Ready, deckhousePod.isBootstrapImage())
+	updater.policies = releasepolicy.New(input.Snapshots["release_policies"], dc, updater.now)
 
 	// fetch releases from snapshot and patch initial statuses
 	updater.FetchAndPrepareReleases(input)
+
+	// predict next patch for Deploy
+	updater.PredictNextRelease()
+
+	// forced release is deployed without waiting for verification of the previous one
+	if updating != nil && !updater.HasForceRelease() {
+		verified := updater.VerifyDeployedRelease(input, dc, deckhousePod, updating)
+		if !verified {
+			// don't deploy anything until the deployed release is verified or rolled back
+			return nil
+		}
+	}
+
 	if len(updater.releases) == 0 {
 		return nil
 	}
 
-	// predict next patch for Deploy
-	updater.PredictNextRelease()
+	updater.ReportFailedReleases(input)
 
 	// has already Deployed the latest release
 	if updater.LastReleaseDeployed() {
@@ -298,7 +327,38 @@ func filterDeckhouseRelease(unstructured *unstructured.Unstructured) (go_hook.Fi
 }
 
 func filterUpdatingCM(unstructured *unstructured.Unstructured) (go_hook.FilterResult, error) {
-	return unstructured.GetName(), nil
+	var cm corev1.ConfigMap
+	err := sdk.FromUnstructured(unstructured, &cm)
+	if err != nil {
+		return nil, err
+	}
+
+	info := updatingInfo{
+		Version:         cm.Data["version"],
+		PreviousVersion: cm.Data["previousVersion"],
+		Failures:        cm.Data["failures"],
+	}
+
+	if deployedAt, ok := cm.Data["deployedAt"]; ok {
+		t, err := time.Parse(time.RFC3339, deployedAt)
+		if err != nil {
+			return nil, err
+		}
+		info.DeployedAt = t
+	}
+
+	return info, nil
+}
+
+func filterDeckhouseReleasePolicy(unstructured *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	var policy v1alpha1.DeckhouseReleasePolicy
+
+	err := sdk.FromUnstructured(unstructured, &policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
 }
 
 func filterDeckhousePod(unstructured *unstructured.Unstructured) (go_hook.FilterResult, error) {
@@ -331,6 +391,7 @@ func filterDeckhousePod(unstructured *unstructured.Unstructured) (go_hook.Filter
 		ImageID:   imageID,
 		Name:      pod.Name,
 		Namespace: pod.Namespace,
+		IP:        pod.Status.PodIP,
 		Ready:     ready,
 	}, nil
 }
@@ -420,6 +481,8 @@ type deckhouseUpdater struct {
 
 	deckhousePodIsReady      bool
 	deckhouseIsBootstrapping bool
+
+	policies *releasepolicy.Policies
 }
 type deckhouseRelease struct {
 	Name    string
@@ -454,6 +517,7 @@ func newDeckhouseUpdater(mode string, podIsReady, isBootstrapping bool) *deckhou
 // ApplyPredictedRelease applies predicted release, checks everything:
 //   - Deckhouse is ready (except patch)
 //   - Canary settings
+//   - Release policies
 //   - Manual approving
 //   - Release requirements
 func (du *deckhouseUpdater) ApplyPredictedRelease(input *go_hook.HookInput) {
@@ -504,11 +568,25 @@ func (du *deckhouseUpdater) ApplyPredictedRelease(input *go_hook.HookInput) {
 		}
 	}
 
+	// check: release policies
+	if msg := du.policies.Check(predictedRelease.Version); msg != "" {
+		input.MetricsCollector.Set("d8_release_blocked", 1, map[string]string{"name": predictedRelease.Name, "reason": "policy"}, metrics.WithGroup(metricReleasesGroup))
+		input.LogEntry.Warningf("Release %s is blocked by a release policy", predictedRelease.Name)
+		updateStatus(input, predictedRelease, msg, v1alpha1.PhasePending)
+		return
+	}
+
 	// check: release is approved or it's a patch
-	if !predictedRelease.Status.Approved && !du.PredictedReleaseIsPatch() {
+	approved, approvalMsg := predictedRelease.Status.Approved, "Waiting for manual approval"
+	// policies with autoApprove take over the approval from the update mode
+	if defined, approvedByPolicy := du.policies.AutoApproval(du.PredictedReleaseIsPatch()); defined {
+		approved = predictedRelease.ManuallyApproved || approvedByPolicy
+		approvalMsg = "Waiting for manual approval, the release is not auto-approved by DeckhouseReleasePolicies"
+	}
+	if !approved && !du.PredictedReleaseIsPatch() {
 		input.LogEntry.Infof("Release %s is waiting for manual approval", predictedRelease.Name)
 		input.MetricsCollector.Set("d8_release_waiting_manual", float64(du.totalPendingManualReleases), map[string]string{"name": predictedRelease.Name}, metrics.WithGroup(metricReleasesGroup))
-		updateStatus(input, predictedRelease, "Waiting for manual approval", v1alpha1.PhasePending)
+		updateStatus(input, predictedRelease, approvalMsg, v1alpha1.PhasePending)
 		return
 	}
 
@@ -567,21 +645,18 @@ func (du *deckhouseUpdater) runReleaseDeploy(input *go_hook.HookInput, predicted
 
 	repo := input.Values.Get("global.modulesImages.registry").String()
 
-	createUpdatingCM(input, predictedRelease.Version.String())
-
-	// patch deckhouse deployment is faster then set internal values and then upgrade by helm
-	// we can set "deckhouse.internal.currentReleaseImageName" value but lets left it this way
-	input.PatchCollector.Filter(func(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-		var depl appsv1.Deployment
-		err := sdk.FromUnstructured(u, &depl)
-		if err != nil {
-			return nil, err
-		}
+	var previousVersion string
+	if currentRelease != nil {
+		previousVersion = currentRelease.Version.String()
+	}
+	createUpdatingCM(input, predictedRelease.Version.String(), previousVersion, du.now)
 
-		depl.Spec.Template.Spec.Containers[0].Image = repo + ":" + predictedRelease.Version.Original()
+	// the watchdog is started before the new image, it must not depend on the new release
+	if currentRelease != nil {
+		createWatchdogJob(input, predictedRelease, currentRelease, repo+":"+currentRelease.Version.Original(), du.now)
+	}
 
-		return sdk.ToUnstructured(&depl)
-	}, "apps/v1", "Deployment", "d8-system", "deckhouse")
+	patchDeckhouseImage(input, repo+":"+predictedRelease.Version.Original())
 
 	updateStatus(input, predictedRelease, "", v1alpha1.PhaseDeployed, true)
 
@@ -597,12 +672,29 @@ func (du *deckhouseUpdater) runReleaseDeploy(input *go_hook.HookInput, predicted
 	}
 }
 
+// patchDeckhouseImage sets the image of the deckhouse deployment.
+// Patching the deployment is faster than setting internal values and then upgrading by helm.
+// We can set "deckhouse.internal.currentReleaseImageName" value but lets left it this way.
+func patchDeckhouseImage(input *go_hook.HookInput, image string) {
+	input.PatchCollector.Filter(func(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		var depl appsv1.Deployment
+		err := sdk.FromUnstructured(u, &depl)
+		if err != nil {
+			return nil, err
+		}
+
+		depl.Spec.Template.Spec.Containers[0].Image = image
+
+		return sdk.ToUnstructured(&depl)
+	}, "apps/v1", "Deployment", "d8-system", "deckhouse")
+}
+
 // PredictNextRelease runs prediction of the next release to deploy.
 // it skips patch releases and save only the latest one
 func (du *deckhouseUpdater) PredictNextRelease() {
 	for i, release := range du.releases {
 		switch release.Status.Phase {
-		case v1alpha1.PhaseOutdated, v1alpha1.PhaseSuspended:
+		case v1alpha1.PhaseOutdated, v1alpha1.PhaseSuspended, v1alpha1.PhaseFailed:
 			// pass
 
 		case v1alpha1.PhasePending:
@@ -799,6 +891,173 @@ func (du *deckhouseUpdater) FetchAndPrepareReleases(input *go_hook.HookInput) {
 	du.releases = releases
 }
 
+// VerifyDeployedRelease checks the release deployed by the previous runs of the hook:
+//   - Deckhouse pod runs the release image and is ready
+//   - the main queue is drained
+//   - requirements from the verification settings are met
+//
+// Failures are stored in the updating ConfigMap. If checks are not passed during the timeout, the release
+// is rolled back by the watchdog Job running the previous image: a broken release cannot roll itself back.
+// Returns true if the release is verified and other releases could be deployed.
+func (du *deckhouseUpdater) VerifyDeployedRelease(input *go_hook.HookInput, dc dependency.Container, pod *deckhousePodInfo, updating *updatingInfo) bool {
+	// ConfigMap is created by the previous Deckhouse version, readiness is the only check for it
+	if updating.DeployedAt.IsZero() {
+		if !pod.Ready {
+			input.MetricsCollector.Set("d8_is_updating", 1, nil, metrics.WithGroup(metricUpdatingGroup))
+			return true
+		}
+		input.MetricsCollector.Expire(metricUpdatingGroup)
+		deleteUpdatingCM(input)
+		return true
+	}
+
+	failures := du.verificationFailures(input, dc, pod, updating)
+	if len(failures) == 0 {
+		input.LogEntry.Infof("Release %s is verified", updating.Version)
+		input.MetricsCollector.Expire(metricUpdatingGroup)
+		deleteUpdatingCM(input)
+		deleteWatchdogJob(input, updating.Version)
+		return true
+	}
+
+	input.MetricsCollector.Set("d8_is_updating", 1, nil, metrics.WithGroup(metricUpdatingGroup))
+	reason := strings.Join(failures, ", ")
+	if reason != updating.Failures {
+		patch := map[string]interface{}{"data": map[string]string{"failures": reason}}
+		input.PatchCollector.MergePatch(patch, "v1", "ConfigMap", "d8-system", "d8-release-updating")
+	}
+
+	timeout := verificationTimeout(input)
+	if du.now.Before(updating.DeployedAt.Add(timeout)) {
+		input.LogEntry.Infof("Release %s is not verified yet: %s", updating.Version, reason)
+		return false
+	}
+
+	if updating.PreviousVersion != "" {
+		input.LogEntry.Warnf("Release %s is not verified in %s, waiting for the rollback: %s", updating.Version, timeout, reason)
+		return false
+	}
+
+	// there is no previous release, hence no watchdog to roll back to it
+	du.failRelease(input, updating, fmt.Sprintf("Post-update verification failed after %s: %s", timeout, reason))
+
+	return false
+}
+
+func verificationTimeout(input *go_hook.HookInput) time.Duration {
+	if v, ok := input.Values.GetOk("deckhouse.update.verification.timeout"); ok {
+		d, err := time.ParseDuration(v.String())
+		if err == nil {
+			return d
+		}
+	}
+
+	return defaultVerificationTimeout
+}
+
+func (du *deckhouseUpdater) verificationFailures(input *go_hook.HookInput, dc dependency.Container, pod *deckhousePodInfo, updating *updatingInfo) []string {
+	failures := make([]string, 0)
+
+	// Recreate strategy of the deployment guarantees that there is only one pod, but it could be the old one
+	tag := pod.Image[strings.LastIndex(pod.Image, ":")+1:]
+	podVersion, err := semver.NewVersion(tag)
+	if err != nil || podVersion.String() != updating.Version {
+		failures = append(failures, fmt.Sprintf("deckhouse pod runs the image %q", pod.Image))
+	} else if !pod.Ready {
+		failures = append(failures, "deckhouse pod is not ready")
+	} else {
+		length, err := mainQueueLength(dc, pod.IP)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("cannot get the main queue length: %s", err))
+		} else if length > 0 {
+			failures = append(failures, fmt.Sprintf("main queue has %d tasks", length))
+		}
+	}
+
+	reqs := input.Values.Get("deckhouse.update.verification.requirements").Map()
+	keys := make([]string, 0, len(reqs))
+	for key := range reqs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		passed, err := requirements.CheckRequirement(key, reqs[key].String(), input.Values)
+		if !passed {
+			failures = append(failures, fmt.Sprintf("%q requirement not met: %s", key, err))
+		}
+	}
+
+	return failures
+}
+
+// failRelease marks the deployed release as Failed when there is no release to roll back to.
+func (du *deckhouseUpdater) failRelease(input *go_hook.HookInput, updating *updatingInfo, reason string) {
+	deleteUpdatingCM(input)
+	input.MetricsCollector.Expire(metricUpdatingGroup)
+
+	for i := range du.releases {
+		release := &du.releases[i]
+		if release.Version.String() != updating.Version {
+			continue
+		}
+
+		input.LogEntry.Errorf("Release %s is failed, there is no previous release to roll back: %s", release.Version.Original(), reason)
+		input.MetricsCollector.Set("d8_release_failed", 1, map[string]string{"name": release.Name}, metrics.WithGroup(metricReleasesGroup))
+		updateStatus(input, release, reason, v1alpha1.PhaseFailed, release.Status.Approved)
+	}
+}
+
+// ReportFailedReleases exposes failed releases newer than the deployed one.
+func (du *deckhouseUpdater) ReportFailedReleases(input *go_hook.HookInput) {
+	for i := du.currentDeployedReleaseIndex + 1; i < len(du.releases); i++ {
+		release := du.releases[i]
+		if release.Status.Phase == v1alpha1.PhaseFailed {
+			input.MetricsCollector.Set("d8_release_failed", 1, map[string]string{"name": release.Name}, metrics.WithGroup(metricReleasesGroup))
+		}
+	}
+}
+
+// mainQueueLength gets the length of the main queue from metrics of the deckhouse pod.
+func mainQueueLength(dc dependency.Container, podIP string) (int, error) {
+	cl := dc.GetHTTPClient(d8http.WithTimeout(5 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+net.JoinHostPort(podIP, "9650")+"/metrics", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := cl.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "deckhouse_tasks_queue_length{") || !strings.Contains(line, `queue="main"`) {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			return 0, err
+		}
+		return int(value), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("deckhouse_tasks_queue_length metric for the main queue is not found")
+}
+
 func (du *deckhouseUpdater) checkReleaseRequirements(input *go_hook.HookInput, rl *deckhouseRelease) bool {
 	for key, value := range rl.Requirements {
 		passed, err := requirements.CheckRequirement(key, value, input.Values)
@@ -816,7 +1075,26 @@ func (du *deckhouseUpdater) checkReleaseRequirements(input *go_hook.HookInput, r
 	return true
 }
 
-func createUpdatingCM(input *go_hook.HookInput, version string) {
+// updatingInfo is stored in the d8-release-updating ConfigMap while the deployed release is being verified.
+type updatingInfo struct {
+	Version         string
+	PreviousVersion string
+	// Failures of the last verification run
+	Failures string
+	// DeployedAt is empty for ConfigMaps created by previous Deckhouse versions
+	DeployedAt time.Time
+}
+
+func getUpdatingInfo(snap []go_hook.FilterResult) *updatingInfo {
+	if len(snap) == 0 {
+		return nil
+	}
+
+	info := snap[0].(updatingInfo)
+	return &info
+}
+
+func createUpdatingCM(input *go_hook.HookInput, version, previousVersion string, deployedAt time.Time) {
 	cm := &corev1.ConfigMap{
 		TypeMeta: v1.TypeMeta{
 			APIVersion: "v1",
@@ -830,22 +1108,93 @@ func createUpdatingCM(input *go_hook.HookInput, version string) {
 			},
 		},
 		Data: map[string]string{
-			"version": version,
+			"version":         version,
+			"previousVersion": previousVersion,
+			"deployedAt":      deployedAt.Format(time.RFC3339),
 		},
 	}
 
 	input.PatchCollector.Create(cm, object_patch.UpdateIfExists())
 }
 
-func isUpdatingCMExists(input *go_hook.HookInput) bool {
-	snap := input.Snapshots["updating_cm"]
-	return len(snap) > 0
-}
-
 func deleteUpdatingCM(input *go_hook.HookInput) {
 	input.PatchCollector.Delete("v1", "ConfigMap", "d8-system", "d8-release-updating", object_patch.InBackground())
 }
 
+func watchdogJobName(version string) string {
+	return "deckhouse-update-watchdog-v" + strings.ReplaceAll(version, ".", "-")
+}
+
+// createWatchdogJob starts the Job which rolls the release back to the previous image
+// if the release is not verified in time. See the update-watchdog helper of deckhouse-controller.
+func createWatchdogJob(input *go_hook.HookInput, release, previousRelease *deckhouseRelease, previousImage string, deployedAt time.Time) {
+	timeout := verificationTimeout(input)
+	labels := map[string]string{
+		"heritage": "deckhouse",
+		"app":      "deckhouse-update-watchdog",
+	}
+
+	job := &batchv1.Job{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "Job",
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Name:      watchdogJobName(release.Version.String()),
+			Namespace: "d8-system",
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			ActiveDeadlineSeconds:   pointer.Int64Ptr(int64((timeout + watchdogDeadlineMargin).Seconds())),
+			TTLSecondsAfterFinished: pointer.Int32Ptr(int32(time.Hour.Seconds())),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "deckhouse",
+					RestartPolicy:      corev1.RestartPolicyOnFailure,
+					PriorityClassName:  "system-cluster-critical",
+					// the same network as the deckhouse pod, the release could break the CNI
+					HostNetwork:  true,
+					DNSPolicy:    corev1.DNSClusterFirstWithHostNet,
+					NodeSelector: map[string]string{"node-role.kubernetes.io/master": ""},
+					Tolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsUser:    pointer.Int64Ptr(65534),
+						RunAsGroup:   pointer.Int64Ptr(65534),
+						RunAsNonRoot: pointer.BoolPtr(true),
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "watchdog",
+							Image: previousImage,
+							Command: []string{
+								"deckhouse-controller", "helper", "update-watchdog",
+								"--release=" + release.Name,
+								"--version=" + release.Version.String(),
+								"--previous-release=" + previousRelease.Name,
+								"--previous-image=" + previousImage,
+								"--deployed-at=" + deployedAt.Format(time.RFC3339),
+								"--timeout=" + timeout.String(),
+							},
+							SecurityContext: &corev1.SecurityContext{
+								AllowPrivilegeEscalation: pointer.BoolPtr(false),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	input.PatchCollector.Create(job, object_patch.IgnoreIfExists())
+}
+
+func deleteWatchdogJob(input *go_hook.HookInput, version string) {
+	input.PatchCollector.Delete("batch/v1", "Job", "d8-system", watchdogJobName(version), object_patch.InBackground())
+}
+
 func updateStatus(input *go_hook.HookInput, release *deckhouseRelease, msg, phase string, approvedFlag ...bool) {
 	approved := release.Status.Approved
 	if len(approvedFlag) > 0 {
@@ -17,8 +17,13 @@ limitations under the License.
 package hooks
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -46,6 +51,7 @@ var _ = Describe("Modules :: deckhouse :: hooks :: update deckhouse image ::", f
 			}
 }`, `{}`)
 	f.RegisterCRD("deckhouse.io", "v1alpha1", "DeckhouseRelease", false)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "DeckhouseReleasePolicy", false)
 
 	dependency.TestDC.CRClient = cr.NewClientMock(GinkgoT())
 
@@ -880,3 +886,464 @@ status:
   reason: Shutdown
 `
 )
+
+var _ = Describe("Modules :: deckhouse :: hooks :: update deckhouse image :: post-update verification ::", func() {
+	f := HookExecutionConfigInit(`{
+        "global": {
+          "modulesImages": {
+            "registry": "my.registry.com/deckhouse"
+          }
+        },
+        "deckhouse": {
+          "internal": {},
+          "releaseChannel": "Stable",
+          "update": {
+            "mode": "Auto",
+            "verification": {
+              "timeout": "30m"
+            }
+          }
+        }
+}`, `{}`)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "DeckhouseRelease", false)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "DeckhouseReleasePolicy", false)
+
+	Context("New release is healthy", func() {
+		BeforeEach(func() {
+			mockHTTPResponses(map[string]string{"10.0.0.1:9650": queueMetrics(0)})
+
+			f.KubeStateSet(updatedDeckhouse(true) + deployedReleases + updatingConfigMap(time.Now().Add(-5*time.Minute)) + watchdogJob)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should finish the verification and delete the watchdog", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.KubernetesResource("ConfigMap", "d8-system", "d8-release-updating").Exists()).To(BeFalse())
+			Expect(f.KubernetesResource("Job", "d8-system", "deckhouse-update-watchdog-v1-26-0").Exists()).To(BeFalse())
+			Expect(f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0").Field("status.phase").String()).To(Equal("Deployed"))
+		})
+	})
+
+	Context("Main queue is not drained yet", func() {
+		BeforeEach(func() {
+			mockHTTPResponses(map[string]string{"10.0.0.1:9650": queueMetrics(12)})
+
+			f.KubeStateSet(updatedDeckhouse(true) + deployedReleases + pendingRelease + updatingConfigMap(time.Now().Add(-5*time.Minute)))
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should wait and not deploy other releases", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.KubernetesResource("ConfigMap", "d8-system", "d8-release-updating").Exists()).To(BeTrue())
+			Expect(f.KubernetesGlobalResource("DeckhouseRelease", "v1-27-0").Field("status.phase").String()).To(Equal("Pending"))
+			dep := f.KubernetesResource("Deployment", "d8-system", "deckhouse")
+			Expect(dep.Field("spec.template.spec.containers").Array()[0].Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.26.0"))
+			Expect(f.MetricsCollector.CollectedMetrics()).To(ContainElement(HaveField("Name", "d8_is_updating")))
+			Expect(f.KubernetesResource("ConfigMap", "d8-system", "d8-release-updating").Field("data.failures").String()).To(Equal("main queue has 12 tasks"))
+		})
+	})
+
+	Context("Release is deployed", func() {
+		BeforeEach(func() {
+			f.KubeStateSet(deckhousePodYaml + deckhouseReleases)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should start the watchdog with the previous image", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			dep := f.KubernetesResource("Deployment", "d8-system", "deckhouse")
+			Expect(dep.Field("spec.template.spec.containers").Array()[0].Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.26.0"))
+
+			job := f.KubernetesResource("Job", "d8-system", "deckhouse-update-watchdog-v1-26-0")
+			Expect(job.Exists()).To(BeTrue())
+			container := job.Field("spec.template.spec.containers").Array()[0]
+			Expect(container.Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.25.0"))
+			Expect(container.Get("command").Array()[3].String()).To(Equal("--release=v1-26-0"))
+			Expect(container.Get("command").Array()[5].String()).To(Equal("--previous-release=v1-25-0"))
+			Expect(container.Get("command").Array()[8].String()).To(Equal("--timeout=30m0s"))
+			Expect(job.Field("spec.activeDeadlineSeconds").Int()).To(Equal(int64(2700)))
+		})
+	})
+
+	Context("New release is not ready after the timeout", func() {
+		BeforeEach(func() {
+			f.KubeStateSet(updatedDeckhouse(false) + deployedReleases + updatingConfigMap(time.Now().Add(-time.Hour)))
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should leave the rollback to the watchdog", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0").Field("status.phase").String()).To(Equal("Deployed"))
+			dep := f.KubernetesResource("Deployment", "d8-system", "deckhouse")
+			Expect(dep.Field("spec.template.spec.containers").Array()[0].Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.26.0"))
+			cm := f.KubernetesResource("ConfigMap", "d8-system", "d8-release-updating")
+			Expect(cm.Exists()).To(BeTrue())
+			Expect(cm.Field("data.failures").String()).To(Equal("deckhouse pod is not ready"))
+		})
+	})
+
+	Context("Failed release", func() {
+		BeforeEach(func() {
+			f.KubeStateSet(deckhousePodYaml + failedReleases)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should not be deployed again", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0").Field("status.phase").String()).To(Equal("Failed"))
+			dep := f.KubernetesResource("Deployment", "d8-system", "deckhouse")
+			Expect(dep.Field("spec.template.spec.containers").Array()[0].Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.25.0"))
+			Expect(f.MetricsCollector.CollectedMetrics()).To(ContainElement(HaveField("Name", "d8_release_failed")))
+		})
+	})
+})
+
+func queueMetrics(length int) string {
+	return fmt.Sprintf(`# TYPE deckhouse_tasks_queue_length gauge
+deckhouse_tasks_queue_length{queue="/modules/deckhouse/update_deckhouse_image"} 1
+deckhouse_tasks_queue_length{queue="main"} %d
+`, length)
+}
+
+func updatedDeckhouse(ready bool) string {
+	return fmt.Sprintf(`
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: deckhouse-6f46df5bd7-nk4j7
+  namespace: d8-system
+  labels:
+    app: deckhouse
+spec:
+  containers:
+    - name: deckhouse
+      image: my.registry.com/deckhouse:v1.26.0
+status:
+  podIP: 10.0.0.1
+  containerStatuses:
+    - imageID: my.registry.com/deckhouse@sha256:d57f01a88e54f863ff5365c989cb4e2654398fa274d46389e0af749090b862d1
+      ready: %t
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deckhouse
+  namespace: d8-system
+spec:
+  template:
+    spec:
+      containers:
+        - name: deckhouse
+          image: my.registry.com/deckhouse:v1.26.0
+`, ready)
+}
+
+func updatingConfigMap(deployedAt time.Time) string {
+	return fmt.Sprintf(`
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: d8-release-updating
+  namespace: d8-system
+data:
+  version: 1.26.0
+  previousVersion: 1.25.0
+  deployedAt: %s
+`, deployedAt.UTC().Format(time.RFC3339))
+}
+
+const (
+	deployedReleases = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseRelease
+metadata:
+  name: v1-25-0
+spec:
+  version: "v1.25.0"
+status:
+  phase: Outdated
+  approved: true
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseRelease
+metadata:
+  name: v1-26-0
+spec:
+  version: "v1.26.0"
+status:
+  phase: Deployed
+  approved: true
+`
+
+	watchdogJob = `
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: deckhouse-update-watchdog-v1-26-0
+  namespace: d8-system
+`
+
+	pendingRelease = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseRelease
+metadata:
+  name: v1-27-0
+spec:
+  version: "v1.27.0"
+status:
+  phase: Pending
+  approved: true
+`
+
+	failedReleases = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseRelease
+metadata:
+  name: v1-25-0
+spec:
+  version: "v1.25.0"
+status:
+  phase: Deployed
+  approved: true
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseRelease
+metadata:
+  name: v1-26-0
+spec:
+  version: "v1.26.0"
+status:
+  phase: Failed
+  approved: true
+  message: "Post-update verification failed after 30m0s: deckhouse pod is not ready"
+`
+)
+
+func mockHTTPResponses(responses map[string]string) {
+	dependency.TestDC.HTTPClient.DoMock.Set(func(req *http.Request) (*http.Response, error) {
+		body, ok := responses[req.URL.Host]
+		if !ok {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewBuffer(nil))}, nil
+		}
+		return &http.Response{
+			Header:     map[string][]string{"Content-Type": {"application/json"}},
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		}, nil
+	})
+}
+
+var _ = Describe("Modules :: deckhouse :: hooks :: update deckhouse image :: release policies ::", func() {
+	f := HookExecutionConfigInit(`{
+        "global": {
+          "modulesImages": {
+            "registry": "my.registry.com/deckhouse"
+          }
+        },
+        "deckhouse": {
+          "internal": {},
+          "releaseChannel": "Stable",
+          "update": {
+            "mode": "Auto"
+          }
+        }
+}`, `{}`)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "DeckhouseRelease", false)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "DeckhouseReleasePolicy", false)
+
+	Context("Release is not deployed long enough in dev clusters", func() {
+		BeforeEach(func() {
+			mockHTTPResponses(map[string]string{"fleet.example.com": fleetWithNotUpdatedCluster})
+
+			f.KubeStateSet(deckhousePodYaml + deckhouseReleases + deployedInDevPolicy)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should block the release with the rule name", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			rl := f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0")
+			Expect(rl.Field("status.phase").String()).To(Equal("Pending"))
+			Expect(rl.Field("status.message").String()).To(Equal(`Release is blocked by rule "soaked-in-dev" of DeckhouseReleasePolicy "production": version v1.26.0 is not deployed for 24h0m0s in 1 of 2 clusters: [dev-2]`))
+			dep := f.KubernetesResource("Deployment", "d8-system", "deckhouse")
+			Expect(dep.Field("spec.template.spec.containers").Array()[0].Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.25.0"))
+		})
+
+		Context("All dev clusters are updated", func() {
+			BeforeEach(func() {
+				mockHTTPResponses(map[string]string{"fleet.example.com": fleetUpdated})
+
+				f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+				f.RunHook()
+			})
+
+			It("Should deploy the release", func() {
+				Expect(f).To(ExecuteSuccessfully())
+				rl := f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0")
+				Expect(rl.Field("status.phase").String()).To(Equal("Deployed"))
+				Expect(rl.Field("status.message").String()).To(Equal(""))
+				dep := f.KubernetesResource("Deployment", "d8-system", "deckhouse")
+				Expect(dep.Field("spec.template.spec.containers").Array()[0].Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.26.0"))
+			})
+		})
+	})
+
+	Context("Fleet status is unavailable", func() {
+		BeforeEach(func() {
+			mockHTTPResponses(map[string]string{})
+
+			f.KubeStateSet(deckhousePodYaml + deckhouseReleases + deployedInDevPolicy)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should block the release", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			rl := f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0")
+			Expect(rl.Field("status.phase").String()).To(Equal("Pending"))
+			Expect(rl.Field("status.message").String()).To(Equal(`Release is blocked by rule "soaked-in-dev" of DeckhouseReleasePolicy "production": cannot get fleet status: unexpected status code 404`))
+		})
+	})
+
+	Context("Upmeter SLA dropped", func() {
+		BeforeEach(func() {
+			mockHTTPResponses(map[string]string{"upmeter.d8-upmeter": upmeterStatusResponse})
+
+			f.KubeStateSet(deckhousePodYaml + deckhouseReleases + upmeterSLAPolicy)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should block the release", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			rl := f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0")
+			Expect(rl.Field("status.phase").String()).To(Equal("Pending"))
+			Expect(rl.Field("status.message").String()).To(Equal(`Release is blocked by rule "control-plane-sla" of DeckhouseReleasePolicy "production": availability of control-plane is 99.000% for the last 24h0m0s, the minimum is 99.9%`))
+		})
+	})
+
+	Context("Auto-approve patch releases only", func() {
+		BeforeEach(func() {
+			f.KubeStateSet(deckhousePodYaml + deckhouseReleases + autoApprovePatchPolicy)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+			f.RunHook()
+		})
+
+		It("Should wait for manual approval of the minor release", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			rl := f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0")
+			Expect(rl.Field("status.phase").String()).To(Equal("Pending"))
+			Expect(rl.Field("status.message").String()).To(Equal("Waiting for manual approval, the release is not auto-approved by DeckhouseReleasePolicies"))
+		})
+
+		Context("Patch release", func() {
+			BeforeEach(func() {
+				f.KubeStateSet(deckhousePodYaml + deckhouseReleases + deckhousePatchRelease + autoApprovePatchPolicy)
+				f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+				f.RunHook()
+			})
+
+			It("Should deploy the patch release", func() {
+				Expect(f).To(ExecuteSuccessfully())
+				rl := f.KubernetesGlobalResource("DeckhouseRelease", "v1-25-1")
+				Expect(rl.Field("status.phase").String()).To(Equal("Deployed"))
+				dep := f.KubernetesResource("Deployment", "d8-system", "deckhouse")
+				Expect(dep.Field("spec.template.spec.containers").Array()[0].Get("image").String()).To(Equal("my.registry.com/deckhouse:v1.25.1"))
+			})
+		})
+
+		Context("Minor release is approved manually", func() {
+			BeforeEach(func() {
+				f.KubeStateSet(deckhousePodYaml + manualApprovedReleases + autoApprovePatchPolicy)
+				f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * * *"))
+				f.RunHook()
+			})
+
+			It("Should deploy the release", func() {
+				Expect(f).To(ExecuteSuccessfully())
+				rl := f.KubernetesGlobalResource("DeckhouseRelease", "v1-26-0")
+				Expect(rl.Field("status.phase").String()).To(Equal("Deployed"))
+			})
+		})
+	})
+})
+
+const (
+	deployedInDevPolicy = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseReleasePolicy
+metadata:
+  name: production
+spec:
+  rules:
+    - name: soaked-in-dev
+      deployedInClusters:
+        fleetStatusURL: https://fleet.example.com/status.json
+        clusterSelector:
+          matchLabels:
+            stage: dev
+        minimumTime: 24h
+`
+
+	upmeterSLAPolicy = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseReleasePolicy
+metadata:
+  name: production
+spec:
+  rules:
+    - name: control-plane-sla
+      upmeterSLA:
+        group: control-plane
+        minimumAvailability: 99.9
+`
+
+	autoApprovePatchPolicy = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: DeckhouseReleasePolicy
+metadata:
+  name: patches
+spec:
+  autoApprove: Patch
+`
+
+	fleetWithNotUpdatedCluster = `{"clusters": [
+  {"name": "dev-1", "labels": {"stage": "dev"}, "releases": [
+    {"version": "v1.25.0", "phase": "Outdated", "transitionTime": "2021-01-01T00:00:00Z"},
+    {"version": "v1.26.0", "phase": "Deployed", "transitionTime": "2021-01-01T00:00:00Z"}
+  ]},
+  {"name": "dev-2", "labels": {"stage": "dev"}, "releases": [
+    {"version": "v1.25.0", "phase": "Deployed", "transitionTime": "2021-01-01T00:00:00Z"}
+  ]},
+  {"name": "prod-1", "labels": {"stage": "prod"}, "releases": [
+    {"version": "v1.24.0", "phase": "Deployed", "transitionTime": "2021-01-01T00:00:00Z"}
+  ]}
+]}`
+
+	fleetUpdated = `{"clusters": [
+  {"name": "dev-1", "labels": {"stage": "dev"}, "releases": [
+    {"version": "v1.26.0", "phase": "Deployed", "transitionTime": "2021-01-01T00:00:00Z"}
+  ]},
+  {"name": "dev-2", "labels": {"stage": "dev"}, "releases": [
+    {"version": "v1.26.1", "phase": "Deployed", "transitionTime": "2021-01-01T00:00:00Z"}
+  ]}
+]}`
+
+	upmeterStatusResponse = `{"step": 300, "statuses": {"control-plane": {"__total__": [
+  {"ts": -1, "up": 85536000000000, "down": 864000000000}
+]}}}`
+)
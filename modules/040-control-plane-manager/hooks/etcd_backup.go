@@ -0,0 +1,137 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"sort"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/sdk"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	etcdBackupsPath = "controlPlaneManager.internal.etcdBackups"
+
+	etcdBackupDefaultLocalPath = "/var/lib/etcd-backup"
+	etcdBackupDefaultRetention = 7
+	// etcdBackupMaxNameLength keeps the d8-etcd-backup-<name> CronJob name within 52 characters
+	etcdBackupMaxNameLength = 37
+)
+
+type etcdBackup struct {
+	Name           string            `json:"name"`
+	Schedule       string            `json:"schedule"`
+	RetentionCount int               `json:"retentionCount"`
+	Storage        etcdBackupStorage `json:"storage"`
+}
+
+type etcdBackupStorage struct {
+	Type  string                `json:"type"`
+	Local *etcdBackupLocalStore `json:"local,omitempty"`
+	S3    *etcdBackupS3Store    `json:"s3,omitempty"`
+}
+
+type etcdBackupLocalStore struct {
+	Path string `json:"path"`
+}
+
+type etcdBackupS3Store struct {
+	Endpoint              string `json:"endpoint"`
+	Region                string `json:"region,omitempty"`
+	Bucket                string `json:"bucket"`
+	Prefix                string `json:"prefix,omitempty"`
+	CredentialsSecretName string `json:"credentialsSecretName"`
+}
+
+var _ = sdk.RegisterFunc(&go_hook.HookConfig{
+	Queue: moduleQueue,
+	Kubernetes: []go_hook.KubernetesConfig{
+		{
+			Name:       "etcd_backups",
+			ApiVersion: "deckhouse.io/v1alpha1",
+			Kind:       "EtcdBackup",
+			FilterFunc: etcdBackupFilter,
+		},
+	},
+}, handleEtcdBackups)
+
+func etcdBackupFilter(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	var cr struct {
+		Spec struct {
+			Schedule       string            `json:"schedule"`
+			RetentionCount int               `json:"retentionCount"`
+			Storage        etcdBackupStorage `json:"storage"`
+		} `json:"spec"`
+	}
+
+	err := sdk.FromUnstructured(obj, &cr)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := etcdBackup{
+		Name:           obj.GetName(),
+		Schedule:       cr.Spec.Schedule,
+		RetentionCount: cr.Spec.RetentionCount,
+		Storage:        cr.Spec.Storage,
+	}
+
+	if backup.RetentionCount == 0 {
+		backup.RetentionCount = etcdBackupDefaultRetention
+	}
+
+	switch backup.Storage.Type {
+	case "Local":
+		if backup.Storage.Local == nil || backup.Storage.Local.Path == "" {
+			backup.Storage.Local = &etcdBackupLocalStore{Path: etcdBackupDefaultLocalPath}
+		}
+		backup.Storage.S3 = nil
+	case "S3":
+		backup.Storage.Local = nil
+	}
+
+	return backup, nil
+}
+
+func handleEtcdBackups(input *go_hook.HookInput) error {
+	snap := input.Snapshots["etcd_backups"]
+
+	backups := make([]etcdBackup, 0, len(snap))
+	for _, s := range snap {
+		backup := s.(etcdBackup)
+
+		if len(backup.Name) > etcdBackupMaxNameLength {
+			input.LogEntry.Warnf("EtcdBackup %s is skipped: the name must be no more than %d characters", backup.Name, etcdBackupMaxNameLength)
+			continue
+		}
+		if backup.Storage.Type == "S3" && backup.Storage.S3 == nil {
+			input.LogEntry.Warnf("EtcdBackup %s is skipped: the s3 storage parameters are required", backup.Name)
+			continue
+		}
+
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name < backups[j].Name
+	})
+
+	input.Values.Set(etcdBackupsPath, backups)
+
+	return nil
+}
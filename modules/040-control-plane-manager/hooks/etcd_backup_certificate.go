@@ -0,0 +1,137 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"time"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/sdk"
+	"github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/pointer"
+
+	"github.com/deckhouse/deckhouse/go_lib/certificate"
+)
+
+/*
+This hook issues the etcd client certificate for the etcd backup Jobs,
+so the Jobs do not need the etcd CA key.
+The certificate is stored in the d8-etcd-backup-pki Secret and reissued if the etcd CA is changed or the certificate expires soon.
+*/
+
+const (
+	etcdBackupCertificatePath = "controlPlaneManager.internal.etcdBackupCertificate"
+	etcdBackupCertificateCN   = "d8-etcd-backup"
+	etcdBackupSecretName      = "d8-etcd-backup-pki"
+
+	etcdBackupCertificateExpiry      = 365 * 24 * time.Hour
+	etcdBackupCertificateRenewBefore = 30 * 24 * time.Hour
+)
+
+var _ = sdk.RegisterFunc(&go_hook.HookConfig{
+	OnBeforeHelm: &go_hook.OrderedConfig{Order: 10},
+	Queue:        moduleQueue,
+	Kubernetes: []go_hook.KubernetesConfig{
+		etcdSecretK8sConfig,
+		{
+			Name:       "etcd_backup_certificate",
+			ApiVersion: "v1",
+			Kind:       "Secret",
+			NamespaceSelector: &types.NamespaceSelector{
+				NameSelector: &types.NameSelector{
+					MatchNames: []string{"kube-system"},
+				},
+			},
+			NameSelector:                 &types.NameSelector{MatchNames: []string{etcdBackupSecretName}},
+			ExecuteHookOnSynchronization: pointer.BoolPtr(false),
+			ExecuteHookOnEvents:          pointer.BoolPtr(false),
+			FilterFunc:                   etcdBackupCertificateFilter,
+		},
+	},
+}, generateEtcdBackupCertificate)
+
+func etcdBackupCertificateFilter(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	if obj.GetName() != etcdBackupSecretName {
+		return nil, nil
+	}
+
+	var sec corev1.Secret
+
+	err := sdk.FromUnstructured(obj, &sec)
+	if err != nil {
+		return nil, err
+	}
+
+	return certificate.Certificate{
+		CA:   string(sec.Data["ca.crt"]),
+		Cert: string(sec.Data["tls.crt"]),
+		Key:  string(sec.Data["tls.key"]),
+	}, nil
+}
+
+func generateEtcdBackupCertificate(input *go_hook.HookInput) error {
+	if len(input.Values.Get(etcdBackupsPath).Array()) == 0 {
+		input.Values.Remove(etcdBackupCertificatePath)
+		return nil
+	}
+
+	var ca certificate.Certificate
+	for _, snap := range input.Snapshots["etcd-certificate"] {
+		if cert := snap.(certificate.Certificate); cert.CA != "" && cert.Key != "" {
+			ca = cert
+		}
+	}
+	if ca.CA == "" {
+		input.LogEntry.Warn("etcd CA is not found, etcd backups are not configured")
+		input.Values.Remove(etcdBackupCertificatePath)
+		return nil
+	}
+
+	for _, snap := range input.Snapshots["etcd_backup_certificate"] {
+		if snap == nil {
+			continue
+		}
+		cert := snap.(certificate.Certificate)
+		if cert.CA == ca.CA && cert.Cert != "" && cert.Key != "" {
+			expiring, err := certificate.IsCertificateExpiringSoon([]byte(cert.Cert), etcdBackupCertificateRenewBefore)
+			if err != nil {
+				return err
+			}
+			if !expiring {
+				input.Values.Set(etcdBackupCertificatePath, cert)
+				return nil
+			}
+		}
+	}
+
+	cert, err := certificate.GenerateSelfSignedCert(input.LogEntry,
+		etcdBackupCertificateCN,
+		certificate.Authority{Cert: ca.CA, Key: ca.Key},
+		certificate.WithSigningDefaultExpiry(etcdBackupCertificateExpiry),
+		certificate.WithSigningDefaultUsage([]string{"signing", "key encipherment", "client auth"}),
+	)
+	if err != nil {
+		return errors.Wrap(err, "generate etcd backup certificate")
+	}
+
+	input.Values.Set(etcdBackupCertificatePath, cert)
+
+	return nil
+}
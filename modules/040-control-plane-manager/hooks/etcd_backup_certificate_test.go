@@ -0,0 +1,167 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	"github.com/deckhouse/deckhouse/go_lib/certificate"
+	. "github.com/deckhouse/deckhouse/testing/hooks"
+)
+
+var _ = Describe("Modules :: control-plane-manager :: hooks :: etcd_backup_certificate ::", func() {
+	const backups = `[{"name": "main", "schedule": "@daily", "retentionCount": 7, "storage": {"type": "Local", "local": {"path": "/var/lib/etcd-backup"}}}]`
+
+	logEntry := logrus.NewEntry(logrus.New())
+	ca, _ := certificate.GenerateCA(logEntry, "etcd-ca")
+	otherCA, _ := certificate.GenerateCA(logEntry, "etcd-ca")
+
+	pkiSecret := func(ca certificate.Authority) string {
+		return fmt.Sprintf(`
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: d8-pki
+  namespace: kube-system
+data:
+  etcd-ca.crt: %s
+  etcd-ca.key: %s
+`, base64.StdEncoding.EncodeToString([]byte(ca.Cert)), base64.StdEncoding.EncodeToString([]byte(ca.Key)))
+	}
+
+	backupSecret := func(cert certificate.Certificate) string {
+		return fmt.Sprintf(`
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: d8-etcd-backup-pki
+  namespace: kube-system
+data:
+  ca.crt: %s
+  tls.crt: %s
+  tls.key: %s
+`, base64.StdEncoding.EncodeToString([]byte(cert.CA)), base64.StdEncoding.EncodeToString([]byte(cert.Cert)), base64.StdEncoding.EncodeToString([]byte(cert.Key)))
+	}
+
+	issued, _ := certificate.GenerateSelfSignedCert(logEntry, etcdBackupCertificateCN, ca,
+		certificate.WithSigningDefaultExpiry(etcdBackupCertificateExpiry),
+		certificate.WithSigningDefaultUsage([]string{"signing", "key encipherment", "client auth"}),
+	)
+
+	f := HookExecutionConfigInit(`{"controlPlaneManager":{"internal":{}}}`, `{}`)
+
+	Context("There are no etcd backups", func() {
+		BeforeEach(func() {
+			f.KubeStateSet(pkiSecret(ca))
+			f.BindingContexts.Set(f.GenerateBeforeHelmContext())
+			f.RunHook()
+		})
+
+		It("Should not issue the certificate", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.ValuesGet(etcdBackupCertificatePath).Exists()).To(BeFalse())
+		})
+	})
+
+	Context("The certificate is not issued yet", func() {
+		BeforeEach(func() {
+			f.ValuesSetFromYaml(etcdBackupsPath, []byte(backups))
+			f.KubeStateSet(pkiSecret(ca))
+			f.BindingContexts.Set(f.GenerateBeforeHelmContext())
+			f.RunHook()
+		})
+
+		It("Should issue the client certificate signed by the etcd CA", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.ValuesGet(etcdBackupCertificatePath + ".ca").String()).To(Equal(ca.Cert))
+			Expect(f.ValuesGet(etcdBackupCertificatePath + ".key").String()).ToNot(BeEmpty())
+
+			caCert, err := certificate.ParseCertificate(ca.Cert)
+			Expect(err).ToNot(HaveOccurred())
+			cert, err := certificate.ParseCertificate(f.ValuesGet(etcdBackupCertificatePath + ".cert").String())
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(cert.Subject.CommonName).To(Equal(etcdBackupCertificateCN))
+			Expect(cert.IsCA).To(BeFalse())
+
+			roots := x509.NewCertPool()
+			roots.AddCert(caCert)
+			_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("The certificate is issued", func() {
+		BeforeEach(func() {
+			f.ValuesSetFromYaml(etcdBackupsPath, []byte(backups))
+			f.KubeStateSet(pkiSecret(ca) + backupSecret(issued))
+			f.BindingContexts.Set(f.GenerateBeforeHelmContext())
+			f.RunHook()
+		})
+
+		It("Should keep the certificate", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.ValuesGet(etcdBackupCertificatePath + ".cert").String()).To(Equal(issued.Cert))
+			Expect(f.ValuesGet(etcdBackupCertificatePath + ".key").String()).To(Equal(issued.Key))
+		})
+	})
+
+	Context("The etcd CA is changed", func() {
+		BeforeEach(func() {
+			f.ValuesSetFromYaml(etcdBackupsPath, []byte(backups))
+			f.KubeStateSet(pkiSecret(otherCA) + backupSecret(issued))
+			f.BindingContexts.Set(f.GenerateBeforeHelmContext())
+			f.RunHook()
+		})
+
+		It("Should reissue the certificate", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.ValuesGet(etcdBackupCertificatePath + ".ca").String()).To(Equal(otherCA.Cert))
+			Expect(f.ValuesGet(etcdBackupCertificatePath + ".cert").String()).ToNot(Equal(issued.Cert))
+		})
+	})
+
+	Context("The certificate expires soon", func() {
+		BeforeEach(func() {
+			expiring, _ := certificate.GenerateSelfSignedCert(logEntry, etcdBackupCertificateCN, ca,
+				certificate.WithSigningDefaultExpiry(24*time.Hour),
+				certificate.WithSigningDefaultUsage([]string{"signing", "key encipherment", "client auth"}),
+			)
+
+			f.ValuesSetFromYaml(etcdBackupsPath, []byte(backups))
+			f.KubeStateSet(pkiSecret(ca) + backupSecret(expiring))
+			f.BindingContexts.Set(f.GenerateBeforeHelmContext())
+			f.RunHook()
+		})
+
+		It("Should reissue the certificate", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			cert, err := certificate.ParseCertificate(f.ValuesGet(etcdBackupCertificatePath + ".cert").String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cert.NotAfter).To(BeTemporally(">", time.Now().Add(300*24*time.Hour)))
+		})
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/deckhouse/deckhouse/testing/hooks"
+)
+
+var _ = Describe("Modules :: control-plane-manager :: hooks :: etcd_backup ::", func() {
+	const (
+		localBackup = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: EtcdBackup
+metadata:
+  name: main
+spec:
+  schedule: "0 */6 * * *"
+  storage:
+    type: Local
+`
+		s3Backup = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: EtcdBackup
+metadata:
+  name: daily
+spec:
+  schedule: "@daily"
+  retentionCount: 30
+  storage:
+    type: S3
+    local:
+      path: /ignored
+    s3:
+      endpoint: https://s3.example.com
+      bucket: etcd-backups
+      prefix: production
+      credentialsSecretName: etcd-backup-s3
+`
+		invalidBackups = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: EtcdBackup
+metadata:
+  name: this-etcd-backup-name-is-too-long-for-the-cronjob
+spec:
+  schedule: "@daily"
+  storage:
+    type: Local
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: EtcdBackup
+metadata:
+  name: no-s3
+spec:
+  schedule: "@daily"
+  storage:
+    type: S3
+`
+	)
+
+	f := HookExecutionConfigInit(`{"controlPlaneManager":{"internal":{}}}`, `{}`)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "EtcdBackup", false)
+
+	Context("Empty cluster", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(``))
+			f.RunHook()
+		})
+
+		It("Must set empty etcdBackups", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.ValuesGet("controlPlaneManager.internal.etcdBackups").String()).To(MatchJSON(`[]`))
+		})
+	})
+
+	Context("Cluster with EtcdBackups", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(localBackup + s3Backup + invalidBackups))
+			f.RunHook()
+		})
+
+		It("Must set valid EtcdBackups sorted by name with defaults", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(f.ValuesGet("controlPlaneManager.internal.etcdBackups").String()).To(MatchJSON(`
+[
+  {
+    "name": "daily",
+    "schedule": "@daily",
+    "retentionCount": 30,
+    "storage": {
+      "type": "S3",
+      "s3": {
+        "endpoint": "https://s3.example.com",
+        "bucket": "etcd-backups",
+        "prefix": "production",
+        "credentialsSecretName": "etcd-backup-s3"
+      }
+    }
+  },
+  {
+    "name": "main",
+    "schedule": "0 */6 * * *",
+    "retentionCount": 7,
+    "storage": {
+      "type": "Local",
+      "local": {
+        "path": "/var/lib/etcd-backup"
+      }
+    }
+  }
+]`))
+		})
+
+		Context("EtcdBackup is deleted", func() {
+			BeforeEach(func() {
+				f.BindingContexts.Set(f.KubeStateSet(localBackup))
+				f.RunHook()
+			})
+
+			It("Must remove it from values", func() {
+				Expect(f).To(ExecuteSuccessfully())
+				Expect(f.ValuesGet("controlPlaneManager.internal.etcdBackups.#.name").String()).To(MatchJSON(`["main"]`))
+			})
+		})
+	})
+})
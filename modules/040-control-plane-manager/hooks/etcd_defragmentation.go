@@ -0,0 +1,386 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook/metrics"
+	"github.com/flant/addon-operator/sdk"
+	"github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	"github.com/deckhouse/deckhouse/go_lib/dependency/etcd"
+)
+
+// Members are defragmented one at a time: the defragmented member does not serve requests until it is done,
+// so the rest of the cluster must keep the quorum. The leader is defragmented last to avoid extra elections.
+
+const (
+	etcdDefragmentationGroup = "etcd_defragmentation"
+
+	// a member is defragmented when the free space is at least defragMinFreeBytes and
+	// either it is at least defragFreeRatio of the database or the database is close to the quota
+	defragMinFreeBytes = 64 * 1024 * 1024
+	defragFreeRatio    = 0.5
+	defragQuotaRatio   = 0.8
+
+	defragTimeout = 5 * time.Minute
+	etcdTimeout   = 15 * time.Second
+)
+
+var _ = sdk.RegisterFunc(&go_hook.HookConfig{
+	Queue: moduleQueue + "/etcd_maintenance",
+	Schedule: []go_hook.ScheduleConfig{
+		{
+			Name:    "etcd-defragmentation",
+			Crontab: "*/15 * * * *",
+		},
+	},
+	Kubernetes: []go_hook.KubernetesConfig{
+		{
+			Name:       "etcd_endpoints",
+			ApiVersion: "v1",
+			Kind:       "Pod",
+			NamespaceSelector: &types.NamespaceSelector{
+				NameSelector: &types.NameSelector{
+					MatchNames: []string{"kube-system"},
+				},
+			},
+			LabelSelector: &v1.LabelSelector{
+				MatchLabels: map[string]string{
+					"component": "etcd",
+					"tier":      "control-plane",
+				},
+			},
+			FieldSelector: &types.FieldSelector{
+				MatchExpressions: []types.FieldSelectorRequirement{
+					{
+						Field:    "status.phase",
+						Operator: "Equals",
+						Value:    "Running",
+					},
+				},
+			},
+			ExecuteHookOnSynchronization: pointer.BoolPtr(false),
+			ExecuteHookOnEvents:          pointer.BoolPtr(false),
+			FilterFunc:                   maintenanceEtcdFilter,
+		},
+		// common etcd certificate snapshot
+		etcdSecretK8sConfig,
+	},
+}, dependency.WithExternalDependencies(etcdDefragmentationHandler))
+
+type etcdMemberStatus struct {
+	Instance *etcdInstance
+
+	MemberID    uint64
+	IsLeader    bool
+	DbSize      int64
+	DbSizeInUse int64
+	Revision    int64
+
+	Err error
+}
+
+func (s *etcdMemberStatus) healthy() bool {
+	return s.Err == nil
+}
+
+func (s *etcdMemberStatus) needDefragmentation(noSpace bool) bool {
+	free := s.DbSize - s.DbSizeInUse
+	if noSpace {
+		return free > 0
+	}
+	if free < defragMinFreeBytes {
+		return false
+	}
+
+	return float64(free) >= float64(s.DbSize)*defragFreeRatio ||
+		float64(s.DbSize) >= float64(s.Instance.MaxDbSize)*defragQuotaRatio
+}
+
+func etcdDefragmentationHandler(input *go_hook.HookInput, dc dependency.Container) error {
+	input.MetricsCollector.Expire(etcdDefragmentationGroup)
+
+	snap := input.Snapshots["etcd_endpoints"]
+	if len(snap) == 0 {
+		input.LogEntry.Debug("No etcd Pods found in snapshot, skipping iteration")
+		return nil
+	}
+
+	instances := make([]*etcdInstance, 0, len(snap))
+	endpoints := make([]string, 0, len(snap))
+	for _, s := range snap {
+		instance := s.(*etcdInstance)
+		instances = append(instances, instance)
+		endpoints = append(endpoints, instance.Endpoint)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Node < instances[j].Node })
+
+	etcdcli, err := getETCDClient(input, dc, endpoints)
+	if err != nil {
+		return err
+	}
+	defer etcdcli.Close()
+
+	statuses := getEtcdMemberStatuses(etcdcli, instances)
+	for _, st := range statuses {
+		if !st.healthy() {
+			input.LogEntry.Warnf("etcd member on node %s is unhealthy: %v", st.Instance.Node, st.Err)
+			continue
+		}
+		labels := map[string]string{"node": st.Instance.Node}
+		input.MetricsCollector.Set("d8_etcd_db_size_bytes", float64(st.DbSize), labels, metrics.WithGroup(etcdDefragmentationGroup))
+		input.MetricsCollector.Set("d8_etcd_db_size_in_use_bytes", float64(st.DbSizeInUse), labels, metrics.WithGroup(etcdDefragmentationGroup))
+	}
+
+	noSpaceAlarms, err := getEtcdNoSpaceAlarms(etcdcli)
+	if err != nil {
+		return err
+	}
+	noSpace := 0.0
+	if len(noSpaceAlarms) > 0 {
+		noSpace = 1.0
+	}
+	input.MetricsCollector.Set("d8_etcd_nospace_alarm", noSpace, map[string]string{}, metrics.WithGroup(etcdDefragmentationGroup))
+
+	if enabled := input.Values.Get("controlPlaneManager.etcd.autoDefragmentation"); enabled.Exists() && !enabled.Bool() {
+		input.LogEntry.Debug("etcd auto defragmentation is disabled")
+		return nil
+	}
+
+	if len(noSpaceAlarms) > 0 {
+		// the space is freed by the defragmentation only if the old revisions are compacted
+		if err := compactEtcd(etcdcli, statuses); err != nil {
+			return err
+		}
+		statuses = getEtcdMemberStatuses(etcdcli, instances)
+	}
+
+	// followers first, the leader last
+	sort.SliceStable(statuses, func(i, j int) bool { return !statuses[i].IsLeader && statuses[j].IsLeader })
+
+	for _, candidate := range statuses {
+		if !candidate.healthy() || !candidate.needDefragmentation(len(noSpaceAlarms) > 0) {
+			continue
+		}
+
+		if err := checkEtcdQuorum(etcdcli, instances, candidate.Instance); err != nil {
+			input.LogEntry.Warnf("Skip etcd defragmentation on node %s: %v", candidate.Instance.Node, err)
+			return nil
+		}
+
+		input.LogEntry.Infof("Defragmenting etcd member on node %s: db size %d, in use %d", candidate.Instance.Node, candidate.DbSize, candidate.DbSizeInUse)
+
+		labels := map[string]string{"node": candidate.Instance.Node}
+		if err := defragmentEtcdMember(etcdcli, candidate.Instance.Endpoint); err != nil {
+			input.MetricsCollector.Set("d8_etcd_defragmentation_failed", 1.0, labels, metrics.WithGroup(etcdDefragmentationGroup))
+			return fmt.Errorf("defragment etcd member on node %s: %v", candidate.Instance.Node, err)
+		}
+
+		// without the group the metric keeps the value between runs
+		input.MetricsCollector.Set("d8_etcd_defragmentation_last_success_timestamp_seconds", float64(time.Now().Unix()), labels)
+	}
+
+	if len(noSpaceAlarms) > 0 {
+		return disarmEtcdNoSpaceAlarms(input, etcdcli, getEtcdMemberStatuses(etcdcli, instances), noSpaceAlarms)
+	}
+
+	return nil
+}
+
+func getEtcdMemberStatuses(etcdcli etcd.Client, instances []*etcdInstance) []*etcdMemberStatus {
+	statuses := make([]*etcdMemberStatus, 0, len(instances))
+
+	for _, instance := range instances {
+		st := &etcdMemberStatus{Instance: instance}
+		statuses = append(statuses, st)
+
+		ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+		resp, err := etcdcli.Status(ctx, instance.Endpoint)
+		cancel()
+		if err != nil {
+			st.Err = err
+			continue
+		}
+		if errs := etcdStatusErrors(resp.Errors); len(errs) > 0 {
+			st.Err = fmt.Errorf("%v", errs)
+			continue
+		}
+		if resp.Leader == 0 {
+			st.Err = errors.New("member has no leader")
+			continue
+		}
+
+		st.MemberID = resp.Header.MemberId
+		st.IsLeader = resp.Leader == resp.Header.MemberId
+		st.DbSize = resp.DbSize
+		st.DbSizeInUse = resp.DbSizeInUse
+		st.Revision = resp.Header.Revision
+	}
+
+	return statuses
+}
+
+// etcdStatusErrors drops the active alarms from the member status errors. etcd reports the alarms of the whole
+// cluster there (e.g. "memberID:2 alarm:NOSPACE "), they do not mean the member is unhealthy.
+func etcdStatusErrors(errs []string) []string {
+	result := make([]string, 0, len(errs))
+	for _, e := range errs {
+		if strings.Contains(e, "alarm:") {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// checkEtcdQuorum checks that the cluster keeps the quorum while the member is defragmented.
+func checkEtcdQuorum(etcdcli etcd.Client, instances []*etcdInstance, defragmented *etcdInstance) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	membersResp, err := etcdcli.MemberList(ctx)
+	if err != nil {
+		return fmt.Errorf("list etcd members: %v", err)
+	}
+
+	var voting int
+	for _, m := range membersResp.Members {
+		if !m.IsLearner {
+			voting++
+		}
+	}
+
+	healthy := 0
+	for _, st := range getEtcdMemberStatuses(etcdcli, instances) {
+		if st.Instance == defragmented {
+			if !st.healthy() {
+				return fmt.Errorf("member is unhealthy: %v", st.Err)
+			}
+			continue
+		}
+		if st.healthy() {
+			healthy++
+		}
+	}
+
+	// a single member cluster is unavailable during the defragmentation anyway
+	if voting <= 1 {
+		return nil
+	}
+
+	if quorum := voting/2 + 1; healthy < quorum {
+		return fmt.Errorf("only %d of %d other members are healthy, the quorum of %d will be lost", healthy, voting-1, quorum)
+	}
+
+	return nil
+}
+
+func defragmentEtcdMember(etcdcli etcd.Client, endpoint string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defragTimeout)
+	defer cancel()
+
+	_, err := etcdcli.Defragment(ctx, endpoint)
+	return err
+}
+
+func compactEtcd(etcdcli etcd.Client, statuses []*etcdMemberStatus) error {
+	var revision int64
+	for _, st := range statuses {
+		if st.healthy() && st.Revision > revision {
+			revision = st.Revision
+		}
+	}
+	if revision == 0 {
+		return errors.New("cannot get the current etcd revision to compact")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defragTimeout)
+	defer cancel()
+
+	_, err := etcdcli.Compact(ctx, revision, clientv3.WithCompactPhysical())
+	if err != nil && !errors.Is(err, rpctypes.ErrCompacted) {
+		return fmt.Errorf("compact etcd to revision %d: %v", revision, err)
+	}
+
+	return nil
+}
+
+func getEtcdNoSpaceAlarms(etcdcli etcd.Client) ([]*etcdserverpb.AlarmMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	resp, err := etcdcli.AlarmList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list etcd alarms: %v", err)
+	}
+
+	alarms := make([]*etcdserverpb.AlarmMember, 0)
+	for _, alarm := range resp.Alarms {
+		if alarm.Alarm == etcdserverpb.AlarmType_NOSPACE {
+			alarms = append(alarms, alarm)
+		}
+	}
+
+	return alarms, nil
+}
+
+// disarmEtcdNoSpaceAlarms disarms NOSPACE alarms of members whose database fits the quota after the defragmentation.
+func disarmEtcdNoSpaceAlarms(input *go_hook.HookInput, etcdcli etcd.Client, statuses []*etcdMemberStatus, alarms []*etcdserverpb.AlarmMember) error {
+	byID := make(map[uint64]*etcdMemberStatus, len(statuses))
+	for _, st := range statuses {
+		if st.healthy() {
+			byID[st.MemberID] = st
+		}
+	}
+
+	for _, alarm := range alarms {
+		st, ok := byID[alarm.MemberID]
+		if !ok {
+			input.LogEntry.Warnf("Cannot disarm NOSPACE alarm of etcd member %x: member status is unknown", alarm.MemberID)
+			continue
+		}
+		if st.DbSize >= st.Instance.MaxDbSize {
+			input.LogEntry.Warnf("Cannot disarm NOSPACE alarm of etcd member on node %s: db size %d still exceeds the quota %d", st.Instance.Node, st.DbSize, st.Instance.MaxDbSize)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+		_, err := etcdcli.AlarmDisarm(ctx, &clientv3.AlarmMember{MemberID: alarm.MemberID, Alarm: etcdserverpb.AlarmType_NOSPACE})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("disarm NOSPACE alarm of etcd member on node %s: %v", st.Instance.Node, err)
+		}
+
+		input.LogEntry.Infof("NOSPACE alarm of etcd member on node %s is disarmed", st.Instance.Node)
+	}
+
+	return nil
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	. "github.com/deckhouse/deckhouse/testing/hooks"
+)
+
+var _ = Describe("Modules :: controler-plane-manager :: hooks :: etcd_defragmentation ::", func() {
+	const (
+		mb = 1024 * 1024
+	)
+
+	type fakeEtcdMember struct {
+		ID          uint64
+		DbSize      int64
+		DbSizeInUse int64
+		Err         error
+	}
+
+	var (
+		members      map[string]*fakeEtcdMember
+		leader       uint64
+		alarms       []*etcdserverpb.AlarmMember
+		defragmented []string
+		compacted    int64
+		disarmed     []uint64
+	)
+
+	etcdPods := testETCDSecret
+	for i := 1; i <= 3; i++ {
+		etcdPods += "---\n" + etcdPodManifest(map[string]interface{}{
+			"name":      fmt.Sprintf("etcd-main-master-%d", i),
+			"nodeName":  fmt.Sprintf("main-master-%d", i),
+			"hostIP":    fmt.Sprintf("192.168.1.%d", i),
+			"maxDbSize": 2048 * mb,
+		})
+	}
+
+	setEtcdMock := func() {
+		defragmented = nil
+		compacted = 0
+		disarmed = nil
+
+		dependency.TestDC.EtcdClient.CloseMock.Return(nil)
+
+		dependency.TestDC.EtcdClient.StatusMock.Set(func(_ context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+			m := members[endpoint]
+			if m.Err != nil {
+				return nil, m.Err
+			}
+			resp := &clientv3.StatusResponse{
+				Header:      &etcdserverpb.ResponseHeader{MemberId: m.ID, Revision: 1000},
+				Leader:      leader,
+				DbSize:      m.DbSize,
+				DbSizeInUse: m.DbSizeInUse,
+			}
+			// etcd reports active alarms of the cluster as the status errors of every member
+			for _, alarm := range alarms {
+				resp.Errors = append(resp.Errors, alarm.String())
+			}
+			return resp, nil
+		})
+
+		dependency.TestDC.EtcdClient.MemberListMock.Set(func(_ context.Context) (*clientv3.MemberListResponse, error) {
+			resp := &clientv3.MemberListResponse{}
+			for _, m := range members {
+				resp.Members = append(resp.Members, &etcdserverpb.Member{ID: m.ID})
+			}
+			return resp, nil
+		})
+
+		dependency.TestDC.EtcdClient.AlarmListMock.Set(func(_ context.Context) (*clientv3.AlarmResponse, error) {
+			return &clientv3.AlarmResponse{Alarms: alarms}, nil
+		})
+
+		dependency.TestDC.EtcdClient.DefragmentMock.Set(func(_ context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+			defragmented = append(defragmented, endpoint)
+			members[endpoint].DbSize = members[endpoint].DbSizeInUse
+			return &clientv3.DefragmentResponse{}, nil
+		})
+
+		dependency.TestDC.EtcdClient.CompactMock.Set(func(_ context.Context, rev int64, _ ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+			compacted = rev
+			for _, m := range members {
+				m.DbSizeInUse /= 4
+			}
+			return &clientv3.CompactResponse{}, nil
+		})
+
+		dependency.TestDC.EtcdClient.AlarmDisarmMock.Set(func(_ context.Context, am *clientv3.AlarmMember) (*clientv3.AlarmResponse, error) {
+			disarmed = append(disarmed, am.MemberID)
+			return &clientv3.AlarmResponse{}, nil
+		})
+	}
+
+	setMembers := func(dbSize, inUse int64) {
+		members = map[string]*fakeEtcdMember{}
+		for i := 1; i <= 3; i++ {
+			members[fmt.Sprintf("https://192.168.1.%d:2379", i)] = &fakeEtcdMember{
+				ID:          uint64(i),
+				DbSize:      dbSize,
+				DbSizeInUse: inUse,
+			}
+		}
+		// main-master-1 is the leader
+		leader = 1
+		alarms = nil
+	}
+
+	metricValue := func(f *HookExecutionConfig, name, node string) *float64 {
+		for _, m := range f.MetricsCollector.CollectedMetrics() {
+			if m.Name == name && m.Labels["node"] == node {
+				return m.Value
+			}
+		}
+		return nil
+	}
+
+	f := HookExecutionConfigInit(`{"controlPlaneManager":{"internal": {}, "apiserver": {"authn": {}, "authz": {}}}}`, "")
+
+	runHook := func() {
+		setEtcdMock()
+		f.BindingContexts.Set(f.KubeStateSet(etcdPods))
+		f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * *"))
+		f.RunHook()
+	}
+
+	Context("etcd is not fragmented", func() {
+		BeforeEach(func() {
+			setMembers(200*mb, 180*mb)
+			runHook()
+		})
+
+		It("Members are not defragmented, db size metrics are exported", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(defragmented).To(BeEmpty())
+
+			Expect(*metricValue(f, "d8_etcd_db_size_bytes", "main-master-2")).To(Equal(float64(200 * mb)))
+			Expect(*metricValue(f, "d8_etcd_db_size_in_use_bytes", "main-master-2")).To(Equal(float64(180 * mb)))
+			Expect(metricValue(f, "d8_etcd_defragmentation_last_success_timestamp_seconds", "main-master-2")).To(BeNil())
+		})
+	})
+
+	Context("etcd is fragmented", func() {
+		BeforeEach(func() {
+			setMembers(1000*mb, 200*mb)
+			runHook()
+		})
+
+		It("Members are defragmented one by one, the leader is the last", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(defragmented).To(Equal([]string{
+				"https://192.168.1.2:2379",
+				"https://192.168.1.3:2379",
+				"https://192.168.1.1:2379",
+			}))
+			Expect(compacted).To(BeZero())
+			Expect(metricValue(f, "d8_etcd_defragmentation_last_success_timestamp_seconds", "main-master-1")).ToNot(BeNil())
+		})
+
+		Context("Auto defragmentation is disabled", func() {
+			BeforeEach(func() {
+				setMembers(1000*mb, 200*mb)
+				f.ValuesSet("controlPlaneManager.etcd.autoDefragmentation", false)
+				runHook()
+			})
+
+			It("Members are not defragmented", func() {
+				Expect(f).To(ExecuteSuccessfully())
+				Expect(defragmented).To(BeEmpty())
+				Expect(*metricValue(f, "d8_etcd_db_size_bytes", "main-master-1")).To(Equal(float64(1000 * mb)))
+			})
+		})
+	})
+
+	Context("etcd database is close to the quota", func() {
+		BeforeEach(func() {
+			setMembers(1800*mb, 1600*mb)
+			runHook()
+		})
+
+		It("Members are defragmented", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(defragmented).To(HaveLen(3))
+		})
+	})
+
+	Context("One of the members is unhealthy", func() {
+		BeforeEach(func() {
+			setMembers(1000*mb, 200*mb)
+			members["https://192.168.1.3:2379"].Err = errors.New("context deadline exceeded")
+			runHook()
+		})
+
+		It("Members are not defragmented to keep the quorum", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(defragmented).To(BeEmpty())
+			Expect(metricValue(f, "d8_etcd_db_size_bytes", "main-master-3")).To(BeNil())
+		})
+	})
+
+	Context("Defragmentation fails", func() {
+		BeforeEach(func() {
+			setMembers(1000*mb, 200*mb)
+			setEtcdMock()
+			dependency.TestDC.EtcdClient.DefragmentMock.Set(func(_ context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+				defragmented = append(defragmented, endpoint)
+				return nil, errors.New("timeout")
+			})
+			f.BindingContexts.Set(f.KubeStateSet(etcdPods))
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/15 * * * *"))
+			f.RunHook()
+		})
+
+		It("Hook fails after the first member, the failure metric is set", func() {
+			Expect(f).ToNot(ExecuteSuccessfully())
+			Expect(defragmented).To(Equal([]string{"https://192.168.1.2:2379"}))
+			Expect(*metricValue(f, "d8_etcd_defragmentation_failed", "main-master-2")).To(Equal(1.0))
+		})
+	})
+
+	Context("NOSPACE alarm is raised", func() {
+		BeforeEach(func() {
+			setMembers(2048*mb, 2000*mb)
+			alarms = []*etcdserverpb.AlarmMember{
+				{MemberID: 2, Alarm: etcdserverpb.AlarmType_NOSPACE},
+			}
+			runHook()
+		})
+
+		It("etcd is compacted, all members are defragmented and the alarm is disarmed", func() {
+			Expect(f).To(ExecuteSuccessfully())
+			Expect(compacted).To(Equal(int64(1000)))
+			Expect(defragmented).To(HaveLen(3))
+			Expect(defragmented[2]).To(Equal("https://192.168.1.1:2379"))
+			Expect(disarmed).To(Equal([]uint64{2}))
+
+			for _, m := range f.MetricsCollector.CollectedMetrics() {
+				if m.Name == "d8_etcd_nospace_alarm" {
+					Expect(*m.Value).To(Equal(1.0))
+				}
+			}
+		})
+	})
+})
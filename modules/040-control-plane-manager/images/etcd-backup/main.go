@@ -0,0 +1,209 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+const (
+	StorageLocal = "Local"
+	StorageS3    = "S3"
+
+	// timeFormat is a part of snapshot names, it is sortable and safe for file names and S3 keys
+	timeFormat = "20060102T150405Z"
+)
+
+type config struct {
+	name      string
+	endpoints []string
+	retention int
+	timeout   time.Duration
+	tmpDir    string
+
+	caFile, certFile, keyFile string
+
+	storage    string
+	localPath  string
+	s3Endpoint string
+	s3Region   string
+	s3Bucket   string
+	s3Prefix   string
+}
+
+func main() {
+	var cfg config
+	var endpoints string
+
+	flag.StringVar(&cfg.name, "name", "", "Name of the EtcdBackup, it is the prefix of snapshot names.")
+	flag.StringVar(&endpoints, "endpoints", "", "Comma separated etcd endpoints.")
+	flag.IntVar(&cfg.retention, "retention-count", 7, "Number of snapshots to keep.")
+	flag.DurationVar(&cfg.timeout, "timeout", 30*time.Minute, "Timeout to take, verify and store the snapshot.")
+	flag.StringVar(&cfg.tmpDir, "tmp-dir", os.TempDir(), "Directory to receive the snapshot to.")
+	flag.StringVar(&cfg.caFile, "cacert", "/etc/etcd/pki/ca.crt", "etcd CA certificate.")
+	flag.StringVar(&cfg.certFile, "cert", "/etc/etcd/pki/ca.crt", "etcd client certificate.")
+	flag.StringVar(&cfg.keyFile, "key", "/etc/etcd/pki/ca.key", "etcd client key.")
+	flag.StringVar(&cfg.storage, "storage", StorageLocal, "Storage type: Local or S3.")
+	flag.StringVar(&cfg.localPath, "local-path", "/var/lib/etcd-backup", "Directory for the Local storage.")
+	flag.StringVar(&cfg.s3Endpoint, "s3-endpoint", "", "S3 endpoint URL, e.g. https://s3.amazonaws.com.")
+	flag.StringVar(&cfg.s3Region, "s3-region", "", "S3 region.")
+	flag.StringVar(&cfg.s3Bucket, "s3-bucket", "", "S3 bucket.")
+	flag.StringVar(&cfg.s3Prefix, "s3-prefix", "", "Prefix of S3 keys.")
+	flag.Parse()
+
+	for _, e := range strings.Split(endpoints, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			cfg.endpoints = append(cfg.endpoints, e)
+		}
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(cfg config) error {
+	if cfg.name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	if len(cfg.endpoints) == 0 {
+		return fmt.Errorf("-endpoints are required")
+	}
+	if cfg.retention < 1 {
+		return fmt.Errorf("-retention-count must be positive")
+	}
+
+	st, err := newStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := loadTLSConfig(cfg.caFile, cfg.certFile, cfg.keyFile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+
+	return backup(ctx, cfg, st, func(endpoints []string) (etcdClient, error) {
+		return clientv3.New(clientv3.Config{
+			Endpoints:   endpoints,
+			DialTimeout: 10 * time.Second,
+			DialOptions: []grpc.DialOption{grpc.WithBlock()},
+			TLS:         tlsConfig,
+			Logger:      zap.NewNop(),
+		})
+	}, time.Now())
+}
+
+// backup takes the snapshot from a healthy member, verifies and stores it, then prunes old snapshots.
+func backup(ctx context.Context, cfg config, st storage, dial dialFunc, now time.Time) error {
+	client, err := dial(cfg.endpoints)
+	if err != nil {
+		return fmt.Errorf("connect to etcd: %v", err)
+	}
+	m, err := selectMember(ctx, client, cfg.endpoints)
+	client.Close()
+	if err != nil {
+		return err
+	}
+	log.Printf("Taking snapshot from %s (member %x, leader %t, revision %d)", m.Endpoint, m.MemberID, m.IsLeader, m.Revision)
+
+	name := cfg.name + "_" + now.UTC().Format(timeFormat)
+
+	tmp := filepath.Join(cfg.tmpDir, name+snapshotExt)
+	defer os.Remove(tmp)
+
+	revision, err := takeSnapshot(ctx, dial, m, tmp)
+	if err != nil {
+		return err
+	}
+
+	info, err := verifySnapshot(tmp, revision)
+	if err != nil {
+		return fmt.Errorf("verify snapshot from %s: %v", m.Endpoint, err)
+	}
+	info.Member = m.Endpoint
+	info.CreatedAt = now.UTC()
+	log.Printf("Snapshot %s is verified: revision %d, %d bytes, sha256 %s", name, info.Revision, info.Size, info.SHA256)
+
+	if err := st.Put(ctx, name, tmp, info); err != nil {
+		return fmt.Errorf("store snapshot %s: %v", name, err)
+	}
+	log.Printf("Snapshot %s is stored", name)
+
+	deleted, err := prune(ctx, st, cfg.name+"_", cfg.retention)
+	if err != nil {
+		return fmt.Errorf("prune snapshots: %v", err)
+	}
+	for _, d := range deleted {
+		log.Printf("Snapshot %s is deleted by retention", d)
+	}
+
+	return nil
+}
+
+func newStorage(cfg config) (storage, error) {
+	switch cfg.storage {
+	case StorageLocal:
+		return localStorage{dir: cfg.localPath}, nil
+	case StorageS3:
+		if cfg.s3Endpoint == "" || cfg.s3Bucket == "" {
+			return nil, fmt.Errorf("-s3-endpoint and -s3-bucket are required for the %s storage", StorageS3)
+		}
+		return newS3Storage(cfg.s3Endpoint, cfg.s3Region, cfg.s3Bucket, cfg.s3Prefix)
+	default:
+		return nil, fmt.Errorf("unknown storage %q, expected %s or %s", cfg.storage, StorageLocal, StorageS3)
+	}
+}
+
+func loadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load etcd client certificate: %v", err)
+	}
+
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("load etcd CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+
+	// etcd listens on node IPs which are not always in the certificate SANs, the same as in control-plane-manager hooks
+	return &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		RootCAs:            pool,
+		InsecureSkipVerify: true,
+	}, nil
+}
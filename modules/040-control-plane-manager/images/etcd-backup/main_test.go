@@ -0,0 +1,332 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// newSnapshot returns a bbolt database with revisions up to lastRevision and the appended sha256 checksum,
+// the same as the Maintenance API streams.
+func newSnapshot(t *testing.T, lastRevision int64) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(keyBucket)
+		if err != nil {
+			return err
+		}
+		for rev := int64(1); rev <= lastRevision; rev++ {
+			key := make([]byte, 17)
+			binary.BigEndian.PutUint64(key[:8], uint64(rev))
+			key[8] = '_'
+			if err := b.Put(key, []byte("value")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return append(data, sum[:]...)
+}
+
+type fakeMember struct {
+	id       uint64
+	revision int64
+	index    uint64
+	errors   []string
+	down     bool
+}
+
+type fakeCluster struct {
+	leader   uint64
+	members  map[string]fakeMember
+	snapshot []byte
+	// snapshotFrom is the endpoint the last snapshot was taken from
+	snapshotFrom string
+}
+
+func (c *fakeCluster) dial(endpoints []string) (etcdClient, error) {
+	return &fakeClient{cluster: c, endpoints: endpoints}, nil
+}
+
+type fakeClient struct {
+	cluster   *fakeCluster
+	endpoints []string
+}
+
+func (f *fakeClient) Status(_ context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	m, ok := f.cluster.members[endpoint]
+	if !ok || m.down {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &clientv3.StatusResponse{
+		Header:    &pb.ResponseHeader{MemberId: m.id, Revision: m.revision},
+		Leader:    f.cluster.leader,
+		RaftIndex: m.index,
+		Errors:    m.errors,
+	}, nil
+}
+
+func (f *fakeClient) Snapshot(context.Context) (io.ReadCloser, error) {
+	if len(f.endpoints) != 1 {
+		return nil, fmt.Errorf("snapshot must be taken from a single member, got %v", f.endpoints)
+	}
+	f.cluster.snapshotFrom = f.endpoints[0]
+	return io.NopCloser(bytes.NewReader(f.cluster.snapshot)), nil
+}
+
+func (f *fakeClient) Close() error { return nil }
+
+func TestSelectMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		members  map[string]fakeMember
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "follower with the highest raft index",
+			members: map[string]fakeMember{
+				"https://10.0.0.1:2379": {id: 1, index: 30},
+				"https://10.0.0.2:2379": {id: 2, index: 20},
+				"https://10.0.0.3:2379": {id: 3, index: 25},
+			},
+			expected: "https://10.0.0.3:2379",
+		},
+		{
+			name: "unhealthy followers are skipped",
+			members: map[string]fakeMember{
+				"https://10.0.0.1:2379": {id: 1, index: 30},
+				"https://10.0.0.2:2379": {id: 2, index: 20, down: true},
+				"https://10.0.0.3:2379": {id: 3, index: 25, errors: []string{"NOSPACE"}},
+			},
+			expected: "https://10.0.0.1:2379",
+		},
+		{
+			name: "no healthy members",
+			members: map[string]fakeMember{
+				"https://10.0.0.1:2379": {id: 1, down: true},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &fakeCluster{leader: 1, members: tt.members}
+			client, _ := cluster.dial(nil)
+
+			m, err := selectMember(context.Background(), client, sortedEndpoints(tt.members))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got member %s", m.Endpoint)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Endpoint != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, m.Endpoint)
+			}
+		})
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	valid := newSnapshot(t, 10)
+
+	corrupted := append([]byte{}, valid...)
+	corrupted[100] ^= 0xff
+
+	tests := []struct {
+		name        string
+		data        []byte
+		minRevision int64
+		err         string
+	}{
+		{name: "valid", data: valid, minRevision: 10},
+		{name: "checksum mismatch", data: corrupted, minRevision: 10, err: "checksum mismatch"},
+		{name: "no checksum", data: valid[:len(valid)-sha256.Size], err: "checksum is missing"},
+		{name: "stale revision", data: valid, minRevision: 11, err: "less than the member revision"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot")
+			if err := os.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := verifySnapshot(path, tt.minRevision)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Revision != 10 || info.Size != int64(len(tt.data)) {
+				t.Errorf("unexpected info %+v", info)
+			}
+			if sum := sha256.Sum256(tt.data); info.SHA256 != fmt.Sprintf("%x", sum) {
+				t.Errorf("expected sha256 %x, got %s", sum, info.SHA256)
+			}
+		})
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	cluster := &fakeCluster{
+		leader: 1,
+		members: map[string]fakeMember{
+			"https://10.0.0.1:2379": {id: 1, revision: 10, index: 30},
+			"https://10.0.0.2:2379": {id: 2, revision: 10, index: 30},
+		},
+		snapshot: newSnapshot(t, 10),
+	}
+	cfg := config{
+		name:      "main",
+		endpoints: sortedEndpoints(cluster.members),
+		retention: 2,
+		tmpDir:    t.TempDir(),
+	}
+	st := localStorage{dir: dir}
+
+	// a snapshot of another EtcdBackup must not be pruned
+	if err := os.WriteFile(filepath.Join(dir, "main-daily_20220101T000000Z.snapshot"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := backup(context.Background(), cfg, st, cluster.dial, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cluster.snapshotFrom != "https://10.0.0.2:2379" {
+		t.Errorf("expected snapshot from the follower, got %s", cluster.snapshotFrom)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, e := range entries {
+		files = append(files, e.Name())
+	}
+	expected := []string{
+		"main-daily_20220101T000000Z.snapshot",
+		"main_20221001T010000Z.json",
+		"main_20221001T010000Z.snapshot",
+		"main_20221001T020000Z.json",
+		"main_20221001T020000Z.snapshot",
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected files %v, got %v", expected, files)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "main_20221001T020000Z.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info snapshotInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Revision != 10 || info.Member != "https://10.0.0.2:2379" || !info.CreatedAt.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	tmp, err := os.ReadDir(cfg.tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmp) != 0 {
+		t.Errorf("temporary snapshots are not removed: %v", tmp)
+	}
+}
+
+func TestBackupCorruptedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := newSnapshot(t, 10)
+	snapshot[100] ^= 0xff
+
+	cluster := &fakeCluster{
+		leader:   1,
+		members:  map[string]fakeMember{"https://10.0.0.1:2379": {id: 1, revision: 10}},
+		snapshot: snapshot,
+	}
+	cfg := config{name: "main", endpoints: sortedEndpoints(cluster.members), retention: 1, tmpDir: t.TempDir()}
+
+	err := backup(context.Background(), cfg, localStorage{dir: dir}, cluster.dial, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("corrupted snapshot is stored: %v", entries)
+	}
+}
+
+func sortedEndpoints(members map[string]fakeMember) []string {
+	endpoints := make([]string, 0, len(members))
+	for e := range members {
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
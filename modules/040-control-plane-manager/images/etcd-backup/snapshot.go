@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdClient is the part of clientv3.Client used to take snapshots.
+type etcdClient interface {
+	Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error)
+	Snapshot(ctx context.Context) (io.ReadCloser, error)
+	Close() error
+}
+
+type dialFunc func(endpoints []string) (etcdClient, error)
+
+// member is an etcd cluster member the snapshot can be taken from.
+type member struct {
+	Endpoint  string
+	MemberID  uint64
+	IsLeader  bool
+	RaftIndex uint64
+	Revision  int64
+}
+
+// selectMember returns a healthy member to take the snapshot from. Followers are preferred to keep the load
+// off the leader, the member with the highest raft index wins among them.
+func selectMember(ctx context.Context, client etcdClient, endpoints []string) (member, error) {
+	var members []member
+
+	for _, endpoint := range endpoints {
+		resp, err := client.Status(ctx, endpoint)
+		if err != nil {
+			log.Printf("member %s is skipped: %v", endpoint, err)
+			continue
+		}
+		if len(resp.Errors) > 0 {
+			log.Printf("member %s is skipped: %v", endpoint, resp.Errors)
+			continue
+		}
+
+		members = append(members, member{
+			Endpoint:  endpoint,
+			MemberID:  resp.Header.MemberId,
+			IsLeader:  resp.Leader == resp.Header.MemberId,
+			RaftIndex: resp.RaftIndex,
+			Revision:  resp.Header.Revision,
+		})
+	}
+
+	if len(members) == 0 {
+		return member{}, fmt.Errorf("there are no healthy etcd members among %v", endpoints)
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].IsLeader != members[j].IsLeader {
+			return !members[i].IsLeader
+		}
+		return members[i].RaftIndex > members[j].RaftIndex
+	})
+
+	return members[0], nil
+}
+
+// takeSnapshot streams the snapshot of the member to the file. It returns the revision of the member right
+// before the snapshot, the snapshot must contain at least this revision.
+func takeSnapshot(ctx context.Context, dial dialFunc, m member, path string) (int64, error) {
+	client, err := dial([]string{m.Endpoint})
+	if err != nil {
+		return 0, fmt.Errorf("connect to %s: %v", m.Endpoint, err)
+	}
+	defer client.Close()
+
+	status, err := client.Status(ctx, m.Endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("get status of %s: %v", m.Endpoint, err)
+	}
+
+	rc, err := client.Snapshot(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("request snapshot from %s: %v", m.Endpoint, err)
+	}
+	defer rc.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = io.Copy(f, rc)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("receive snapshot from %s: %v", m.Endpoint, err)
+	}
+
+	return status.Header.Revision, nil
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	snapshotExt = ".snapshot"
+	infoExt     = ".json"
+)
+
+// storage keeps snapshots with their info files.
+type storage interface {
+	// Put stores the snapshot file as <name>.snapshot and the info as <name>.json.
+	Put(ctx context.Context, name, snapshotPath string, info snapshotInfo) error
+	// List returns names of stored snapshots with the prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the snapshot and its info.
+	Delete(ctx context.Context, name string) error
+}
+
+// prune keeps the latest retention snapshots with the prefix and deletes the rest.
+// Snapshot names end with the UTC creation time, so the lexicographical order is the chronological one.
+func prune(ctx context.Context, s storage, prefix string, retention int) ([]string, error) {
+	names, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) <= retention {
+		return nil, nil
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	deleted := names[retention:]
+	for _, name := range deleted {
+		if err := s.Delete(ctx, name); err != nil {
+			return nil, fmt.Errorf("delete %s: %v", name, err)
+		}
+	}
+	return deleted, nil
+}
+
+// localStorage keeps snapshots in the node directory.
+type localStorage struct {
+	dir string
+}
+
+func (s localStorage) Put(_ context.Context, name, snapshotPath string, info snapshotInfo) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	src, err := os.Open(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := s.writeFile(name+snapshotExt, src); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(name+infoExt, bytes.NewReader(data))
+}
+
+// writeFile writes to a temporary file and renames it to never leave a partial snapshot in the directory.
+func (s localStorage) writeFile(name string, r io.Reader) error {
+	tmp, err := os.CreateTemp(s.dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s localStorage) List(_ context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) || !strings.HasSuffix(entry.Name(), snapshotExt) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), snapshotExt))
+	}
+	return names, nil
+}
+
+func (s localStorage) Delete(_ context.Context, name string) error {
+	for _, file := range []string{name + snapshotExt, name + infoExt} {
+		if err := os.Remove(filepath.Join(s.dir, file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3Storage keeps snapshots in the bucket of an S3-compatible storage.
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+	// prefix is the "directory" in the bucket, without the trailing slash
+	prefix string
+}
+
+// newS3Storage creates the storage for the endpoint URL, e.g. https://s3.amazonaws.com.
+// Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+func newS3Storage(endpoint, region, bucket, prefix string) (*s3Storage, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse S3 endpoint: %v", err)
+	}
+	if u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("S3 endpoint %q must be an http or https URL", endpoint)
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: u.Scheme == "https",
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Storage{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+func (s *s3Storage) key(file string) string {
+	return path.Join(s.prefix, file)
+}
+
+func (s *s3Storage) Put(ctx context.Context, name, snapshotPath string, info snapshotInfo) error {
+	_, err := s.client.FPutObject(ctx, s.bucket, s.key(name+snapshotExt), snapshotPath, minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		UserMetadata: map[string]string{"sha256": info.SHA256},
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, s.key(name+infoExt), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	return err
+}
+
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.key(prefix)}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		file := path.Base(object.Key)
+		if path.Dir(object.Key) != path.Dir(s.key(prefix)) || !strings.HasSuffix(file, snapshotExt) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(file, snapshotExt))
+	}
+	return names, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, name string) error {
+	for _, file := range []string{name + snapshotExt, name + infoExt} {
+		if err := s.client.RemoveObject(ctx, s.bucket, s.key(file), minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// keyBucket is the bbolt bucket where etcd stores key revisions.
+var keyBucket = []byte("key")
+
+// snapshotInfo is stored next to the snapshot as <name>.json.
+type snapshotInfo struct {
+	// Revision is the latest revision of the keyspace in the snapshot.
+	Revision int64 `json:"revision"`
+	// Size is the snapshot size in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the checksum of the whole snapshot file.
+	SHA256 string `json:"sha256"`
+	// Member is the endpoint of the etcd member the snapshot was taken from.
+	Member    string    `json:"member"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// verifySnapshot checks the snapshot received from the Maintenance API:
+//   - etcd appends the sha256 of the database to the stream, it must match the content;
+//   - the database must pass the bbolt consistency check;
+//   - the latest revision in the database must not be less than minRevision.
+func verifySnapshot(path string, minRevision int64) (snapshotInfo, error) {
+	var info snapshotInfo
+
+	f, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return info, err
+	}
+	info.Size = st.Size()
+
+	// the database consists of 512 bytes aligned pages, so the checksum is the remainder
+	if info.Size < sha256.Size || info.Size%512 != sha256.Size {
+		return info, fmt.Errorf("snapshot size %d: the sha256 checksum is missing", info.Size)
+	}
+
+	dbHash := sha256.New()
+	fileHash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(dbHash, fileHash), f, info.Size-sha256.Size); err != nil {
+		return info, err
+	}
+
+	trailer := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(f, trailer); err != nil {
+		return info, err
+	}
+	fileHash.Write(trailer)
+
+	if !bytes.Equal(dbHash.Sum(nil), trailer) {
+		return info, fmt.Errorf("snapshot checksum mismatch: expected %x, got %x", trailer, dbHash.Sum(nil))
+	}
+	info.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+
+	info.Revision, err = snapshotRevision(path)
+	if err != nil {
+		return info, err
+	}
+	if info.Revision < minRevision {
+		return info, fmt.Errorf("snapshot revision %d is less than the member revision %d", info.Revision, minRevision)
+	}
+
+	return info, nil
+}
+
+// snapshotRevision returns the latest revision in the etcd database. Keys of the key bucket are revisions:
+// 8 bytes of the main revision, '_', 8 bytes of the sub revision and an optional tombstone mark.
+func snapshotRevision(path string) (int64, error) {
+	db, err := bolt.Open(path, 0400, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return 0, fmt.Errorf("open snapshot database: %v", err)
+	}
+	defer db.Close()
+
+	var revision int64
+	err = db.View(func(tx *bolt.Tx) error {
+		// the channel is drained to let the check finish before the transaction is closed
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = err
+			}
+		}
+		if checkErr != nil {
+			return fmt.Errorf("snapshot database is inconsistent: %v", checkErr)
+		}
+
+		b := tx.Bucket(keyBucket)
+		if b == nil {
+			return fmt.Errorf("snapshot database has no %q bucket", keyBucket)
+		}
+
+		k, _ := b.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		if len(k) < 17 {
+			return fmt.Errorf("malformed revision key %x", k)
+		}
+		revision = int64(binary.BigEndian.Uint64(k[:8]))
+		return nil
+	})
+
+	return revision, err
+}
@@ -60,6 +60,7 @@ var _ = Describe("Module :: control-plane-manager :: helm template :: arguments
         kubeControllerManager119: imagehash
         kubeScheduler119: imagehash
         kubeApiserverHealthcheck: imagehash
+        etcdBackup: imagehash
   discovery:
     d8SpecificNodeCountByRole:
       worker: 1
@@ -106,7 +107,7 @@ var _ = Describe("Module :: control-plane-manager :: helm template :: arguments
 
 				rule := f.KubernetesResource("PrometheusRule", "d8-system", "control-plane-manager-etcd-maintenance")
 
-				assertSpecDotGroupsArray(rule, 1)
+				assertSpecDotGroupsArray(rule, 2)
 			})
 		})
 	})
@@ -155,4 +156,92 @@ resources:
 		})
 	})
 
+	Context("With etcdBackups", func() {
+		BeforeEach(func() {
+			f.ValuesSetFromYaml("controlPlaneManager.internal.etcdBackupCertificate", etcdBackupCertificate)
+			f.ValuesSetFromYaml("controlPlaneManager.internal.etcdBackups", `
+- name: main
+  schedule: "0 */6 * * *"
+  retentionCount: 7
+  storage:
+    type: Local
+    local:
+      path: /var/lib/etcd-backup
+- name: offsite
+  schedule: "@daily"
+  retentionCount: 30
+  storage:
+    type: S3
+    s3:
+      endpoint: https://s3.example.com
+      bucket: etcd-backups
+      prefix: production
+      credentialsSecretName: etcd-backup-s3
+`)
+			f.HelmRender()
+		})
+
+		It("should render CronJobs", func() {
+			Expect(f.RenderError).ShouldNot(HaveOccurred())
+
+			local := f.KubernetesResource("CronJob", "kube-system", "d8-etcd-backup-main")
+			Expect(local.Exists()).To(BeTrue())
+			Expect(local.Field("apiVersion").String()).To(Equal("batch/v1"))
+			Expect(local.Field("spec.schedule").String()).To(Equal("0 */6 * * *"))
+			podSpec := local.Field("spec.jobTemplate.spec.template.spec")
+			Expect(podSpec.Get("containers.0.args").String()).To(MatchJSON(`[
+"-name=main",
+"-endpoints=https://192.168.199.186:2379",
+"-retention-count=7",
+"-tmp-dir=/tmp",
+"-cacert=/etc/etcd/pki/ca.crt",
+"-cert=/etc/etcd/pki/tls.crt",
+"-key=/etc/etcd/pki/tls.key",
+"-storage=Local",
+"-local-path=/backup"
+]`))
+			Expect(podSpec.Get("volumes.#(name==\"backup\").hostPath.path").String()).To(Equal("/var/lib/etcd-backup"))
+			Expect(podSpec.Get("volumes.#(name==\"pki\").secret").String()).To(MatchJSON(`{"secretName": "d8-etcd-backup-pki", "defaultMode": 256}`))
+
+			pki := f.KubernetesResource("Secret", "kube-system", "d8-etcd-backup-pki")
+			Expect(pki.Exists()).To(BeTrue())
+			Expect(pki.Field("data.tls\\.crt").String()).To(Equal("Y2VydA=="))
+			Expect(pki.Field("data").Map()).ToNot(HaveKey("ca.key"))
+
+			s3 := f.KubernetesResource("CronJob", "kube-system", "d8-etcd-backup-offsite")
+			Expect(s3.Exists()).To(BeTrue())
+			podSpec = s3.Field("spec.jobTemplate.spec.template.spec")
+			Expect(podSpec.Get("containers.0.args").String()).To(ContainSubstring(`"-s3-prefix=production"`))
+			Expect(podSpec.Get("containers.0.env.#(name==\"AWS_ACCESS_KEY_ID\").valueFrom.secretKeyRef.name").String()).To(Equal("etcd-backup-s3"))
+			Expect(podSpec.Get("volumes.#(name==\"backup\")").Exists()).To(BeFalse())
+		})
+	})
+
+	Context("With etcdBackups without the client certificate", func() {
+		BeforeEach(func() {
+			f.ValuesSetFromYaml("controlPlaneManager.internal.etcdBackups", `[{"name": "main", "schedule": "@daily", "retentionCount": 1, "storage": {"type": "Local", "local": {"path": "/var/lib/etcd-backup"}}}]`)
+			f.HelmRender()
+		})
+
+		It("should not render CronJobs", func() {
+			Expect(f.RenderError).ShouldNot(HaveOccurred())
+			Expect(f.KubernetesResource("CronJob", "kube-system", "d8-etcd-backup-main").Exists()).To(BeFalse())
+		})
+	})
+
+	Context("With etcdBackups in Kubernetes 1.20", func() {
+		BeforeEach(func() {
+			f.ValuesSet("controlPlaneManager.internal.effectiveKubernetesVersion", "1.20")
+			f.ValuesSetFromYaml("controlPlaneManager.internal.etcdBackupCertificate", etcdBackupCertificate)
+			f.ValuesSetFromYaml("controlPlaneManager.internal.etcdBackups", `[{"name": "main", "schedule": "@daily", "retentionCount": 1, "storage": {"type": "Local", "local": {"path": "/var/lib/etcd-backup"}}}]`)
+			f.HelmRender()
+		})
+
+		It("should render batch/v1beta1 CronJob", func() {
+			Expect(f.RenderError).ShouldNot(HaveOccurred())
+			Expect(f.KubernetesResource("CronJob", "kube-system", "d8-etcd-backup-main").Field("apiVersion").String()).To(Equal("batch/v1beta1"))
+		})
+	})
 })
+
+const etcdBackupCertificate = `{"ca": "ca", "cert": "cert", "key": "key"}`
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	reasonKilled     = "EarlyOOMKilled"
+	reasonNoVictim   = "EarlyOOMNoVictim"
+	reasonSystemKill = "EarlyOOMSystemKill"
+
+	eventsComponent = "early-oom"
+	apiTimeout      = 10 * time.Second
+)
+
+// eventRecorder creates Kubernetes events for early-oom interventions.
+type eventRecorder interface {
+	// Record creates the event for the node and for the victim pod if it is not nil.
+	Record(victim *Victim, reason, message string)
+}
+
+type noopRecorder struct{}
+
+func (noopRecorder) Record(*Victim, string, string) {}
+
+type kubeRecorder struct {
+	client   kubernetes.Interface
+	nodeName string
+}
+
+// newEventRecorder returns the recorder using the in-cluster config, events are only logged outside the cluster.
+func newEventRecorder(nodeName string) eventRecorder {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Printf("Kubernetes events are disabled: %v", err)
+		return noopRecorder{}
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Printf("Kubernetes events are disabled: %v", err)
+		return noopRecorder{}
+	}
+
+	return &kubeRecorder{client: client, nodeName: nodeName}
+}
+
+func (r *kubeRecorder) Record(victim *Victim, reason, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+
+	r.create(ctx, corev1.ObjectReference{
+		Kind: "Node",
+		Name: r.nodeName,
+		// the same as kubelet does
+		UID: types.UID(r.nodeName),
+	}, metav1.NamespaceDefault, reason, message)
+
+	if victim == nil {
+		return
+	}
+
+	pod, err := r.findPod(ctx, victim.PodUID)
+	if err != nil {
+		log.Printf("cannot find the pod %s: %v", victim.PodUID, err)
+		return
+	}
+	if pod == nil {
+		return
+	}
+
+	r.create(ctx, corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}, pod.Namespace, reason, message)
+}
+
+func (r *kubeRecorder) findPod(ctx context.Context, uid string) (*corev1.Pod, error) {
+	pods, err := r.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", r.nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pods.Items {
+		if string(pods.Items[i].UID) == uid {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *kubeRecorder) create(ctx context.Context, object corev1.ObjectReference, namespace, reason, message string) {
+	now := metav1.Now()
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: eventsComponent + "-",
+			Namespace:    namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source: corev1.EventSource{
+			Component: eventsComponent,
+			Host:      r.nodeName,
+		},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := r.client.CoreV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		log.Printf("cannot create the %s event for %s %s: %v", reason, object.Kind, object.Name, err)
+	}
+}
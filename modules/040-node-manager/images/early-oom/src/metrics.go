@@ -0,0 +1,90 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	interventionKilled   = "Killed"
+	interventionNoVictim = "NoVictim"
+	interventionError    = "Error"
+)
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	pressure         *prometheus.GaugeVec
+	policyTriggers   *prometheus.CounterVec
+	interventions    *prometheus.CounterVec
+	lastIntervention prometheus.Gauge
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		pressure: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "early_oom_pressure",
+			Help: "Share of the stall time from /proc/pressure in percents.",
+		}, []string{"resource", "type", "window"}),
+		policyTriggers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "early_oom_policy_triggers_total",
+			Help: "Number of times the policy threshold was exceeded.",
+		}, []string{"resource", "type", "window", "action"}),
+		interventions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "early_oom_interventions_total",
+			Help: "Number of early-oom interventions by the result and the QoS class of the victim pod.",
+		}, []string{"result", "qos_class"}),
+		lastIntervention: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "early_oom_last_intervention_timestamp_seconds",
+			Help: "Time of the last early-oom intervention.",
+		}),
+	}
+
+	m.registry.MustRegister(m.pressure, m.policyTriggers, m.interventions, m.lastIntervention)
+	return m
+}
+
+func (m *metrics) observePressure(resource string, stats procfs.PSIStats) {
+	for typ, line := range map[string]*procfs.PSILine{"some": stats.Some, "full": stats.Full} {
+		if line == nil {
+			continue
+		}
+		m.pressure.WithLabelValues(resource, typ, "avg10").Set(line.Avg10)
+		m.pressure.WithLabelValues(resource, typ, "avg60").Set(line.Avg60)
+		m.pressure.WithLabelValues(resource, typ, "avg300").Set(line.Avg300)
+	}
+}
+
+func (m *metrics) policyTriggered(p Policy) {
+	m.policyTriggers.WithLabelValues(p.Resource, p.Type, p.Window, p.Action).Inc()
+}
+
+func (m *metrics) intervention(result, qosClass string) {
+	m.interventions.WithLabelValues(result, qosClass).Inc()
+	m.lastIntervention.Set(float64(time.Now().Unix()))
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/procfs"
+)
+
+const (
+	// ActionKill kills the victim cgroup when the policy threshold is exceeded.
+	ActionKill = "Kill"
+	// ActionReport only exposes the policy trigger in metrics.
+	ActionReport = "Report"
+)
+
+var (
+	psiResources = []string{"memory", "cpu", "io"}
+	psiTypes     = []string{"some", "full"}
+	psiWindows   = []string{"avg10", "avg60"}
+)
+
+// defaultPolicies keep the behaviour of the early-oom before policies were introduced.
+var defaultPolicies = []Policy{
+	{Resource: "memory", Type: "full", Window: "avg10", Threshold: 5, Action: ActionKill},
+}
+
+// Policy is a threshold for a single PSI value, e.g. memory full avg10 > 5%.
+type Policy struct {
+	// Resource is a pressure resource: memory, cpu or io.
+	Resource string `json:"resource"`
+	// Type is a stall type: some or full.
+	Type string `json:"type"`
+	// Window is an averaging window: avg10 or avg60.
+	Window string `json:"window"`
+	// Threshold is a share of the stall time in percents.
+	Threshold float64 `json:"threshold"`
+	// Action is Kill or Report.
+	Action string `json:"action"`
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("%s %s %s > %.2f", p.Resource, p.Type, p.Window, p.Threshold)
+}
+
+func (p Policy) validate() error {
+	if !contains(psiResources, p.Resource) {
+		return fmt.Errorf("unknown resource %q, expected one of %v", p.Resource, psiResources)
+	}
+	if !contains(psiTypes, p.Type) {
+		return fmt.Errorf("unknown type %q, expected one of %v", p.Type, psiTypes)
+	}
+	if !contains(psiWindows, p.Window) {
+		return fmt.Errorf("unknown window %q, expected one of %v", p.Window, psiWindows)
+	}
+	if p.Threshold <= 0 || p.Threshold > 100 {
+		return fmt.Errorf("threshold %.2f must be in (0, 100]", p.Threshold)
+	}
+	if p.Action != ActionKill && p.Action != ActionReport {
+		return fmt.Errorf("unknown action %q, expected %s or %s", p.Action, ActionKill, ActionReport)
+	}
+	if p.Action == ActionKill && p.Resource != "memory" {
+		return fmt.Errorf("action %s is supported only for the memory resource", ActionKill)
+	}
+	return nil
+}
+
+// value returns the policy value from PSI stats. The second value is false if the kernel does not
+// report the stall type for the resource, e.g. cpu full is available since Linux 5.13.
+func (p Policy) value(stats procfs.PSIStats) (float64, bool) {
+	line := stats.Some
+	if p.Type == "full" {
+		line = stats.Full
+	}
+	if line == nil {
+		return 0, false
+	}
+
+	if p.Window == "avg60" {
+		return line.Avg60, true
+	}
+	return line.Avg10, true
+}
+
+// parsePolicies parses policies in JSON. Default policies are returned if there are no policies in the input.
+// Invalid policies are skipped, they are returned as errors in the second value to report them.
+func parsePolicies(data string) ([]Policy, []error, error) {
+	if strings.TrimSpace(data) == "" {
+		return defaultPolicies, nil, nil
+	}
+
+	var parsed []Policy
+	if err := json.Unmarshal([]byte(data), &parsed); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse policies: %v", err)
+	}
+	if len(parsed) == 0 {
+		return defaultPolicies, nil, nil
+	}
+
+	policies := make([]Policy, 0, len(parsed))
+	var rejected []error
+	for i, p := range parsed {
+		// the module config uses capitalized values, e.g. Memory, Full, Avg10
+		p.Resource = strings.ToLower(p.Resource)
+		p.Type = strings.ToLower(p.Type)
+		p.Window = strings.ToLower(p.Window)
+
+		if p.Action == "" {
+			p.Action = ActionKill
+		}
+		if err := p.validate(); err != nil {
+			rejected = append(rejected, fmt.Errorf("policy #%d is skipped: %v", i+1, err))
+			continue
+		}
+		policies = append(policies, p)
+	}
+
+	return policies, rejected, nil
+}
+
+// policyCheck is a result of the policy check.
+type policyCheck struct {
+	Policy
+	Value     float64
+	Triggered bool
+}
+
+// checkPolicies reads PSI stats for resources from policies and checks thresholds.
+func checkPolicies(fs procfs.FS, policies []Policy, m *metrics) ([]policyCheck, error) {
+	stats := make(map[string]procfs.PSIStats)
+
+	checks := make([]policyCheck, 0, len(policies))
+	for _, p := range policies {
+		s, ok := stats[p.Resource]
+		if !ok {
+			var err error
+			s, err = fs.PSIStatsForResource(p.Resource)
+			if err != nil {
+				return nil, err
+			}
+			stats[p.Resource] = s
+			m.observePressure(p.Resource, s)
+		}
+
+		value, ok := p.value(s)
+		if !ok {
+			continue
+		}
+
+		check := policyCheck{Policy: p, Value: value, Triggered: value > p.Threshold}
+		if check.Triggered {
+			m.policyTriggered(p)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -17,9 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -29,13 +33,55 @@ import (
 const (
 	pollInterval     = 5 * time.Second
 	recoveryInterval = 15 * time.Second
-	memoryThreshold  = 5.00
 
-	sysrqTriggerFile  = "/proc/sysrq-trigger"
+	sysrqTriggerFile  = "sysrq-trigger"
 	sysrqOOMCharacter = "f"
 )
 
 func main() {
+	procRoot := flag.String("proc-root", procfs.DefaultMountPoint, "Mount point of the host procfs.")
+	cgroupRoot := flag.String("cgroup-root", "/sys/fs/cgroup", "Mount point of the host cgroup v2 hierarchy.")
+	policiesJSON := flag.String("policies", os.Getenv("EARLY_OOM_POLICIES"), "Policies in JSON, memory full avg10 > 5% kills a victim if empty.")
+	metricsAddress := flag.String("metrics-address", "127.0.0.1:8085", "Address to serve Prometheus metrics on.")
+	nodeName := flag.String("node-name", os.Getenv("NODE_NAME"), "Node name for Kubernetes events.")
+	podUID := flag.String("pod-uid", os.Getenv("POD_UID"), "UID of the early-oom Pod to never select it as a victim.")
+	flag.Parse()
+
+	policies, rejected, err := parsePolicies(*policiesJSON)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, err := range rejected {
+		log.Print(err)
+	}
+
+	fs, err := procfs.NewFS(*procRoot)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m := &monitor{
+		fs:       fs,
+		cgroups:  cgroupFS{root: *cgroupRoot, procRoot: *procRoot, excludePodUID: *podUID},
+		policies: policies,
+		sysrq:    filepath.Join(*procRoot, sysrqTriggerFile),
+		kill:     killProcess,
+		metrics:  newMetrics(),
+		recorder: newEventRecorder(*nodeName),
+	}
+
+	for _, p := range policies {
+		log.Printf("Policy: %s, action %s", p, p.Action)
+	}
+	if !m.cgroups.isV2() {
+		log.Printf("cgroup v2 is not mounted at %s, the system OOM killer will select victims", *cgroupRoot)
+	}
+
+	go func() {
+		http.Handle("/metrics", m.metrics.handler())
+		log.Fatal(http.ListenAndServe(*metricsAddress, nil))
+	}()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
 
@@ -46,7 +92,13 @@ func main() {
 			log.Printf("Caught signal %s, exiting", sig.String())
 			os.Exit(0)
 		case <-t.C:
-			if iteration() {
+			intervened, err := m.iteration()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if intervened {
+				log.Printf("Waiting for recovery for %s", recoveryInterval.String())
 				t.Reset(recoveryInterval)
 			} else {
 				t.Reset(pollInterval)
@@ -55,30 +107,84 @@ func main() {
 	}
 }
 
-func iteration() bool {
-	fs, err := procfs.NewDefaultFS()
+type monitor struct {
+	fs       procfs.FS
+	cgroups  cgroupFS
+	policies []Policy
+	// sysrq is the sysrq-trigger file path to call the system OOM killer if cgroup v2 is not available.
+	sysrq    string
+	kill     func(pid int) error
+	metrics  *metrics
+	recorder eventRecorder
+}
+
+// iteration checks policies and kills a victim if a policy with the Kill action is triggered.
+// It returns true if there was an intervention and the node needs time to recover.
+func (m *monitor) iteration() (bool, error) {
+	checks, err := checkPolicies(m.fs, m.policies, m.metrics)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
 
-	stats, err := fs.PSIStatsForResource("memory")
-	if err != nil {
-		log.Fatal(err)
+	var trigger *policyCheck
+	for i := range checks {
+		if !checks[i].Triggered {
+			continue
+		}
+
+		log.Printf("%s %s %s value %.2f, threshold %.2f, action %s",
+			checks[i].Resource, checks[i].Type, checks[i].Window, checks[i].Value, checks[i].Threshold, checks[i].Action)
+
+		if trigger == nil && checks[i].Action == ActionKill {
+			trigger = &checks[i]
+		}
+	}
+
+	if trigger == nil {
+		return false, nil
 	}
 
-	if stats.Full.Avg10 > memoryThreshold {
-		log.Printf("full avg10 value %f, threshold %f, triggering system OOM killer...", stats.Full.Avg10, memoryThreshold)
-		err := triggerSystemOOM(sysrqTriggerFile)
-		if err != nil {
-			log.Fatal(err)
+	cause := fmt.Sprintf("%s %s %s pressure %.2f%% exceeded the %.2f%% threshold", trigger.Resource, trigger.Type, trigger.Window, trigger.Value, trigger.Threshold)
+
+	if !m.cgroups.isV2() {
+		log.Printf("Triggering system OOM killer...")
+		if err := triggerSystemOOM(m.sysrq); err != nil {
+			return false, err
 		}
 
-		log.Printf("Waiting for recovery for %s", recoveryInterval.String())
+		m.metrics.intervention(interventionKilled, "")
+		m.recorder.Record(nil, reasonSystemKill, cause+", the system OOM killer is triggered")
+		return true, nil
+	}
+
+	victim, err := m.cgroups.selectVictim()
+	if err != nil {
+		m.metrics.intervention(interventionError, "")
+		log.Printf("cannot select a victim: %v", err)
+		return true, nil
+	}
 
-		return true
+	if victim == nil {
+		log.Printf("There are no pods to kill")
+		m.metrics.intervention(interventionNoVictim, "")
+		m.recorder.Record(nil, reasonNoVictim, cause+", but there are no pods to kill")
+		return true, nil
 	}
 
-	return false
+	log.Printf("Killing %s (pod %s, QoS class %s, memory pressure %.2f, memory usage %d bytes)",
+		victim.Path, victim.PodUID, victim.QOSClass, victim.Pressure, victim.MemoryCurrent)
+
+	if err := killCgroup(victim.Path, m.kill); err != nil {
+		log.Printf("cannot kill %s: %v", victim.Path, err)
+		m.metrics.intervention(interventionError, victim.QOSClass)
+		return true, nil
+	}
+
+	m.metrics.intervention(interventionKilled, victim.QOSClass)
+	m.recorder.Record(victim, reasonKilled, fmt.Sprintf("%s, the %s container cgroup of the %s pod is killed",
+		cause, filepath.Base(victim.Path), victim.QOSClass))
+
+	return true, nil
 }
 
 func triggerSystemOOM(sysrqTriggerFile string) error {
@@ -0,0 +1,447 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeTree is a temporary directory with files of the fake procfs or cgroupfs.
+type fakeTree string
+
+func newFakeTree(t *testing.T) fakeTree {
+	return fakeTree(t.TempDir())
+}
+
+func (f fakeTree) path(elem ...string) string {
+	return filepath.Join(append([]string{string(f)}, elem...)...)
+}
+
+func (f fakeTree) write(t *testing.T, content string, elem ...string) {
+	t.Helper()
+
+	path := f.path(elem...)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f fakeTree) read(t *testing.T, elem ...string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(f.path(elem...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func pressure(someAvg10, fullAvg10 float64) string {
+	return fmt.Sprintf("some avg10=%.2f avg60=0.00 avg300=0.00 total=0\nfull avg10=%.2f avg60=0.00 avg300=0.00 total=0\n", someAvg10, fullAvg10)
+}
+
+// pod writes a pod cgroup with containers and their memory usage to the fake cgroupfs.
+func (f fakeTree) pod(t *testing.T, dir string, podPressure float64, containers map[string]uint64) {
+	t.Helper()
+
+	f.write(t, pressure(podPressure, 0), dir, "memory.pressure")
+	var total uint64
+	for name, current := range containers {
+		f.write(t, fmt.Sprint(current), dir, name, "memory.current")
+		f.write(t, "", dir, name, "cgroup.kill")
+		total += current
+	}
+	f.write(t, fmt.Sprint(total), dir, "memory.current")
+}
+
+type fakeRecorder struct {
+	reasons []string
+	victims []*Victim
+}
+
+func (r *fakeRecorder) Record(victim *Victim, reason, _ string) {
+	r.reasons = append(r.reasons, reason)
+	r.victims = append(r.victims, victim)
+}
+
+func newTestMonitor(t *testing.T, proc, cgroups fakeTree, policies []Policy) (*monitor, *fakeRecorder) {
+	t.Helper()
+
+	fs, err := procfs.NewFS(proc.path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &fakeRecorder{}
+	return &monitor{
+		fs:       fs,
+		cgroups:  cgroupFS{root: cgroups.path()},
+		policies: policies,
+		sysrq:    proc.path(sysrqTriggerFile),
+		kill: func(pid int) error {
+			return fmt.Errorf("unexpected kill of %d", pid)
+		},
+		metrics:  newMetrics(),
+		recorder: recorder,
+	}, recorder
+}
+
+func TestIteration(t *testing.T) {
+	proc := newFakeTree(t)
+	proc.write(t, pressure(10, 2), "pressure", "memory")
+	proc.write(t, pressure(50, 0), "pressure", "cpu")
+	proc.write(t, "", sysrqTriggerFile)
+
+	cgroups := newFakeTree(t)
+	cgroups.write(t, "cpu memory", "cgroup.controllers")
+	cgroups.pod(t, "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0bd8d7c5_0a1f_4c3b_9b69_0c2a5a6f7e01.slice", 3,
+		map[string]uint64{"cri-containerd-pause.scope": 100, "cri-containerd-app.scope": 1000})
+	cgroups.pod(t, "system.slice", 90, map[string]uint64{"kubelet.service": 5000})
+
+	policies := []Policy{
+		{Resource: "memory", Type: "full", Window: "avg10", Threshold: 5, Action: ActionKill},
+		{Resource: "cpu", Type: "some", Window: "avg10", Threshold: 40, Action: ActionReport},
+	}
+
+	m, recorder := newTestMonitor(t, proc, cgroups, policies)
+
+	intervened, err := m.iteration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intervened {
+		t.Fatalf("memory pressure is below the threshold, but the monitor intervened")
+	}
+	if got := testutil.ToFloat64(m.metrics.policyTriggers.WithLabelValues("cpu", "some", "avg10", ActionReport)); got != 1 {
+		t.Errorf("expected the cpu policy to be triggered once, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.metrics.pressure.WithLabelValues("memory", "full", "avg10")); got != 2 {
+		t.Errorf("expected memory full avg10 pressure 2, got %v", got)
+	}
+
+	proc.write(t, pressure(30, 20), "pressure", "memory")
+
+	intervened, err = m.iteration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !intervened {
+		t.Fatalf("memory pressure is above the threshold, but the monitor did not intervene")
+	}
+
+	killed := cgroups.read(t, "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0bd8d7c5_0a1f_4c3b_9b69_0c2a5a6f7e01.slice", "cri-containerd-app.scope", "cgroup.kill")
+	if killed != "1" {
+		t.Errorf("expected the app container to be killed")
+	}
+	if cgroups.read(t, "system.slice", "kubelet.service", "cgroup.kill") != "" {
+		t.Errorf("system slices must never be killed")
+	}
+	if proc.read(t, sysrqTriggerFile) != "" {
+		t.Errorf("the system OOM killer must not be triggered on cgroup v2")
+	}
+
+	if len(recorder.reasons) != 1 || recorder.reasons[0] != reasonKilled {
+		t.Fatalf("expected the %s event, got %v", reasonKilled, recorder.reasons)
+	}
+	if uid := recorder.victims[0].PodUID; uid != "0bd8d7c5-0a1f-4c3b-9b69-0c2a5a6f7e01" {
+		t.Errorf("unexpected victim pod UID %q", uid)
+	}
+	if got := testutil.ToFloat64(m.metrics.interventions.WithLabelValues(interventionKilled, QOSBurstable)); got != 1 {
+		t.Errorf("expected one intervention, got %v", got)
+	}
+}
+
+func TestIterationNoVictim(t *testing.T) {
+	proc := newFakeTree(t)
+	proc.write(t, pressure(30, 20), "pressure", "memory")
+
+	cgroups := newFakeTree(t)
+	cgroups.write(t, "cpu memory", "cgroup.controllers")
+	cgroups.pod(t, "system.slice", 90, map[string]uint64{"kubelet.service": 5000})
+
+	m, recorder := newTestMonitor(t, proc, cgroups, defaultPolicies)
+
+	intervened, err := m.iteration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !intervened {
+		t.Errorf("expected the monitor to wait for recovery")
+	}
+	if len(recorder.reasons) != 1 || recorder.reasons[0] != reasonNoVictim {
+		t.Errorf("expected the %s event, got %v", reasonNoVictim, recorder.reasons)
+	}
+	if cgroups.read(t, "system.slice", "kubelet.service", "cgroup.kill") != "" {
+		t.Errorf("system slices must never be killed")
+	}
+}
+
+func TestIterationCgroupV1(t *testing.T) {
+	proc := newFakeTree(t)
+	proc.write(t, pressure(30, 20), "pressure", "memory")
+	proc.write(t, "", sysrqTriggerFile)
+
+	m, recorder := newTestMonitor(t, proc, newFakeTree(t), defaultPolicies)
+
+	if _, err := m.iteration(); err != nil {
+		t.Fatal(err)
+	}
+	if proc.read(t, sysrqTriggerFile) != sysrqOOMCharacter {
+		t.Errorf("expected the system OOM killer to be triggered")
+	}
+	if len(recorder.reasons) != 1 || recorder.reasons[0] != reasonSystemKill {
+		t.Errorf("expected the %s event, got %v", reasonSystemKill, recorder.reasons)
+	}
+}
+
+func TestSelectVictim(t *testing.T) {
+	tests := []struct {
+		name   string
+		pods   map[string]float64
+		expect string
+	}{
+		{
+			name: "BestEffort is preferred to Burstable",
+			pods: map[string]float64{
+				"kubepods/besteffort/pod11111111-1111-1111-1111-111111111111": 0,
+				"kubepods/burstable/pod22222222-2222-2222-2222-222222222222":  50,
+				"kubepods/pod33333333-3333-3333-3333-333333333333":            90,
+			},
+			expect: "kubepods/besteffort/pod11111111-1111-1111-1111-111111111111",
+		},
+		{
+			name: "Burstable is preferred to Guaranteed",
+			pods: map[string]float64{
+				"kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod22222222_2222_2222_2222_222222222222.slice": 1,
+				"kubepods.slice/kubepods-pod33333333_3333_3333_3333_333333333333.slice":                                    90,
+			},
+			expect: "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod22222222_2222_2222_2222_222222222222.slice",
+		},
+		{
+			name: "The highest memory pressure in the class",
+			pods: map[string]float64{
+				"kubepods/burstable/pod22222222-2222-2222-2222-222222222222": 10,
+				"kubepods/burstable/pod44444444-4444-4444-4444-444444444444": 30,
+				"kubepods/burstable/pod55555555-5555-5555-5555-555555555555": 20,
+			},
+			expect: "kubepods/burstable/pod44444444-4444-4444-4444-444444444444",
+		},
+		{
+			name: "Guaranteed",
+			pods: map[string]float64{
+				"kubepods/pod33333333-3333-3333-3333-333333333333": 0,
+			},
+			expect: "kubepods/pod33333333-3333-3333-3333-333333333333",
+		},
+		{
+			name: "Own pod is excluded",
+			pods: map[string]float64{
+				"kubepods/pod00000000-0000-0000-0000-000000000000": 90,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cgroups := newFakeTree(t)
+			for dir, p := range tt.pods {
+				cgroups.pod(t, dir, p, map[string]uint64{"app": 10})
+			}
+
+			victim, err := cgroupFS{root: cgroups.path(), excludePodUID: "00000000-0000-0000-0000-000000000000"}.selectVictim()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.expect == "" {
+				if victim != nil {
+					t.Fatalf("expected no victim, got %+v", victim)
+				}
+				return
+			}
+
+			if victim == nil || victim.Path != cgroups.path(tt.expect, "app") {
+				t.Fatalf("expected %s, got %+v", tt.expect, victim)
+			}
+		})
+	}
+}
+
+func TestSelectVictimSkipsProtectedProcesses(t *testing.T) {
+	proc := newFakeTree(t)
+	cgroups := newFakeTree(t)
+
+	// container writes a container cgroup with a single process to the fake cgroupfs and procfs.
+	container := func(dir string, pid int, oomScoreAdj int, current uint64) {
+		cgroups.write(t, fmt.Sprint(current), dir, "memory.current")
+		cgroups.write(t, fmt.Sprintf("%d\n", pid), dir, "cgroup.procs")
+		proc.write(t, fmt.Sprintf("%d\n", oomScoreAdj), fmt.Sprint(pid), "oom_score_adj")
+	}
+
+	critical := "kubepods/burstable/pod22222222-2222-2222-2222-222222222222"
+	cgroups.write(t, pressure(90, 0), critical, "memory.pressure")
+	container(critical+"/pause", 10, -998, 1)
+	container(critical+"/app", 11, -997, 1000)
+
+	regular := "kubepods/burstable/pod44444444-4444-4444-4444-444444444444"
+	cgroups.write(t, pressure(10, 0), regular, "memory.pressure")
+	container(regular+"/pause", 20, -998, 1000)
+	container(regular+"/app", 21, 900, 10)
+
+	guaranteed := "kubepods/pod33333333-3333-3333-3333-333333333333"
+	cgroups.write(t, pressure(50, 0), guaranteed, "memory.pressure")
+	container(guaranteed+"/app", 30, -997, 100)
+
+	fs := cgroupFS{root: cgroups.path(), procRoot: proc.path()}
+
+	victim, err := fs.selectVictim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if victim == nil || victim.Path != cgroups.path(regular, "app") {
+		t.Fatalf("expected the app container of %s, got %+v", regular, victim)
+	}
+
+	if err := os.RemoveAll(cgroups.path(regular)); err != nil {
+		t.Fatal(err)
+	}
+	victim, err = fs.selectVictim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if victim != nil {
+		t.Fatalf("expected no victim, all containers are protected, got %+v", victim)
+	}
+}
+
+func TestKillCgroupWithoutCgroupKill(t *testing.T) {
+	cgroups := newFakeTree(t)
+	cgroups.write(t, "10\n11\n", "pod", "cgroup.procs")
+	cgroups.write(t, "12\n", "pod", "app", "cgroup.procs")
+
+	var killed []string
+	err := killCgroup(cgroups.path("pod"), func(pid int) error {
+		killed = append(killed, fmt.Sprint(pid))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(killed)
+	if strings.Join(killed, ",") != "10,11,12" {
+		t.Errorf("expected all processes of the cgroup tree to be killed, got %v", killed)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expect   []Policy
+		rejected int
+		wantErr  bool
+	}{
+		{
+			name:   "empty",
+			expect: defaultPolicies,
+		},
+		{
+			name:   "null",
+			input:  "null",
+			expect: defaultPolicies,
+		},
+		{
+			name:  "default action",
+			input: `[{"resource": "memory", "type": "some", "window": "avg60", "threshold": 40}]`,
+			expect: []Policy{
+				{Resource: "memory", Type: "some", Window: "avg60", Threshold: 40, Action: ActionKill},
+			},
+		},
+		{
+			name:  "report",
+			input: `[{"resource": "IO", "type": "Full", "window": "Avg10", "threshold": 20, "action": "Report"}]`,
+			expect: []Policy{
+				{Resource: "io", Type: "full", Window: "avg10", Threshold: 20, Action: ActionReport},
+			},
+		},
+		{
+			name: "kill on cpu pressure is skipped",
+			input: `[{"resource": "CPU", "type": "Some", "window": "Avg10", "threshold": 20, "action": "Kill"},
+				{"resource": "Memory", "type": "Full", "window": "Avg10", "threshold": 5, "action": "Kill"}]`,
+			expect: []Policy{
+				{Resource: "memory", Type: "full", Window: "avg10", Threshold: 5, Action: ActionKill},
+			},
+			rejected: 1,
+		},
+		{
+			name:     "unknown window",
+			input:    `[{"resource": "memory", "type": "full", "window": "avg300", "threshold": 5}]`,
+			expect:   []Policy{},
+			rejected: 1,
+		},
+		{
+			name:     "threshold out of range",
+			input:    `[{"resource": "memory", "type": "full", "window": "avg10", "threshold": 0}]`,
+			expect:   []Policy{},
+			rejected: 1,
+		},
+		{
+			name:    "malformed",
+			input:   `[{"resource": "memory"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, rejected, err := parsePolicies(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(policies, tt.expect) {
+				t.Errorf("expected %v, got %v", tt.expect, policies)
+			}
+			if len(rejected) != tt.rejected {
+				t.Errorf("expected %d rejected policies, got %v", tt.rejected, rejected)
+			}
+		})
+	}
+}
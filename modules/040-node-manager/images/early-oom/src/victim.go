@@ -0,0 +1,436 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/prometheus/procfs"
+)
+
+const (
+	QOSBestEffort = "BestEffort"
+	QOSBurstable  = "Burstable"
+	QOSGuaranteed = "Guaranteed"
+)
+
+// qosPriority is the order in which victims are selected.
+var qosPriority = []string{QOSBestEffort, QOSBurstable, QOSGuaranteed}
+
+// protectedOOMScoreAdj is the oom_score_adj of processes the system OOM killer should not kill: kubelet sets -997
+// for Guaranteed and critical pods and -998 for pause containers, kubelet and containerd run with -999.
+const protectedOOMScoreAdj = -997
+
+var (
+	// kubepodsDirs are kubelet cgroups for systemd and cgroupfs cgroup drivers. Processes outside these cgroups,
+	// e.g. system.slice with kubelet and containerd, are never selected as victims.
+	kubepodsDirs = []string{"kubepods.slice", "kubepods"}
+
+	// besteffort, kubepods-besteffort.slice
+	qosDirRegex = regexp.MustCompile(`^(?:kubepods-)?(besteffort|burstable)(?:\.slice)?$`)
+	// pod0bd8d7c5-..., kubepods-burstable-pod0bd8d7c5_....slice
+	podDirRegex = regexp.MustCompile(`^(?:kubepods-(?:besteffort-|burstable-)?)?pod([0-9a-fA-F_-]+)(?:\.slice)?$`)
+)
+
+// Victim is a pod container cgroup selected to be killed.
+type Victim struct {
+	// Path is the cgroup directory of the container, or of the pod if there are no container cgroups.
+	Path     string
+	PodUID   string
+	QOSClass string
+	// Pressure is the pod memory some avg10 pressure.
+	Pressure float64
+	// MemoryCurrent is the container memory usage in bytes.
+	MemoryCurrent uint64
+}
+
+// cgroupFS selects victims in the cgroup v2 hierarchy.
+type cgroupFS struct {
+	root string
+	// procRoot is the host procfs to read oom_score_adj of processes.
+	procRoot string
+	// excludePodUID is the pod of the early-oom itself.
+	excludePodUID string
+}
+
+// isV2 returns true if the unified cgroup v2 hierarchy is mounted at the root.
+func (c cgroupFS) isV2() bool {
+	_, err := os.Stat(filepath.Join(c.root, "cgroup.controllers"))
+	return err == nil
+}
+
+// selectVictim returns the pod container to kill. BestEffort pods are preferred to Burstable, Burstable to Guaranteed.
+// Among pods of the same QoS class, the pod with the highest memory pressure is selected, the memory usage breaks ties.
+// Containers with processes protected by oom_score_adj are never selected.
+// It returns nil if there are no pods to kill on the node.
+func (c cgroupFS) selectVictim() (*Victim, error) {
+	pods, err := c.pods()
+	if err != nil {
+		return nil, err
+	}
+
+	priority := make(map[string]int, len(qosPriority))
+	for i, class := range qosPriority {
+		priority[class] = i
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		if pods[i].QOSClass != pods[j].QOSClass {
+			return priority[pods[i].QOSClass] < priority[pods[j].QOSClass]
+		}
+		if pods[i].Pressure != pods[j].Pressure {
+			return pods[i].Pressure > pods[j].Pressure
+		}
+		return pods[i].MemoryCurrent > pods[j].MemoryCurrent
+	})
+
+	for _, pod := range pods {
+		if pod.PodUID == c.excludePodUID {
+			continue
+		}
+
+		victim, err := c.largestContainer(pod)
+		if err != nil {
+			return nil, err
+		}
+		if victim != nil {
+			return victim, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// pods lists pod cgroups with their QoS classes, memory pressure and usage.
+func (c cgroupFS) pods() ([]Victim, error) {
+	var pods []Victim
+
+	for _, dir := range kubepodsDirs {
+		kubepods := filepath.Join(c.root, dir)
+		entries, err := os.ReadDir(kubepods)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			if m := qosDirRegex.FindStringSubmatch(entry.Name()); m != nil {
+				class := QOSBestEffort
+				if m[1] == "burstable" {
+					class = QOSBurstable
+				}
+
+				classPods, err := c.podsInDir(filepath.Join(kubepods, entry.Name()), class)
+				if err != nil {
+					return nil, err
+				}
+				pods = append(pods, classPods...)
+				continue
+			}
+
+			if pod, ok, err := c.pod(filepath.Join(kubepods, entry.Name()), QOSGuaranteed); err != nil {
+				return nil, err
+			} else if ok {
+				pods = append(pods, pod)
+			}
+		}
+	}
+
+	return pods, nil
+}
+
+func (c cgroupFS) podsInDir(dir, class string) ([]Victim, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []Victim
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		pod, ok, err := c.pod(filepath.Join(dir, entry.Name()), class)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+func (c cgroupFS) pod(dir, class string) (Victim, bool, error) {
+	m := podDirRegex.FindStringSubmatch(filepath.Base(dir))
+	if m == nil {
+		return Victim{}, false, nil
+	}
+
+	pod := Victim{
+		Path: dir,
+		// systemd escapes dashes in the pod UID
+		PodUID:   strings.ReplaceAll(m[1], "_", "-"),
+		QOSClass: class,
+	}
+
+	stats, err := readPSIStats(filepath.Join(dir, "memory.pressure"))
+	if err != nil {
+		return Victim{}, false, err
+	}
+	if stats.Some != nil {
+		pod.Pressure = stats.Some.Avg10
+	}
+
+	pod.MemoryCurrent, err = readMemoryCurrent(dir)
+	if err != nil {
+		return Victim{}, false, err
+	}
+
+	return pod, true, nil
+}
+
+// largestContainer returns the container cgroup of the pod with the highest memory usage.
+// The pause container is never selected since its process is protected by oom_score_adj.
+// It returns nil if all containers of the pod are protected.
+func (c cgroupFS) largestContainer(pod Victim) (*Victim, error) {
+	entries, err := os.ReadDir(pod.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var victim *Victim
+	hasContainers := false
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		hasContainers = true
+
+		dir := filepath.Join(pod.Path, entry.Name())
+		protected, err := c.isProtected(dir)
+		if err != nil {
+			return nil, err
+		}
+		if protected {
+			continue
+		}
+
+		current, err := readMemoryCurrent(dir)
+		if err != nil {
+			return nil, err
+		}
+		if victim == nil || current > victim.MemoryCurrent {
+			container := pod
+			container.Path = dir
+			container.MemoryCurrent = current
+			victim = &container
+		}
+	}
+
+	if hasContainers {
+		return victim, nil
+	}
+
+	// there are no container cgroups, the pod cgroup is killed as a whole
+	protected, err := c.isProtected(pod.Path)
+	if err != nil || protected {
+		return nil, err
+	}
+	return &pod, nil
+}
+
+// isProtected returns true if a process of the cgroup or its descendants has oom_score_adj <= -997.
+func (c cgroupFS) isProtected(dir string) (bool, error) {
+	protected := false
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || protected {
+			return err
+		}
+
+		pids, err := readCgroupProcs(path)
+		if err != nil {
+			return err
+		}
+		for _, pid := range pids {
+			data, err := os.ReadFile(filepath.Join(c.procRoot, strconv.Itoa(pid), "oom_score_adj"))
+			if os.IsNotExist(err) {
+				// the process has exited
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			adj, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+			if err != nil {
+				return fmt.Errorf("oom_score_adj of %d: %v", pid, err)
+			}
+			if adj <= protectedOOMScoreAdj {
+				protected = true
+				return nil
+			}
+		}
+		return nil
+	})
+
+	return protected, err
+}
+
+// killCgroup kills all processes of the cgroup and its descendants.
+// cgroup.kill is available since Linux 5.14, for older kernels processes are killed one by one.
+func killCgroup(dir string, kill func(pid int) error) error {
+	f, err := os.OpenFile(filepath.Join(dir, "cgroup.kill"), os.O_WRONLY, 0)
+	if err == nil {
+		_, err = f.Write([]byte("1"))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+
+		pids, err := readCgroupProcs(path)
+		if err != nil {
+			return err
+		}
+
+		for _, pid := range pids {
+			if err := kill(pid); err != nil && err != syscall.ESRCH {
+				return fmt.Errorf("kill %d: %v", pid, err)
+			}
+		}
+		return nil
+	})
+}
+
+// readCgroupProcs returns processes of the cgroup, but not of its descendants.
+func readCgroupProcs(dir string) ([]int, error) {
+	path := filepath.Join(dir, "cgroup.procs")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func killProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
+
+func readMemoryCurrent(dir string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "memory.current"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+}
+
+// readPSIStats parses a cgroup pressure file, the format is the same as of /proc/pressure files:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPSIStats(path string) (procfs.PSIStats, error) {
+	var stats procfs.PSIStats
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		line := &procfs.PSILine{}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return stats, fmt.Errorf("%s: malformed field %q", path, field)
+			}
+
+			var err error
+			switch kv[0] {
+			case "avg10":
+				line.Avg10, err = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				line.Avg60, err = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				line.Avg300, err = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				line.Total, err = strconv.ParseUint(kv[1], 10, 64)
+			}
+			if err != nil {
+				return stats, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			stats.Some = line
+		case "full":
+			stats.Full = line
+		}
+	}
+
+	return stats, scanner.Err()
+}
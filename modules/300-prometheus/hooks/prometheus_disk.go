@@ -88,6 +88,23 @@ var _ = sdk.RegisterFunc(&go_hook.HookConfig{
 			},
 			FilterFunc: applyPodFilter,
 		},
+		{
+			Name:       "disk_sizing_status",
+			ApiVersion: "v1",
+			Kind:       "ConfigMap",
+			NamespaceSelector: &types.NamespaceSelector{
+				NameSelector: &types.NameSelector{
+					MatchNames: []string{"d8-monitoring"},
+				},
+			},
+			NameSelector: &types.NameSelector{
+				MatchNames: []string{diskSizingStatusConfigMap},
+			},
+			// the status is written by the hook itself
+			ExecuteHookOnEvents:          pointer.BoolPtr(false),
+			ExecuteHookOnSynchronization: pointer.BoolPtr(false),
+			FilterFunc:                   applyDiskSizingStatusFilter,
+		},
 	},
 }, dependency.WithExternalDependencies(prometheusDisk))
 
@@ -220,6 +237,9 @@ func prometheusDisk(input *go_hook.HookInput, dc dependency.Container) error {
 		return nil
 	}
 
+	forecastMode := input.Values.Get("prometheus.diskSizingMode").String() == diskSizingModeForecast
+	statuses := make(map[string]diskSizingStatus)
+
 	proms := []string{"main", "longterm"}
 	for _, promName := range proms {
 		promNameForPath := strings.ToUpper(promName[0:1]) + promName[1:]
@@ -227,6 +247,12 @@ func prometheusDisk(input *go_hook.HookInput, dc dependency.Container) error {
 		var diskSize int64  // GiB
 		var retention int64 // GiB
 
+		retentionDaysConfigPath := "prometheus.retentionDays"
+		if promName == "longterm" {
+			retentionDaysConfigPath = "prometheus.longtermRetentionDays"
+		}
+		retentionDays := input.Values.Get(retentionDaysConfigPath).Int()
+
 		pvcExists := false
 		for _, obj := range input.Snapshots["pvcs"] {
 			if obj.(PersistentVolumeClaimFilter).PromName == promName {
@@ -256,15 +282,45 @@ func prometheusDisk(input *go_hook.HookInput, dc dependency.Container) error {
 
 			desiredSize := calcDesiredSize(input, kubeClient, promName)
 
+			var forecast *diskForecast
+			expandable := false
+			if forecastMode && retentionDays > 0 {
+				forecast, err = getDiskForecast(dc, promName)
+				if err != nil {
+					input.LogEntry.Warnf("cannot forecast the disk size of Prometheus %s: %v", promName, err)
+					statuses[promName] = diskSizingStatus{
+						Decision:                diskSizingDecisionUsage,
+						Message:                 fmt.Sprintf("Ingestion rate is unavailable, the disk is sized by the current usage: %v", err),
+						ConfiguredRetentionDays: retentionDays,
+						RetentionDays:           retentionDays,
+					}
+				}
+
+				expandable = isDiskExpandable(input, kubeClient, promName)
+				if forecast != nil && expandable {
+					forecastSize := forecast.diskSizeGigabytes(retentionDays)
+					if forecastSize > diskResizeLimit {
+						forecastSize = diskResizeLimit
+					}
+					if forecastSize > desiredSize {
+						desiredSize = forecastSize
+					}
+				}
+			}
+
 			if desiredSize <= diskResizeLimit {
 				diskSize = desiredSize
 			}
 
+			var currentSize int64 // GiB
 			for _, obj := range input.Snapshots["pvcs"] {
 				pvc := obj.(PersistentVolumeClaimFilter)
 				if pvc.PromName != promName {
 					continue
 				}
+				if pvc.RequestsStorage > currentSize {
+					currentSize = pvc.RequestsStorage
+				}
 
 				if pvc.RequestsStorage < diskSize {
 					patch := makePatchRequestsStorage(diskSize)
@@ -278,20 +334,53 @@ func prometheusDisk(input *go_hook.HookInput, dc dependency.Container) error {
 			}
 
 			retention = diskSize * 8 / 10 // 80%
+
+			if forecast != nil {
+				status := forecastRetention(*forecast, expandable, diskResizeLimit, currentSize, diskSize, retentionDays)
+				input.LogEntry.Infof("Prometheus %s disk sizing: %s", promName, status.Message)
+				statuses[promName] = status
+				retentionDays = status.RetentionDays
+			} else if status, ok := statuses[promName]; ok {
+				status.DiskSizeGigabytes = diskSize
+				status.RetentionGigabytes = retention
+				statuses[promName] = status
+			}
 		}
 
 		diskSizePath := fmt.Sprintf("prometheus.internal.prometheus%s.diskSizeGigabytes", promNameForPath)
 		retentionPath := fmt.Sprintf("prometheus.internal.prometheus%s.retentionGigabytes", promNameForPath)
+		retentionDaysPath := fmt.Sprintf("prometheus.internal.prometheus%s.retentionDays", promNameForPath)
 
 		input.LogEntry.Debugf("diskSizePath: %s, diskSize: %d", diskSizePath, diskSize)
 
 		input.Values.Set(diskSizePath, diskSize)
 		input.Values.Set(retentionPath, retention)
+		input.Values.Set(retentionDaysPath, retentionDays)
+	}
+
+	if forecastMode {
+		return reportDiskSizing(input, statuses)
+	}
+
+	if len(input.Snapshots["disk_sizing_status"]) > 0 {
+		// decisions of the Forecast mode are outdated
+		input.PatchCollector.Delete("v1", "ConfigMap", "d8-monitoring", diskSizingStatusConfigMap)
 	}
 
 	return nil
 }
 
+// isDiskExpandable returns true if all the Prometheus disks can be expanded online.
+func isDiskExpandable(input *go_hook.HookInput, kubeClient k8s.Client, promName string) bool {
+	for _, obj := range input.Snapshots["pvcs"] {
+		pvc := obj.(PersistentVolumeClaimFilter)
+		if pvc.PromName == promName && !isVolumeExpansionAllowed(input, pvc.StorageClass) {
+			return false
+		}
+	}
+	return !isLocalStorage(input, kubeClient, promName)
+}
+
 func makePatchRequestsStorage(diskSize int64) map[string]interface{} {
 	return map[string]interface{}{
 		"spec": map[string]interface{}{
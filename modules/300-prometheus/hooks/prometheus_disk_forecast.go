@@ -0,0 +1,340 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook/metrics"
+	"github.com/flant/addon-operator/sdk"
+	"github.com/flant/shell-operator/pkg/kube/object_patch"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	d8http "github.com/deckhouse/deckhouse/go_lib/dependency/http"
+)
+
+// In the Forecast mode the disk is sized by the TSDB growth: the ingestion rate of the Prometheus multiplied
+// by the bytes per sample after compaction. Prometheus metrics are scraped by the main Prometheus, so both
+// Prometheuses are queried there. The decisions are stored in the status ConfigMap and reported with Events.
+
+const (
+	diskSizingModeForecast = "Forecast"
+
+	diskSizingStatusConfigMap = "prometheus-disk-sizing"
+
+	diskSizingDecisionKeep           = "Keep"
+	diskSizingDecisionExpand         = "Expand"
+	diskSizingDecisionLowerRetention = "LowerRetention"
+	diskSizingDecisionUsage          = "Usage"
+
+	// Prometheus stores 1-2 bytes per sample, the upper bound is used until the first compaction
+	defaultBytesPerSample = 2
+
+	gibibyte = 1024 * 1024 * 1024
+)
+
+type diskSizingStatus struct {
+	Decision                string `json:"decision"`
+	Message                 string `json:"message"`
+	IngestionBytesPerDay    int64  `json:"ingestionBytesPerDay,omitempty"`
+	DiskSizeGigabytes       int64  `json:"diskSizeGigabytes"`
+	RetentionGigabytes      int64  `json:"retentionGigabytes"`
+	RetentionDays           int64  `json:"retentionDays"`
+	ConfiguredRetentionDays int64  `json:"configuredRetentionDays"`
+}
+
+func applyDiskSizingStatusFilter(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	var cm = &corev1.ConfigMap{}
+	err := sdk.FromUnstructured(obj, cm)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert kubernetes object: %v", err)
+	}
+
+	statuses := make(map[string]diskSizingStatus, len(cm.Data))
+	for promName, data := range cm.Data {
+		var status diskSizingStatus
+		// the invalid status is considered as absent
+		if json.Unmarshal([]byte(data), &status) == nil {
+			statuses[promName] = status
+		}
+	}
+
+	return statuses, nil
+}
+
+// diskForecast is the TSDB growth of the Prometheus.
+type diskForecast struct {
+	BytesPerDay float64
+}
+
+// diskSizeGigabytes returns the disk size to keep data for the retention days, the retention size is 80% of the disk.
+func (f diskForecast) diskSizeGigabytes(retentionDays int64) int64 {
+	size := int64(math.Ceil(float64(f.requiredGigabytes(retentionDays)) * 10 / 8))
+	// round up to 5GiB not to resize the disk on every small growth
+	return (size + 4) / 5 * 5
+}
+
+func (f diskForecast) requiredGigabytes(retentionDays int64) int64 {
+	return int64(math.Ceil(f.BytesPerDay * float64(retentionDays) / gibibyte))
+}
+
+// retentionDays returns how many days of data fit into the retention size.
+func (f diskForecast) retentionDays(retentionGigabytes int64) int64 {
+	return int64(float64(retentionGigabytes) * gibibyte / f.BytesPerDay)
+}
+
+func (f diskForecast) String() string {
+	return fmt.Sprintf("%.2fGiB per day", f.BytesPerDay/gibibyte)
+}
+
+func getDiskForecast(dc dependency.Container, promName string) (*diskForecast, error) {
+	selector := fmt.Sprintf(`{job="prometheus", namespace="d8-monitoring", pod=~"prometheus-%s-[0-9]+"}`, promName)
+
+	samplesPerSecond, ok, err := queryPrometheusValue(dc, "max(rate(prometheus_tsdb_head_samples_appended_total"+selector+"[1h]))")
+	if err != nil {
+		return nil, err
+	}
+	if !ok || samplesPerSecond <= 0 {
+		return nil, fmt.Errorf("no ingestion rate for Prometheus %s", promName)
+	}
+
+	bytesPerSample, ok, err := queryPrometheusValue(dc, "max(prometheus_tsdb_compaction_chunk_size_bytes_sum"+selector+" / prometheus_tsdb_compaction_chunk_samples_sum"+selector+")")
+	if err != nil {
+		return nil, err
+	}
+	if !ok || bytesPerSample <= 0 {
+		bytesPerSample = defaultBytesPerSample
+	}
+
+	return &diskForecast{BytesPerDay: samplesPerSecond * bytesPerSample * 86400}, nil
+}
+
+// queryPrometheusValue returns the value of the instant query with a single result.
+func queryPrometheusValue(dc dependency.Container, query string) (float64, bool, error) {
+	cl := dc.GetHTTPClient(d8http.WithInsecureSkipVerify())
+
+	promURL := "https://prometheus.d8-monitoring:9090/api/v1/query?query=" + url.QueryEscape(query)
+	req, err := http.NewRequest("GET", promURL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	err = d8http.SetKubeAuthToken(req)
+	if err != nil {
+		return 0, false, err
+	}
+
+	res, err := cl.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	var response struct {
+		Data struct {
+			Result []struct {
+				Value []interface{} `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(response.Data.Result) == 0 || len(response.Data.Result[0].Value) < 2 {
+		return 0, false, nil
+	}
+	raw, ok := response.Data.Result[0].Value[1].(string)
+	if !ok {
+		return 0, false, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, nil
+	}
+
+	return value, true, nil
+}
+
+// forecastRetention returns the status with the retention days that fit into the disk.
+func forecastRetention(forecast diskForecast, expandable bool, diskResizeLimit, currentSize, diskSize, retentionDays int64) diskSizingStatus {
+	required := forecast.requiredGigabytes(retentionDays)
+	retention := diskSize * 8 / 10
+
+	status := diskSizingStatus{
+		Decision:                diskSizingDecisionKeep,
+		IngestionBytesPerDay:    int64(forecast.BytesPerDay),
+		DiskSizeGigabytes:       diskSize,
+		RetentionGigabytes:      retention,
+		RetentionDays:           retentionDays,
+		ConfiguredRetentionDays: retentionDays,
+	}
+
+	msg := []string{fmt.Sprintf("Ingestion of %s needs %dGiB for %d days of retention.", forecast, required, retentionDays)}
+
+	if diskSize > currentSize {
+		status.Decision = diskSizingDecisionExpand
+		msg = append(msg, fmt.Sprintf("The disk is expanded from %dGiB to %dGiB.", currentSize, diskSize))
+	}
+
+	if required > retention {
+		fitDays := forecast.retentionDays(retention)
+		if fitDays < 1 {
+			fitDays = 1
+		}
+		if fitDays < retentionDays {
+			status.Decision = diskSizingDecisionLowerRetention
+			status.RetentionDays = fitDays
+
+			reason := "the storage class does not allow volume expansion"
+			if expandable {
+				reason = fmt.Sprintf("the disk size limit of %dGiB is reached", diskResizeLimit)
+			}
+			msg = append(msg, fmt.Sprintf("The disk of %dGiB cannot be expanded further, %s, retention is lowered to %d days.", diskSize, reason, fitDays))
+		}
+	}
+
+	if status.Decision == diskSizingDecisionKeep {
+		msg = append(msg, fmt.Sprintf("The disk of %dGiB is enough.", diskSize))
+	}
+
+	status.Message = strings.Join(msg, " ")
+	return status
+}
+
+// reportDiskSizing stores the statuses to the ConfigMap and creates Events for the changed decisions.
+func reportDiskSizing(input *go_hook.HookInput, statuses map[string]diskSizingStatus) error {
+	previous := make(map[string]diskSizingStatus)
+	for _, obj := range input.Snapshots["disk_sizing_status"] {
+		previous = obj.(map[string]diskSizingStatus)
+	}
+
+	data := make(map[string]string, len(statuses))
+	for promName, status := range statuses {
+		input.MetricsCollector.Set(
+			"d8_prometheus_ingestion_bytes_per_day",
+			float64(status.IngestionBytesPerDay),
+			map[string]string{"prometheus": promName},
+			metrics.WithGroup("prometheus_disk_hook"),
+		)
+		input.MetricsCollector.Set(
+			"d8_prometheus_effective_retention_days",
+			float64(status.RetentionDays),
+			map[string]string{"prometheus": promName},
+			metrics.WithGroup("prometheus_disk_hook"),
+		)
+
+		raw, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		data[promName] = string(raw)
+
+		if prev, ok := previous[promName]; ok && !diskSizingChanged(prev, status) {
+			continue
+		}
+		input.PatchCollector.Create(diskSizingEvent(promName, status))
+	}
+
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      diskSizingStatusConfigMap,
+			Namespace: "d8-monitoring",
+			Labels: map[string]string{
+				"heritage": "deckhouse",
+				"module":   "prometheus",
+			},
+		},
+		Data: data,
+	}
+	input.PatchCollector.Create(cm, object_patch.UpdateIfExists())
+
+	return nil
+}
+
+// diskSizingChanged returns true if the decision is changed, keeping the expanded disk is not a new decision.
+func diskSizingChanged(prev, cur diskSizingStatus) bool {
+	if prev.DiskSizeGigabytes != cur.DiskSizeGigabytes || prev.RetentionDays != cur.RetentionDays {
+		return true
+	}
+	if prev.Decision == diskSizingDecisionExpand && cur.Decision == diskSizingDecisionKeep {
+		return false
+	}
+	return prev.Decision != cur.Decision
+}
+
+func diskSizingEvent(promName string, status diskSizingStatus) *eventsv1.Event {
+	eventType := corev1.EventTypeNormal
+	reason := "PrometheusDiskSizeSufficient"
+	switch status.Decision {
+	case diskSizingDecisionExpand:
+		reason = "PrometheusDiskExpansion"
+	case diskSizingDecisionLowerRetention:
+		eventType = corev1.EventTypeWarning
+		reason = "PrometheusRetentionLowered"
+	case diskSizingDecisionUsage:
+		eventType = corev1.EventTypeWarning
+		reason = "PrometheusDiskForecastUnavailable"
+	}
+
+	now := time.Now()
+
+	return &eventsv1.Event{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Event",
+			APIVersion: "events.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "d8-monitoring",
+			// the same naming as events of client-go recorder
+			Name: fmt.Sprintf("%s.%x", promName, now.UnixNano()),
+		},
+		Regarding: corev1.ObjectReference{
+			Kind:       "Prometheus",
+			Name:       promName,
+			Namespace:  "d8-monitoring",
+			APIVersion: "monitoring.coreos.com/v1",
+		},
+		Reason:              reason,
+		Note:                status.Message,
+		Action:              "DiskSizing",
+		Type:                eventType,
+		EventTime:           metav1.MicroTime{Time: now},
+		ReportingInstance:   "deckhouse",
+		ReportingController: "deckhouse",
+	}
+}
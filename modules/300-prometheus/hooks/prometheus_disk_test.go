@@ -17,9 +17,18 @@ limitations under the License.
 package hooks
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
 	. "github.com/deckhouse/deckhouse/testing/hooks"
 )
 
@@ -300,4 +309,206 @@ status:
 		})
 	})
 
+	Context("Forecast mode", func() {
+		const (
+			pvcsForecast = `
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  labels:
+    app: prometheus
+    prometheus: main
+  name: prometheus-main-db-prometheus-main-0
+  namespace: d8-monitoring
+spec:
+  resources:
+    requests:
+      storage: 50Gi
+  storageClassName: ceph-ssd
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  labels:
+    app: prometheus
+    prometheus: longterm
+  name: prometheus-longterm-db-prometheus-longterm-0
+  namespace: d8-monitoring
+spec:
+  resources:
+    requests:
+      storage: 40Gi
+  storageClassName: ceph-ssd
+`
+		)
+
+		prometheusResponse := func(value string) *http.Response {
+			return &http.Response{
+				Header:     map[string][]string{"Content-Type": {"application/json"}},
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(`{"data": {"result": [{"metric": {}, "value": [1660000000, "` + value + `"]}]}}`)),
+			}
+		}
+
+		// main: 100000 samples/s * 1.5 bytes ~ 12.07GiB per day, 182GiB for 15 days, 230GiB disk
+		// longterm: 100 samples/s * 2 bytes ~ 0.02GiB per day, 18GiB for 1095 days, 25GiB disk
+		setPrometheusMock := func() {
+			dependency.TestDC.HTTPClient.DoMock.Set(func(req *http.Request) (*http.Response, error) {
+				query := req.URL.Query().Get("query")
+				main := strings.Contains(query, "prometheus-main-")
+				switch {
+				case strings.Contains(query, "samples_appended") && main:
+					return prometheusResponse("100000"), nil
+				case strings.Contains(query, "samples_appended"):
+					return prometheusResponse("100"), nil
+				case main:
+					return prometheusResponse("1.5"), nil
+				}
+				return prometheusResponse("NaN"), nil
+			})
+		}
+
+		diskSizingStatus := func(promName string) string {
+			return f.KubernetesResource("ConfigMap", "d8-monitoring", "prometheus-disk-sizing").Field("data." + promName).String()
+		}
+
+		eventReasons := func() []string {
+			gvr := schema.GroupVersionResource{Group: "events.k8s.io", Version: "v1", Resource: "events"}
+			events, err := f.KubeClient().Dynamic().Resource(gvr).Namespace("d8-monitoring").List(context.TODO(), metav1.ListOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			reasons := make([]string, 0, len(events.Items))
+			for _, e := range events.Items {
+				reasons = append(reasons, e.Object["regarding"].(map[string]interface{})["name"].(string)+"/"+e.Object["reason"].(string))
+			}
+			return reasons
+		}
+
+		runHook := func(state string) {
+			f.ValuesSet("prometheus.diskSizingMode", "Forecast")
+			f.ValuesSet("prometheus.retentionDays", 15)
+			f.ValuesSet("prometheus.longtermRetentionDays", 1095)
+			f.BindingContexts.Set(f.KubeStateSet(state))
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/10 * * * *"))
+			f.RunHook()
+		}
+
+		Context("Storage class allows volume expansion", func() {
+			BeforeEach(func() {
+				setPrometheusMock()
+				runHook(prom + pvcsForecast + storageClassExpensionTrue)
+			})
+
+			It("Main disk must be expanded for the retention days ahead of time, longterm disk must be kept", func() {
+				Expect(f).To(ExecuteSuccessfully())
+
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.diskSizeGigabytes").Int()).To(Equal(int64(230)))
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.retentionGigabytes").Int()).To(Equal(int64(184)))
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.retentionDays").Int()).To(Equal(int64(15)))
+				Expect(f.KubernetesResource("PersistentVolumeClaim", "d8-monitoring", "prometheus-main-db-prometheus-main-0").Field("spec.resources.requests.storage").String()).To(Equal("230Gi"))
+
+				Expect(f.ValuesGet("prometheus.internal.prometheusLongterm.diskSizeGigabytes").Int()).To(Equal(int64(40)))
+				Expect(f.ValuesGet("prometheus.internal.prometheusLongterm.retentionDays").Int()).To(Equal(int64(1095)))
+
+				Expect(diskSizingStatus("main")).To(ContainSubstring(`"decision":"Expand"`))
+				Expect(diskSizingStatus("main")).To(ContainSubstring(`The disk is expanded from 50GiB to 230GiB.`))
+				Expect(diskSizingStatus("longterm")).To(ContainSubstring(`"decision":"Keep"`))
+
+				Expect(eventReasons()).To(ConsistOf("main/PrometheusDiskExpansion", "longterm/PrometheusDiskSizeSufficient"))
+			})
+
+			Context("Decisions are not changed", func() {
+				BeforeEach(func() {
+					runHook(prom + pvcsForecast + storageClassExpensionTrue)
+				})
+
+				It("Events must not be created again", func() {
+					Expect(f).To(ExecuteSuccessfully())
+					Expect(eventReasons()).To(HaveLen(2))
+				})
+			})
+		})
+
+		Context("Disk size limit is reached", func() {
+			BeforeEach(func() {
+				setPrometheusMock()
+				f.ConfigValuesSet("prometheus.mainMaxDiskSizeGigabytes", 200)
+				runHook(prom + pvcsForecast + storageClassExpensionTrue)
+			})
+
+			It("Main disk must be expanded to the limit, retention must be lowered", func() {
+				Expect(f).To(ExecuteSuccessfully())
+
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.diskSizeGigabytes").Int()).To(Equal(int64(200)))
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.retentionDays").Int()).To(Equal(int64(13)))
+
+				Expect(diskSizingStatus("main")).To(ContainSubstring(`"decision":"LowerRetention"`))
+				Expect(diskSizingStatus("main")).To(ContainSubstring(`the disk size limit of 200GiB is reached, retention is lowered to 13 days`))
+				Expect(eventReasons()).To(ContainElement("main/PrometheusRetentionLowered"))
+			})
+		})
+
+		Context("Storage class does not allow volume expansion", func() {
+			BeforeEach(func() {
+				setPrometheusMock()
+				runHook(prom + pvcsForecast + storageClassExpensionFalse)
+			})
+
+			It("Disk must not be expanded, retention must be lowered to fit the disk", func() {
+				Expect(f).To(ExecuteSuccessfully())
+
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.diskSizeGigabytes").Int()).To(Equal(int64(50)))
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.retentionGigabytes").Int()).To(Equal(int64(40)))
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.retentionDays").Int()).To(Equal(int64(3)))
+				Expect(f.KubernetesResource("PersistentVolumeClaim", "d8-monitoring", "prometheus-main-db-prometheus-main-0").Field("spec.resources.requests.storage").String()).To(Equal("50Gi"))
+
+				Expect(diskSizingStatus("main")).To(ContainSubstring(`the storage class does not allow volume expansion, retention is lowered to 3 days`))
+			})
+		})
+
+		Context("Prometheus is unavailable", func() {
+			BeforeEach(func() {
+				dependency.TestDC.HTTPClient.DoMock.Set(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusServiceUnavailable,
+						Body:       ioutil.NopCloser(bytes.NewBuffer(nil)),
+					}, nil
+				})
+				runHook(prom + pvcsForecast + storageClassExpensionTrue)
+			})
+
+			It("Disk must be sized by the usage, retention must be kept", func() {
+				Expect(f).To(ExecuteSuccessfully())
+
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.diskSizeGigabytes").Int()).To(Equal(int64(50)))
+				Expect(f.ValuesGet("prometheus.internal.prometheusMain.retentionDays").Int()).To(Equal(int64(15)))
+
+				Expect(diskSizingStatus("main")).To(ContainSubstring(`"decision":"Usage"`))
+				Expect(eventReasons()).To(ContainElement("main/PrometheusDiskForecastUnavailable"))
+			})
+		})
+
+		Context("Usage mode with the status ConfigMap", func() {
+			BeforeEach(func() {
+				f.BindingContexts.Set(f.KubeStateSet(prom + pvcsForecast + storageClassExpensionTrue + `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: prometheus-disk-sizing
+  namespace: d8-monitoring
+data:
+  main: '{"decision":"Keep"}'
+`))
+				f.BindingContexts.Set(f.GenerateScheduleContext("*/10 * * * *"))
+				f.RunHook()
+			})
+
+			It("Status ConfigMap must be deleted", func() {
+				Expect(f).To(ExecuteSuccessfully())
+				Expect(f.KubernetesResource("ConfigMap", "d8-monitoring", "prometheus-disk-sizing").Exists()).To(BeFalse())
+			})
+		})
+	})
 })
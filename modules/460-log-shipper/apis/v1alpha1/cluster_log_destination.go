@@ -37,7 +37,7 @@ type ClusterLogDestination struct {
 }
 
 type ClusterLogDestinationSpec struct {
-	// Type of cluster log source: Loki, Elasticsearch, Logstash, Vector
+	// Type of cluster log source: Loki, Elasticsearch, Logstash, Vector, Kafka, Splunk, S3
 	Type string `json:"type,omitempty"`
 
 	// Loki describes spec for loki endpoint
@@ -52,6 +52,15 @@ type ClusterLogDestinationSpec struct {
 	// Vector spec for the Vector endpoint
 	Vector VectorSpec `json:"vector"`
 
+	// Kafka spec for the Kafka brokers
+	Kafka KafkaSpec `json:"kafka"`
+
+	// Splunk spec for the Splunk HTTP Event Collector
+	Splunk SplunkSpec `json:"splunk"`
+
+	// S3 spec for the S3-compatible object storage
+	S3 S3Spec `json:"s3"`
+
 	// Add extra labels for sources
 	ExtraLabels map[string]string `json:"extraLabels,omitempty"`
 
@@ -60,6 +69,30 @@ type ClusterLogDestinationSpec struct {
 }
 
 type ClusterLogDestinationStatus struct {
+	// Accepted is true if the destination is added to the vector config
+	Accepted bool `json:"accepted"`
+
+	// Errors found in the destination
+	Errors []string `json:"errors,omitempty"`
+
+	// MatchedSources is the number of configs sending logs to the destination
+	MatchedSources int `json:"matchedSources"`
+
+	// ConfigChecksum is the sha256 checksum of the last generated vector config
+	ConfigChecksum string `json:"configChecksum,omitempty"`
+
+	// Delivery health of the destination according to vector internal metrics
+	Delivery *DeliveryStatus `json:"delivery,omitempty"`
+}
+
+type DeliveryStatus struct {
+	// SentEvents is the number of events sent to the destination by all vector instances during the last check period
+	SentEvents int64 `json:"sentEvents"`
+
+	// Errors is the number of errors of the destination sink during the last check period
+	Errors int64 `json:"errors"`
+
+	LastCheckTime metav1.Time `json:"lastCheckTime"`
 }
 
 type LokiAuthSpec struct {
@@ -130,3 +163,56 @@ type VectorSpec struct {
 
 	TLS CommonTLSSpec `json:"tls,omitempty"`
 }
+
+type KafkaSASLSpec struct {
+	Mechanism string `json:"mechanism,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+}
+
+type KafkaSpec struct {
+	BootstrapServers []string `json:"bootstrapServers,omitempty"`
+
+	Topic    string `json:"topic,omitempty"`
+	KeyField string `json:"keyField,omitempty"`
+
+	Compression string `json:"compression,omitempty"`
+
+	SASL *KafkaSASLSpec `json:"sasl,omitempty"`
+
+	TLS *CommonTLSSpec `json:"tls,omitempty"`
+}
+
+type SplunkSpec struct {
+	Endpoint string `json:"endpoint,omitempty"`
+
+	Token string `json:"token,omitempty"`
+	Index string `json:"index,omitempty"`
+
+	TLS CommonTLSSpec `json:"tls,omitempty"`
+}
+
+type S3AuthSpec struct {
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+}
+
+// S3BatchSpec limits the size of a single object written to the bucket.
+type S3BatchSpec struct {
+	MaxBytes    *int32 `json:"maxBytes,omitempty"`
+	TimeoutSecs *int32 `json:"timeoutSecs,omitempty"`
+}
+
+type S3Spec struct {
+	Endpoint string `json:"endpoint,omitempty"`
+
+	Bucket    string `json:"bucket,omitempty"`
+	Region    string `json:"region,omitempty"`
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+
+	Auth S3AuthSpec `json:"auth,omitempty"`
+
+	Batch S3BatchSpec `json:"batch,omitempty"`
+
+	TLS CommonTLSSpec `json:"tls,omitempty"`
+}
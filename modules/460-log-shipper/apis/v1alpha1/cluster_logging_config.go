@@ -54,11 +54,25 @@ type ClusterLoggingConfigSpec struct {
 	// Multiline parsers
 	MultiLineParser MultiLineParser `json:"multilineParser,omitempty"`
 
+	// Parser extracts fields from messages
+	Parser Parser `json:"parser,omitempty"`
+
 	// DestinationRefs slice of ClusterLogDestination names
 	DestinationRefs []string `json:"destinationRefs,omitempty"`
 }
 
 type ClusterLoggingConfigStatus struct {
+	// Accepted is true if the config is added to the vector config
+	Accepted bool `json:"accepted"`
+
+	// Errors found in the config, e.g., references to absent destinations or invalid regexes
+	Errors []string `json:"errors,omitempty"`
+
+	// MatchedSources is the number of vector sources created for the config
+	MatchedSources int `json:"matchedSources"`
+
+	// ConfigChecksum is the sha256 checksum of the last generated vector config
+	ConfigChecksum string `json:"configChecksum,omitempty"`
 }
 
 type KubernetesPodsSpec struct {
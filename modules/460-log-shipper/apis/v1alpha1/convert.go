@@ -20,25 +20,61 @@ import (
 	"fmt"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+// NamespacedName returns a name for the namespaced resource which is unique among both cluster and namespaced resources.
+// Kubernetes object names cannot contain the underscore, so it never clashes with a name of a cluster resource.
+func NamespacedName(namespace, name string) string {
+	return fmt.Sprintf("%s_%s", namespace, name)
+}
+
+// NamespacedToCluster converts PodLoggingConfig to ClusterLoggingConfig.
+// The source always collects logs only from the namespace of the PodLoggingConfig
+// and is sent only to ClusterLogDestinations or to LogDestinations from the same namespace.
 func NamespacedToCluster(namespaced PodLoggingConfig) ClusterLoggingConfig {
+	refs := make([]string, 0, len(namespaced.Spec.ClusterDestinationRefs)+len(namespaced.Spec.DestinationRefs))
+	for _, ref := range namespaced.Spec.ClusterDestinationRefs {
+		// Skip references which cannot be a name of ClusterLogDestination,
+		// otherwise they could point to LogDestinations from other namespaces.
+		if len(validation.IsDNS1123Subdomain(ref)) > 0 {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	for _, ref := range namespaced.Spec.DestinationRefs {
+		refs = append(refs, NamespacedName(namespaced.Namespace, ref))
+	}
+
 	return ClusterLoggingConfig{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("%s_%s", namespaced.Namespace, namespaced.Name),
+			Name: NamespacedName(namespaced.Namespace, namespaced.Name),
 		},
 		Spec: ClusterLoggingConfigSpec{
 			Type:            SourceKubernetesPods,
 			LabelFilters:    namespaced.Spec.LabelFilters,
 			LogFilters:      namespaced.Spec.LogFilters,
 			MultiLineParser: namespaced.Spec.MultiLineParser,
+			Parser:          namespaced.Spec.Parser,
 
 			KubernetesPods: KubernetesPodsSpec{
 				NamespaceSelector: NamespaceSelector{MatchNames: []string{namespaced.Namespace}},
 				LabelSelector:     namespaced.Spec.LabelSelector,
 			},
-			DestinationRefs: namespaced.Spec.ClusterDestinationRefs,
+			DestinationRefs: refs,
 		},
 		Status: ClusterLoggingConfigStatus{},
 	}
 }
+
+// NamespacedDestinationToCluster converts LogDestination to ClusterLogDestination.
+// The name of the result can be referenced only by PodLoggingConfigs from the same namespace.
+func NamespacedDestinationToCluster(namespaced LogDestination) ClusterLogDestination {
+	return ClusterLogDestination{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: NamespacedName(namespaced.Namespace, namespaced.Name),
+		},
+		Spec:   namespaced.Spec,
+		Status: ClusterLogDestinationStatus{},
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LogDestination specify output for logs stream of PodLoggingConfigs in the same namespace
+type LogDestination struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec defines the behavior of a namespaced log destination.
+	// It is the same as for ClusterLogDestination.
+	Spec ClusterLogDestinationSpec `json:"spec"`
+
+	// Most recently observed status of a namespaced log destination.
+	// Populated by the system.
+	Status LogDestinationStatus `json:"status,omitempty"`
+}
+
+// LogDestinationStatus is the same as for ClusterLogDestination.
+type LogDestinationStatus = ClusterLogDestinationStatus
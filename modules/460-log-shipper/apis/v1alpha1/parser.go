@@ -0,0 +1,41 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Parser extracts fields from the message into the parsed_data field of the event
+// before the labels and logs filtration.
+type Parser struct {
+	Type ParserType `json:"type,omitempty"`
+
+	// Regex is a regular expression with named capture groups for the Regex parser type.
+	Regex string `json:"regex,omitempty"`
+
+	// PromoteFields are parsed fields which are copied to the top level of the event.
+	// They become labels for Loki and top-level fields for other destinations.
+	PromoteFields []string `json:"promoteFields,omitempty"`
+}
+
+type ParserType string
+
+const (
+	ParserNone          ParserType = "None"
+	ParserJSON          ParserType = "JSON"
+	ParserLogfmt        ParserType = "Logfmt"
+	ParserKlog          ParserType = "Klog"
+	ParserNginxCombined ParserType = "NginxCombined"
+	ParserRegex         ParserType = "Regex"
+)
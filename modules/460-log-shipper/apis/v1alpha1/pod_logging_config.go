@@ -46,9 +46,15 @@ type PodLoggingConfigSpec struct {
 	// Multiline parsers
 	MultiLineParser MultiLineParser `json:"multilineParser,omitempty"`
 
+	// Parser extracts fields from messages
+	Parser Parser `json:"parser,omitempty"`
+
 	// ClusterDestinationRefs slice of ClusterLogDestination names
 	ClusterDestinationRefs []string `json:"clusterDestinationRefs,omitempty"`
-}
 
-type PodLoggingConfigStatus struct {
+	// DestinationRefs slice of LogDestination names from the same namespace
+	DestinationRefs []string `json:"destinationRefs,omitempty"`
 }
+
+// PodLoggingConfigStatus is the same as for ClusterLoggingConfig.
+type PodLoggingConfigStatus = ClusterLoggingConfigStatus
@@ -21,6 +21,9 @@ const (
 	DestLogstash      = "Logstash"
 	DestLoki          = "Loki"
 	DestVector        = "Vector"
+	DestKafka         = "Kafka"
+	DestSplunk        = "Splunk"
+	DestS3            = "S3"
 )
 
 const (
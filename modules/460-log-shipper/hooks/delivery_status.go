@@ -0,0 +1,209 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/sdk"
+	"github.com/flant/shell-operator/pkg/kube/object_patch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/pointer"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	d8http "github.com/deckhouse/deckhouse/go_lib/dependency/http"
+	"github.com/deckhouse/deckhouse/go_lib/set"
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis/v1alpha1"
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/hooks/internal/vector/destination"
+)
+
+// This hook reports delivery health of every destination to its status.
+// Vector internal metrics are scraped by Prometheus from all log-shipper agents,
+// so the hook takes sums for the sink of the destination from all of them.
+
+const (
+	deliveryCheckPeriod = "5m"
+
+	sentEventsQuery = `sum by (component_id) (increase(vector_component_sent_events_total{component_kind="sink"}[` + deliveryCheckPeriod + `]))`
+	errorsQuery     = `sum by (component_id) (increase(vector_component_errors_total{component_kind="sink"}[` + deliveryCheckPeriod + `]))`
+)
+
+type deliveryDestination struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// componentID returns the name of the vector sink for the destination.
+func (d deliveryDestination) componentID() string {
+	if d.Namespace == "" {
+		return destination.ComposeName(d.Name)
+	}
+	return destination.ComposeName(v1alpha1.NamespacedName(d.Namespace, d.Name))
+}
+
+func filterDeliveryDestination(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	return deliveryDestination{
+		Kind:      obj.GetKind(),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}, nil
+}
+
+var _ = sdk.RegisterFunc(&go_hook.HookConfig{
+	Queue: "/modules/log-shipper/delivery_status",
+	Schedule: []go_hook.ScheduleConfig{
+		{Name: "cron", Crontab: "*/5 * * * *"},
+	},
+	Kubernetes: []go_hook.KubernetesConfig{
+		{
+			Name:                         "cluster_log_destination",
+			ApiVersion:                   "deckhouse.io/v1alpha1",
+			Kind:                         "ClusterLogDestination",
+			ExecuteHookOnEvents:          pointer.BoolPtr(false),
+			ExecuteHookOnSynchronization: pointer.BoolPtr(false),
+			FilterFunc:                   filterDeliveryDestination,
+		},
+		{
+			Name:                         "namespaced_log_destination",
+			ApiVersion:                   "deckhouse.io/v1alpha1",
+			Kind:                         "LogDestination",
+			ExecuteHookOnEvents:          pointer.BoolPtr(false),
+			ExecuteHookOnSynchronization: pointer.BoolPtr(false),
+			FilterFunc:                   filterDeliveryDestination,
+		},
+	},
+}, dependency.WithExternalDependencies(updateDeliveryStatus))
+
+func updateDeliveryStatus(input *go_hook.HookInput, dc dependency.Container) error {
+	if !input.Values.Get("logShipper.internal.activated").Bool() {
+		return nil
+	}
+	if !set.NewFromValues(input.Values, "global.enabledModules").Has("prometheus") {
+		return nil
+	}
+
+	sentEvents, err := queryPrometheus(dc, sentEventsQuery)
+	if err != nil {
+		input.LogEntry.Warnf("Prometheus request for sent events failed: %s", err)
+		return nil // don't fail the hook
+	}
+
+	errs, err := queryPrometheus(dc, errorsQuery)
+	if err != nil {
+		input.LogEntry.Warnf("Prometheus request for sink errors failed: %s", err)
+		return nil
+	}
+
+	now := metav1.NewTime(time.Now().UTC())
+
+	for _, snapshot := range []string{"cluster_log_destination", "namespaced_log_destination"} {
+		for _, d := range input.Snapshots[snapshot] {
+			dest := d.(deliveryDestination)
+
+			// The sink is absent in the vector config, e.g., no configs send logs to the destination.
+			var delivery interface{}
+
+			id := dest.componentID()
+			if sent, ok := sentEvents[id]; ok {
+				delivery = v1alpha1.DeliveryStatus{
+					SentEvents:    sent,
+					Errors:        errs[id],
+					LastCheckTime: now,
+				}
+			}
+
+			patch := map[string]interface{}{
+				"status": map[string]interface{}{
+					"delivery": delivery,
+				},
+			}
+			input.PatchCollector.MergePatch(patch, "deckhouse.io/v1alpha1", dest.Kind, dest.Namespace, dest.Name, object_patch.WithSubresource("/status"))
+		}
+	}
+
+	return nil
+}
+
+// queryPrometheus returns values of the instant query by the component_id label.
+func queryPrometheus(dc dependency.Container, query string) (map[string]int64, error) {
+	cl := dc.GetHTTPClient(d8http.WithInsecureSkipVerify())
+
+	promURL := "https://prometheus.d8-monitoring:9090/api/v1/query?query=" + url.QueryEscape(query)
+	req, err := http.NewRequest("GET", promURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = d8http.SetKubeAuthToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := cl.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	var response promMetrics
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]int64, len(response.Data.Result))
+	for _, record := range response.Data.Result {
+		if len(record.Value) < 2 {
+			continue
+		}
+		raw, ok := record.Value[1].(string)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(value) {
+			continue
+		}
+		// increase() extrapolates values, so they are not always integers
+		values[record.Metric.ComponentID] = int64(math.Round(value))
+	}
+
+	return values, nil
+}
+
+type promMetrics struct {
+	Data struct {
+		Result []struct {
+			Metric struct {
+				ComponentID string `json:"component_id"`
+			} `json:"metric"`
+			Value []interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
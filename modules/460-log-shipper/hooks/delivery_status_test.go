@@ -0,0 +1,137 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	. "github.com/deckhouse/deckhouse/testing/hooks"
+)
+
+const deliveryStatusState = `
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: loki-storage
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.loki:3100
+status:
+  accepted: true
+  matchedSources: 1
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: unused
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.loki:3100
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: LogDestination
+metadata:
+  name: tenant-loki
+  namespace: tenant-a
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.tenant-a:3100
+`
+
+func prometheusResponse(body string) *http.Response {
+	return &http.Response{
+		Header:     map[string][]string{"Content-Type": {"application/json"}},
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+var _ = Describe("Log shipper :: delivery status ::", func() {
+	f := HookExecutionConfigInit(`{"global": {"enabledModules": ["prometheus"]}, "logShipper": {"internal": {"activated": true}}}`, ``)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "ClusterLogDestination", false)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "LogDestination", true)
+
+	Context("Prometheus returns metrics", func() {
+		BeforeEach(func() {
+			dependency.TestDC.HTTPClient.DoMock.Set(func(req *http.Request) (*http.Response, error) {
+				if strings.Contains(req.URL.Query().Get("query"), "vector_component_errors_total") {
+					return prometheusResponse(`{"data": {"result": [
+						{"metric": {"component_id": "destination/cluster/loki-storage"}, "value": [1660000000, "3.9"]}
+					]}}`), nil
+				}
+				return prometheusResponse(`{"data": {"result": [
+					{"metric": {"component_id": "destination/cluster/loki-storage"}, "value": [1660000000, "1234.4"]},
+					{"metric": {"component_id": "destination/cluster/tenant-a_tenant-loki"}, "value": [1660000000, "0"]}
+				]}}`), nil
+			})
+
+			f.KubeStateSet(deliveryStatusState)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/5 * * * *"))
+			f.RunHook()
+		})
+
+		It("Should set delivery health to destination statuses", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			loki := f.KubernetesGlobalResource("ClusterLogDestination", "loki-storage")
+			Expect(loki.Field("status.accepted").Bool()).To(BeTrue())
+			Expect(loki.Field("status.delivery.sentEvents").Int()).To(Equal(int64(1234)))
+			Expect(loki.Field("status.delivery.errors").Int()).To(Equal(int64(4)))
+			Expect(loki.Field("status.delivery.lastCheckTime").Exists()).To(BeTrue())
+
+			tenant := f.KubernetesResource("LogDestination", "tenant-a", "tenant-loki")
+			Expect(tenant.Field("status.delivery.sentEvents").Int()).To(Equal(int64(0)))
+			Expect(tenant.Field("status.delivery.errors").Int()).To(Equal(int64(0)))
+
+			unused := f.KubernetesGlobalResource("ClusterLogDestination", "unused")
+			Expect(unused.Field("status.delivery").Exists()).To(BeFalse())
+		})
+	})
+
+	Context("Prometheus is unavailable", func() {
+		BeforeEach(func() {
+			dependency.TestDC.HTTPClient.DoMock.Set(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Body:       ioutil.NopCloser(bytes.NewBuffer(nil)),
+				}, nil
+			})
+
+			f.KubeStateSet(deliveryStatusState)
+			f.BindingContexts.Set(f.GenerateScheduleContext("*/5 * * * *"))
+			f.RunHook()
+		})
+
+		It("Should not fail and keep statuses", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			loki := f.KubernetesGlobalResource("ClusterLogDestination", "loki-storage")
+			Expect(loki.Field("status.accepted").Bool()).To(BeTrue())
+			Expect(loki.Field("status.delivery").Exists()).To(BeFalse())
+		})
+	})
+})
@@ -17,6 +17,8 @@ limitations under the License.
 package hooks
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"time"
 
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
@@ -31,10 +33,22 @@ import (
 	"github.com/deckhouse/deckhouse/modules/460-log-shipper/hooks/internal/composer"
 )
 
+// fromUnstructuredWithoutStatus converts the object to the typed one leaving the status empty.
+// The status is written by the hook, so its changes should not trigger the hook again.
+func fromUnstructuredWithoutStatus(obj *unstructured.Unstructured, target interface{}) error {
+	withoutStatus := &unstructured.Unstructured{Object: make(map[string]interface{}, len(obj.Object))}
+	for key, value := range obj.Object {
+		if key != "status" {
+			withoutStatus.Object[key] = value
+		}
+	}
+	return sdk.FromUnstructured(withoutStatus, target)
+}
+
 func filterPodLoggingConfig(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
 	var src v1alpha1.PodLoggingConfig
 
-	err := sdk.FromUnstructured(obj, &src)
+	err := fromUnstructuredWithoutStatus(obj, &src)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +58,7 @@ func filterPodLoggingConfig(obj *unstructured.Unstructured) (go_hook.FilterResul
 func filterClusterLoggingConfig(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
 	var src v1alpha1.ClusterLoggingConfig
 
-	err := sdk.FromUnstructured(obj, &src)
+	err := fromUnstructuredWithoutStatus(obj, &src)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +68,17 @@ func filterClusterLoggingConfig(obj *unstructured.Unstructured) (go_hook.FilterR
 func filterClusterLogDestination(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
 	var dst v1alpha1.ClusterLogDestination
 
-	err := sdk.FromUnstructured(obj, &dst)
+	err := fromUnstructuredWithoutStatus(obj, &dst)
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+func filterLogDestination(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	var dst v1alpha1.LogDestination
+
+	err := fromUnstructuredWithoutStatus(obj, &dst)
 	if err != nil {
 		return nil, err
 	}
@@ -83,11 +107,19 @@ var _ = sdk.RegisterFunc(&go_hook.HookConfig{
 			Kind:       "ClusterLogDestination",
 			FilterFunc: filterClusterLogDestination,
 		},
+		{
+			Name:       "namespaced_log_destination",
+			ApiVersion: "deckhouse.io/v1alpha1",
+			Kind:       "LogDestination",
+			FilterFunc: filterLogDestination,
+		},
 	},
 }, generateConfig)
 
 func generateConfig(input *go_hook.HookInput) error {
-	configContent, err := composer.FromInput(input).Do()
+	c := composer.FromInput(input)
+
+	configContent, err := c.Do()
 	if err != nil {
 		return err
 	}
@@ -95,6 +127,12 @@ func generateConfig(input *go_hook.HookInput) error {
 	activated := len(configContent) != 0
 	input.Values.Set("logShipper.internal.activated", activated)
 
+	var checksum string
+	if activated {
+		checksum = fmt.Sprintf("%x", sha256.Sum256(configContent))
+	}
+	patchStatuses(input, c, checksum)
+
 	if !activated {
 		input.PatchCollector.Delete(
 			"v1", "Secret", "d8-log-shipper", "d8-log-shipper-config",
@@ -147,3 +185,55 @@ func generateConfig(input *go_hook.HookInput) error {
 
 	return nil
 }
+
+// patchStatuses reports the result of composing for every custom resource.
+func patchStatuses(input *go_hook.HookInput, c *composer.Composer, checksum string) {
+	for _, s := range input.Snapshots["cluster_log_source"] {
+		src := s.(v1alpha1.ClusterLoggingConfig)
+		patchStatus(input, "ClusterLoggingConfig", "", src.Name, c.SourceStatus[src.Name], checksum)
+	}
+
+	for _, s := range input.Snapshots["namespaced_log_source"] {
+		src := s.(v1alpha1.PodLoggingConfig)
+		name := v1alpha1.NamespacedName(src.Namespace, src.Name)
+		patchStatus(input, "PodLoggingConfig", src.Namespace, src.Name, c.SourceStatus[name], checksum)
+	}
+
+	for _, d := range input.Snapshots["cluster_log_destination"] {
+		dest := d.(v1alpha1.ClusterLogDestination)
+		patchStatus(input, "ClusterLogDestination", "", dest.Name, c.DestStatus[dest.Name], checksum)
+	}
+
+	for _, d := range input.Snapshots["namespaced_log_destination"] {
+		dest := d.(v1alpha1.LogDestination)
+		name := v1alpha1.NamespacedName(dest.Namespace, dest.Name)
+		patchStatus(input, "LogDestination", dest.Namespace, dest.Name, c.DestStatus[name], checksum)
+	}
+}
+
+func patchStatus(input *go_hook.HookInput, kind, namespace, name string, status *composer.Status, checksum string) {
+	if status == nil {
+		return
+	}
+
+	// Null values remove errors and the checksum left from previous runs.
+	var errs interface{}
+	if len(status.Errors) > 0 {
+		errs = status.Errors
+	}
+	var configChecksum interface{}
+	if checksum != "" {
+		configChecksum = checksum
+	}
+
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"accepted":       status.Accepted,
+			"errors":         errs,
+			"matchedSources": status.MatchedSources,
+			"configChecksum": configChecksum,
+		},
+	}
+
+	input.PatchCollector.MergePatch(patch, "deckhouse.io/v1alpha1", kind, namespace, name, object_patch.WithSubresource("/status"))
+}
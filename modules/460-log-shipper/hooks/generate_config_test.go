@@ -17,7 +17,9 @@ limitations under the License.
 package hooks
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -25,6 +27,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
 
 	. "github.com/deckhouse/deckhouse/testing/hooks"
 	"github.com/deckhouse/deckhouse/testing/library/object_store"
@@ -53,6 +56,7 @@ var _ = Describe("Log shipper :: generate config from crd ::", func() {
 	f.RegisterCRD("deckhouse.io", "v1alpha1", "ClusterLoggingConfig", false)
 	f.RegisterCRD("deckhouse.io", "v1alpha1", "ClusterLogDestination", false)
 	f.RegisterCRD("deckhouse.io", "v1alpha1", "PodLoggingConfig", true)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "LogDestination", true)
 
 	Context("Simple pair", func() {
 		BeforeEach(func() {
@@ -879,4 +883,506 @@ spec:
 			})
 		})
 	})
+
+	Context("Pods to Kafka, Splunk and S3", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(`
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLoggingConfig
+metadata:
+  name: audit-source
+spec:
+  type: KubernetesPods
+  destinationRefs:
+    - test-kafka-dest
+    - test-splunk-dest
+    - test-s3-dest
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: test-kafka-dest
+spec:
+  type: Kafka
+  kafka:
+    bootstrapServers:
+      - "192.168.1.1:9093"
+      - "192.168.1.2:9093"
+    topic: "logs-{{ namespace }}"
+    keyField: pod
+    compression: Zstd
+    sasl:
+      mechanism: ScramSha512
+      username: vector
+      password: c2VjcmV0
+    tls:
+      verifyHostname: false
+  rateLimit:
+    linesPerMinute: 1000
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: test-splunk-dest
+spec:
+  type: Splunk
+  splunk:
+    endpoint: "https://192.168.1.1:8088"
+    token: dGVzdC10b2tlbg==
+    index: "k8s-{{ namespace }}"
+    tls:
+      verifyCertificate: false
+  extraLabels:
+    cluster: dev
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: test-s3-dest
+spec:
+  type: S3
+  s3:
+    endpoint: "https://storage.example.com"
+    bucket: audit
+    region: ru-central1
+    keyPrefix: "{{ namespace }}/%F/"
+    auth:
+      accessKeyID: a2V5LWlk
+      secretAccessKey: c2VjcmV0LWtleQ==
+    batch:
+      timeoutSecs: 60
+  rateLimit:
+    linesPerMinute: 5000
+---
+`))
+			f.RunHook()
+		})
+
+		It("Should create secret", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			Expect(f.ValuesGet("logShipper.internal.activated").Bool()).To(BeTrue())
+
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			Expect(secret).To(Not(BeEmpty()))
+
+			assertConfig(secret, "kafka-splunk-s3.json")
+		})
+		Context("With deleting object", func() {
+			BeforeEach(func() {
+				f.BindingContexts.Set(f.KubeStateSet(""))
+				f.RunHook()
+			})
+			It("Should delete secret and deactivate module", func() {
+				Expect(f).To(ExecuteSuccessfully())
+				Expect(f.ValuesGet("logShipper.internal.activated").Bool()).To(BeFalse())
+				Expect(f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config").Exists()).To(BeFalse())
+			})
+		})
+	})
+
+	Context("Namespaced source with namespaced destinations", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(`
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: PodLoggingConfig
+metadata:
+  name: app-logs
+  namespace: tenant-a
+spec:
+  labelSelector:
+    matchLabels:
+      app: test
+  destinationRefs:
+    - tenant-loki
+  clusterDestinationRefs:
+    - tenant-b_tenant-loki
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: PodLoggingConfig
+metadata:
+  name: not-ready
+  namespace: tenant-a
+spec:
+  destinationRefs:
+    - absent-loki
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: LogDestination
+metadata:
+  name: tenant-loki
+  namespace: tenant-a
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.tenant-a:3100
+  rateLimit:
+    linesPerMinute: 300
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: LogDestination
+metadata:
+  name: tenant-loki
+  namespace: tenant-b
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.tenant-b:3100
+---
+`))
+			f.RunHook()
+		})
+
+		It("Should create secret", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			Expect(f.ValuesGet("logShipper.internal.activated").Bool()).To(BeTrue())
+			Expect(secret).To(Not(BeEmpty()))
+
+			assertConfig(secret, "namespaced-destination.json")
+		})
+
+		It("Should collect logs only from the namespace of the source", func() {
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			config, err := base64.StdEncoding.DecodeString(secret.Field(`data`).Get("vector\\.json").String())
+			Expect(err).To(BeNil())
+
+			sources := gjson.GetBytes(config, "sources").Map()
+			Expect(sources).To(HaveLen(1))
+			for _, src := range sources {
+				Expect(src.Get("extra_field_selector").String()).To(HavePrefix("metadata.namespace=tenant-a,"))
+			}
+
+			sinks := gjson.GetBytes(config, "sinks").Map()
+			Expect(sinks).To(HaveLen(1))
+			Expect(sinks).To(HaveKey("destination/cluster/tenant-a_tenant-loki"))
+		})
+	})
+
+	Context("Namespaced destination with VRL in an extra label key", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(`
+apiVersion: deckhouse.io/v1alpha1
+kind: PodLoggingConfig
+metadata:
+  name: app-logs
+  namespace: tenant-a
+spec:
+  destinationRefs:
+    - injected-key
+    - tenant-elastic
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: LogDestination
+metadata:
+  name: injected-key
+  namespace: tenant-a
+spec:
+  type: Elasticsearch
+  elasticsearch:
+    endpoint: http://elastic.tenant-a:9200
+  extraLabels:
+    "a = get_env_var!(\"VECTOR_TOKEN\")\n.b": value
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: LogDestination
+metadata:
+  name: tenant-elastic
+  namespace: tenant-a
+spec:
+  type: Elasticsearch
+  elasticsearch:
+    endpoint: http://elastic.tenant-a:9200
+  extraLabels:
+    app_info: "{{ app }}"
+`))
+			f.RunHook()
+		})
+
+		It("Should not put VRL from extra labels into the config", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			config, err := base64.StdEncoding.DecodeString(secret.Field(`data`).Get("vector\\.json").String())
+			Expect(err).To(BeNil())
+
+			sinks := gjson.GetBytes(config, "sinks").Map()
+			Expect(sinks).To(HaveLen(1))
+			Expect(sinks).To(HaveKey("destination/cluster/tenant-a_tenant-elastic"))
+			Expect(string(config)).ToNot(ContainSubstring("get_env_var"))
+		})
+
+		It("Should report the invalid key to the destination status", func() {
+			dest := f.KubernetesResource("LogDestination", "tenant-a", "injected-key")
+			Expect(dest.Field("status.accepted").Bool()).To(BeFalse())
+			Expect(dest.Field("status.errors").String()).To(MatchJSON(`["extraLabels: invalid key \"a = get_env_var!(\\\"VECTOR_TOKEN\\\")\\n.b\", must match ^[a-zA-Z0-9_]+$"]`))
+		})
+	})
+
+	Context("Namespaced source with a single quote in the parser regex", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(`
+apiVersion: deckhouse.io/v1alpha1
+kind: PodLoggingConfig
+metadata:
+  name: quoted-regex
+  namespace: tenant-a
+spec:
+  parser:
+    type: Regex
+    regex: "^(?P<msg>don't .*)$"
+  destinationRefs:
+    - tenant-loki
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: PodLoggingConfig
+metadata:
+  name: escaped-regex
+  namespace: tenant-a
+spec:
+  parser:
+    type: Regex
+    regex: '^(?P<msg>don\x27t .*)$'
+  destinationRefs:
+    - tenant-loki
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: LogDestination
+metadata:
+  name: tenant-loki
+  namespace: tenant-a
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.tenant-a:3100
+`))
+			f.RunHook()
+		})
+
+		It("Should not put the regex with the quote into the config", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			config, err := base64.StdEncoding.DecodeString(secret.Field(`data`).Get("vector\\.json").String())
+			Expect(err).To(BeNil())
+
+			sources := gjson.GetBytes(config, "sources").Map()
+			Expect(sources).To(HaveLen(1))
+			Expect(sources).To(HaveKey("cluster_logging_config/tenant-a_escaped-regex:tenant-a"))
+
+			parser := gjson.GetBytes(config, `transforms.transform/source/tenant-a_escaped-regex/02_parser.source`)
+			Expect(parser.String()).To(HavePrefix(`structured, err = parse_regex(.message, r'^(?P<msg>don\x27t .*)$')`))
+		})
+
+		It("Should report the regex to the source status", func() {
+			quoted := f.KubernetesResource("PodLoggingConfig", "tenant-a", "quoted-regex")
+			Expect(quoted.Field("status.accepted").Bool()).To(BeFalse())
+			Expect(quoted.Field("status.errors").String()).To(MatchJSON(`["parser: invalid regex: single quotes are not allowed, use \\x27 instead"]`))
+
+			escaped := f.KubernetesResource("PodLoggingConfig", "tenant-a", "escaped-regex")
+			Expect(escaped.Field("status.accepted").Bool()).To(BeTrue())
+		})
+	})
+
+	Context("Klog parser with promoted fields", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(`
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLoggingConfig
+metadata:
+  name: go-services
+spec:
+  type: KubernetesPods
+  kubernetesPods:
+    namespaceSelector:
+      matchNames:
+        - backend
+  parser:
+    type: Klog
+    promoteFields:
+      - level
+  logFilter:
+    - field: level
+      operator: In
+      values: ["warning", "error", "fatal"]
+  destinationRefs:
+    - loki-storage
+    - test-es-dest
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: loki-storage
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.loki:3100
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: test-es-dest
+spec:
+  type: Elasticsearch
+  elasticsearch:
+    index: "logs-%F"
+    endpoint: "http://192.168.1.1:9200"
+---
+`))
+			f.RunHook()
+		})
+
+		It("Should create secret", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			Expect(f.ValuesGet("logShipper.internal.activated").Bool()).To(BeTrue())
+			Expect(secret).To(Not(BeEmpty()))
+
+			assertConfig(secret, "parser.json")
+		})
+	})
+
+	Context("Configs with errors", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(`
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLoggingConfig
+metadata:
+  name: typo-in-ref
+spec:
+  type: KubernetesPods
+  destinationRefs:
+    - loki-storage
+    - loki-storag
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLoggingConfig
+metadata:
+  name: invalid-regex
+spec:
+  type: KubernetesPods
+  logFilter:
+    - field: level
+      operator: Regex
+      values: ["(warn"]
+  destinationRefs:
+    - loki-storage
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: PodLoggingConfig
+metadata:
+  name: tenant-logs
+  namespace: tenant-a
+spec:
+  destinationRefs:
+    - absent
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: loki-storage
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.loki:3100
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: unused
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.loki:3100
+`))
+			f.RunHook()
+		})
+
+		It("Should generate config only for valid sources", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			config, err := base64.StdEncoding.DecodeString(secret.Field(`data`).Get("vector\\.json").String())
+			Expect(err).To(BeNil())
+
+			sources := gjson.GetBytes(config, "sources").Map()
+			Expect(sources).To(HaveLen(1))
+			Expect(sources).To(HaveKey("cluster_logging_config/typo-in-ref"))
+		})
+
+		It("Should report errors to statuses", func() {
+			secret := f.KubernetesResource("Secret", "d8-log-shipper", "d8-log-shipper-config")
+			config, err := base64.StdEncoding.DecodeString(secret.Field(`data`).Get("vector\\.json").String())
+			Expect(err).To(BeNil())
+			checksum := fmt.Sprintf("%x", sha256.Sum256(config))
+
+			typo := f.KubernetesGlobalResource("ClusterLoggingConfig", "typo-in-ref")
+			Expect(typo.Field("status").String()).To(MatchJSON(fmt.Sprintf(`{
+				"accepted": true,
+				"errors": ["destination \"loki-storag\" is not found"],
+				"matchedSources": 1,
+				"configChecksum": %q
+			}`, checksum)))
+
+			invalid := f.KubernetesGlobalResource("ClusterLoggingConfig", "invalid-regex")
+			Expect(invalid.Field("status.accepted").Bool()).To(BeFalse())
+			Expect(invalid.Field("status.errors").Array()).To(HaveLen(1))
+			Expect(invalid.Field("status.errors.0").String()).To(HavePrefix("logFilter[0]: invalid regex:"))
+
+			tenant := f.KubernetesResource("PodLoggingConfig", "tenant-a", "tenant-logs")
+			Expect(tenant.Field("status.accepted").Bool()).To(BeFalse())
+			Expect(tenant.Field("status.errors").String()).To(MatchJSON(`["destination \"absent\" is not found"]`))
+
+			loki := f.KubernetesGlobalResource("ClusterLogDestination", "loki-storage")
+			Expect(loki.Field("status.accepted").Bool()).To(BeTrue())
+			Expect(loki.Field("status.matchedSources").Int()).To(Equal(int64(1)))
+			Expect(loki.Field("status.configChecksum").String()).To(Equal(checksum))
+
+			unused := f.KubernetesGlobalResource("ClusterLogDestination", "unused")
+			Expect(unused.Field("status.accepted").Bool()).To(BeFalse())
+			Expect(unused.Field("status.matchedSources").Int()).To(Equal(int64(0)))
+		})
+	})
+
+	Context("Fixed config with errors in the status", func() {
+		BeforeEach(func() {
+			f.BindingContexts.Set(f.KubeStateSet(`
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLoggingConfig
+metadata:
+  name: typo-in-ref
+spec:
+  type: KubernetesPods
+  destinationRefs:
+    - loki-storage
+status:
+  accepted: false
+  errors:
+    - destination "loki-storag" is not found
+  matchedSources: 0
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: ClusterLogDestination
+metadata:
+  name: loki-storage
+spec:
+  type: Loki
+  loki:
+    endpoint: http://loki.loki:3100
+`))
+			f.RunHook()
+		})
+
+		It("Should remove errors from the status", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			typo := f.KubernetesGlobalResource("ClusterLoggingConfig", "typo-in-ref")
+			Expect(typo.Field("status.accepted").Bool()).To(BeTrue())
+			Expect(typo.Field("status.matchedSources").Int()).To(Equal(int64(1)))
+			Expect(typo.Field("status.errors").Exists()).To(BeFalse())
+		})
+	})
 })
@@ -17,6 +17,9 @@ limitations under the License.
 package composer
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
 
 	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis"
@@ -29,16 +32,21 @@ import (
 type Composer struct {
 	Source []v1alpha1.ClusterLoggingConfig
 	Dest   []v1alpha1.ClusterLogDestination
+
+	// SourceStatus and DestStatus are filled by Do, keys are names of sources and destinations.
+	SourceStatus map[string]*Status
+	DestStatus   map[string]*Status
 }
 
 func FromInput(input *go_hook.HookInput) *Composer {
 	sourceSnap := input.Snapshots["cluster_log_source"]
 	namespacedSourceSnap := input.Snapshots["namespaced_log_source"]
 	destSnap := input.Snapshots["cluster_log_destination"]
+	namespacedDestSnap := input.Snapshots["namespaced_log_destination"]
 
 	res := &Composer{
 		Source: make([]v1alpha1.ClusterLoggingConfig, 0, len(sourceSnap)+len(namespacedSourceSnap)),
-		Dest:   make([]v1alpha1.ClusterLogDestination, 0, len(destSnap)),
+		Dest:   make([]v1alpha1.ClusterLogDestination, 0, len(destSnap)+len(namespacedDestSnap)),
 	}
 
 	for _, d := range destSnap {
@@ -46,6 +54,11 @@ func FromInput(input *go_hook.HookInput) *Composer {
 		res.Dest = append(res.Dest, dest)
 	}
 
+	for _, nd := range namespacedDestSnap {
+		dest := nd.(v1alpha1.LogDestination)
+		res.Dest = append(res.Dest, v1alpha1.NamespacedDestinationToCluster(dest))
+	}
+
 	for _, s := range sourceSnap {
 		src := s.(v1alpha1.ClusterLoggingConfig)
 		res.Source = append(res.Source, src)
@@ -60,17 +73,30 @@ func FromInput(input *go_hook.HookInput) *Composer {
 }
 
 func (c *Composer) Do() ([]byte, error) {
+	c.SourceStatus = make(map[string]*Status, len(c.Source))
+	c.DestStatus = make(map[string]*Status, len(c.Dest))
+
 	destinationRefs, err := c.composeDestinations()
 	if err != nil {
 		return nil, err
 	}
 
 	file := NewVectorFile()
+	promotedFields := make(map[string][]string)
 
 	for _, s := range c.Source {
+		status := &Status{}
+		c.SourceStatus[s.Name] = status
+
+		validateSource(s.Spec, status)
+		if len(status.Errors) > 0 {
+			continue
+		}
+
 		transforms, err := transform.CreateLogSourceTransforms(s.Name, &transform.LogSourceConfig{
 			SourceType:    s.Spec.Type,
 			MultilineType: s.Spec.MultiLineParser.Type,
+			Parser:        s.Spec.Parser,
 			LabelFilter:   s.Spec.LabelFilters,
 			LogFilter:     s.Spec.LogFilters,
 		})
@@ -84,9 +110,22 @@ func (c *Composer) Do() ([]byte, error) {
 		}
 
 		destinations := make([]PipelineDestination, 0, len(s.Spec.DestinationRefs))
+		destinationNames := make([]string, 0, len(s.Spec.DestinationRefs))
 
 		for _, ref := range s.Spec.DestinationRefs {
-			destinations = append(destinations, destinationRefs[destination.ComposeName(ref)])
+			// References to absent destinations are reported, e.g., a typo or a PodLoggingConfig created before its LogDestination.
+			dest, ok := destinationRefs[destination.ComposeName(ref)]
+			if !ok {
+				status.addError("destination %q is not found", refName(s.Name, ref))
+				continue
+			}
+			promotedFields[dest.Destination.GetName()] = append(promotedFields[dest.Destination.GetName()], s.Spec.Parser.PromoteFields...)
+			destinations = append(destinations, dest)
+			destinationNames = append(destinationNames, ref)
+		}
+
+		if len(destinations) == 0 {
+			continue
 		}
 
 		err = file.AppendLogPipeline(&Pipeline{
@@ -96,8 +135,20 @@ func (c *Composer) Do() ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		status.Accepted = true
+		status.MatchedSources = len(src.Source.BuildSources())
+		for _, name := range destinationNames {
+			c.DestStatus[name].MatchedSources++
+		}
 	}
 
+	for _, status := range c.DestStatus {
+		status.Accepted = status.MatchedSources > 0
+	}
+
+	promoteToLabels(file.Sinks, promotedFields)
+
 	return file.ConvertToJSON()
 }
 
@@ -105,7 +156,19 @@ func (c *Composer) composeDestinations() (map[string]PipelineDestination, error)
 	destinationByName := make(map[string]PipelineDestination)
 
 	for _, d := range c.Dest {
+		status := &Status{}
+		c.DestStatus[d.Name] = status
+
+		validateDestination(d.Spec, status)
+		if len(status.Errors) > 0 {
+			continue
+		}
+
 		dest := newLogDest(d.Spec.Type, d.Name, d.Spec)
+		if dest == nil {
+			status.addError("unsupported destination type %q", d.Spec.Type)
+			continue
+		}
 
 		transforms, err := transform.CreateLogDestinationTransforms(d.Name, d)
 		if err != nil {
@@ -121,6 +184,41 @@ func (c *Composer) composeDestinations() (map[string]PipelineDestination, error)
 	return destinationByName, nil
 }
 
+// refName returns the destination name as it is written in the config.
+// References of PodLoggingConfigs to LogDestinations are prefixed with the namespace by the conversion.
+func refName(source, ref string) string {
+	if i := strings.Index(source, "_"); i >= 0 {
+		return strings.TrimPrefix(ref, source[:i+1])
+	}
+	return ref
+}
+
+// promoteToLabels makes promoted fields labels of Loki sinks. Other destinations send them as top-level fields of the event.
+// A sink is shared by all sources sending logs to the destination, so its labels are built from promoted fields
+// of all of them. If the field is absent, e.g., it is promoted by another source, Vector skips the label
+// without dropping the event.
+func promoteToLabels(sinks map[string]apis.LogDestination, fieldsBySink map[string][]string) {
+	for name, fields := range fieldsBySink {
+		loki, ok := sinks[name].(*destination.Loki)
+		if !ok || len(fields) == 0 {
+			continue
+		}
+
+		sink := *loki
+		sink.Labels = make(map[string]string, len(loki.Labels)+len(fields))
+		for label, value := range loki.Labels {
+			sink.Labels[label] = value
+		}
+		for _, field := range fields {
+			if _, ok := sink.Labels[field]; ok {
+				continue
+			}
+			sink.Labels[field] = fmt.Sprintf("{{ %s }}", field)
+		}
+		sinks[name] = &sink
+	}
+}
+
 func newLogSource(typ, name string, spec v1alpha1.ClusterLoggingConfigSpec) apis.LogSource {
 	switch typ {
 	case v1alpha1.SourceFile:
@@ -141,6 +239,12 @@ func newLogDest(typ, name string, spec v1alpha1.ClusterLogDestinationSpec) apis.
 		return destination.NewLogstash(name, spec)
 	case v1alpha1.DestVector:
 		return destination.NewVector(name, spec)
+	case v1alpha1.DestKafka:
+		return destination.NewKafka(name, spec)
+	case v1alpha1.DestSplunk:
+		return destination.NewSplunk(name, spec)
+	case v1alpha1.DestS3:
+		return destination.NewS3(name, spec)
 	}
 	return nil
 }
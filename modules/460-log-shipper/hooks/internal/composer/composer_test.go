@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis/v1alpha1"
+)
+
+func TestPromoteFieldsToSharedLokiSink(t *testing.T) {
+	newSource := func(name string, parser v1alpha1.Parser) v1alpha1.ClusterLoggingConfig {
+		return v1alpha1.ClusterLoggingConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1alpha1.ClusterLoggingConfigSpec{
+				Type:            v1alpha1.SourceKubernetesPods,
+				Parser:          parser,
+				DestinationRefs: []string{"loki"},
+			},
+		}
+	}
+
+	c := &Composer{
+		Dest: []v1alpha1.ClusterLogDestination{{
+			ObjectMeta: metav1.ObjectMeta{Name: "loki"},
+			Spec: v1alpha1.ClusterLogDestinationSpec{
+				Type:        v1alpha1.DestLoki,
+				Loki:        v1alpha1.LokiSpec{Endpoint: "http://loki:3100"},
+				ExtraLabels: map[string]string{"cluster": "main"},
+			},
+		}},
+		Source: []v1alpha1.ClusterLoggingConfig{
+			newSource("app", v1alpha1.Parser{Type: v1alpha1.ParserJSON, PromoteFields: []string{"level", "user"}}),
+			newSource("ingress", v1alpha1.Parser{Type: v1alpha1.ParserLogfmt, PromoteFields: []string{"level", "status"}}),
+			newSource("system", v1alpha1.Parser{}),
+		},
+	}
+
+	sinkLabels := func() map[string]string {
+		content, err := c.Do()
+		require.NoError(t, err)
+
+		var file struct {
+			Sinks map[string]struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"sinks"`
+		}
+		require.NoError(t, json.Unmarshal(content, &file))
+		require.Len(t, file.Sinks, 1)
+		return file.Sinks["destination/cluster/loki"].Labels
+	}
+
+	labels := sinkLabels()
+	assert.Equal(t, "main", labels["cluster"])
+	assert.Equal(t, "{{ level }}", labels["level"])
+	assert.Equal(t, "{{ user }}", labels["user"])
+	assert.Equal(t, "{{ status }}", labels["status"])
+
+	// Labels do not pile up from one composition to another.
+	c.Source = c.Source[2:]
+	labels = sinkLabels()
+	assert.Equal(t, "main", labels["cluster"])
+	assert.NotContains(t, labels, "level")
+	assert.NotContains(t, labels, "user")
+	assert.NotContains(t, labels, "status")
+}
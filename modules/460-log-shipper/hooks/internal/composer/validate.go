@@ -0,0 +1,99 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package composer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis/v1alpha1"
+)
+
+// Status is the result of composing the vector config for a single source or destination.
+type Status struct {
+	Accepted       bool
+	Errors         []string
+	MatchedSources int
+}
+
+func (s *Status) addError(format string, args ...interface{}) {
+	s.Errors = append(s.Errors, fmt.Sprintf(format, args...))
+}
+
+// validateSource checks the parts of the config which cannot be checked by the custom resource definition.
+// Vector refuses to load the whole config with an invalid regex, so such configs must not get into it.
+func validateSource(spec v1alpha1.ClusterLoggingConfigSpec, status *Status) {
+	validateFilters("labelFilter", spec.LabelFilters, status)
+	validateFilters("logFilter", spec.LogFilters, status)
+
+	if spec.Parser.Type == v1alpha1.ParserRegex {
+		if err := validateRegex(spec.Parser.Regex); err != nil {
+			status.addError("parser: invalid regex: %v", err)
+		}
+	}
+}
+
+// validateRegex checks that the regex is valid and can be written into a VRL raw string r'...'.
+// A single quote ends the raw string, it can be matched by \x27 instead.
+func validateRegex(value string) error {
+	if strings.Contains(value, "'") {
+		return errors.New(`single quotes are not allowed, use \x27 instead`)
+	}
+	_, err := regexp.Compile(value)
+	return err
+}
+
+// extraLabelKey is the key of the extra label which can be used as a field name in VRL and as a Loki label name.
+var extraLabelKey = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// validateDestination checks the parts of the destination which cannot be checked by the custom resource definition.
+// Keys of extra labels are written into VRL as they are, so an arbitrary key could inject VRL code into the config.
+func validateDestination(spec v1alpha1.ClusterLogDestinationSpec, status *Status) {
+	keys := make([]string, 0, len(spec.ExtraLabels))
+	for key := range spec.ExtraLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !extraLabelKey.MatchString(key) {
+			status.addError("extraLabels: invalid key %q, must match %s", key, extraLabelKey)
+		}
+	}
+}
+
+func validateFilters(section string, filters []v1alpha1.Filter, status *Status) {
+	for i, filter := range filters {
+		if filter.Operator != v1alpha1.FilterOpRegex && filter.Operator != v1alpha1.FilterOpNotRegex {
+			continue
+		}
+
+		for _, raw := range filter.Values {
+			value, ok := raw.(string)
+			if !ok {
+				status.addError("%s[%d]: regex %v is not a string", section, i, raw)
+				continue
+			}
+			if err := validateRegex(value); err != nil {
+				status.addError("%s[%d]: invalid regex: %v", section, i, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package destination
+
+import (
+	"strings"
+
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis/v1alpha1"
+)
+
+// kafkaSASLMechanisms maps CamelCase values of the custom resource to the librdkafka mechanism names.
+var kafkaSASLMechanisms = map[string]string{
+	"Plain":       "PLAIN",
+	"ScramSha256": "SCRAM-SHA-256",
+	"ScramSha512": "SCRAM-SHA-512",
+}
+
+type Kafka struct {
+	CommonSettings
+
+	BootstrapServers string `json:"bootstrap_servers"`
+
+	Topic string `json:"topic"`
+
+	KeyField string `json:"key_field,omitempty"`
+
+	Encoding KafkaEncoding `json:"encoding,omitempty"`
+
+	Compression string `json:"compression,omitempty"`
+
+	SASL KafkaSASL `json:"sasl,omitempty"`
+
+	TLS KafkaTLS `json:"tls,omitempty"`
+}
+
+type KafkaEncoding struct {
+	Codec           string `json:"codec,omitempty"`
+	TimestampFormat string `json:"timestamp_format,omitempty"`
+}
+
+type KafkaSASL struct {
+	Enabled   bool   `json:"enabled"`
+	Mechanism string `json:"mechanism,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+}
+
+// KafkaTLS differs from the CommonTLS, the kafka sink does not use TLS unless it is explicitly enabled.
+type KafkaTLS struct {
+	CommonTLS
+	Enabled bool `json:"enabled"`
+}
+
+func NewKafka(name string, cspec v1alpha1.ClusterLogDestinationSpec) *Kafka {
+	spec := cspec.Kafka
+
+	// Disable buffer. It is buggy. Vector developers know about problems with buffer.
+	// More info about buffer rewriting here - https://github.com/vectordotdev/vector/issues/9476
+	// common.Buffer = buffer{
+	//	Size: 100 * 1024 * 1024, // 100MiB in bytes for vector persistent queue
+	//	Type: "disk",
+	// }
+
+	var tls KafkaTLS
+	if spec.TLS != nil {
+		tls = KafkaTLS{
+			CommonTLS: CommonTLS{
+				CAFile:            decodeB64(spec.TLS.CAFile),
+				CertFile:          decodeB64(spec.TLS.CertFile),
+				KeyFile:           decodeB64(spec.TLS.KeyFile),
+				KeyPass:           decodeB64(spec.TLS.KeyPass),
+				VerifyCertificate: true,
+				VerifyHostname:    true,
+			},
+			Enabled: true,
+		}
+		if spec.TLS.VerifyCertificate != nil {
+			tls.VerifyCertificate = *spec.TLS.VerifyCertificate
+		}
+		if spec.TLS.VerifyHostname != nil {
+			tls.VerifyHostname = *spec.TLS.VerifyHostname
+		}
+	}
+
+	var sasl KafkaSASL
+	if spec.SASL != nil {
+		sasl = KafkaSASL{
+			Enabled:   true,
+			Mechanism: kafkaSASLMechanisms[spec.SASL.Mechanism],
+			Username:  spec.SASL.Username,
+			Password:  decodeB64(spec.SASL.Password),
+		}
+	}
+
+	compression := strings.ToLower(spec.Compression)
+	if compression == "" {
+		compression = "none"
+	}
+
+	return &Kafka{
+		CommonSettings: CommonSettings{
+			Name: ComposeName(name),
+			Type: "kafka",
+		},
+		BootstrapServers: strings.Join(spec.BootstrapServers, ","),
+		Topic:            spec.Topic,
+		KeyField:         spec.KeyField,
+		Encoding: KafkaEncoding{
+			Codec:           "json",
+			TimestampFormat: "rfc3339",
+		},
+		Compression: compression,
+		SASL:        sasl,
+		TLS:         tls,
+	}
+}
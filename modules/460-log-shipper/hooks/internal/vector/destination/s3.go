@@ -0,0 +1,123 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package destination
+
+import (
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis/v1alpha1"
+)
+
+const (
+	defaultS3BatchMaxBytes    = 10 * 1024 * 1024 // 10MiB
+	defaultS3BatchTimeoutSecs = 300
+)
+
+type S3 struct {
+	CommonSettings
+
+	Endpoint string `json:"endpoint,omitempty"`
+
+	Bucket string `json:"bucket"`
+
+	Region string `json:"region,omitempty"`
+
+	KeyPrefix string `json:"key_prefix,omitempty"`
+
+	Auth S3Auth `json:"auth,omitempty"`
+
+	Encoding S3Encoding `json:"encoding,omitempty"`
+
+	Compression string `json:"compression"`
+
+	Batch S3Batch `json:"batch"`
+
+	TLS CommonTLS `json:"tls,omitempty"`
+}
+
+type S3Auth struct {
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+}
+
+type S3Encoding struct {
+	Codec           string `json:"codec,omitempty"`
+	TimestampFormat string `json:"timestamp_format,omitempty"`
+}
+
+type S3Batch struct {
+	MaxBytes    int32 `json:"max_bytes"`
+	TimeoutSecs int32 `json:"timeout_secs"`
+}
+
+func NewS3(name string, cspec v1alpha1.ClusterLogDestinationSpec) *S3 {
+	spec := cspec.S3
+
+	// Disable buffer. It is buggy. Vector developers know about problems with buffer.
+	// More info about buffer rewriting here - https://github.com/vectordotdev/vector/issues/9476
+	// common.Buffer = buffer{
+	//	Size: 100 * 1024 * 1024, // 100MiB in bytes for vector persistent queue
+	//	Type: "disk",
+	// }
+
+	tls := CommonTLS{
+		CAFile:            decodeB64(spec.TLS.CAFile),
+		CertFile:          decodeB64(spec.TLS.CertFile),
+		KeyFile:           decodeB64(spec.TLS.KeyFile),
+		KeyPass:           decodeB64(spec.TLS.KeyPass),
+		VerifyCertificate: true,
+		VerifyHostname:    true,
+	}
+	if spec.TLS.VerifyCertificate != nil {
+		tls.VerifyCertificate = *spec.TLS.VerifyCertificate
+	}
+	if spec.TLS.VerifyHostname != nil {
+		tls.VerifyHostname = *spec.TLS.VerifyHostname
+	}
+
+	// Objects in the archive are rarely read, so it is better to write them in large gzipped chunks.
+	batch := S3Batch{
+		MaxBytes:    defaultS3BatchMaxBytes,
+		TimeoutSecs: defaultS3BatchTimeoutSecs,
+	}
+	if spec.Batch.MaxBytes != nil {
+		batch.MaxBytes = *spec.Batch.MaxBytes
+	}
+	if spec.Batch.TimeoutSecs != nil {
+		batch.TimeoutSecs = *spec.Batch.TimeoutSecs
+	}
+
+	return &S3{
+		CommonSettings: CommonSettings{
+			Name: ComposeName(name),
+			Type: "aws_s3",
+		},
+		Endpoint:  spec.Endpoint,
+		Bucket:    spec.Bucket,
+		Region:    spec.Region,
+		KeyPrefix: spec.KeyPrefix,
+		Auth: S3Auth{
+			AccessKeyID:     decodeB64(spec.Auth.AccessKeyID),
+			SecretAccessKey: decodeB64(spec.Auth.SecretAccessKey),
+		},
+		Encoding: S3Encoding{
+			Codec:           "ndjson",
+			TimestampFormat: "rfc3339",
+		},
+		Compression: "gzip",
+		Batch:       batch,
+		TLS:         tls,
+	}
+}
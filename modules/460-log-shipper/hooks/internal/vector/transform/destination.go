@@ -30,6 +30,10 @@ func CreateLogDestinationTransforms(name string, dest v1alpha1.ClusterLogDestina
 	case v1alpha1.DestElasticsearch, v1alpha1.DestLogstash:
 		transforms = append(transforms, DeDotTransform())
 
+		if len(dest.Spec.ExtraLabels) > 0 {
+			transforms = append(transforms, ExtraFieldTransform(dest.Spec.ExtraLabels))
+		}
+	case v1alpha1.DestKafka, v1alpha1.DestSplunk, v1alpha1.DestS3:
 		if len(dest.Spec.ExtraLabels) > 0 {
 			transforms = append(transforms, ExtraFieldTransform(dest.Spec.ExtraLabels))
 		}
@@ -44,7 +48,8 @@ func CreateLogDestinationTransforms(name string, dest v1alpha1.ClusterLogDestina
 	}
 
 	switch dest.Spec.Type {
-	case v1alpha1.DestElasticsearch, v1alpha1.DestLogstash, v1alpha1.DestVector:
+	case v1alpha1.DestElasticsearch, v1alpha1.DestLogstash, v1alpha1.DestVector,
+		v1alpha1.DestKafka, v1alpha1.DestSplunk, v1alpha1.DestS3:
 		transforms = append(transforms, CleanUpParsedDataTransform())
 	}
 
@@ -0,0 +1,47 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis"
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/apis/v1alpha1"
+	"github.com/deckhouse/deckhouse/modules/460-log-shipper/hooks/internal/vrl"
+)
+
+func CreateParserTransforms(parser v1alpha1.Parser) ([]apis.LogTransform, error) {
+	switch parser.Type {
+	case v1alpha1.ParserJSON, v1alpha1.ParserLogfmt, v1alpha1.ParserKlog, v1alpha1.ParserNginxCombined, v1alpha1.ParserRegex:
+	default:
+		return []apis.LogTransform{}, nil
+	}
+
+	rule, err := vrl.ParserRule.Render(vrl.Args{"parser": parser})
+	if err != nil {
+		return nil, err
+	}
+
+	return []apis.LogTransform{&DynamicTransform{
+		CommonTransform: CommonTransform{
+			Name: "parser",
+			Type: "remap",
+		},
+		DynamicArgsMap: map[string]interface{}{
+			"source":        rule,
+			"drop_on_abort": false,
+		},
+	}}, nil
+}
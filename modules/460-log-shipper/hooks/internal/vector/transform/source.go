@@ -55,6 +55,8 @@ type LogSourceConfig struct {
 
 	MultilineType v1alpha1.MultiLineParserType
 
+	Parser v1alpha1.Parser
+
 	LabelFilter []v1alpha1.Filter
 	LogFilter   []v1alpha1.Filter
 }
@@ -70,6 +72,12 @@ func CreateLogSourceTransforms(name string, cfg *LogSourceConfig) ([]apis.LogTra
 
 	transforms = append(transforms, CreateMultiLineTransforms(cfg.MultilineType)...)
 
+	parserTransforms, err := CreateParserTransforms(cfg.Parser)
+	if err != nil {
+		return nil, err
+	}
+	transforms = append(transforms, parserTransforms...)
+
 	labelFilterTransforms, err := CreateLabelFilterTransforms(cfg.LabelFilter)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,44 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vrl
+
+// ParserRule parses the message with the chosen parser and stores the result to the parsed_data field.
+// If the message cannot be parsed, parsed_data is left untouched, and the ParseJSONRule is applied later.
+//
+// Promoted fields are copied to the top level of the event without overwriting existing fields,
+// e.g., a parsed namespace field does not replace the namespace of the Pod.
+const ParserRule Rule = `
+{{- if eq $.parser.Type "JSON" }}
+structured, err = parse_json(.message)
+{{- else if eq $.parser.Type "Logfmt" }}
+structured, err = parse_logfmt(.message)
+{{- else if eq $.parser.Type "Klog" }}
+structured, err = parse_klog(.message)
+{{- else if eq $.parser.Type "NginxCombined" }}
+structured, err = parse_nginx_log(.message, "combined")
+{{- else if eq $.parser.Type "Regex" }}
+structured, err = parse_regex(.message, r'{{ $.parser.Regex }}')
+{{- end }}
+if err == null && is_object(structured) {
+    .parsed_data = structured
+}
+{{- range $field := $.parser.PromoteFields }}
+if exists(.parsed_data.{{ $field }}) && !exists(.{{ $field }}) {
+    .{{ $field }} = .parsed_data.{{ $field }}
+}
+{{- end }}
+`
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vrl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserRule(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		parser map[string]interface{}
+		res    string
+	}{
+		{
+			name:   "Klog with promoted fields",
+			parser: map[string]interface{}{"Type": "Klog", "PromoteFields": []string{"level", "file"}},
+			res: strings.TrimSpace(`
+structured, err = parse_klog(.message)
+if err == null && is_object(structured) {
+    .parsed_data = structured
+}
+if exists(.parsed_data.level) && !exists(.level) {
+    .level = .parsed_data.level
+}
+if exists(.parsed_data.file) && !exists(.file) {
+    .file = .parsed_data.file
+}
+`),
+		},
+		{
+			name:   "Regex",
+			parser: map[string]interface{}{"Type": "Regex", "Regex": `^(?P<level>[A-Z]+) (?P<message>.*)$`},
+			res: strings.TrimSpace(`
+structured, err = parse_regex(.message, r'^(?P<level>[A-Z]+) (?P<message>.*)$')
+if err == null && is_object(structured) {
+    .parsed_data = structured
+}
+`),
+		},
+		{
+			name:   "Nginx",
+			parser: map[string]interface{}{"Type": "NginxCombined"},
+			res: strings.TrimSpace(`
+structured, err = parse_nginx_log(.message, "combined")
+if err == null && is_object(structured) {
+    .parsed_data = structured
+}
+`),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := ParserRule.Render(Args{"parser": tc.parser})
+			require.NoError(t, err)
+			require.Equal(t, tc.res, res)
+		})
+	}
+}
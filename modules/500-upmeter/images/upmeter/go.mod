@@ -9,6 +9,7 @@ require (
 	github.com/golang-migrate/migrate/v4 v4.14.1
 	github.com/golang/snappy v0.0.3
 	github.com/grpc-ecosystem/grpc-gateway v1.16.0 // indirect
+	github.com/lib/pq v1.10.2
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/onsi/gomega v1.19.0
 	github.com/prometheus/prometheus v2.5.0+incompatible
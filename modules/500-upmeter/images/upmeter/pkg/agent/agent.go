@@ -30,6 +30,7 @@ import (
 	dbcontext "d8.io/upmeter/pkg/db/context"
 	"d8.io/upmeter/pkg/kubernetes"
 	"d8.io/upmeter/pkg/monitor/node"
+	"d8.io/upmeter/pkg/monitor/userprobe"
 	"d8.io/upmeter/pkg/probe"
 	"d8.io/upmeter/pkg/probe/calculated"
 	"d8.io/upmeter/pkg/registry"
@@ -41,8 +42,9 @@ type Agent struct {
 
 	logger *log.Logger
 
-	sender    *sender.Sender
-	scheduler *scheduler.Scheduler
+	sender           *sender.Sender
+	scheduler        *scheduler.Scheduler
+	userProbeMonitor *userprobe.Monitor
 }
 
 type Config struct {
@@ -97,9 +99,16 @@ func (a *Agent) Start(ctx context.Context) error {
 		return fmt.Errorf("starting node monitor: %v", err)
 	}
 
+	// User-defined probes from UpmeterProbe custom resources
+	userProbes := probe.NewUserProbes(ftr, a.logger)
+	a.userProbeMonitor, err = userprobe.StartMonitor(ctx, kubeAccess.Kubernetes(), userProbes, log.NewEntry(a.logger))
+	if err != nil {
+		return fmt.Errorf("starting upmeterprobes.deckhouse.io monitor: %v", err)
+	}
+
 	runnerLoader := probe.NewLoader(ftr, kubeAccess, nodeMon, dynamicConfig, a.logger)
 	calcLoader := calculated.NewLoader(ftr, a.logger)
-	registry := registry.New(runnerLoader, calcLoader)
+	registry := registry.New(runnerLoader, calcLoader, userProbes)
 
 	// Database connection with pool
 	dbctx, err := db.Connect(a.config.DatabasePath, dbcontext.DefaultConnectionOptions())
@@ -124,5 +133,6 @@ func (a *Agent) Start(ctx context.Context) error {
 func (a *Agent) Stop() error {
 	a.scheduler.Stop()
 	a.sender.Stop()
+	a.userProbeMonitor.Stop()
 	return nil
 }
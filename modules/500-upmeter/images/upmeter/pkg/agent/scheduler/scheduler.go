@@ -26,6 +26,7 @@ import (
 	"d8.io/upmeter/pkg/check"
 	"d8.io/upmeter/pkg/db/dao"
 	"d8.io/upmeter/pkg/registry"
+	"d8.io/upmeter/pkg/set"
 )
 
 type Scheduler struct {
@@ -193,12 +194,30 @@ func (e *Scheduler) export(start time.Time) error {
 		series := e.series[id]
 		series.Clean()
 	}
+	e.forgetRemovedProbes()
 
 	e.send <- episodes
 
 	return nil
 }
 
+// forgetRemovedProbes drops results of probes that are not in the registry anymore, e.g. deleted
+// UpmeterProbe resources, so they do not produce episodes after removal.
+func (e *Scheduler) forgetRemovedProbes() {
+	known := set.New()
+	for _, runner := range e.registry.Runners() {
+		known.Add(runner.ProbeRef().Id())
+	}
+
+	for id := range e.results {
+		if known.Has(id) {
+			continue
+		}
+		delete(e.results, id)
+		delete(e.series, id)
+	}
+}
+
 func (e *Scheduler) convert(start time.Time) ([]check.Episode, error) {
 	episodes := make([]check.Episode, 0, len(e.results))
 
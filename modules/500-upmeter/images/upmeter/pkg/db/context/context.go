@@ -29,18 +29,20 @@ const (
 )
 
 type DbContext struct {
-	conns *pool
-	db    *sql.DB
-	tx    *sql.Tx
+	dialect Dialect
+	conns   *pool
+	db      *sql.DB
+	tx      *sql.Tx
 }
 
 func NewDbContext() *DbContext {
-	return &DbContext{}
+	return &DbContext{dialect: SQLite}
 }
 
 // Connect opens a DB without pooling. Mainly for tests.
 func (c *DbContext) Connect(path string) error {
-	db, err := open(path, nil)
+	c.dialect = DialectByPath(path)
+	db, err := open(c.dialect, path, nil)
 	if err != nil {
 		return err
 	}
@@ -61,26 +63,34 @@ func parseIntEnvVar(name string) int {
 	return n
 }
 
-// ConnectWithPool creates a pool of DB connections.
+// ConnectWithPool creates a pool of DB connections. The path is either SQLite file path or PostgreSQL
+// connection URL.
 func (c *DbContext) ConnectWithPool(path string, opts map[string]string) error {
 	size := parseIntEnvVar("UPMETER_DB_POOL_SIZE") // FIXME bring out to the app arguments
 	if size == 0 {
 		size = defaultPoolSize
 	}
+	c.dialect = DialectByPath(path)
 	c.conns = newPool(size)
 
-	return c.conns.Connect(path, opts)
+	return c.conns.Connect(c.dialect, path, opts)
 }
 
 func (c *DbContext) Handler() *sql.DB {
 	return c.db
 }
 
+// Dialect returns the SQL dialect of the connected database
+func (c *DbContext) Dialect() Dialect {
+	return c.dialect
+}
+
 func (c *DbContext) Copy() *DbContext {
 	return &DbContext{
-		conns: c.conns,
-		db:    c.db,
-		tx:    c.tx,
+		dialect: c.dialect,
+		conns:   c.conns,
+		db:      c.db,
+		tx:      c.tx,
 	}
 }
 
@@ -100,20 +110,21 @@ func (c *DbContext) StmtRunner() StmtRunner {
 // If context is stoppable, returns non-stoppable db-only context.
 func (c *DbContext) Start() *DbContext {
 	if c.tx != nil {
-		return &DbContext{tx: c.tx}
+		return &DbContext{dialect: c.dialect, tx: c.tx}
 	}
 
 	// Do not copy pool if the db is already captured.
 	if c.db != nil {
-		return &DbContext{db: c.db}
+		return &DbContext{dialect: c.dialect, db: c.db}
 	}
 
 	// Capture connection from the pool if it is a "root" context.
 	if c.conns != nil && c.db == nil {
 		db := c.conns.Capture()
 		return &DbContext{
-			conns: c.conns,
-			db:    db,
+			dialect: c.dialect,
+			conns:   c.conns,
+			db:      db,
 		}
 	}
 
@@ -131,7 +142,7 @@ func (c *DbContext) BeginTransaction() (*DbContext, error) {
 	ctx := context.Background() // FIXME (e.shevchenko) pass the context from the outside
 
 	if c.tx != nil {
-		return &DbContext{tx: c.tx}, nil
+		return &DbContext{dialect: c.dialect, tx: c.tx}, nil
 	}
 
 	if c.db == nil {
@@ -143,7 +154,7 @@ func (c *DbContext) BeginTransaction() (*DbContext, error) {
 		return nil, err
 	}
 
-	return &DbContext{tx: tx}, nil
+	return &DbContext{dialect: c.dialect, tx: tx}, nil
 }
 
 func (c *DbContext) Rollback() error {
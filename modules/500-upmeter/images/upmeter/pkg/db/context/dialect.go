@@ -0,0 +1,59 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// Dialect is the SQL flavor of the database. DAOs choose the implementation by it.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// DialectByPath detects the database by connection string. PostgreSQL is selected by URL scheme
+// "postgres://" or "postgresql://", anything else is considered as SQLite file path.
+func DialectByPath(path string) Dialect {
+	if strings.HasPrefix(path, "postgres://") || strings.HasPrefix(path, "postgresql://") {
+		return Postgres
+	}
+	return SQLite
+}
+
+// openPostgres opens a PostgreSQL database and checks the connection, so that the misconfiguration
+// is visible on start.
+func openPostgres(url string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open postgres database: %v", err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("cannot connect to postgres database: %v", err)
+	}
+
+	return db, nil
+}
@@ -51,8 +51,12 @@ func DefaultConnectionOptions() map[string]string {
 	}
 }
 
-// open opens a sqlite database
-func open(dbpath string, opts map[string]string) (*sql.DB, error) {
+// open opens a database of the dialect. Options are SQLite-specific, they are ignored for PostgreSQL.
+func open(dialect Dialect, dbpath string, opts map[string]string) (*sql.DB, error) {
+	if dialect == Postgres {
+		return openPostgres(dbpath)
+	}
+
 	uri := buildUri(dbpath, opts)
 
 	db, err := sql.Open("sqlite3", uri)
@@ -98,10 +102,24 @@ func (c *pool) Release(conn *sql.DB) {
 	c.conns <- conn
 }
 
-func (c *pool) Connect(path string, opts map[string]string, poolInjector ...func(pool *pool)) error {
+func (c *pool) Connect(dialect Dialect, path string, opts map[string]string, poolInjector ...func(pool *pool)) error {
+	if dialect == Postgres {
+		// PostgreSQL handles concurrent writes, so the single database handle with its own connection pool is
+		// shared. The custom pool only limits the number of concurrently captured contexts.
+		db, err := openPostgres(path)
+		if err != nil {
+			return err
+		}
+		db.SetMaxOpenConns(c.size)
+		for i := 0; i < c.size; i++ {
+			c.conns <- db
+		}
+		return nil
+	}
+
 	for i := 0; i < c.size; i++ {
 		var db *sql.DB
-		db, err := open(path, opts)
+		db, err := open(dialect, path, opts)
 		if err != nil {
 			return err
 		}
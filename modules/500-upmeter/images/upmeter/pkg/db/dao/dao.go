@@ -0,0 +1,82 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import (
+	"time"
+
+	"d8.io/upmeter/pkg/check"
+	dbcontext "d8.io/upmeter/pkg/db/context"
+	"d8.io/upmeter/pkg/server/ranges"
+)
+
+// Episodes30s stores 30-second episodes. The server keeps them for 24 hours to calculate 5-minute episodes,
+// the agent keeps them until they are sent.
+type Episodes30s interface {
+	GetBySlotAndProbe(slot time.Time, ref check.ProbeRef) (Entity, error)
+	ListByRange(start, end time.Time, ref check.ProbeRef) ([]Entity, error)
+	ListBySlot(slot time.Time) ([]Entity, error)
+	ListEpisodesBySlot(slot time.Time) ([]check.Episode, error)
+	GetEarliestTimeSlot() (time.Time, error)
+	Stats() ([]string, error)
+
+	Insert(episode check.Episode) error
+	Update(rowid int64, episode check.Episode) error
+	SaveBatch(episodes []check.Episode) error
+	DeleteUpTo(slot time.Time) error
+}
+
+// Episodes5m stores 5-minute episodes which are used for SLA reporting.
+type Episodes5m interface {
+	GetBySlotAndProbe(slot time.Time, ref check.ProbeRef) (Entity, error)
+	ListEpisodesByRange(from, to int64, ref check.ProbeRef) ([]check.Episode, error)
+	ListEpisodeSumsForRanges(rng ranges.StepRange, ref check.ProbeRef) ([]check.Episode, error)
+
+	Insert(episode check.Episode) error
+	Update(rowid int64, episode check.Episode) error
+}
+
+// ExportEpisodes stores episodes to be exported via remote_write.
+type ExportEpisodes interface {
+	Save(entities []ExportEntity) error
+	GetEarliestEpisodes(syncID string, originsCount int) ([]ExportEntity, error)
+	DeleteUpTo(syncID string, slot time.Time) error
+}
+
+// NewEpisodeDao30s returns the DAO implementation for the database dialect
+func NewEpisodeDao30s(dbCtx *dbcontext.DbContext) Episodes30s {
+	if dbCtx.Dialect() == dbcontext.Postgres {
+		return newPostgresEpisodeDao30s(dbCtx)
+	}
+	return newSQLiteEpisodeDao30s(dbCtx)
+}
+
+// NewEpisodeDao5m returns the DAO implementation for the database dialect
+func NewEpisodeDao5m(dbCtx *dbcontext.DbContext) Episodes5m {
+	if dbCtx.Dialect() == dbcontext.Postgres {
+		return newPostgresEpisodeDao5m(dbCtx)
+	}
+	return newSQLiteEpisodeDao5m(dbCtx)
+}
+
+// NewExportEpisodesDAO returns the DAO implementation for the database dialect
+func NewExportEpisodesDAO(dbCtx *dbcontext.DbContext) ExportEpisodes {
+	if dbCtx.Dialect() == dbcontext.Postgres {
+		return newPostgresExportDAO(dbCtx)
+	}
+	return newSQLiteExportDAO(dbCtx)
+}
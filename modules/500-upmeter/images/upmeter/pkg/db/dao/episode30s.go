@@ -24,12 +24,13 @@ import (
 	dbcontext "d8.io/upmeter/pkg/db/context"
 )
 
+// EpisodeDao30s is the SQLite implementation of Episodes30s
 type EpisodeDao30s struct {
 	DbCtx *dbcontext.DbContext
 	Table string
 }
 
-func NewEpisodeDao30s(dbCtx *dbcontext.DbContext) *EpisodeDao30s {
+func newSQLiteEpisodeDao30s(dbCtx *dbcontext.DbContext) *EpisodeDao30s {
 	return &EpisodeDao30s{
 		DbCtx: dbCtx,
 		Table: "episodes_30s",
@@ -0,0 +1,245 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"d8.io/upmeter/pkg/check"
+	dbcontext "d8.io/upmeter/pkg/db/context"
+)
+
+// PostgresEpisodeDao30s is the PostgreSQL implementation of Episodes30s
+type PostgresEpisodeDao30s struct {
+	DbCtx *dbcontext.DbContext
+}
+
+func newPostgresEpisodeDao30s(dbCtx *dbcontext.DbContext) *PostgresEpisodeDao30s {
+	return &PostgresEpisodeDao30s{DbCtx: dbCtx}
+}
+
+// GetBySlotAndProbe locks the found row till the end of the transaction, because several server replicas
+// can combine the same episode concurrently.
+func (d *PostgresEpisodeDao30s) GetBySlotAndProbe(slot time.Time, ref check.ProbeRef) (Entity, error) {
+	const query = selectEntityStmt + `
+	FROM
+		episodes_30s
+	WHERE
+		timeslot   = $1 AND
+		group_name = $2 AND
+		probe_name = $3
+	FOR UPDATE
+	`
+
+	var entity Entity
+
+	rows, err := d.DbCtx.StmtRunner().Query(query, slot.Unix(), ref.Group, ref.Probe)
+	if err != nil {
+		return entity, fmt.Errorf("cannot fetch episodes by timeslot, group_name, probe_name: %v", err)
+	}
+	defer rows.Close()
+
+	records, err := parseEpisodeEntities(rows)
+	if err != nil {
+		return entity, err
+	}
+	if len(records) == 0 {
+		return Entity{Rowid: -1}, nil
+	}
+
+	return records[0], nil
+}
+
+func (d *PostgresEpisodeDao30s) ListByRange(start, end time.Time, ref check.ProbeRef) ([]Entity, error) {
+	const query = selectEntityStmt + `
+	FROM
+		episodes_30s
+	WHERE
+		timeslot  >= $1 AND
+		timeslot   < $2 AND
+		group_name = $3 AND
+		probe_name = $4
+	`
+
+	rows, err := d.DbCtx.StmtRunner().Query(query, start.Unix(), end.Unix(), ref.Group, ref.Probe)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query SELECT: %v", err)
+	}
+	defer rows.Close()
+
+	return parseEpisodeEntities(rows)
+}
+
+func (d *PostgresEpisodeDao30s) Insert(episode check.Episode) error {
+	const query = `
+	INSERT INTO
+		episodes_30s
+		(timeslot, nano_up, nano_down, nano_unknown, nano_unmeasured, group_name, probe_name)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT
+		(timeslot, group_name, probe_name)
+	DO UPDATE SET
+		nano_up         = EXCLUDED.nano_up,
+		nano_down       = EXCLUDED.nano_down,
+		nano_unknown    = EXCLUDED.nano_unknown,
+		nano_unmeasured = EXCLUDED.nano_unmeasured
+	`
+
+	_, err := d.DbCtx.StmtRunner().Exec(
+		query,
+		episode.TimeSlot.Unix(),
+		episode.Up,
+		episode.Down,
+		episode.Unknown,
+		episode.NoData,
+		episode.ProbeRef.Group,
+		episode.ProbeRef.Probe,
+	)
+	return err
+}
+
+func (d *PostgresEpisodeDao30s) Update(rowid int64, episode check.Episode) error {
+	const query = `
+	UPDATE
+		episodes_30s
+	SET
+		nano_up         = $1,
+		nano_down       = $2,
+		nano_unknown    = $3,
+		nano_unmeasured = $4
+	WHERE
+		rowid = $5
+	`
+
+	_, err := d.DbCtx.StmtRunner().Exec(
+		query,
+		episode.Up,
+		episode.Down,
+		episode.Unknown,
+		episode.NoData,
+		rowid,
+	)
+	return err
+}
+
+func (d *PostgresEpisodeDao30s) ListBySlot(slot time.Time) ([]Entity, error) {
+	const query = selectEntityStmt + `
+	FROM    episodes_30s
+	WHERE   timeslot = $1
+	`
+
+	rows, err := d.DbCtx.StmtRunner().Query(query, slot.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("cannot query SELECT: %v", err)
+	}
+	defer rows.Close()
+
+	return parseEpisodeEntities(rows)
+}
+
+func (d *PostgresEpisodeDao30s) ListEpisodesBySlot(slot time.Time) ([]check.Episode, error) {
+	const query = selectEntityStmt + `
+	FROM    episodes_30s
+	WHERE   timeslot = $1
+	`
+
+	rows, err := d.DbCtx.StmtRunner().Query(query, slot.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("cannot query SELECT: %v", err)
+	}
+	defer rows.Close()
+
+	return parseEpisodesFromEntities(rows)
+}
+
+func (d *PostgresEpisodeDao30s) DeleteUpTo(slot time.Time) error {
+	const query = `
+	DELETE FROM episodes_30s
+	WHERE timeslot <= $1
+	`
+	_, err := d.DbCtx.StmtRunner().Exec(query, slot.Unix())
+	return err
+}
+
+func (d *PostgresEpisodeDao30s) Stats() ([]string, error) {
+	const query = `
+	SELECT   timeslot, count(timeslot)
+	FROM     episodes_30s
+	GROUP BY timeslot
+	ORDER BY timeslot
+	`
+
+	rows, err := d.DbCtx.StmtRunner().Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("select stats: %v", err)
+	}
+	defer rows.Close()
+
+	stats := []string{}
+	for rows.Next() {
+		var startUnix, count int64
+		err = rows.Scan(&startUnix, &count)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse stats: %v", err)
+		}
+		stats = append(stats, fmt.Sprintf("%d %d", startUnix, count))
+	}
+
+	return stats, nil
+}
+
+func (d *PostgresEpisodeDao30s) SaveBatch(episodes []check.Episode) error {
+	for _, ep := range episodes {
+		err := d.Insert(ep)
+		if err != nil {
+			return fmt.Errorf("inserting episode (%s): %w", ep.String(), err)
+		}
+	}
+	return nil
+}
+
+func (d *PostgresEpisodeDao30s) GetEarliestTimeSlot() (time.Time, error) {
+	const query = `
+	SELECT MIN(timeslot)
+	FROM episodes_30s
+	`
+
+	slot := time.Unix(0, 0)
+
+	rows, err := d.DbCtx.StmtRunner().Query(query)
+	if err != nil {
+		return slot, fmt.Errorf("select stats: %v", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		// MIN returns NULL on the empty table
+		var startUnix sql.NullInt64
+		err = rows.Scan(&startUnix)
+		if err != nil {
+			return slot, fmt.Errorf("cannot parse: %v", err)
+		}
+		if startUnix.Valid {
+			slot = time.Unix(startUnix.Int64, 0)
+		}
+	}
+
+	return slot, nil
+}
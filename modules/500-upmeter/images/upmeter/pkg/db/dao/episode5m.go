@@ -35,12 +35,13 @@ func areAllProbesRequested(probe string) bool {
 	return probe == ProbeEnumeration
 }
 
+// EpisodeDao5m is the SQLite implementation of Episodes5m
 type EpisodeDao5m struct {
 	DbCtx *dbcontext.DbContext
 	Table string
 }
 
-func NewEpisodeDao5m(dbCtx *dbcontext.DbContext) *EpisodeDao5m {
+func newSQLiteEpisodeDao5m(dbCtx *dbcontext.DbContext) *EpisodeDao5m {
 	return &EpisodeDao5m{
 		DbCtx: dbCtx,
 		Table: "episodes_5m",
@@ -0,0 +1,226 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"d8.io/upmeter/pkg/check"
+	dbcontext "d8.io/upmeter/pkg/db/context"
+	"d8.io/upmeter/pkg/server/ranges"
+)
+
+// PostgresEpisodeDao5m is the PostgreSQL implementation of Episodes5m
+type PostgresEpisodeDao5m struct {
+	DbCtx *dbcontext.DbContext
+}
+
+func newPostgresEpisodeDao5m(dbCtx *dbcontext.DbContext) *PostgresEpisodeDao5m {
+	return &PostgresEpisodeDao5m{DbCtx: dbCtx}
+}
+
+// GetBySlotAndProbe locks the found row till the end of the transaction, because several server replicas
+// can update the same episode concurrently.
+func (d *PostgresEpisodeDao5m) GetBySlotAndProbe(slot time.Time, ref check.ProbeRef) (Entity, error) {
+	const query = selectEntityStmt + `
+	FROM
+		episodes_5m
+	WHERE
+		timeslot   = $1 AND
+		group_name = $2 AND
+		probe_name = $3
+	FOR UPDATE
+	`
+
+	var entity Entity
+
+	rows, err := d.DbCtx.StmtRunner().Query(query, slot.Unix(), ref.Group, ref.Probe)
+	if err != nil {
+		return entity, fmt.Errorf("cannot fetch episodes by timeslot, group_name, probe_name: %v", err)
+	}
+	defer rows.Close()
+
+	records, err := parseEpisodeEntities(rows)
+	if err != nil {
+		return entity, err
+	}
+	if len(records) == 0 {
+		return Entity{Rowid: -1}, nil
+	}
+
+	return records[0], nil
+}
+
+func (d *PostgresEpisodeDao5m) Insert(episode check.Episode) error {
+	const query = `
+	INSERT INTO
+		episodes_5m
+		(timeslot, nano_up, nano_down, nano_unknown, nano_unmeasured, group_name, probe_name)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT
+		(timeslot, group_name, probe_name)
+	DO UPDATE SET
+		nano_up         = EXCLUDED.nano_up,
+		nano_down       = EXCLUDED.nano_down,
+		nano_unknown    = EXCLUDED.nano_unknown,
+		nano_unmeasured = EXCLUDED.nano_unmeasured
+	`
+
+	_, err := d.DbCtx.StmtRunner().Exec(
+		query,
+		episode.TimeSlot.Unix(),
+		episode.Up,
+		episode.Down,
+		episode.Unknown,
+		episode.NoData,
+		episode.ProbeRef.Group,
+		episode.ProbeRef.Probe,
+	)
+	return err
+}
+
+func (d *PostgresEpisodeDao5m) Update(rowid int64, episode check.Episode) error {
+	const query = `
+	UPDATE
+		episodes_5m
+	SET
+		nano_up         = $1,
+		nano_down       = $2,
+		nano_unknown    = $3,
+		nano_unmeasured = $4
+	WHERE
+		rowid = $5
+	`
+
+	_, err := d.DbCtx.StmtRunner().Exec(
+		query,
+		episode.Up,
+		episode.Down,
+		episode.Unknown,
+		episode.NoData,
+		rowid,
+	)
+	return err
+}
+
+func (d *PostgresEpisodeDao5m) ListEpisodesByRange(from, to int64, ref check.ProbeRef) ([]check.Episode, error) {
+	args := &pgArgs{}
+
+	query := selectEntityStmt + `
+	FROM    episodes_5m
+	WHERE   timeslot >= ` + args.Add(from) + ` AND timeslot < ` + args.Add(to)
+
+	if ref.Group != "" {
+		query += " AND group_name = " + args.Add(ref.Group)
+	}
+
+	if !areAllProbesRequested(ref.Probe) {
+		// Choose specific probe
+		query += " AND probe_name = " + args.Add(ref.Probe)
+	}
+
+	rows, err := d.DbCtx.StmtRunner().Query(query, args.Values()...)
+	if err != nil {
+		return nil, fmt.Errorf("select for TimeslotRange: %v", err)
+	}
+	defer rows.Close()
+
+	return parseEpisodesFromEntities(rows)
+}
+
+// ListEpisodeSumsForRanges returns sums of nanoseconds for each group_name+probe_name in every subrange.
+// Unlike SQLite implementation, the group is always selected, because the scanned columns should not
+// depend on the filter.
+func (d *PostgresEpisodeDao5m) ListEpisodeSumsForRanges(rng ranges.StepRange, ref check.ProbeRef) ([]check.Episode, error) {
+	res := make([]check.Episode, 0)
+
+	for _, stepRange := range rng.Subranges {
+		args := &pgArgs{}
+
+		where := []string{
+			"timeslot >= " + args.Add(stepRange.From),
+			"timeslot < " + args.Add(stepRange.To),
+		}
+		if ref.Group != "" {
+			where = append(where, "group_name = "+args.Add(ref.Group))
+		}
+		if !areAllProbesRequested(ref.Probe) {
+			where = append(where, "probe_name = "+args.Add(ref.Probe))
+		}
+
+		query := `
+		SELECT   sum(nano_up), sum(nano_down), sum(nano_unknown), sum(nano_unmeasured), group_name, probe_name
+		FROM     episodes_5m
+		WHERE    ` + strings.Join(where, " AND ") + `
+		GROUP BY group_name, probe_name
+		`
+
+		episodes, err := d.querySums(query, args.Values(), time.Unix(stepRange.From, 0))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, episodes...)
+	}
+
+	return res, nil
+}
+
+func (d *PostgresEpisodeDao5m) querySums(query string, args []interface{}, slot time.Time) ([]check.Episode, error) {
+	rows, err := d.DbCtx.StmtRunner().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select for TimeslotRange: %v", err)
+	}
+	defer rows.Close()
+
+	episodes := make([]check.Episode, 0)
+	for rows.Next() {
+		var ep check.Episode
+		err = rows.Scan(
+			&ep.Up,
+			&ep.Down,
+			&ep.Unknown,
+			&ep.NoData,
+			&ep.ProbeRef.Group,
+			&ep.ProbeRef.Probe,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("row to Episode5m: %v", err)
+		}
+		ep.TimeSlot = slot
+		episodes = append(episodes, ep)
+	}
+
+	return episodes, nil
+}
+
+// pgArgs collects query arguments and returns positional placeholders for them, since PostgreSQL
+// does not support "?" placeholders.
+type pgArgs struct {
+	values []interface{}
+}
+
+func (a *pgArgs) Add(value interface{}) string {
+	a.values = append(a.values, value)
+	return fmt.Sprintf("$%d", len(a.values))
+}
+
+func (a *pgArgs) Values() []interface{} {
+	return a.values
+}
@@ -87,11 +87,12 @@ func (e *ExportEntity) AddOrigin(o string) {
 
 var ErrNotFound = fmt.Errorf("not found")
 
+// ExportDAO is the SQLite implementation of ExportEpisodes
 type ExportDAO struct {
 	ctx *dbcontext.DbContext
 }
 
-func NewExportEpisodesDAO(ctx *dbcontext.DbContext) *ExportDAO {
+func newSQLiteExportDAO(ctx *dbcontext.DbContext) *ExportDAO {
 	return &ExportDAO{ctx}
 }
 
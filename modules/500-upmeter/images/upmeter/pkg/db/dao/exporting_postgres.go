@@ -0,0 +1,216 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import (
+	"fmt"
+	"time"
+
+	"d8.io/upmeter/pkg/db"
+	dbcontext "d8.io/upmeter/pkg/db/context"
+)
+
+// PostgresExportDAO is the PostgreSQL implementation of ExportEpisodes. The logic of choosing episodes
+// to export is the same as in SQLite implementation, see getEarliestTimeSlot.
+type PostgresExportDAO struct {
+	ctx *dbcontext.DbContext
+}
+
+func newPostgresExportDAO(ctx *dbcontext.DbContext) *PostgresExportDAO {
+	return &PostgresExportDAO{ctx}
+}
+
+func (dao *PostgresExportDAO) Save(entities []ExportEntity) error {
+	return db.WithTx(dao.ctx, func(tx *dbcontext.DbContext) error {
+		for _, entity := range entities {
+			found, err := pgGetExportEpisode(tx, entity)
+			if err != nil {
+				return fmt.Errorf("cannot fetch: %v", err)
+			}
+			if found != nil {
+				entity.Origins.Merge(found.Origins)
+			}
+			err = pgSaveExportEpisode(tx, entity)
+			if err != nil {
+				return fmt.Errorf("cannot save: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (dao *PostgresExportDAO) GetEarliestEpisodes(syncID string, originsCount int) ([]ExportEntity, error) {
+	trans, err := db.NewTx(dao.ctx)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := pgGetEarliestExportEpisodes(trans.Ctx(), syncID, originsCount)
+	return entities, trans.Act(err)
+}
+
+func (dao *PostgresExportDAO) DeleteUpTo(syncID string, slot time.Time) error {
+	ctx := dao.ctx.Start()
+	defer ctx.Stop()
+
+	const q = `
+	DELETE FROM export_episodes
+	WHERE sync_id = $1 AND timeslot <= $2
+	`
+	_, err := ctx.StmtRunner().Exec(q, syncID, slot.Unix())
+	return err
+}
+
+// pgGetExportEpisode fetches entity and locks it till the end of the transaction, so that origins
+// are merged correctly when several server replicas save the same episode.
+func pgGetExportEpisode(ctx *dbcontext.DbContext, filter ExportEntity) (*ExportEntity, error) {
+	const query = `
+	SELECT  sync_id, timeslot, group_name, probe_name,
+		nano_up, nano_down, nano_unknown, nano_unmeasured,
+		origins
+	FROM  export_episodes
+	WHERE   sync_id    = $1 AND
+		timeslot   = $2 AND
+		group_name = $3 AND
+		probe_name = $4
+	LIMIT 1
+	FOR UPDATE;
+	`
+	rows, err := ctx.StmtRunner().Query(
+		query,
+		filter.SyncID,
+		filter.Episode.TimeSlot.Unix(),
+		filter.Episode.ProbeRef.Group,
+		filter.Episode.ProbeRef.Probe,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities, err := parseExportEpisodeEntities(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, nil
+	}
+
+	return &entities[0], nil
+}
+
+func pgSaveExportEpisode(tx *dbcontext.DbContext, entity ExportEntity) error {
+	const query = `
+	INSERT INTO export_episodes
+		(sync_id, timeslot, group_name, probe_name,
+		 nano_up, nano_down, nano_unknown, nano_unmeasured,
+		 origins, origins_count)
+	VALUES
+		($1, $2, $3, $4,
+		 $5, $6, $7, $8,
+		 $9, $10)
+	ON CONFLICT
+		(sync_id, timeslot, group_name, probe_name)
+	DO UPDATE SET
+		nano_up         = EXCLUDED.nano_up,
+		nano_down       = EXCLUDED.nano_down,
+		nano_unknown    = EXCLUDED.nano_unknown,
+		nano_unmeasured = EXCLUDED.nano_unmeasured,
+		origins         = EXCLUDED.origins,
+		origins_count   = EXCLUDED.origins_count;
+	`
+
+	_, err := tx.StmtRunner().Exec(
+		query,
+		entity.SyncID,
+		entity.Episode.TimeSlot.Unix(),
+
+		entity.Episode.ProbeRef.Group,
+		entity.Episode.ProbeRef.Probe,
+
+		entity.Episode.Up,
+		entity.Episode.Down,
+		entity.Episode.Unknown,
+		entity.Episode.NoData,
+
+		entity.Origins.String(),
+		entity.Origins.Size(),
+	)
+
+	return err
+}
+
+func pgGetEarliestExportEpisodes(ctx *dbcontext.DbContext, syncID string, originsCount int) ([]ExportEntity, error) {
+	commonSlot, err := pgGetEarliestTimeSlot(ctx, syncID, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	slot := commonSlot
+	if commonSlot >= time.Now().Unix() && originsCount > 1 {
+		// not found means error as well, the only corner case is the 24h expiration convention
+		fulfilledSlot, err := pgGetEarliestTimeSlot(ctx, syncID, originsCount)
+		if err != nil {
+			return nil, err
+		}
+		slot = minInt64(fulfilledSlot, commonSlot)
+	}
+
+	const query = `
+	SELECT  sync_id, timeslot, group_name, probe_name,
+		nano_up, nano_down, nano_unknown, nano_unmeasured,
+		origins
+	FROM  export_episodes
+	WHERE   sync_id  = $1 AND
+		timeslot = $2;
+	`
+	rows, err := ctx.StmtRunner().Query(query, syncID, slot)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute query: %v", err)
+	}
+	defer rows.Close()
+
+	return parseExportEpisodeEntities(rows)
+}
+
+// pgGetEarliestTimeSlot finds the earliest timeslot for syncID and originsCount.
+// Set originsCount to -1 to search only by syncID.
+func pgGetEarliestTimeSlot(ctx *dbcontext.DbContext, syncID string, originsCount int) (int64, error) {
+	const query = `
+	SELECT   MIN(timeslot)
+	FROM     export_episodes
+	WHERE    sync_id = $1 AND origins_count >= $2
+	GROUP BY sync_id;
+	`
+
+	rows, err := ctx.StmtRunner().Query(query, syncID, originsCount)
+	if err != nil {
+		return 0, fmt.Errorf("cannot execute query: %v", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, ErrNotFound
+	}
+
+	var slot int64
+	err = rows.Scan(&slot)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse: %v", err)
+	}
+
+	return slot, nil
+}
@@ -524,7 +524,7 @@ func newRandomEpisodes(n int) []*check.Episode {
 }
 
 //nolint:unparam
-func newExportDao(t *testing.T) *ExportDAO {
+func newExportDao(t *testing.T) ExportEpisodes {
 	dbctx := getTestDatabase(t)
 	return NewExportEpisodesDAO(dbctx)
 }
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dao
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"d8.io/upmeter/pkg/check"
+	"d8.io/upmeter/pkg/db"
+	dbcontext "d8.io/upmeter/pkg/db/context"
+	"d8.io/upmeter/pkg/db/migrations"
+	"d8.io/upmeter/pkg/server/ranges"
+)
+
+// getPostgresDatabase connects to the database from UPMETER_TEST_POSTGRES_URL, migrates it and cleans all tables.
+// Tests are skipped if the variable is not set.
+func getPostgresDatabase(t *testing.T) *dbcontext.DbContext {
+	url := os.Getenv("UPMETER_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("UPMETER_TEST_POSTGRES_URL is not set")
+	}
+
+	dbctx, err := db.Connect(url, nil)
+	if err != nil {
+		t.Fatalf("cannot connect to postgres: %v", err)
+	}
+
+	err = migrations.MigrateDatabase(context.TODO(), dbctx, "../migrations/server-postgres")
+	if err != nil {
+		t.Fatalf("cannot migrate postgres: %v", err)
+	}
+
+	ctx := dbctx.Start()
+	defer ctx.Stop()
+	_, err = ctx.StmtRunner().Exec(`TRUNCATE episodes_30s, episodes_5m, export_episodes`)
+	if err != nil {
+		t.Fatalf("cannot clean tables: %v", err)
+	}
+
+	return dbctx
+}
+
+func Test_pgArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	args := &pgArgs{}
+	g.Expect(args.Add(int64(1))).To(Equal("$1"))
+	g.Expect(args.Add("group")).To(Equal("$2"))
+	g.Expect(args.Values()).To(Equal([]interface{}{int64(1), "group"}))
+}
+
+func Test_DAO_selects_implementation_by_dialect(t *testing.T) {
+	g := NewWithT(t)
+
+	dbctx := getTestDatabase(t)
+	g.Expect(NewEpisodeDao30s(dbctx)).To(BeAssignableToTypeOf(&EpisodeDao30s{}))
+	g.Expect(NewEpisodeDao5m(dbctx)).To(BeAssignableToTypeOf(&EpisodeDao5m{}))
+	g.Expect(NewExportEpisodesDAO(dbctx)).To(BeAssignableToTypeOf(&ExportDAO{}))
+}
+
+func Test_Postgres_episodes30s_CRUD(t *testing.T) {
+	g := NewWithT(t)
+	dbctx := getPostgresDatabase(t)
+
+	daoCtx := dbctx.Start()
+	defer daoCtx.Stop()
+
+	dao30s := NewEpisodeDao30s(daoCtx)
+	g.Expect(dao30s).To(BeAssignableToTypeOf(&PostgresEpisodeDao30s{}))
+
+	slot, err := dao30s.GetEarliestTimeSlot()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(slot).To(Equal(time.Unix(0, 0)), "should be zero slot for the empty table")
+
+	episodes := []check.Episode{
+		{ProbeRef: check.ProbeRef{Group: "nginx", Probe: "main"}, TimeSlot: t360, Up: 10 * time.Second},
+		{ProbeRef: check.ProbeRef{Group: "nginx", Probe: "redirect"}, TimeSlot: t360, Up: 20 * time.Second},
+	}
+	err = dao30s.SaveBatch(episodes)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	entity, err := dao30s.GetBySlotAndProbe(t360, episodes[1].ProbeRef)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(entity.Rowid).ShouldNot(BeEquivalentTo(-1))
+	g.Expect(entity.Episode.Up).To(Equal(20 * time.Second))
+
+	entity.Episode.Down = 5 * time.Second
+	err = dao30s.Update(entity.Rowid, entity.Episode)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	list, err := dao30s.ListByRange(t360, t360.Add(30*time.Second), episodes[1].ProbeRef)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(list).To(HaveLen(1))
+	g.Expect(list[0].Episode.Down).To(Equal(5 * time.Second))
+
+	slot, err = dao30s.GetEarliestTimeSlot()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(slot).To(Equal(t360))
+
+	err = dao30s.DeleteUpTo(t360)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	all, err := dao30s.ListEpisodesBySlot(t360)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(all).To(BeEmpty())
+}
+
+func Test_Postgres_episodes5m_sums(t *testing.T) {
+	g := NewWithT(t)
+	dbctx := getPostgresDatabase(t)
+
+	daoCtx := dbctx.Start()
+	defer daoCtx.Stop()
+
+	dao5m := NewEpisodeDao5m(daoCtx)
+	ref := check.ProbeRef{Group: "nginx", Probe: "main"}
+	for _, slot := range []int64{0, 300, 600} {
+		err := dao5m.Insert(check.Episode{ProbeRef: ref, TimeSlot: time.Unix(slot, 0), Up: time.Minute, Down: 4 * time.Minute})
+		g.Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	rng := ranges.StepRange{Subranges: []ranges.Range{{From: 0, To: 600}, {From: 600, To: 900}}}
+	sums, err := dao5m.ListEpisodeSumsForRanges(rng, check.ProbeRef{Group: "nginx", Probe: ProbeEnumeration})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(sums).To(HaveLen(2))
+	g.Expect(sums[0].ProbeRef).To(Equal(ref))
+	g.Expect(sums[0].Up).To(Equal(2 * time.Minute))
+	g.Expect(sums[1].Down).To(Equal(4 * time.Minute))
+	g.Expect(sums[1].TimeSlot).To(Equal(time.Unix(600, 0)))
+}
+
+// Server replicas can insert the same episode concurrently, so the second insert must not violate the unique index.
+func Test_Postgres_episodes_insert_is_upsert(t *testing.T) {
+	g := NewWithT(t)
+	dbctx := getPostgresDatabase(t)
+
+	daoCtx := dbctx.Start()
+	defer daoCtx.Stop()
+
+	ref := check.ProbeRef{Group: "nginx", Probe: "main"}
+	for _, storage := range []interface {
+		Insert(check.Episode) error
+		GetBySlotAndProbe(time.Time, check.ProbeRef) (Entity, error)
+	}{NewEpisodeDao30s(daoCtx), NewEpisodeDao5m(daoCtx)} {
+		err := storage.Insert(check.Episode{ProbeRef: ref, TimeSlot: t360, Up: 10 * time.Second})
+		g.Expect(err).ShouldNot(HaveOccurred())
+		err = storage.Insert(check.Episode{ProbeRef: ref, TimeSlot: t360, Up: 20 * time.Second, Down: 5 * time.Second})
+		g.Expect(err).ShouldNot(HaveOccurred())
+
+		entity, err := storage.GetBySlotAndProbe(t360, ref)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(entity.Episode.Up).To(Equal(20 * time.Second))
+		g.Expect(entity.Episode.Down).To(Equal(5 * time.Second))
+	}
+}
+
+func Test_Postgres_ExportDAO_MergesOrigins(t *testing.T) {
+	g := NewWithT(t)
+	storage := NewExportEpisodesDAO(getPostgresDatabase(t))
+
+	saved, opts := genExportEntities(genOpts{n: 1})
+	for _, o := range []string{"a", "b", "a"} {
+		saved[0].Origins = newSet(o)
+		err := storage.Save(saved)
+		g.Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	got, err := storage.GetEarliestEpisodes(*opts.syncID, 2)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(got).To(HaveLen(1))
+	g.Expect(got[0].Origins.String()).To(Equal("a:b"))
+
+	err = storage.DeleteUpTo(*opts.syncID, got[0].Episode.TimeSlot)
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	_, err = storage.GetEarliestEpisodes(*opts.syncID, 2)
+	g.Expect(err).To(Equal(ErrNotFound))
+}
@@ -23,6 +23,8 @@ import (
 	"testing"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 
@@ -79,8 +81,17 @@ func newMigrate(dbctx *dbcontext.DbContext, migrationsPath string) (*migrate.Mig
 	ctx := dbctx.Start()
 	defer ctx.Stop()
 
-	// no tx to be able to do vacuum
-	driver, err := sqlite3.WithInstance(ctx.Handler(), &sqlite3.Config{NoTxWrap: true})
+	var (
+		driver database.Driver
+		err    error
+	)
+	switch dbctx.Dialect() {
+	case dbcontext.Postgres:
+		driver, err = postgres.WithInstance(ctx.Handler(), &postgres.Config{})
+	default:
+		// no tx to be able to do vacuum
+		driver, err = sqlite3.WithInstance(ctx.Handler(), &sqlite3.Config{NoTxWrap: true})
+	}
 	if err != nil {
 		return nil, fmt.Errorf("cannot init driver: %v", err)
 	}
@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS sync_id_sorted;
+DROP INDEX IF EXISTS episodes5m_time_group_probe;
+DROP INDEX IF EXISTS episodes30s_time_group_probe;
+
+DROP TABLE IF EXISTS export_episodes;
+DROP TABLE IF EXISTS episodes_5m;
+DROP TABLE IF EXISTS episodes_30s;
+
+COMMIT;
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userprobe
+
+import (
+	"context"
+	"fmt"
+
+	kube "github.com/flant/kube-client/client"
+	"github.com/flant/shell-operator/pkg/kube_events_manager"
+	"github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type Monitor struct {
+	monitor kube_events_manager.Monitor
+	logger  *log.Entry
+}
+
+func NewMonitor(kubeClient kube.Client, logger *log.Entry) *Monitor {
+	monitor := kube_events_manager.NewMonitor()
+	monitor.WithKubeClient(kubeClient)
+	monitor.EnableKubeEventCb()
+
+	return &Monitor{
+		monitor: monitor,
+		logger:  logger,
+	}
+}
+
+// StartMonitor starts the monitor with the handler subscribed. Objects existing before the start
+// are passed to the handler as added ones.
+func StartMonitor(ctx context.Context, kubeClient kube.Client, handler Handler, logger *log.Entry) (*Monitor, error) {
+	m := NewMonitor(kubeClient, logger)
+	m.Subscribe(handler)
+	if err := m.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	objs, err := m.List()
+	if err != nil {
+		m.Stop()
+		return nil, err
+	}
+	for _, obj := range objs {
+		handler.OnAdd(obj)
+	}
+
+	return m, nil
+}
+
+func (m *Monitor) Start(ctx context.Context) error {
+	config := &kube_events_manager.MonitorConfig{
+		Metadata: struct {
+			MonitorId    string
+			DebugName    string
+			LogLabels    map[string]string
+			MetricLabels map[string]string
+		}{
+			"upmeterprobe-monitor",
+			"upmeterprobe-monitor",
+			map[string]string{},
+			map[string]string{},
+		},
+		EventTypes: []types.WatchEventType{
+			types.WatchEventAdded,
+			types.WatchEventModified,
+			types.WatchEventDeleted,
+		},
+		ApiVersion:              "deckhouse.io/v1",
+		Kind:                    "UpmeterProbe",
+		LogEntry:                m.logger.WithField("component", "upmeterprobe-monitor"),
+		KeepFullObjectsInMemory: true,
+	}
+
+	m.monitor.WithContext(ctx)
+	m.monitor.WithConfig(config)
+
+	err := m.monitor.CreateInformers()
+	if err != nil {
+		return fmt.Errorf("creating informer: %v", err)
+	}
+
+	m.monitor.Start(ctx)
+	return nil
+}
+
+func (m *Monitor) Stop() {
+	m.monitor.Stop()
+}
+
+func (m *Monitor) getLogger() *log.Entry {
+	return m.monitor.GetConfig().LogEntry
+}
+
+func (m *Monitor) Subscribe(handler Handler) {
+	m.monitor.WithKubeEventCb(func(ev types.KubeEvent) {
+		// One event and one object per change, we always have single item in these lists.
+		evType := ev.WatchEvents[0]
+		raw := ev.Objects[0].Object
+
+		obj, err := convert(raw)
+		if err != nil {
+			m.getLogger().Errorf("cannot convert UpmeterProbe object: %v", err)
+			return
+		}
+
+		switch evType {
+		case types.WatchEventAdded:
+			handler.OnAdd(obj)
+		case types.WatchEventModified:
+			handler.OnModify(obj)
+		case types.WatchEventDeleted:
+			handler.OnDelete(obj)
+		}
+	})
+}
+
+func (m *Monitor) List() ([]*UpmeterProbe, error) {
+	res := make([]*UpmeterProbe, 0)
+	for _, obj := range m.monitor.Snapshot() {
+		up, err := convert(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, up)
+	}
+	return res, nil
+}
+
+func convert(o *unstructured.Unstructured) (*UpmeterProbe, error) {
+	var up UpmeterProbe
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.UnstructuredContent(), &up)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert unstructured to v1.UpmeterProbe: %v", err)
+	}
+	return &up, nil
+}
+
+type Handler interface {
+	OnAdd(*UpmeterProbe)
+	OnModify(*UpmeterProbe)
+	OnDelete(*UpmeterProbe)
+}
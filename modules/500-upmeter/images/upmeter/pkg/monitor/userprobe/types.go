@@ -0,0 +1,72 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userprobe
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Spec is the spec in the UpmeterProbe CRD. Exactly one of HTTP, TCP or DNS sections is expected.
+type Spec struct {
+	// Interval is the period of the check, e.g. "30s"
+	Interval string `json:"interval,omitempty"`
+
+	HTTP *HTTPSpec `json:"http,omitempty"`
+	TCP  *TCPSpec  `json:"tcp,omitempty"`
+	DNS  *DNSSpec  `json:"dns,omitempty"`
+}
+
+type HTTPSpec struct {
+	URL            string `json:"url"`
+	Method         string `json:"method,omitempty"`
+	ExpectedStatus int    `json:"expectedStatus,omitempty"`
+	// BodyRegex is the regular expression the response body must match
+	BodyRegex string `json:"bodyRegex,omitempty"`
+	// TLSExpiryThreshold fails the check when the server certificate expires sooner, e.g. "168h"
+	TLSExpiryThreshold string `json:"tlsExpiryThreshold,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+}
+
+type TCPSpec struct {
+	// Address is the host:port pair to connect to
+	Address string `json:"address"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type DNSSpec struct {
+	Name string `json:"name"`
+	// Server is the host:port of the DNS server, the system resolver is used if empty
+	Server  string `json:"server,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// UpmeterProbe is the Schema for the user-defined probe
+type UpmeterProbe struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec Spec `json:"spec,omitempty"`
+}
+
+// UpmeterProbeList contains a list of UpmeterProbe objects
+type UpmeterProbeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []UpmeterProbe `json:"items"`
+}
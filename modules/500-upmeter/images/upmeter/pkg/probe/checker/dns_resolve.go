@@ -0,0 +1,73 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"d8.io/upmeter/pkg/check"
+)
+
+// DNSResolveAvailable is a checker constructor and configurator for user-defined DNS names
+type DNSResolveAvailable struct {
+	Name string
+	// Server is the host:port of the DNS server, the system resolver is used if empty
+	Server  string
+	Timeout time.Duration
+}
+
+func (c DNSResolveAvailable) Checker() check.Checker {
+	resolver := &net.Resolver{}
+	if c.Server != "" {
+		server := c.Server
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return &dnsResolveChecker{
+		name:     c.Name,
+		resolver: resolver,
+		timeout:  c.Timeout,
+	}
+}
+
+type dnsResolveChecker struct {
+	name     string
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+func (c *dnsResolveChecker) Check() check.Error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	addrs, err := c.resolver.LookupIPAddr(ctx, c.name)
+	if err != nil {
+		return check.ErrFail("cannot resolve %q: %v", c.name, err)
+	}
+	if len(addrs) == 0 {
+		return check.ErrFail("resolved no addresses for %q", c.name)
+	}
+	return nil
+}
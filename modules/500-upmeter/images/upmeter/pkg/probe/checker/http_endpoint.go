@@ -0,0 +1,119 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"d8.io/upmeter/pkg/check"
+)
+
+// HTTPEndpointAvailable is a checker constructor and configurator for user-defined HTTP endpoints
+type HTTPEndpointAvailable struct {
+	URL            string
+	Method         string
+	ExpectedStatus int
+
+	// BodyRegex is checked against the response body if set
+	BodyRegex *regexp.Regexp
+
+	// TLSExpiryThreshold is the minimal remaining validity of the server certificate, ignored if zero
+	TLSExpiryThreshold time.Duration
+	InsecureSkipVerify bool
+
+	Timeout time.Duration
+}
+
+func (c HTTPEndpointAvailable) Checker() check.Checker {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify},
+		},
+		// the checker does not follow redirects, the expected status can be a redirect one
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &httpEndpointChecker{client: client, config: c}
+}
+
+type httpEndpointChecker struct {
+	client *http.Client
+	config HTTPEndpointAvailable
+}
+
+func (c *httpEndpointChecker) Check() check.Error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, c.config.Method, c.config.URL, nil)
+	if err != nil {
+		return check.ErrUnknown("cannot create request: %v", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return check.ErrFail("cannot dial %q: %v", c.config.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != c.config.ExpectedStatus {
+		// drain the body to reuse the connection
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return check.ErrFail("HTTP: %s %s returned status %d, expected %d",
+			req.Method, c.config.URL, resp.StatusCode, c.config.ExpectedStatus)
+	}
+
+	if err := verifyCertificateExpiry(resp.TLS, c.config.TLSExpiryThreshold); err != nil {
+		return check.ErrFail("HTTP: %s: %v", c.config.URL, err)
+	}
+
+	if c.config.BodyRegex == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return check.ErrFail("cannot read response body: %v", err)
+	}
+	if !c.config.BodyRegex.Match(body) {
+		return check.ErrFail("HTTP: %s response body does not match %q", c.config.URL, c.config.BodyRegex.String())
+	}
+
+	return nil
+}
+
+// verifyCertificateExpiry checks that the leaf certificate is valid at least for the threshold duration
+func verifyCertificateExpiry(state *tls.ConnectionState, threshold time.Duration) error {
+	if threshold == 0 || state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	notAfter := state.PeerCertificates[0].NotAfter
+	if time.Until(notAfter) < threshold {
+		return fmt.Errorf("certificate expires at %s, less than %s left", notAfter.Format(time.RFC3339), threshold)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"d8.io/upmeter/pkg/check"
+)
+
+func Test_httpEndpointChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer tlsServer.Close()
+
+	tests := []struct {
+		name   string
+		config HTTPEndpointAvailable
+		status check.Status
+	}{
+		{
+			name:   "expected status",
+			config: HTTPEndpointAvailable{URL: server.URL, ExpectedStatus: 200},
+			status: check.Up,
+		},
+		{
+			name:   "unexpected status",
+			config: HTTPEndpointAvailable{URL: server.URL + "/missing", ExpectedStatus: 200},
+			status: check.Down,
+		},
+		{
+			name:   "expected non-200 status",
+			config: HTTPEndpointAvailable{URL: server.URL + "/missing", ExpectedStatus: 404},
+			status: check.Up,
+		},
+		{
+			name:   "body matches",
+			config: HTTPEndpointAvailable{URL: server.URL, ExpectedStatus: 200, BodyRegex: regexp.MustCompile(`"status":\s*"ok"`)},
+			status: check.Up,
+		},
+		{
+			name:   "body does not match",
+			config: HTTPEndpointAvailable{URL: server.URL, ExpectedStatus: 200, BodyRegex: regexp.MustCompile(`fail`)},
+			status: check.Down,
+		},
+		{
+			name:   "untrusted certificate",
+			config: HTTPEndpointAvailable{URL: tlsServer.URL, ExpectedStatus: 200},
+			status: check.Down,
+		},
+		{
+			name:   "certificate is valid long enough",
+			config: HTTPEndpointAvailable{URL: tlsServer.URL, ExpectedStatus: 200, InsecureSkipVerify: true, TLSExpiryThreshold: 24 * time.Hour},
+			status: check.Up,
+		},
+		{
+			name:   "certificate expires too soon",
+			config: HTTPEndpointAvailable{URL: tlsServer.URL, ExpectedStatus: 200, InsecureSkipVerify: true, TLSExpiryThreshold: 100 * 365 * 24 * time.Hour},
+			status: check.Down,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Method = http.MethodGet
+			tt.config.Timeout = time.Second
+
+			err := tt.config.Checker().Check()
+
+			if tt.status == check.Up {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Equal(t, tt.status, err.Status())
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"net"
+	"time"
+
+	"d8.io/upmeter/pkg/check"
+)
+
+// TCPConnectAvailable is a checker constructor and configurator for user-defined TCP endpoints
+type TCPConnectAvailable struct {
+	// Address is the host:port pair
+	Address string
+	Timeout time.Duration
+}
+
+func (c TCPConnectAvailable) Checker() check.Checker {
+	return &tcpConnectChecker{address: c.Address, timeout: c.Timeout}
+}
+
+type tcpConnectChecker struct {
+	address string
+	timeout time.Duration
+}
+
+func (c *tcpConnectChecker) Check() check.Error {
+	conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return check.ErrFail("cannot connect to %q: %v", c.address, err)
+	}
+	_ = conn.Close()
+	return nil
+}
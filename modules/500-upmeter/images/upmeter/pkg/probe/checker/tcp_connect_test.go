@@ -0,0 +1,48 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checker
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"d8.io/upmeter/pkg/check"
+)
+
+func Test_tcpConnectChecker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	address := listener.Addr().String()
+
+	t.Run("listening port", func(t *testing.T) {
+		err := TCPConnectAvailable{Address: address, Timeout: time.Second}.Checker().Check()
+		assert.NoError(t, err)
+	})
+
+	_ = listener.Close()
+
+	t.Run("closed port", func(t *testing.T) {
+		err := TCPConnectAvailable{Address: address, Timeout: time.Second}.Checker().Check()
+		assert.Error(t, err)
+		assert.Equal(t, check.Down, err.Status())
+	})
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"d8.io/upmeter/pkg/check"
+	"d8.io/upmeter/pkg/monitor/userprobe"
+	"d8.io/upmeter/pkg/probe/checker"
+)
+
+const (
+	groupUser = "user"
+
+	userProbeDefaultInterval = 30 * time.Second
+	userProbeDefaultTimeout  = 5 * time.Second
+	userProbeMinInterval     = 5 * time.Second
+)
+
+// UserProbes keeps runners for probes defined by UpmeterProbe custom resources. They are placed in the
+// "user" group and named after the resource. The set changes in runtime, so it implements
+// userprobe.Handler to follow the monitor.
+type UserProbes struct {
+	filter Filter
+	logger *logrus.Logger
+
+	mu      sync.RWMutex
+	runners map[string]*check.Runner
+}
+
+func NewUserProbes(filter Filter, logger *logrus.Logger) *UserProbes {
+	return &UserProbes{
+		filter:  filter,
+		logger:  logger,
+		runners: make(map[string]*check.Runner),
+	}
+}
+
+func (u *UserProbes) OnAdd(obj *userprobe.UpmeterProbe) {
+	u.set(obj)
+}
+
+func (u *UserProbes) OnModify(obj *userprobe.UpmeterProbe) {
+	u.set(obj)
+}
+
+func (u *UserProbes) OnDelete(obj *userprobe.UpmeterProbe) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.runners[obj.Name]; ok {
+		delete(u.runners, obj.Name)
+		u.logger.Infof("Unregister probe %s/%s", groupUser, obj.Name)
+	}
+}
+
+func (u *UserProbes) set(obj *userprobe.UpmeterProbe) {
+	rc, err := newUserProbeConfig(obj)
+	if err != nil {
+		u.logger.Errorf("cannot register UpmeterProbe %q: %v", obj.Name, err)
+		u.OnDelete(obj)
+		return
+	}
+	if !u.filter.Enabled(rc.Ref()) {
+		// The probe could be registered before the modification.
+		u.OnDelete(obj)
+		return
+	}
+
+	runnerLogger := u.logger.WithFields(map[string]interface{}{
+		"group": rc.group,
+		"probe": rc.probe,
+		"check": rc.check,
+	})
+	runner := check.NewRunner(rc.group, rc.probe, rc.check, rc.period, rc.config.Checker(), runnerLogger)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.runners[obj.Name] = runner
+	u.logger.Infof("Register probe %s", runner.ProbeRef().Id())
+}
+
+// Runners returns current runners sorted by probe name
+func (u *UserProbes) Runners() []*check.Runner {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	runners := make([]*check.Runner, 0, len(u.runners))
+	for _, runner := range u.runners {
+		runners = append(runners, runner)
+	}
+	sort.Slice(runners, func(i, j int) bool {
+		return runners[i].ProbeRef().Probe < runners[j].ProbeRef().Probe
+	})
+	return runners
+}
+
+func (u *UserProbes) Groups() []string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if len(u.runners) == 0 {
+		return []string{}
+	}
+	return []string{groupUser}
+}
+
+func (u *UserProbes) Probes() []check.ProbeRef {
+	runners := u.Runners()
+
+	refs := make([]check.ProbeRef, 0, len(runners))
+	for _, runner := range runners {
+		refs = append(refs, runner.ProbeRef())
+	}
+	return refs
+}
+
+func newUserProbeConfig(obj *userprobe.UpmeterProbe) (runnerConfig, error) {
+	rc := runnerConfig{
+		group: groupUser,
+		probe: obj.Name,
+	}
+
+	period, err := parseDurationOrDefault(obj.Spec.Interval, userProbeDefaultInterval)
+	if err != nil {
+		return rc, fmt.Errorf("interval: %v", err)
+	}
+	if period < userProbeMinInterval {
+		return rc, fmt.Errorf("interval %s is less than %s", period, userProbeMinInterval)
+	}
+	rc.period = period
+
+	spec := obj.Spec
+	switch {
+	case spec.HTTP != nil:
+		rc.check = "http"
+		rc.config, err = newHTTPEndpointConfig(spec.HTTP)
+	case spec.TCP != nil:
+		rc.check = "tcp"
+		rc.config, err = newTCPConnectConfig(spec.TCP)
+	case spec.DNS != nil:
+		rc.check = "dns"
+		rc.config, err = newDNSResolveConfig(spec.DNS)
+	default:
+		err = fmt.Errorf("one of http, tcp or dns should be specified")
+	}
+
+	return rc, err
+}
+
+func newHTTPEndpointConfig(spec *userprobe.HTTPSpec) (checker.Config, error) {
+	timeout, err := parseDurationOrDefault(spec.Timeout, userProbeDefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("http.timeout: %v", err)
+	}
+	threshold, err := parseDurationOrDefault(spec.TLSExpiryThreshold, 0)
+	if err != nil {
+		return nil, fmt.Errorf("http.tlsExpiryThreshold: %v", err)
+	}
+
+	config := checker.HTTPEndpointAvailable{
+		URL:                spec.URL,
+		Method:             spec.Method,
+		ExpectedStatus:     spec.ExpectedStatus,
+		TLSExpiryThreshold: threshold,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+		Timeout:            timeout,
+	}
+	if config.Method == "" {
+		config.Method = http.MethodGet
+	}
+	if config.ExpectedStatus == 0 {
+		config.ExpectedStatus = http.StatusOK
+	}
+	if spec.BodyRegex != "" {
+		config.BodyRegex, err = regexp.Compile(spec.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("http.bodyRegex: %v", err)
+		}
+	}
+
+	return config, nil
+}
+
+func newTCPConnectConfig(spec *userprobe.TCPSpec) (checker.Config, error) {
+	timeout, err := parseDurationOrDefault(spec.Timeout, userProbeDefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("tcp.timeout: %v", err)
+	}
+
+	return checker.TCPConnectAvailable{
+		Address: spec.Address,
+		Timeout: timeout,
+	}, nil
+}
+
+func newDNSResolveConfig(spec *userprobe.DNSSpec) (checker.Config, error) {
+	timeout, err := parseDurationOrDefault(spec.Timeout, userProbeDefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dns.timeout: %v", err)
+	}
+
+	return checker.DNSResolveAvailable{
+		Name:    spec.Name,
+		Server:  spec.Server,
+		Timeout: timeout,
+	}, nil
+}
+
+func parseDurationOrDefault(s string, defaultValue time.Duration) (time.Duration, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"d8.io/upmeter/pkg/check"
+	"d8.io/upmeter/pkg/monitor/userprobe"
+)
+
+func TestUserProbes(t *testing.T) {
+	newProbe := func(name string, spec userprobe.Spec) *userprobe.UpmeterProbe {
+		return &userprobe.UpmeterProbe{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+	}
+
+	site := newProbe("site", userprobe.Spec{HTTP: &userprobe.HTTPSpec{URL: "https://example.com"}})
+	db := newProbe("db", userprobe.Spec{Interval: "1m", TCP: &userprobe.TCPSpec{Address: "db.example.com:5432"}})
+	disabled := newProbe("disabled", userprobe.Spec{DNS: &userprobe.DNSSpec{Name: "example.com"}})
+	invalid := newProbe("invalid", userprobe.Spec{Interval: "1s", DNS: &userprobe.DNSSpec{Name: "example.com"}})
+
+	probes := NewUserProbes(NewProbeFilter([]string{"user/disabled"}), newDummyLogger().Logger)
+	assert.Empty(t, probes.Groups())
+
+	probes.OnAdd(site)
+	probes.OnAdd(db)
+	probes.OnAdd(disabled)
+	probes.OnAdd(invalid)
+
+	assert.Equal(t, []string{"user"}, probes.Groups())
+	assert.Equal(t, []check.ProbeRef{{Group: "user", Probe: "db"}, {Group: "user", Probe: "site"}}, probes.Probes())
+	assert.Equal(t, time.Minute, probes.Runners()[0].Period())
+	assert.Equal(t, 30*time.Second, probes.Runners()[1].Period())
+
+	// becomes invalid
+	probes.OnModify(newProbe("db", userprobe.Spec{}))
+	assert.Equal(t, []check.ProbeRef{{Group: "user", Probe: "site"}}, probes.Probes())
+
+	// becomes disabled
+	probes.OnAdd(db)
+	probes.filter = NewProbeFilter([]string{"user/db"})
+	probes.OnModify(db)
+	assert.Equal(t, []check.ProbeRef{{Group: "user", Probe: "site"}}, probes.Probes())
+
+	probes.OnDelete(site)
+	assert.Empty(t, probes.Runners())
+	assert.Empty(t, probes.Groups())
+}
+
+func Test_newUserProbeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    userprobe.Spec
+		check   string
+		wantErr bool
+	}{
+		{
+			name:  "http",
+			spec:  userprobe.Spec{HTTP: &userprobe.HTTPSpec{URL: "https://example.com", BodyRegex: "^ok$", TLSExpiryThreshold: "168h"}},
+			check: "http",
+		},
+		{
+			name:    "http with invalid regex",
+			spec:    userprobe.Spec{HTTP: &userprobe.HTTPSpec{URL: "https://example.com", BodyRegex: "("}},
+			wantErr: true,
+		},
+		{
+			name:  "tcp",
+			spec:  userprobe.Spec{TCP: &userprobe.TCPSpec{Address: "example.com:443", Timeout: "2s"}},
+			check: "tcp",
+		},
+		{
+			name:    "tcp with invalid timeout",
+			spec:    userprobe.Spec{TCP: &userprobe.TCPSpec{Address: "example.com:443", Timeout: "2"}},
+			wantErr: true,
+		},
+		{
+			name:  "dns",
+			spec:  userprobe.Spec{DNS: &userprobe.DNSSpec{Name: "example.com", Server: "8.8.8.8:53"}},
+			check: "dns",
+		},
+		{
+			name:    "no check",
+			spec:    userprobe.Spec{Interval: "10s"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := newUserProbeConfig(&userprobe.UpmeterProbe{ObjectMeta: metav1.ObjectMeta{Name: "p"}, Spec: tt.spec})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.check, rc.check)
+			assert.Equal(t, check.ProbeRef{Group: "user", Probe: "p"}, rc.Ref())
+		})
+	}
+}
@@ -29,19 +29,36 @@ type Registry struct {
 	// runners contains allowed check runners
 	runners []*check.Runner
 
+	// dynamic contains runners that can be added or removed in runtime
+	dynamic RunnerLister
+
 	// calculators contains calculators probes definitions
 	calculators []*calculated.Probe
 }
 
-func New(runLoader *probe.Loader, calcLoader *calculated.Loader) *Registry {
+// RunnerLister provides runners that change in runtime, e.g. probes defined by custom resources
+type RunnerLister interface {
+	Runners() []*check.Runner
+}
+
+func New(runLoader *probe.Loader, calcLoader *calculated.Loader, dynamic RunnerLister) *Registry {
 	return &Registry{
 		runners:     runLoader.Load(),
+		dynamic:     dynamic,
 		calculators: calcLoader.Load(),
 	}
 }
 
 func (r *Registry) Runners() []*check.Runner {
-	return r.runners
+	if r.dynamic == nil {
+		return r.runners
+	}
+
+	dynamic := r.dynamic.Runners()
+	runners := make([]*check.Runner, 0, len(r.runners)+len(dynamic))
+	runners = append(runners, r.runners...)
+	runners = append(runners, dynamic...)
+	return runners
 }
 
 func (r *Registry) Calculators() []*calculated.Probe {
@@ -53,28 +70,22 @@ type ProbeLister interface {
 	Probes() []check.ProbeRef
 }
 
-// NewProbeLister returns the lister of known groups and probes
+// NewProbeLister returns the lister of known groups and probes. Listers are queried on each call,
+// so the result follows listers with runtime changes.
 func NewProbeLister(listers ...ProbeLister) *RegistryProbeLister {
-	return &RegistryProbeLister{
-		groups: collectGroups(listers...),
-		probes: collectProbes(listers...),
-	}
+	return &RegistryProbeLister{listers: listers}
 }
 
 type RegistryProbeLister struct {
-	// groups contain loaded groups
-	groups []string
-
-	// probes refs of contain loaded probes
-	probes []check.ProbeRef
+	listers []ProbeLister
 }
 
 func (pl *RegistryProbeLister) Probes() []check.ProbeRef {
-	return pl.probes
+	return collectProbes(pl.listers...)
 }
 
 func (pl *RegistryProbeLister) Groups() []string {
-	return pl.groups
+	return collectGroups(pl.listers...)
 }
 
 func collectGroups(ls ...ProbeLister) []string {
@@ -0,0 +1,381 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"d8.io/upmeter/pkg/check"
+	dbcontext "d8.io/upmeter/pkg/db/context"
+	"d8.io/upmeter/pkg/db/dao"
+	"d8.io/upmeter/pkg/monitor/downtime"
+	"d8.io/upmeter/pkg/registry"
+	"d8.io/upmeter/pkg/server/entity"
+	"d8.io/upmeter/pkg/server/ranges"
+)
+
+type ReportResponse struct {
+	Period  entity.PeriodKind `json:"period"`
+	SLO     float64           `json:"slo"`
+	From    int64             `json:"from"`
+	To      int64             `json:"to"`
+	Rollups []entity.Rollup   `json:"rollups"`
+}
+
+// ReportHandler serves SLA reports with calendar month or quarter rollups for groups and probes
+type ReportHandler struct {
+	DbCtx           *dbcontext.DbContext
+	DowntimeMonitor *downtime.Monitor
+	ProbeLister     registry.ProbeLister
+	// SLO is the default target availability in percent
+	SLO float64
+}
+
+func (h *ReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Infoln("Report", r.RemoteAddr, r.RequestURI)
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "%d GET is required\n", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseReportFilter(r, h.SLO, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "%d Error: %s\n", http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := h.getReport(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "%d Error: %s\n", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if filter.format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", reportFileName(resp)))
+		if err := writeReportCSV(w, resp); err != nil {
+			log.Errorf("cannot write report: %v", err)
+		}
+		return
+	}
+
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "%d Error: %s\n", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(respJSON)
+}
+
+type reportFilter struct {
+	from, to          time.Time
+	period            entity.PeriodKind
+	slo               float64
+	format            string
+	probeRef          check.ProbeRef
+	muteDowntimeTypes []string
+}
+
+// parseReportFilter reads the query. 'from' and 'to' are months (2021-07) or unix timestamps, 'to' is exclusive.
+// By default, the report covers 12 calendar months including the current one.
+func parseReportFilter(r *http.Request, defaultSLO float64, now time.Time) (*reportFilter, error) {
+	query := r.URL.Query()
+	now = now.UTC()
+
+	filter := &reportFilter{
+		to:                now.Truncate(5 * time.Minute),
+		from:              time.Date(now.Year(), now.Month()-11, 1, 0, 0, 0, 0, time.UTC),
+		period:            entity.PeriodMonth,
+		slo:               defaultSLO,
+		format:            "json",
+		probeRef:          check.ProbeRef{Group: query.Get("group"), Probe: query.Get("probe")},
+		muteDowntimeTypes: parseDowntimeTypes(query.Get("muteDowntimeTypes")),
+	}
+
+	var err error
+	if arg := query.Get("from"); arg != "" {
+		filter.from, err = parseReportTime(arg, false)
+		if err != nil {
+			return nil, fmt.Errorf("from=%q: %v", arg, err)
+		}
+	}
+	if arg := query.Get("to"); arg != "" {
+		filter.to, err = parseReportTime(arg, true)
+		if err != nil {
+			return nil, fmt.Errorf("to=%q: %v", arg, err)
+		}
+	}
+	if !filter.from.Before(filter.to) {
+		return nil, fmt.Errorf("'from' should be before 'to'")
+	}
+
+	switch period := entity.PeriodKind(query.Get("period")); period {
+	case "":
+	case entity.PeriodMonth, entity.PeriodQuarter:
+		filter.period = period
+	default:
+		return nil, fmt.Errorf("period=%q is not one of: month, quarter", period)
+	}
+
+	if arg := query.Get("slo"); arg != "" {
+		filter.slo, err = strconv.ParseFloat(arg, 64)
+		if err != nil || filter.slo <= 0 || filter.slo > 100 {
+			return nil, fmt.Errorf("slo=%q is not a percentage", arg)
+		}
+	}
+
+	switch format := query.Get("format"); format {
+	case "":
+	case "json", "csv":
+		filter.format = format
+	default:
+		return nil, fmt.Errorf("format=%q is not one of: json, csv", format)
+	}
+
+	if filter.probeRef.Probe != "" && filter.probeRef.Group == "" {
+		return nil, fmt.Errorf("'group' is required when 'probe' is specified")
+	}
+
+	// force default filtering
+	if len(filter.muteDowntimeTypes) == 0 {
+		filter.muteDowntimeTypes = []string{
+			"Maintenance",
+			"InfrastructureMaintenance",
+			"InfrastructureAccident",
+		}
+	}
+
+	return filter, nil
+}
+
+// parseReportTime parses a month or a unix timestamp. The month is the end of the range when 'end' is true.
+func parseReportTime(s string, end bool) (time.Time, error) {
+	if month, err := time.Parse("2006-01", s); err == nil {
+		if end {
+			month = month.AddDate(0, 1, 0)
+		}
+		return month, nil
+	}
+
+	ts, err := parseTimestamp(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not a month (YYYY-MM) or a timestamp")
+	}
+	return time.Unix(ts, 0).UTC(), nil
+}
+
+func (h *ReportHandler) getReport(filter *reportFilter) (*ReportResponse, error) {
+	periods := entity.CalendarPeriods(filter.from, filter.to, filter.period)
+
+	// All periods are calculated at once as subranges of the step range
+	rng := ranges.StepRange{
+		From:      periods[0].Range.From,
+		To:        periods[len(periods)-1].Range.To,
+		Subranges: make([]ranges.Range, 0, len(periods)),
+	}
+	for _, p := range periods {
+		rng.Subranges = append(rng.Subranges, p.Range)
+	}
+
+	groups := h.ProbeLister.Groups()
+	if filter.probeRef.Group != "" {
+		groups = []string{filter.probeRef.Group}
+	}
+
+	allIncidents, err := h.DowntimeMonitor.List()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get incidents: %v", err)
+	}
+
+	rollups := make([]entity.Rollup, 0)
+	for _, group := range groups {
+		groupRollups, err := h.groupRollups(group, filter, periods, rng, allIncidents)
+		if err != nil {
+			return nil, fmt.Errorf("cannot calculate report for group %s: %v", group, err)
+		}
+		rollups = append(rollups, groupRollups...)
+	}
+
+	return &ReportResponse{
+		Period:  filter.period,
+		SLO:     filter.slo,
+		From:    rng.From,
+		To:      rng.To,
+		Rollups: rollups,
+	}, nil
+}
+
+// groupRollups returns rollups for the group total and its probes for each period
+func (h *ReportHandler) groupRollups(group string, filter *reportFilter, periods []entity.Period, rng ranges.StepRange, allIncidents []check.DowntimeIncident) ([]entity.Rollup, error) {
+	incidents := filterIncidents(allIncidents, incidentInRange(rng.From, rng.To), incidentAffectsGroup(group))
+	mutingIncidents := filterIncidents(incidents, incidentMutedByTypes(filter.muteDowntimeTypes))
+
+	refs := []check.ProbeRef{{Group: group, Probe: dao.GroupAggregation}}
+	if filter.probeRef.Probe != "" {
+		refs = []check.ProbeRef{filter.probeRef}
+	} else {
+		refs = append(refs, check.ProbeRef{Group: group, Probe: dao.ProbeEnumeration})
+	}
+
+	summaries := make(map[string][]entity.EpisodeSummary)
+	for _, ref := range refs {
+		statuses, err := entity.Statuses(h.DbCtx, ref, rng, mutingIncidents)
+		if err != nil {
+			return nil, err
+		}
+		for probe, s := range statuses[group] {
+			summaries[probe] = s
+		}
+	}
+
+	probes := make([]string, 0, len(summaries))
+	for probe := range summaries {
+		probes = append(probes, probe)
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		// the group total goes first
+		if probes[i] == dao.GroupAggregation || probes[j] == dao.GroupAggregation {
+			return probes[i] == dao.GroupAggregation
+		}
+		return probes[i] < probes[j]
+	})
+
+	rollups := make([]entity.Rollup, 0)
+	for _, period := range periods {
+		periodIncidents := newRollupIncidents(
+			filterIncidents(incidents, incidentInRange(period.Range.From, period.Range.To)),
+			filter.muteDowntimeTypes,
+		)
+
+		for _, probe := range probes {
+			summary, ok := findSummary(summaries[probe], period.Range.From)
+			if !ok {
+				continue
+			}
+			rollup := entity.NewRollup(period, check.ProbeRef{Group: group, Probe: probe}, summary, filter.slo)
+			rollup.Incidents = append(rollup.Incidents, periodIncidents...)
+			rollups = append(rollups, rollup)
+		}
+	}
+
+	return rollups, nil
+}
+
+func findSummary(summaries []entity.EpisodeSummary, timeslot int64) (entity.EpisodeSummary, bool) {
+	for _, s := range summaries {
+		if s.TimeSlot == timeslot {
+			return s, true
+		}
+	}
+	return entity.EpisodeSummary{}, false
+}
+
+func newRollupIncidents(incidents []check.DowntimeIncident, muteTypes []string) []entity.RollupIncident {
+	isMuted := incidentMutedByTypes(muteTypes)
+
+	res := make([]entity.RollupIncident, 0, len(incidents))
+	for _, inc := range incidents {
+		res = append(res, entity.RollupIncident{
+			Name:        inc.DowntimeName,
+			Type:        inc.Type,
+			Description: inc.Description,
+			Start:       inc.Start,
+			End:         inc.End,
+			Muted:       isMuted(inc),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start < res[j].Start })
+	return res
+}
+
+func reportFileName(resp *ReportResponse) string {
+	format := "2006-01-02"
+	return fmt.Sprintf("upmeter-report-%s-%s.csv",
+		time.Unix(resp.From, 0).UTC().Format(format),
+		time.Unix(resp.To, 0).UTC().Format(format))
+}
+
+var reportCSVHeader = []string{
+	"period", "from", "to", "group", "probe", "availability", "slo",
+	"up_seconds", "down_seconds", "unknown_seconds", "muted_seconds", "nodata_seconds",
+	"budget_seconds", "budget_remaining_seconds", "incidents",
+}
+
+// writeReportCSV writes a row per rollup. Incidents are joined in one column as "name: Type", muted ones are marked.
+func writeReportCSV(w io.Writer, resp *ReportResponse) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(reportCSVHeader); err != nil {
+		return err
+	}
+
+	formatTime := func(ts int64) string {
+		return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+	}
+	formatInt := func(i int64) string {
+		return strconv.FormatInt(i, 10)
+	}
+
+	for _, r := range resp.Rollups {
+		availability := ""
+		if r.Availability != nil {
+			availability = strconv.FormatFloat(*r.Availability, 'f', 4, 64)
+		}
+
+		incidents := make([]string, 0, len(r.Incidents))
+		for _, inc := range r.Incidents {
+			s := fmt.Sprintf("%s: %s", inc.Name, inc.Type)
+			if inc.Muted {
+				s += " (muted)"
+			}
+			incidents = append(incidents, s)
+		}
+
+		record := []string{
+			r.Period, formatTime(r.From), formatTime(r.To), r.Group, r.Probe, availability,
+			strconv.FormatFloat(resp.SLO, 'f', -1, 64),
+			formatInt(r.UpSeconds), formatInt(r.DownSeconds), formatInt(r.UnknownSeconds),
+			formatInt(r.MutedSeconds), formatInt(r.NoDataSeconds),
+			formatInt(r.BudgetSeconds), formatInt(r.BudgetRemainingSeconds),
+			strings.Join(incidents, "; "),
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"d8.io/upmeter/pkg/server/entity"
+)
+
+func Test_parseReportFilter(t *testing.T) {
+	now := time.Date(2021, 7, 15, 10, 3, 0, 0, time.UTC)
+
+	parse := func(query string) (*reportFilter, error) {
+		r := httptest.NewRequest("GET", "/api/report?"+query, nil)
+		return parseReportFilter(r, 99.9, now)
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		filter, err := parse("")
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC), filter.from)
+		assert.Equal(t, time.Date(2021, 7, 15, 10, 0, 0, 0, time.UTC), filter.to)
+		assert.Equal(t, entity.PeriodMonth, filter.period)
+		assert.Equal(t, 99.9, filter.slo)
+		assert.Equal(t, "json", filter.format)
+		assert.Equal(t, []string{"Maintenance", "InfrastructureMaintenance", "InfrastructureAccident"}, filter.muteDowntimeTypes)
+	})
+
+	t.Run("months are inclusive", func(t *testing.T) {
+		filter, err := parse("from=2021-01&to=2021-03&period=quarter&slo=99.5&format=csv&muteDowntimeTypes=Mnt!Acd")
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), filter.from)
+		assert.Equal(t, time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC), filter.to)
+		assert.Equal(t, entity.PeriodQuarter, filter.period)
+		assert.Equal(t, 99.5, filter.slo)
+		assert.Equal(t, "csv", filter.format)
+		assert.Equal(t, []string{"Maintenance", "Accident"}, filter.muteDowntimeTypes)
+	})
+
+	t.Run("timestamps", func(t *testing.T) {
+		filter, err := parse("from=1609459200&to=1612137600")
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), filter.from)
+		assert.Equal(t, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), filter.to)
+	})
+
+	for _, query := range []string{
+		"from=2021-13",
+		"from=2021-05&to=2021-04",
+		"period=week",
+		"slo=101",
+		"format=pdf",
+		"probe=dns",
+	} {
+		t.Run("invalid "+query, func(t *testing.T) {
+			_, err := parse(query)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_writeReportCSV(t *testing.T) {
+	availability := 99.95
+	resp := &ReportResponse{
+		Period: entity.PeriodMonth,
+		SLO:    99.9,
+		Rollups: []entity.Rollup{
+			{
+				Period:                 "2021-06",
+				From:                   1622505600,
+				To:                     1625097600,
+				Group:                  "synthetic",
+				Probe:                  "__total__",
+				Availability:           &availability,
+				UpSeconds:              2591000,
+				DownSeconds:            1000,
+				BudgetSeconds:          2592,
+				BudgetRemainingSeconds: 1592,
+				Incidents: []entity.RollupIncident{
+					{Name: "upgrade", Type: "Maintenance", Muted: true},
+					{Name: "outage", Type: "Accident"},
+				},
+			},
+			{
+				Period: "2021-06",
+				From:   1622505600,
+				To:     1625097600,
+				Group:  "synthetic",
+				Probe:  "dns",
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeReportCSV(buf, resp))
+
+	expected := "period,from,to,group,probe,availability,slo,up_seconds,down_seconds,unknown_seconds,muted_seconds,nodata_seconds,budget_seconds,budget_remaining_seconds,incidents\n" +
+		"2021-06,2021-06-01T00:00:00Z,2021-07-01T00:00:00Z,synthetic,__total__,99.9500,99.9,2591000,1000,0,0,0,2592,1592,upgrade: Maintenance (muted); outage: Accident\n" +
+		"2021-06,2021-06-01T00:00:00Z,2021-07-01T00:00:00Z,synthetic,dns,,99.9,0,0,0,0,0,0,0,\n"
+	assert.Equal(t, expected, buf.String())
+}
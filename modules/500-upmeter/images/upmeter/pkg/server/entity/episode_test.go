@@ -202,7 +202,7 @@ func newMemoryEpisodeDao30s(t *testing.T) *dao.EpisodeDao30s {
 		t.Fatalf("cannot create table: %v", err)
 	}
 
-	return dao.NewEpisodeDao30s(dbctx)
+	return dao.NewEpisodeDao30s(dbctx).(*dao.EpisodeDao30s)
 }
 
 func newMemoryEpisodeDao5m() *dao.EpisodeDao5m {
@@ -244,5 +244,5 @@ func newMemoryEpisodeDao5m() *dao.EpisodeDao5m {
 		panic(err)
 	}
 
-	return dao.NewEpisodeDao5m(dbctx)
+	return dao.NewEpisodeDao5m(dbctx).(*dao.EpisodeDao5m)
 }
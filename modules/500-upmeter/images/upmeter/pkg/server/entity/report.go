@@ -0,0 +1,145 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"time"
+
+	"d8.io/upmeter/pkg/check"
+	"d8.io/upmeter/pkg/server/ranges"
+)
+
+type PeriodKind string
+
+const (
+	PeriodMonth   PeriodKind = "month"
+	PeriodQuarter PeriodKind = "quarter"
+)
+
+// Period is a calendar month or quarter in UTC. The last period can be cut by the report end.
+type Period struct {
+	Name  string
+	Range ranges.Range
+}
+
+// CalendarPeriods splits [from, to) into calendar periods. The first period starts at the beginning
+// of the month or quarter containing 'from'.
+func CalendarPeriods(from, to time.Time, kind PeriodKind) []Period {
+	from, to = from.UTC(), to.UTC()
+
+	months := 1
+	if kind == PeriodQuarter {
+		months = 3
+	}
+
+	month := from.Month() - (from.Month()-1)%time.Month(months)
+	start := time.Date(from.Year(), month, 1, 0, 0, 0, 0, time.UTC)
+
+	periods := make([]Period, 0)
+	for start.Before(to) {
+		end := start.AddDate(0, months, 0)
+		rng := ranges.Range{From: start.Unix(), To: end.Unix()}
+		if end.After(to) {
+			rng.To = to.Unix()
+		}
+
+		periods = append(periods, Period{Name: periodName(start, kind), Range: rng})
+		start = end
+	}
+
+	return periods
+}
+
+func periodName(start time.Time, kind PeriodKind) string {
+	if kind == PeriodQuarter {
+		return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())-1)/3+1)
+	}
+	return start.Format("2006-01")
+}
+
+// Rollup is the SLA summary of a group or a probe for a calendar period. Muted time is excluded from
+// the availability calculation as well as unknown and missing data.
+type Rollup struct {
+	Period string `json:"period"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+	Group  string `json:"group"`
+	Probe  string `json:"probe"`
+
+	// Availability is the percentage of up time in the known time, it is absent when there is no data
+	Availability *float64 `json:"availability,omitempty"`
+
+	UpSeconds      int64 `json:"upSeconds"`
+	DownSeconds    int64 `json:"downSeconds"`
+	UnknownSeconds int64 `json:"unknownSeconds"`
+	MutedSeconds   int64 `json:"mutedSeconds"`
+	NoDataSeconds  int64 `json:"noDataSeconds"`
+
+	// BudgetSeconds is the downtime allowed by SLO for the known time
+	BudgetSeconds int64 `json:"budgetSeconds"`
+	// BudgetRemainingSeconds is negative when the SLO is violated
+	BudgetRemainingSeconds int64 `json:"budgetRemainingSeconds"`
+
+	Incidents []RollupIncident `json:"incidents"`
+}
+
+type RollupIncident struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Start       int64  `json:"start"`
+	End         int64  `json:"end"`
+	// Muted incidents are not counted as downtime
+	Muted bool `json:"muted"`
+}
+
+// NewRollup calculates availability and the downtime budget for the summary. SLO is a percentage, e.g. 99.9.
+func NewRollup(period Period, ref check.ProbeRef, summary EpisodeSummary, slo float64) Rollup {
+	known := summary.Known()
+	budget := time.Duration(float64(known) * (100 - slo) / 100)
+
+	rollup := Rollup{
+		Period: period.Name,
+		From:   period.Range.From,
+		To:     period.Range.To,
+		Group:  ref.Group,
+		Probe:  ref.Probe,
+
+		UpSeconds:      seconds(summary.Up),
+		DownSeconds:    seconds(summary.Down),
+		UnknownSeconds: seconds(summary.Unknown),
+		MutedSeconds:   seconds(summary.Muted),
+		NoDataSeconds:  seconds(summary.NoData),
+
+		BudgetSeconds:          seconds(budget),
+		BudgetRemainingSeconds: seconds(budget - summary.Down),
+
+		Incidents: make([]RollupIncident, 0),
+	}
+
+	if known > 0 {
+		availability := 100 * float64(summary.Up) / float64(known)
+		rollup.Availability = &availability
+	}
+
+	return rollup
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
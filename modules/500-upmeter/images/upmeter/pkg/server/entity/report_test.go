@@ -0,0 +1,108 @@
+/*
+Copyright 2021 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entity
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"d8.io/upmeter/pkg/server/ranges"
+)
+
+func Test_CalendarPeriods(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("months", func(t *testing.T) {
+		g := NewWithT(t)
+
+		periods := CalendarPeriods(date(2021, 11, 15), date(2022, 2, 10), PeriodMonth)
+
+		g.Expect(periods).To(Equal([]Period{
+			{Name: "2021-11", Range: ranges.Range{From: date(2021, 11, 1).Unix(), To: date(2021, 12, 1).Unix()}},
+			{Name: "2021-12", Range: ranges.Range{From: date(2021, 12, 1).Unix(), To: date(2022, 1, 1).Unix()}},
+			{Name: "2022-01", Range: ranges.Range{From: date(2022, 1, 1).Unix(), To: date(2022, 2, 1).Unix()}},
+			{Name: "2022-02", Range: ranges.Range{From: date(2022, 2, 1).Unix(), To: date(2022, 2, 10).Unix()}},
+		}))
+	})
+
+	t.Run("quarters", func(t *testing.T) {
+		g := NewWithT(t)
+
+		periods := CalendarPeriods(date(2021, 5, 15), date(2022, 1, 1), PeriodQuarter)
+
+		g.Expect(periods).To(Equal([]Period{
+			{Name: "2021-Q2", Range: ranges.Range{From: date(2021, 4, 1).Unix(), To: date(2021, 7, 1).Unix()}},
+			{Name: "2021-Q3", Range: ranges.Range{From: date(2021, 7, 1).Unix(), To: date(2021, 10, 1).Unix()}},
+			{Name: "2021-Q4", Range: ranges.Range{From: date(2021, 10, 1).Unix(), To: date(2022, 1, 1).Unix()}},
+		}))
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(CalendarPeriods(date(2021, 5, 1), date(2021, 5, 1), PeriodMonth)).To(BeEmpty())
+	})
+}
+
+func Test_NewRollup(t *testing.T) {
+	period := Period{Name: "2021-06", Range: ranges.Range{From: 0, To: 30 * 24 * 3600}}
+
+	t.Run("budget is partially spent", func(t *testing.T) {
+		g := NewWithT(t)
+
+		summary := EpisodeSummary{
+			Up:      9990 * time.Minute,
+			Down:    4 * time.Minute,
+			Unknown: 6 * time.Minute,
+			Muted:   time.Hour,
+		}
+
+		rollup := NewRollup(period, probeRef, summary, 99.9)
+
+		g.Expect(rollup.Availability).NotTo(BeNil())
+		g.Expect(*rollup.Availability).To(BeNumerically("~", 99.96, 0.001))
+		g.Expect(rollup.DownSeconds).To(BeEquivalentTo(240))
+		g.Expect(rollup.MutedSeconds).To(BeEquivalentTo(3600))
+		// 0.1% of 9994 minutes
+		g.Expect(rollup.BudgetSeconds).To(BeEquivalentTo(599))
+		g.Expect(rollup.BudgetRemainingSeconds).To(BeEquivalentTo(359))
+	})
+
+	t.Run("budget is exceeded", func(t *testing.T) {
+		g := NewWithT(t)
+
+		summary := EpisodeSummary{Up: 99 * time.Minute, Down: time.Minute}
+
+		rollup := NewRollup(period, probeRef, summary, 99.9)
+
+		g.Expect(*rollup.Availability).To(BeNumerically("~", 99, 0.001))
+		g.Expect(rollup.BudgetRemainingSeconds).To(BeNumerically("<", 0))
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		g := NewWithT(t)
+
+		rollup := NewRollup(period, probeRef, EpisodeSummary{NoData: 30 * 24 * time.Hour}, 99.9)
+
+		g.Expect(rollup.Availability).To(BeNil())
+		g.Expect(rollup.BudgetSeconds).To(BeZero())
+	})
+}
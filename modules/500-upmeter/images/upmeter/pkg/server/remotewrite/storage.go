@@ -27,7 +27,7 @@ import (
 type SyncIdentifier string // not to mess up with other string arguments
 
 type storage struct {
-	dao          *dao.ExportDAO
+	dao          dao.ExportEpisodes
 	originsCount int
 }
 
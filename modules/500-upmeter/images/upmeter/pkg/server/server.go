@@ -33,6 +33,7 @@ import (
 	"d8.io/upmeter/pkg/db/dao"
 	"d8.io/upmeter/pkg/kubernetes"
 	"d8.io/upmeter/pkg/monitor/downtime"
+	"d8.io/upmeter/pkg/monitor/userprobe"
 	"d8.io/upmeter/pkg/probe"
 	"d8.io/upmeter/pkg/probe/calculated"
 	"d8.io/upmeter/pkg/registry"
@@ -54,6 +55,7 @@ type server struct {
 
 	server                *http.Server
 	downtimeMonitor       *downtime.Monitor
+	userProbeMonitor      *userprobe.Monitor
 	remoteWriteController *remotewrite.Controller
 }
 
@@ -66,6 +68,9 @@ type Config struct {
 
 	OriginsCount int
 
+	// SLO is the target availability in percent for SLA reports
+	SLO float64
+
 	DisabledProbes []string
 	DynamicProbes  *DynamicProbesConfig
 }
@@ -117,13 +122,20 @@ func (s *server) Start(ctx context.Context) error {
 
 	go cleanOld30sEpisodes(ctx, dbctx)
 
+	// User-defined probes are known from UpmeterProbe CRs, agents run them
+	userProbes := probe.NewUserProbes(probe.NewProbeFilter(s.config.DisabledProbes), newDummyLogger())
+	s.userProbeMonitor, err = userprobe.StartMonitor(ctx, kubeClient, userProbes, log.NewEntry(s.logger))
+	if err != nil {
+		return fmt.Errorf("cannot start upmeterprobes.deckhouse.io monitor: %v", err)
+	}
+
 	// Probe lister that can only list groups and probes
-	probeLister := newProbeLister(s.config.DisabledProbes, s.config.DynamicProbes)
+	probeLister := newProbeLister(s.config.DisabledProbes, s.config.DynamicProbes, userProbes)
 
 	// Start http server. It blocks, that's why it is the last here.
 	s.logger.Debugf("starting HTTP server")
 	listenAddr := s.config.ListenHost + ":" + s.config.ListenPort
-	s.server = initHttpServer(dbctx, s.downtimeMonitor, s.remoteWriteController, probeLister, listenAddr)
+	s.server = initHttpServer(dbctx, s.downtimeMonitor, s.remoteWriteController, probeLister, s.config.SLO, listenAddr)
 
 	err = s.server.ListenAndServe()
 	if err == http.ErrServerClosed {
@@ -140,6 +152,7 @@ func (s *server) Stop() error {
 	}
 	s.remoteWriteController.Stop()
 	s.downtimeMonitor.Stop()
+	s.userProbeMonitor.Stop()
 
 	return nil
 }
@@ -170,13 +183,14 @@ func cleanOld30sEpisodes(ctx context.Context, dbCtx *dbcontext.DbContext) {
 	}
 }
 
-func initHttpServer(dbCtx *dbcontext.DbContext, downtimeMonitor *downtime.Monitor, controller *remotewrite.Controller, probeLister registry.ProbeLister, addr string) *http.Server {
+func initHttpServer(dbCtx *dbcontext.DbContext, downtimeMonitor *downtime.Monitor, controller *remotewrite.Controller, probeLister registry.ProbeLister, slo float64, addr string) *http.Server {
 	mux := http.NewServeMux()
 
 	// Setup API handlers
 	mux.Handle("/api/probe", &api.ProbeListHandler{DbCtx: dbCtx, ProbeLister: probeLister})
 	mux.Handle("/api/status/range", &api.StatusRangeHandler{DbCtx: dbCtx, DowntimeMonitor: downtimeMonitor})
 	mux.Handle("/public/api/status", &api.PublicStatusHandler{DbCtx: dbCtx, DowntimeMonitor: downtimeMonitor, ProbeLister: probeLister})
+	mux.Handle("/api/report", &api.ReportHandler{DbCtx: dbCtx, DowntimeMonitor: downtimeMonitor, ProbeLister: probeLister, SLO: slo})
 	mux.Handle("/downtime", &api.AddEpisodesHandler{DbCtx: dbCtx, RemoteWrite: controller})
 	mux.Handle("/stats", &api.StatsHandler{DbCtx: dbCtx})
 	// Kubernetes probes
@@ -216,7 +230,7 @@ func initDowntimeMonitor(ctx context.Context, kubeClient kube.Client, logger *lo
 	return m, m.Start(ctx)
 }
 
-func newProbeLister(disabled []string, dynamic *DynamicProbesConfig) *registry.RegistryProbeLister {
+func newProbeLister(disabled []string, dynamic *DynamicProbesConfig, userProbes *probe.UserProbes) *registry.RegistryProbeLister {
 	noLogger := newDummyLogger()
 	noFilter := probe.NewProbeFilter(disabled)
 	noAccess := &kubernetes.Accessor{}
@@ -227,7 +241,7 @@ func newProbeLister(disabled []string, dynamic *DynamicProbesConfig) *registry.R
 	runLoader := probe.NewLoader(noFilter, noAccess, nil, dynamicConfig, noLogger)
 	calcLoader := calculated.NewLoader(noFilter, noLogger)
 
-	return registry.NewProbeLister(runLoader, calcLoader)
+	return registry.NewProbeLister(runLoader, calcLoader, userProbes)
 }
 
 func newDummyLogger() *log.Logger {
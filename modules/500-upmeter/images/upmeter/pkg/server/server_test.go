@@ -20,13 +20,16 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"d8.io/upmeter/pkg/check"
+	"d8.io/upmeter/pkg/monitor/userprobe"
+	"d8.io/upmeter/pkg/probe"
 )
 
 // Test how all the known probes and groups are presented
 func Test_newProbeLister(t *testing.T) {
-	pl := newProbeLister([]string{}, &DynamicProbesConfig{})
+	pl := newProbeLister([]string{}, &DynamicProbesConfig{}, probe.NewUserProbes(probe.NewProbeFilter([]string{}), newDummyLogger()))
 
 	allProbesSorted := []check.ProbeRef{
 		{Group: "control-plane", Probe: "apiserver"},
@@ -76,7 +79,7 @@ func Test_newProbeLister_with_dynamic(t *testing.T) {
 	pl := newProbeLister([]string{}, &DynamicProbesConfig{
 		IngressControllers: []string{"main", "main-w-pp"},
 		NodeGroups:         []string{"system", "frontend", "worker"},
-	})
+	}, probe.NewUserProbes(probe.NewProbeFilter([]string{}), newDummyLogger()))
 
 	allProbesSorted := []check.ProbeRef{
 		{Group: "control-plane", Probe: "apiserver"},
@@ -127,3 +130,19 @@ func Test_newProbeLister_with_dynamic(t *testing.T) {
 	assert.Equal(t, allProbesSorted, pl.Probes())
 	assert.Equal(t, allGroupsSorted, pl.Groups())
 }
+
+// Test that probes from UpmeterProbe resources are listed as they come
+func Test_newProbeLister_with_user_probes(t *testing.T) {
+	userProbes := probe.NewUserProbes(probe.NewProbeFilter([]string{}), newDummyLogger())
+	pl := newProbeLister([]string{}, &DynamicProbesConfig{}, userProbes)
+
+	assert.NotContains(t, pl.Groups(), "user")
+
+	userProbes.OnAdd(&userprobe.UpmeterProbe{
+		ObjectMeta: metav1.ObjectMeta{Name: "site"},
+		Spec:       userprobe.Spec{HTTP: &userprobe.HTTPSpec{URL: "https://example.com"}},
+	})
+
+	assert.Contains(t, pl.Groups(), "user")
+	assert.Contains(t, pl.Probes(), check.ProbeRef{Group: "user", Probe: "site"})
+}
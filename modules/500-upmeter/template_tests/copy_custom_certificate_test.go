@@ -77,6 +77,7 @@ auth:
   webui:
     password: zx
 disabledProbes: []
+replicas: 1
 https:
   mode: CustomCertificate
 internal:
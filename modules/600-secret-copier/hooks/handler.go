@@ -95,6 +95,25 @@ func ApplyCopierNamespaceFilter(obj *unstructured.Unstructured) (go_hook.FilterR
 	return n, nil
 }
 
+var copierNamespacesK8sConfig = go_hook.KubernetesConfig{
+	Name:       "namespaces",
+	ApiVersion: "v1",
+	Kind:       "Namespace",
+	LabelSelector: &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{
+				Key:      "heritage",
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values: []string{
+					"upmeter",
+				},
+			},
+		},
+	},
+	FilterFunc:             ApplyCopierNamespaceFilter,
+	WaitForSynchronization: go_hook.Bool(false),
+}
+
 var _ = sdk.RegisterFunc(&go_hook.HookConfig{
 	Settings: &go_hook.HookConfigSettings{
 		ExecutionMinInterval: 5 * time.Second,
@@ -117,24 +136,7 @@ var _ = sdk.RegisterFunc(&go_hook.HookConfig{
 			FilterFunc:             ApplyCopierSecretFilter,
 			WaitForSynchronization: go_hook.Bool(false),
 		},
-		{
-			Name:       "namespaces",
-			ApiVersion: "v1",
-			Kind:       "Namespace",
-			LabelSelector: &metav1.LabelSelector{
-				MatchExpressions: []metav1.LabelSelectorRequirement{
-					{
-						Key:      "heritage",
-						Operator: metav1.LabelSelectorOpNotIn,
-						Values: []string{
-							"upmeter",
-						},
-					},
-				},
-			},
-			FilterFunc:             ApplyCopierNamespaceFilter,
-			WaitForSynchronization: go_hook.Bool(false),
-		},
+		copierNamespacesK8sConfig,
 	},
 }, dependency.WithExternalDependencies(copierHandler))
 
@@ -214,6 +216,10 @@ func copierHandler(input *go_hook.HookInput, dc dependency.Container) error {
 		}
 		// Secret not exists, create it.
 		err := createOrUpdateSecret(k8, secretDesired)
+		if err == errSecretNotManaged {
+			input.LogEntry.Warnf("Secret %s exists and is not managed by secret-copier, skip it", path)
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -222,15 +228,22 @@ func copierHandler(input *go_hook.HookInput, dc dependency.Container) error {
 	return nil
 }
 
+// errSecretNotManaged is returned for Secrets without the secret-copier label, they are never overwritten.
+var errSecretNotManaged = fmt.Errorf("secret is not managed by secret-copier")
+
 // todo(31337Ghost) consider switching to separate create/update functions after a bug is fixed in shell-operator that causes missing Secrets in snapshots
 func createOrUpdateSecret(k8 k8s.Client, secret *Secret) error {
-	_, err := k8.CoreV1().Secrets(secret.Namespace).Get(context.TODO(), secret.Name, metav1.GetOptions{})
+	existing, err := k8.CoreV1().Secrets(secret.Namespace).Get(context.TODO(), secret.Name, metav1.GetOptions{})
 	if errors.IsNotFound(err) {
 		return createSecret(k8, secret)
 	} else if err != nil {
 		return err
 	}
 
+	if _, ok := existing.Labels[secretCopierEnableKey]; !ok {
+		return errSecretNotManaged
+	}
+
 	return updateSecret(k8, secret)
 }
 
@@ -391,4 +391,44 @@ data:
 			Expect(err).ToNot(BeNil())
 		})
 	})
+
+	Context("Target namespace has an unmanaged Secret with the same name", func() {
+		BeforeEach(func() {
+			var unmanaged *corev1.Secret
+			_ = yaml.Unmarshal([]byte(`
+apiVersion: v1
+kind: Secret
+type: Opaque
+metadata:
+  name: s2
+  namespace: ns1
+data:
+  supersecret: b3du
+`), &unmanaged)
+			unmanagedYAML, _ := yaml.Marshal(&unmanaged)
+			nsYAML1, _ := yaml.Marshal(&ns1)
+			nsYAML2, _ := yaml.Marshal(&ns2)
+			secretOriginalYAML2, _ := yaml.Marshal(&secretOriginal2)
+
+			f.BindingContexts.Set(f.KubeStateSet(strings.Join([]string{
+				string(nsYAML1),
+				string(nsYAML2),
+				string(secretOriginalYAML2),
+				string(unmanagedYAML),
+			}, "---\n")))
+
+			_, _ = f.KubeClient().CoreV1().Secrets(secretOriginal2.Namespace).Create(context.TODO(), secretOriginal2, metav1.CreateOptions{})
+			_, _ = f.KubeClient().CoreV1().Secrets(unmanaged.Namespace).Create(context.TODO(), unmanaged, metav1.CreateOptions{})
+
+			f.RunHook()
+		})
+
+		It("Unmanaged Secret must not be overwritten", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			s, err := f.KubeClient().CoreV1().Secrets("ns1").Get(context.TODO(), "s2", metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			Expect(string(s.Data["supersecret"])).To(Equal("own"))
+		})
+	})
 })
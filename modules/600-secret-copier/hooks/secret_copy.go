@@ -0,0 +1,564 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/flant/addon-operator/pkg/module_manager/go_hook"
+	"github.com/flant/addon-operator/sdk"
+	"github.com/flant/shell-operator/pkg/kube/object_patch"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/deckhouse/deckhouse/go_lib/dependency"
+	"github.com/deckhouse/deckhouse/go_lib/dependency/k8s"
+)
+
+// SecretCopy copies the source Secret or ConfigMap to the target namespaces. Copies are marked with
+// the secretCopyLabel, objects without it are never overwritten or deleted, and copies themselves
+// cannot be sources to prevent syncing them back.
+
+const (
+	secretCopyLabel = "secret-copier.deckhouse.io/secret-copy"
+
+	secretCopyKindSecret    = "Secret"
+	secretCopyKindConfigMap = "ConfigMap"
+)
+
+type SecretCopySpec struct {
+	Kind   string `json:"kind"`
+	Source struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"source"`
+	TargetNamespaces struct {
+		LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	} `json:"targetNamespaces"`
+	Keys SecretCopyKeys `json:"keys"`
+}
+
+type SecretCopyKeys struct {
+	Include []string          `json:"include,omitempty"`
+	Exclude []string          `json:"exclude,omitempty"`
+	Rename  map[string]string `json:"rename,omitempty"`
+}
+
+type SecretCopyConflict struct {
+	Namespace string `json:"namespace"`
+	Reason    string `json:"reason"`
+}
+
+type SecretCopyStatus struct {
+	SyncedNamespaces []string             `json:"syncedNamespaces"`
+	Conflicts        []SecretCopyConflict `json:"conflicts"`
+	Message          string               `json:"message,omitempty"`
+}
+
+type SecretCopy struct {
+	Name   string
+	Spec   SecretCopySpec
+	Status SecretCopyStatus
+}
+
+// CopiedObject is a Secret or a ConfigMap copied by a SecretCopy.
+type CopiedObject struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Owner is the name of the SecretCopy.
+	Owner string
+	Type  v1.SecretType
+	// Data is the data of Secrets and the binary data of ConfigMaps.
+	Data map[string][]byte
+	// StringData is the data of ConfigMaps.
+	StringData map[string]string
+}
+
+func copiedObjectPath(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+func (o *CopiedObject) Path() string {
+	return copiedObjectPath(o.Kind, o.Namespace, o.Name)
+}
+
+func applySecretCopyFilter(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	var sc struct {
+		Spec   SecretCopySpec   `json:"spec"`
+		Status SecretCopyStatus `json:"status"`
+	}
+	err := sdk.FromUnstructured(obj, &sc)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc.Spec.Kind == "" {
+		sc.Spec.Kind = secretCopyKindSecret
+	}
+	if sc.Status.SyncedNamespaces == nil {
+		sc.Status.SyncedNamespaces = []string{}
+	}
+	if sc.Status.Conflicts == nil {
+		sc.Status.Conflicts = []SecretCopyConflict{}
+	}
+
+	return &SecretCopy{
+		Name:   obj.GetName(),
+		Spec:   sc.Spec,
+		Status: sc.Status,
+	}, nil
+}
+
+func applyCopiedSecretFilter(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	secret := &v1.Secret{}
+	err := sdk.FromUnstructured(obj, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CopiedObject{
+		Kind:      secretCopyKindSecret,
+		Namespace: secret.Namespace,
+		Name:      secret.Name,
+		Owner:     secret.Labels[secretCopyLabel],
+		Type:      secret.Type,
+		Data:      secret.Data,
+	}, nil
+}
+
+func applyCopiedConfigMapFilter(obj *unstructured.Unstructured) (go_hook.FilterResult, error) {
+	cm := &v1.ConfigMap{}
+	err := sdk.FromUnstructured(obj, cm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CopiedObject{
+		Kind:       secretCopyKindConfigMap,
+		Namespace:  cm.Namespace,
+		Name:       cm.Name,
+		Owner:      cm.Labels[secretCopyLabel],
+		Data:       cm.BinaryData,
+		StringData: cm.Data,
+	}, nil
+}
+
+var copiedObjectsLabelSelector = &metav1.LabelSelector{
+	MatchExpressions: []metav1.LabelSelectorRequirement{
+		{
+			Key:      secretCopyLabel,
+			Operator: metav1.LabelSelectorOpExists,
+		},
+	},
+}
+
+var _ = sdk.RegisterFunc(&go_hook.HookConfig{
+	Settings: &go_hook.HookConfigSettings{
+		ExecutionMinInterval: 5 * time.Second,
+		ExecutionBurst:       3,
+	},
+	Queue: "/modules/secret-copier",
+	// sources are not watched, changes are propagated by schedule
+	Schedule: []go_hook.ScheduleConfig{
+		{
+			Name:    "sync-secret-copies",
+			Crontab: "* * * * *",
+		},
+	},
+	Kubernetes: []go_hook.KubernetesConfig{
+		{
+			Name:       "secret_copies",
+			ApiVersion: "deckhouse.io/v1alpha1",
+			Kind:       "SecretCopy",
+			FilterFunc: applySecretCopyFilter,
+		},
+		copierNamespacesK8sConfig,
+		{
+			Name:                   "copied_secrets",
+			ApiVersion:             "v1",
+			Kind:                   "Secret",
+			LabelSelector:          copiedObjectsLabelSelector,
+			FilterFunc:             applyCopiedSecretFilter,
+			WaitForSynchronization: go_hook.Bool(false),
+		},
+		{
+			Name:                   "copied_configmaps",
+			ApiVersion:             "v1",
+			Kind:                   "ConfigMap",
+			LabelSelector:          copiedObjectsLabelSelector,
+			FilterFunc:             applyCopiedConfigMapFilter,
+			WaitForSynchronization: go_hook.Bool(false),
+		},
+	},
+}, dependency.WithExternalDependencies(secretCopyHandler))
+
+func secretCopyHandler(input *go_hook.HookInput, dc dependency.Container) error {
+	copies := make([]*SecretCopy, 0, len(input.Snapshots["secret_copies"]))
+	copyNames := make(map[string]bool)
+	for _, s := range input.Snapshots["secret_copies"] {
+		sc := s.(*SecretCopy)
+		copies = append(copies, sc)
+		copyNames[sc.Name] = true
+	}
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Name < copies[j].Name })
+
+	namespaces := make([]*Namespace, 0, len(input.Snapshots["namespaces"]))
+	for _, n := range input.Snapshots["namespaces"] {
+		namespaces = append(namespaces, n.(*Namespace))
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+
+	existing := make(map[string]*CopiedObject)
+	for _, snap := range [][]go_hook.FilterResult{input.Snapshots["copied_secrets"], input.Snapshots["copied_configmaps"]} {
+		for _, o := range snap {
+			obj := o.(*CopiedObject)
+			existing[obj.Path()] = obj
+		}
+	}
+
+	if len(copies) == 0 && len(existing) == 0 {
+		return nil
+	}
+
+	k8, err := dc.GetK8sClient()
+	if err != nil {
+		return fmt.Errorf("can't init Kubernetes client: %v", err)
+	}
+
+	desired := make(map[string]*CopiedObject)
+	// copies of the SecretCopy that cannot be synced now are kept as is
+	keepOwners := make(map[string]bool)
+
+	for _, sc := range copies {
+		status := SecretCopyStatus{
+			SyncedNamespaces: []string{},
+			Conflicts:        []SecretCopyConflict{},
+		}
+
+		objects, err := secretCopyDesiredObjects(k8, sc, namespaces)
+		switch err.(type) {
+		case nil:
+		case secretCopySourceNotFound:
+			status.Message = err.Error()
+		case secretCopyError:
+			status.Message = err.Error()
+			keepOwners[sc.Name] = true
+		default:
+			return err
+		}
+
+		for _, obj := range objects {
+			path := obj.Path()
+
+			if owner := desired[path]; owner != nil {
+				status.Conflicts = append(status.Conflicts, SecretCopyConflict{
+					Namespace: obj.Namespace,
+					Reason:    fmt.Sprintf("%s is copied by SecretCopy %s", obj.Name, owner.Owner),
+				})
+				continue
+			}
+
+			if cur, ok := existing[path]; ok {
+				if cur.Owner != sc.Name && copyNames[cur.Owner] {
+					status.Conflicts = append(status.Conflicts, SecretCopyConflict{
+						Namespace: obj.Namespace,
+						Reason:    fmt.Sprintf("%s is copied by SecretCopy %s", obj.Name, cur.Owner),
+					})
+					continue
+				}
+			} else {
+				exists, err := copyTargetExists(k8, obj)
+				if err != nil {
+					return err
+				}
+				if exists {
+					status.Conflicts = append(status.Conflicts, SecretCopyConflict{
+						Namespace: obj.Namespace,
+						Reason:    fmt.Sprintf("%s %s exists and is not managed by secret-copier", obj.Kind, obj.Name),
+					})
+					continue
+				}
+			}
+
+			desired[path] = obj
+			status.SyncedNamespaces = append(status.SyncedNamespaces, obj.Namespace)
+		}
+
+		if !reflect.DeepEqual(status, sc.Status) {
+			patchSecretCopyStatus(input, sc.Name, status)
+		}
+	}
+
+	for path, obj := range existing {
+		if _, ok := desired[path]; ok || keepOwners[obj.Owner] {
+			continue
+		}
+		input.PatchCollector.Delete("v1", obj.Kind, obj.Namespace, obj.Name)
+	}
+
+	for path, obj := range desired {
+		cur, ok := existing[path]
+		if ok && reflect.DeepEqual(cur, obj) {
+			continue
+		}
+		if ok && cur.Type != obj.Type {
+			// the type of Secrets is immutable
+			input.PatchCollector.Delete("v1", obj.Kind, obj.Namespace, obj.Name)
+		}
+		input.PatchCollector.Create(obj.toKubernetesObject(), object_patch.UpdateIfExists())
+	}
+
+	return nil
+}
+
+// secretCopyError is the SecretCopy misconfiguration, it is reported in the status.
+type secretCopyError string
+
+func (e secretCopyError) Error() string {
+	return string(e)
+}
+
+// secretCopySourceNotFound is reported in the status, copies of the deleted source are deleted too.
+type secretCopySourceNotFound string
+
+func (e secretCopySourceNotFound) Error() string {
+	return string(e)
+}
+
+func secretCopyDesiredObjects(k8 k8s.Client, sc *SecretCopy, namespaces []*Namespace) ([]*CopiedObject, error) {
+	source, err := getSecretCopySource(k8, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := labels.Everything()
+	if sc.Spec.TargetNamespaces.LabelSelector != nil {
+		selector, err = metav1.LabelSelectorAsSelector(sc.Spec.TargetNamespaces.LabelSelector)
+		if err != nil {
+			return nil, secretCopyError(fmt.Sprintf("invalid target namespaces selector: %v", err))
+		}
+	}
+
+	objects := make([]*CopiedObject, 0)
+	for _, ns := range namespaces {
+		if ns.IsTerminating || ns.Name == sc.Spec.Source.Namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(ns.Labels)) {
+			continue
+		}
+
+		obj := *source
+		obj.Namespace = ns.Name
+		objects = append(objects, &obj)
+	}
+
+	return objects, nil
+}
+
+// getSecretCopySource returns the source object with the filtered keys, it returns nil if the source does not exist.
+func getSecretCopySource(k8 k8s.Client, sc *SecretCopy) (*CopiedObject, error) {
+	ns, name := sc.Spec.Source.Namespace, sc.Spec.Source.Name
+	source := &CopiedObject{
+		Kind:  sc.Spec.Kind,
+		Name:  name,
+		Owner: sc.Name,
+	}
+
+	var sourceLabels map[string]string
+	switch sc.Spec.Kind {
+	case secretCopyKindSecret:
+		secret, err := k8.CoreV1().Secrets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil, secretCopySourceNotFound(fmt.Sprintf("source Secret %s/%s not found", ns, name))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't get source secret object `%s/%s`: %v", ns, name, err)
+		}
+		sourceLabels = secret.Labels
+		source.Type = secret.Type
+		source.Data = secret.Data
+
+	case secretCopyKindConfigMap:
+		cm, err := k8.CoreV1().ConfigMaps(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil, secretCopySourceNotFound(fmt.Sprintf("source ConfigMap %s/%s not found", ns, name))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't get source configmap object `%s/%s`: %v", ns, name, err)
+		}
+		sourceLabels = cm.Labels
+		source.Data = cm.BinaryData
+		source.StringData = cm.Data
+
+	default:
+		return nil, secretCopyError(fmt.Sprintf("unknown kind %q", sc.Spec.Kind))
+	}
+
+	if owner, ok := sourceLabels[secretCopyLabel]; ok {
+		return nil, secretCopyError(fmt.Sprintf("source %s %s/%s is a copy made by SecretCopy %s", sc.Spec.Kind, ns, name, owner))
+	}
+
+	if err := filterSecretCopyData(source, sc.Spec.Keys); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// secretCopyKeys returns the source keys to copy by the key in the copy.
+func secretCopyKeys(sourceKeys []string, keys SecretCopyKeys) (map[string]string, error) {
+	include := make(map[string]bool, len(keys.Include))
+	for _, k := range keys.Include {
+		include[k] = true
+	}
+	exclude := make(map[string]bool, len(keys.Exclude))
+	for _, k := range keys.Exclude {
+		exclude[k] = true
+	}
+
+	sort.Strings(sourceKeys)
+
+	result := make(map[string]string, len(sourceKeys))
+	for _, key := range sourceKeys {
+		if len(include) > 0 && !include[key] {
+			continue
+		}
+		if exclude[key] {
+			continue
+		}
+
+		newKey := key
+		if k, ok := keys.Rename[key]; ok {
+			newKey = k
+		}
+		if from, ok := result[newKey]; ok {
+			return nil, secretCopyError(fmt.Sprintf("keys %q and %q are both copied as %q", from, key, newKey))
+		}
+
+		result[newKey] = key
+	}
+
+	return result, nil
+}
+
+// filterSecretCopyData applies the keys filter to the data and the string data of the source object.
+func filterSecretCopyData(obj *CopiedObject, keys SecretCopyKeys) error {
+	sourceKeys := make([]string, 0, len(obj.Data)+len(obj.StringData))
+	for k := range obj.Data {
+		sourceKeys = append(sourceKeys, k)
+	}
+	for k := range obj.StringData {
+		sourceKeys = append(sourceKeys, k)
+	}
+
+	mapping, err := secretCopyKeys(sourceKeys, keys)
+	if err != nil {
+		return err
+	}
+
+	var data map[string][]byte
+	var stringData map[string]string
+	for newKey, key := range mapping {
+		if value, ok := obj.Data[key]; ok {
+			if data == nil {
+				data = make(map[string][]byte)
+			}
+			data[newKey] = value
+			continue
+		}
+		if stringData == nil {
+			stringData = make(map[string]string)
+		}
+		stringData[newKey] = obj.StringData[key]
+	}
+
+	// nil for empty data to compare with copies read back from the cluster
+	obj.Data = data
+	obj.StringData = stringData
+
+	return nil
+}
+
+func copyTargetExists(k8 k8s.Client, obj *CopiedObject) (bool, error) {
+	var err error
+	switch obj.Kind {
+	case secretCopyKindSecret:
+		_, err = k8.CoreV1().Secrets(obj.Namespace).Get(context.TODO(), obj.Name, metav1.GetOptions{})
+	case secretCopyKindConfigMap:
+		_, err = k8.CoreV1().ConfigMaps(obj.Namespace).Get(context.TODO(), obj.Name, metav1.GetOptions{})
+	}
+
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("can't get %s object `%s/%s`: %v", obj.Kind, obj.Namespace, obj.Name, err)
+	}
+
+	return true, nil
+}
+
+func (o *CopiedObject) toKubernetesObject() interface{} {
+	meta := metav1.ObjectMeta{
+		Name:      o.Name,
+		Namespace: o.Namespace,
+		Labels:    map[string]string{secretCopyLabel: o.Owner},
+	}
+
+	if o.Kind == secretCopyKindConfigMap {
+		return &v1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: meta,
+			Data:       o.StringData,
+			BinaryData: o.Data,
+		}
+	}
+
+	return &v1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: meta,
+		Type:       o.Type,
+		Data:       o.Data,
+	}
+}
+
+func patchSecretCopyStatus(input *go_hook.HookInput, name string, status SecretCopyStatus) {
+	// the message is removed from the status with the explicit null
+	var message interface{}
+	if status.Message != "" {
+		message = status.Message
+	}
+
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"syncedNamespaces": status.SyncedNamespaces,
+			"conflicts":        status.Conflicts,
+			"message":          message,
+		},
+	}
+
+	input.PatchCollector.MergePatch(patch, "deckhouse.io/v1alpha1", "SecretCopy", "", name, object_patch.WithSubresource("/status"))
+}
@@ -0,0 +1,384 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	. "github.com/deckhouse/deckhouse/testing/hooks"
+)
+
+var _ = Describe("Modules :: secret-copier :: hooks :: secret_copy ::", func() {
+	const (
+		namespaces = `
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: d8-system
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns1
+  labels:
+    team: a
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns2
+  labels:
+    team: b
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns3
+status:
+  phase: Terminating
+`
+		// .dockerconfigjson: {"auths":{}}, token: abc
+		registrySecret = `
+---
+apiVersion: v1
+kind: Secret
+type: kubernetes.io/dockerconfigjson
+metadata:
+  name: registry
+  namespace: d8-system
+data:
+  .dockerconfigjson: eyJhdXRocyI6e319
+  token: YWJj
+`
+		registrySecretCopy = `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: SecretCopy
+metadata:
+  name: registry
+spec:
+  source:
+    namespace: d8-system
+    name: registry
+  keys:
+    include:
+    - .dockerconfigjson
+`
+	)
+
+	f := HookExecutionConfigInit(`{}`, `{}`)
+	f.RegisterCRD("deckhouse.io", "v1alpha1", "SecretCopy", false)
+
+	runHook := func(state string) {
+		f.BindingContexts.Set(f.KubeStateSet(state))
+
+		// the hook gets sources and unmanaged objects with the typed client
+		for _, doc := range strings.Split(state, "---") {
+			var obj metav1.TypeMeta
+			_ = yaml.Unmarshal([]byte(doc), &obj)
+			switch obj.Kind {
+			case "Secret":
+				var secret *corev1.Secret
+				_ = yaml.Unmarshal([]byte(doc), &secret)
+				_, _ = f.KubeClient().CoreV1().Secrets(secret.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+			case "ConfigMap":
+				var cm *corev1.ConfigMap
+				_ = yaml.Unmarshal([]byte(doc), &cm)
+				_, _ = f.KubeClient().CoreV1().ConfigMaps(cm.Namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+			}
+		}
+
+		f.BindingContexts.Set(f.GenerateScheduleContext("* * * * *"))
+		f.RunHook()
+	}
+
+	Context("Empty cluster", func() {
+		BeforeEach(func() {
+			runHook(``)
+		})
+
+		It("Hook must not fail", func() {
+			Expect(f).To(ExecuteSuccessfully())
+		})
+	})
+
+	Context("SecretCopy with included keys", func() {
+		BeforeEach(func() {
+			runHook(namespaces + registrySecret + registrySecretCopy)
+		})
+
+		It("Only .dockerconfigjson must be copied to all namespaces but the source and terminating ones", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			for _, ns := range []string{"ns1", "ns2"} {
+				s := f.KubernetesResource("Secret", ns, "registry")
+				Expect(s.Exists()).To(BeTrue())
+				Expect(s.Field("type").String()).To(Equal("kubernetes.io/dockerconfigjson"))
+				Expect(s.Field("data").Map()).To(HaveLen(1))
+				Expect(s.Field(`data.\.dockerconfigjson`).String()).To(Equal("eyJhdXRocyI6e319"))
+				Expect(s.Field(`metadata.labels.secret-copier\.deckhouse\.io/secret-copy`).String()).To(Equal("registry"))
+			}
+			Expect(f.KubernetesResource("Secret", "ns3", "registry").Exists()).To(BeFalse())
+
+			sc := f.KubernetesGlobalResource("SecretCopy", "registry")
+			Expect(sc.Field("status.syncedNamespaces").String()).To(MatchJSON(`["ns1","ns2"]`))
+			Expect(sc.Field("status.conflicts").String()).To(MatchJSON(`[]`))
+		})
+
+		Context("Source is deleted", func() {
+			BeforeEach(func() {
+				_ = f.KubeClient().CoreV1().Secrets("d8-system").Delete(context.TODO(), "registry", metav1.DeleteOptions{})
+				runHook(namespaces + registrySecretCopy)
+			})
+
+			It("Copies must be deleted, the status must have a message", func() {
+				Expect(f).To(ExecuteSuccessfully())
+
+				Expect(f.KubernetesResource("Secret", "ns1", "registry").Exists()).To(BeFalse())
+				Expect(f.KubernetesResource("Secret", "ns2", "registry").Exists()).To(BeFalse())
+
+				sc := f.KubernetesGlobalResource("SecretCopy", "registry")
+				Expect(sc.Field("status.syncedNamespaces").String()).To(MatchJSON(`[]`))
+				Expect(sc.Field("status.message").String()).To(Equal("source Secret d8-system/registry not found"))
+			})
+		})
+
+		Context("SecretCopy is deleted", func() {
+			BeforeEach(func() {
+				runHook(namespaces + registrySecret)
+			})
+
+			It("Copies must be deleted", func() {
+				Expect(f).To(ExecuteSuccessfully())
+
+				Expect(f.KubernetesResource("Secret", "ns1", "registry").Exists()).To(BeFalse())
+				Expect(f.KubernetesResource("Secret", "ns2", "registry").Exists()).To(BeFalse())
+				Expect(f.KubernetesResource("Secret", "d8-system", "registry").Exists()).To(BeTrue())
+			})
+		})
+	})
+
+	Context("Managed copy is modified", func() {
+		BeforeEach(func() {
+			runHook(namespaces + registrySecret + registrySecretCopy + `
+---
+apiVersion: v1
+kind: Secret
+type: kubernetes.io/dockerconfigjson
+metadata:
+  name: registry
+  namespace: ns1
+  labels:
+    secret-copier.deckhouse.io/secret-copy: registry
+data:
+  .dockerconfigjson: bW9kaWZpZWQ=
+  extra: YWJj
+`)
+		})
+
+		It("Copy must be restored", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			s := f.KubernetesResource("Secret", "ns1", "registry")
+			Expect(s.Field("data").Map()).To(HaveLen(1))
+			Expect(s.Field(`data.\.dockerconfigjson`).String()).To(Equal("eyJhdXRocyI6e319"))
+		})
+	})
+
+	Context("Target namespace has an unmanaged Secret", func() {
+		BeforeEach(func() {
+			runHook(namespaces + registrySecret + registrySecretCopy + `
+---
+apiVersion: v1
+kind: Secret
+type: kubernetes.io/dockerconfigjson
+metadata:
+  name: registry
+  namespace: ns2
+data:
+  .dockerconfigjson: b3du
+`)
+		})
+
+		It("Unmanaged Secret must not be overwritten, the conflict must be in the status", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			s := f.KubernetesResource("Secret", "ns2", "registry")
+			Expect(s.Field(`data.\.dockerconfigjson`).String()).To(Equal("b3du"))
+			Expect(s.Field("metadata.labels").Exists()).To(BeFalse())
+
+			Expect(f.KubernetesResource("Secret", "ns1", "registry").Exists()).To(BeTrue())
+
+			sc := f.KubernetesGlobalResource("SecretCopy", "registry")
+			Expect(sc.Field("status.syncedNamespaces").String()).To(MatchJSON(`["ns1"]`))
+			Expect(sc.Field("status.conflicts").String()).To(MatchJSON(`[{"namespace":"ns2","reason":"Secret registry exists and is not managed by secret-copier"}]`))
+		})
+	})
+
+	Context("SecretCopy of a ConfigMap with renamed keys and the target namespace selector", func() {
+		BeforeEach(func() {
+			runHook(namespaces + `
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ca
+  namespace: d8-system
+data:
+  ca.crt: cert
+  ca.key: key
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: SecretCopy
+metadata:
+  name: ca
+spec:
+  kind: ConfigMap
+  source:
+    namespace: d8-system
+    name: ca
+  targetNamespaces:
+    labelSelector:
+      matchLabels:
+        team: b
+  keys:
+    exclude:
+    - ca.key
+    rename:
+      ca.crt: root.crt
+`)
+		})
+
+		It("ConfigMap must be copied only to the matched namespace with the renamed key", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			Expect(f.KubernetesResource("ConfigMap", "ns1", "ca").Exists()).To(BeFalse())
+
+			cm := f.KubernetesResource("ConfigMap", "ns2", "ca")
+			Expect(cm.Exists()).To(BeTrue())
+			Expect(cm.Field("data").String()).To(MatchJSON(`{"root.crt":"cert"}`))
+
+			sc := f.KubernetesGlobalResource("SecretCopy", "ca")
+			Expect(sc.Field("status.syncedNamespaces").String()).To(MatchJSON(`["ns2"]`))
+		})
+	})
+
+	Context("Two SecretCopies have the same target", func() {
+		BeforeEach(func() {
+			runHook(namespaces + registrySecret + registrySecretCopy + `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: registry
+  namespace: ns1
+data:
+  token: YWJj
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: SecretCopy
+metadata:
+  name: registry-ns1
+spec:
+  source:
+    namespace: ns1
+    name: registry
+`)
+		})
+
+		It("Target must be copied by the first SecretCopy only", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			Expect(f.KubernetesResource("Secret", "ns2", "registry").Field(`metadata.labels.secret-copier\.deckhouse\.io/secret-copy`).String()).To(Equal("registry"))
+
+			sc := f.KubernetesGlobalResource("SecretCopy", "registry-ns1")
+			Expect(sc.Field("status.conflicts").String()).To(MatchJSON(`[{"namespace":"d8-system","reason":"Secret registry exists and is not managed by secret-copier"},{"namespace":"ns2","reason":"registry is copied by SecretCopy registry"}]`))
+		})
+	})
+
+	Context("Source is a copy", func() {
+		BeforeEach(func() {
+			runHook(namespaces + `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: registry
+  namespace: ns1
+  labels:
+    secret-copier.deckhouse.io/secret-copy: registry
+data:
+  token: YWJj
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: SecretCopy
+metadata:
+  name: reverse
+spec:
+  source:
+    namespace: ns1
+    name: registry
+`)
+		})
+
+		It("Secret must not be copied, the status must have a message", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			Expect(f.KubernetesResource("Secret", "d8-system", "registry").Exists()).To(BeFalse())
+			Expect(f.KubernetesResource("Secret", "ns2", "registry").Exists()).To(BeFalse())
+
+			sc := f.KubernetesGlobalResource("SecretCopy", "reverse")
+			Expect(sc.Field("status.message").String()).To(Equal("source Secret ns1/registry is a copy made by SecretCopy registry"))
+		})
+	})
+
+	Context("Renamed keys collide", func() {
+		BeforeEach(func() {
+			runHook(namespaces + registrySecret + `
+---
+apiVersion: deckhouse.io/v1alpha1
+kind: SecretCopy
+metadata:
+  name: registry
+spec:
+  source:
+    namespace: d8-system
+    name: registry
+  keys:
+    rename:
+      token: .dockerconfigjson
+`)
+		})
+
+		It("Secret must not be copied, the status must have a message", func() {
+			Expect(f).To(ExecuteSuccessfully())
+
+			Expect(f.KubernetesResource("Secret", "ns1", "registry").Exists()).To(BeFalse())
+
+			sc := f.KubernetesGlobalResource("SecretCopy", "registry")
+			Expect(sc.Field("status.message").String()).To(Equal(`keys ".dockerconfigjson" and "token" are both copied as ".dockerconfigjson"`))
+		})
+	})
+})
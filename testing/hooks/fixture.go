@@ -0,0 +1,209 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const fixtureHeader = "# Recorded cluster state for a hook test. Re-record it with the D8_FIXTURE_RECORD_KUBECONFIG or D8_FIXTURE_RECORD_DUMP environment variable.\n"
+
+// Fixture is a recorded cluster state to replay in a hook test.
+type Fixture struct {
+	// Hook is a path to the hook the fixture is recorded for, it is informational.
+	Hook       string `json:"hook,omitempty"`
+	RecordedAt string `json:"recordedAt,omitempty"`
+
+	// Binding to run the hook with after the objects are loaded: Synchronization (default),
+	// Schedule, OnStartup, BeforeHelm, AfterHelm, AfterDeleteHelm, BeforeAll or AfterAll.
+	Binding string `json:"binding,omitempty"`
+	// Crontab for the Schedule binding.
+	Crontab string `json:"crontab,omitempty"`
+
+	// Values and ConfigValues are set by their top level keys before the hook is run.
+	Values       map[string]interface{} `json:"values,omitempty"`
+	ConfigValues map[string]interface{} `json:"configValues,omitempty"`
+
+	// KeepSecrets lists Secrets (namespace/name) or their keys (namespace/name/key) which data is recorded as is.
+	// Data of other Secrets is redacted, so list only data without sensitive information.
+	KeepSecrets []string `json:"keepSecrets,omitempty"`
+
+	Objects []unstructured.Unstructured `json:"objects"`
+
+	Expected *FixtureExpectations `json:"expected,omitempty"`
+}
+
+// FixtureExpectations are checked after the fixture is replayed.
+type FixtureExpectations struct {
+	// Values maps a values path to the expected value.
+	Values map[string]interface{} `json:"values,omitempty"`
+	// Objects are expected states of the cluster objects after the hook patches are applied.
+	Objects []FixtureObject `json:"objects,omitempty"`
+}
+
+// FixtureObject is an expected object state.
+type FixtureObject struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Absent means the object must not exist.
+	Absent bool `json:"absent,omitempty"`
+	// Fields maps a field path (e.g. status.desired) to the expected value.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// LoadFixture reads a fixture from the YAML file.
+func LoadFixture(path string) (*Fixture, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture %s: %v", path, err)
+	}
+
+	var fixture Fixture
+	err = yaml.UnmarshalStrict(content, &fixture)
+	if err != nil {
+		return nil, fmt.Errorf("parse fixture %s: %v", path, err)
+	}
+
+	return &fixture, nil
+}
+
+// Save writes the fixture to the YAML file.
+func (f *Fixture) Save(path string) error {
+	content, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append([]byte(fixtureHeader), content...), 0644)
+}
+
+// KubeState returns fixture objects as a multi-document YAML for KubeStateSet.
+func (f *Fixture) KubeState() (string, error) {
+	var buf bytes.Buffer
+	for _, obj := range f.Objects {
+		content, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString("---\n")
+		buf.Write(content)
+	}
+
+	return buf.String(), nil
+}
+
+// ReplayFixture loads the fixture into the fake cluster and values, runs the hook
+// and checks the fixture expectations. It must be called from a ginkgo node (BeforeEach or It).
+// CRDs for custom resources in the fixture must be registered with RegisterCRD beforehand.
+//
+// If D8_FIXTURE_RECORD_KUBECONFIG (and optionally D8_FIXTURE_RECORD_CONTEXT) or D8_FIXTURE_RECORD_DUMP
+// is set, the fixture objects are re-recorded from the cluster or the dump file before the replay.
+func (hec *HookExecutionConfig) ReplayFixture(path string) *Fixture {
+	source, err := fixtureSourceFromEnv()
+	Expect(err).ToNot(HaveOccurred())
+	if source != nil {
+		Expect(hec.RecordFixture(source, path)).To(Succeed())
+	}
+
+	fixture, err := LoadFixture(path)
+	Expect(err).ToNot(HaveOccurred())
+
+	for key, value := range fixture.Values {
+		hec.ValuesSet(key, value)
+	}
+	for key, value := range fixture.ConfigValues {
+		hec.ConfigValuesSet(key, value)
+	}
+
+	state, err := fixture.KubeState()
+	Expect(err).ToNot(HaveOccurred())
+
+	hec.BindingContexts.Set(hec.KubeStateSet(state))
+	switch fixture.Binding {
+	case "", "Synchronization":
+	case "Schedule":
+		hec.BindingContexts.Set(hec.GenerateScheduleContext(fixture.Crontab))
+	case "OnStartup":
+		hec.BindingContexts.Set(hec.GenerateOnStartupContext())
+	case "BeforeHelm":
+		hec.BindingContexts.Set(hec.GenerateBeforeHelmContext())
+	case "AfterHelm":
+		hec.BindingContexts.Set(hec.GenerateAfterHelmContext())
+	case "AfterDeleteHelm":
+		hec.BindingContexts.Set(hec.GenerateAfterDeleteHelmContext())
+	case "BeforeAll":
+		hec.BindingContexts.Set(hec.GenerateBeforeAllContext())
+	case "AfterAll":
+		hec.BindingContexts.Set(hec.GenerateAfterAllContext())
+	default:
+		Fail(fmt.Sprintf("fixture %s: unknown binding %q", path, fixture.Binding))
+	}
+
+	hec.RunHook()
+	Expect(hec).To(ExecuteSuccessfully())
+
+	if fixture.Expected != nil {
+		hec.expectFixture(fixture.Expected)
+	}
+
+	return fixture
+}
+
+func (hec *HookExecutionConfig) expectFixture(expected *FixtureExpectations) {
+	for path, value := range expected.Values {
+		By("Checking values " + path)
+		expectedJSON, err := json.Marshal(value)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hec.ValuesGet(path).Exists()).To(BeTrue(), "values %s must exist", path)
+		Expect(hec.ValuesGet(path).Raw).To(MatchJSON(expectedJSON), "values %s", path)
+	}
+
+	for _, expectedObj := range expected.Objects {
+		ref := fmt.Sprintf("%s %s/%s", expectedObj.Kind, expectedObj.Namespace, expectedObj.Name)
+		By("Checking " + ref)
+
+		obj := hec.KubernetesResource(expectedObj.Kind, expectedObj.Namespace, expectedObj.Name)
+		if expectedObj.Absent {
+			Expect(obj.Exists()).To(BeFalse(), "%s must be absent", ref)
+			continue
+		}
+		Expect(obj.Exists()).To(BeTrue(), "%s must exist", ref)
+
+		for path, value := range expectedObj.Fields {
+			expectedJSON, err := json.Marshal(value)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(obj.Field(path).Exists()).To(BeTrue(), "%s: field %s must exist", ref, path)
+			Expect(obj.Field(path).Raw).To(MatchJSON(expectedJSON), "%s: field %s", ref, path)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	klient "github.com/flant/kube-client/client"
+	"github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const redactedSecretValue = "redacted"
+
+// ObjectSource provides objects to record a fixture from.
+type ObjectSource interface {
+	// List returns objects of the kind from all namespaces. Empty apiVersion matches any version.
+	List(apiVersion, kind string) ([]unstructured.Unstructured, error)
+}
+
+// ClusterSource lists objects from a live cluster.
+type ClusterSource struct {
+	client klient.Client
+}
+
+// NewClusterSource connects to the cluster using the kubeconfig path and context.
+// Empty values mean the default kubeconfig and its current context.
+func NewClusterSource(kubeconfig, contextName string) (*ClusterSource, error) {
+	client := klient.New()
+	client.WithConfigPath(kubeconfig)
+	client.WithContextName(contextName)
+	if err := client.Init(); err != nil {
+		return nil, fmt.Errorf("init kubernetes client: %v", err)
+	}
+
+	return &ClusterSource{client: client}, nil
+}
+
+func (s *ClusterSource) List(apiVersion, kind string) ([]unstructured.Unstructured, error) {
+	gvr, err := s.client.GroupVersionResource(apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.client.Dynamic().Resource(gvr).List(context.TODO(), v1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %v", gvr.String(), err)
+	}
+
+	return list.Items, nil
+}
+
+// DumpSource lists objects from a YAML or JSON file, e.g. 'kubectl get ... -A -o yaml' output.
+// The file may contain multiple documents and List objects.
+type DumpSource struct {
+	objects []unstructured.Unstructured
+}
+
+// NewDumpSource reads objects from the dump file.
+func NewDumpSource(path string) (*DumpSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	source := new(DumpSource)
+	decoder := k8syaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		var obj unstructured.Unstructured
+		err := decoder.Decode(&obj.Object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse dump %s: %v", path, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if !obj.IsList() {
+			source.objects = append(source.objects, obj)
+			continue
+		}
+
+		err = obj.EachListItem(func(item runtime.Object) error {
+			source.objects = append(source.objects, *item.(*unstructured.Unstructured))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("parse dump %s: %v", path, err)
+		}
+	}
+
+	return source, nil
+}
+
+func (s *DumpSource) List(apiVersion, kind string) ([]unstructured.Unstructured, error) {
+	var result []unstructured.Unstructured
+	for _, obj := range s.objects {
+		if apiVersion != "" && obj.GetAPIVersion() != apiVersion {
+			continue
+		}
+		if !strings.EqualFold(obj.GetKind(), kind) {
+			continue
+		}
+		result = append(result, obj)
+	}
+
+	return result, nil
+}
+
+// fixtureSourceFromEnv returns a source to re-record fixtures from or nil if recording is not requested.
+func fixtureSourceFromEnv() (ObjectSource, error) {
+	if path := os.Getenv("D8_FIXTURE_RECORD_DUMP"); path != "" {
+		return NewDumpSource(path)
+	}
+
+	if kubeconfig := os.Getenv("D8_FIXTURE_RECORD_KUBECONFIG"); kubeconfig != "" {
+		return NewClusterSource(kubeconfig, os.Getenv("D8_FIXTURE_RECORD_CONTEXT"))
+	}
+
+	return nil, nil
+}
+
+// bindingSelector is a subset of a kubernetes binding used to select objects to record.
+// Field names follow the shell hook configuration, so it is parsed from the '--config' output as is.
+type bindingSelector struct {
+	ApiVersion    string                   `json:"apiVersion,omitempty"`
+	Kind          string                   `json:"kind"`
+	NameSelector  *types.NameSelector      `json:"nameSelector,omitempty"`
+	Namespace     *types.NamespaceSelector `json:"namespace,omitempty"`
+	LabelSelector *v1.LabelSelector        `json:"labelSelector,omitempty"`
+	FieldSelector *types.FieldSelector     `json:"fieldSelector,omitempty"`
+}
+
+func (hec *HookExecutionConfig) bindingSelectors() ([]bindingSelector, error) {
+	var selectors []bindingSelector
+
+	if hec.GoHook != nil {
+		for _, binding := range hec.GoHook.Hook.Config().Kubernetes {
+			selectors = append(selectors, bindingSelector{
+				ApiVersion:    binding.ApiVersion,
+				Kind:          binding.Kind,
+				NameSelector:  binding.NameSelector,
+				Namespace:     binding.NamespaceSelector,
+				LabelSelector: binding.LabelSelector,
+				FieldSelector: binding.FieldSelector,
+			})
+		}
+		return selectors, nil
+	}
+
+	var config struct {
+		Kubernetes []bindingSelector `json:"kubernetes"`
+	}
+	if err := json.Unmarshal([]byte(hec.hookConfig), &config); err != nil {
+		return nil, fmt.Errorf("parse hook config: %v", err)
+	}
+
+	return config.Kubernetes, nil
+}
+
+// RecordFixture records objects the hook kubernetes bindings subscribe to from the source into the fixture file.
+// Binding, values, expectations and kept Secrets of an existing fixture are preserved, objects are replaced.
+func (hec *HookExecutionConfig) RecordFixture(source ObjectSource, path string) error {
+	fixture := new(Fixture)
+	if _, err := os.Stat(path); err == nil {
+		fixture, err = LoadFixture(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	selectors, err := hec.bindingSelectors()
+	if err != nil {
+		return err
+	}
+
+	objects, err := recordObjects(source, selectors)
+	if err != nil {
+		return err
+	}
+
+	for i := range objects {
+		sanitizeObject(&objects[i], fixture.KeepSecrets)
+	}
+
+	fixture.Hook = hec.HookPath
+	if hec.GoHook != nil {
+		fixture.Hook = hec.GoHook.Metadata.Path
+	}
+	fixture.RecordedAt = time.Now().UTC().Format(time.RFC3339)
+	fixture.Objects = objects
+
+	return fixture.Save(path)
+}
+
+func recordObjects(source ObjectSource, selectors []bindingSelector) ([]unstructured.Unstructured, error) {
+	var namespaceLabels map[string]labels.Set
+	recorded := make(map[string]unstructured.Unstructured)
+
+	for _, selector := range selectors {
+		if selector.Namespace != nil && selector.Namespace.LabelSelector != nil && namespaceLabels == nil {
+			namespaces, err := source.List("v1", "Namespace")
+			if err != nil {
+				return nil, fmt.Errorf("list namespaces: %v", err)
+			}
+			namespaceLabels = make(map[string]labels.Set, len(namespaces))
+			for _, ns := range namespaces {
+				namespaceLabels[ns.GetName()] = ns.GetLabels()
+			}
+		}
+
+		objects, err := source.List(selector.ApiVersion, selector.Kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range objects {
+			ok, err := selector.matches(&obj, namespaceLabels)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				recorded[objectKey(&obj)] = obj
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(recorded))
+	for key := range recorded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]unstructured.Unstructured, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, recorded[key])
+	}
+
+	return result, nil
+}
+
+func objectKey(obj *unstructured.Unstructured) string {
+	return strings.Join([]string{obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()}, "/")
+}
+
+func (s bindingSelector) matches(obj *unstructured.Unstructured, namespaceLabels map[string]labels.Set) (bool, error) {
+	if s.NameSelector != nil && len(s.NameSelector.MatchNames) > 0 && !containsString(s.NameSelector.MatchNames, obj.GetName()) {
+		return false, nil
+	}
+
+	if s.Namespace != nil {
+		if s.Namespace.NameSelector != nil && len(s.Namespace.NameSelector.MatchNames) > 0 &&
+			!containsString(s.Namespace.NameSelector.MatchNames, obj.GetNamespace()) {
+			return false, nil
+		}
+
+		if s.Namespace.LabelSelector != nil {
+			selector, err := v1.LabelSelectorAsSelector(s.Namespace.LabelSelector)
+			if err != nil {
+				return false, fmt.Errorf("%s namespace label selector: %v", s.Kind, err)
+			}
+			if !selector.Matches(namespaceLabels[obj.GetNamespace()]) {
+				return false, nil
+			}
+		}
+	}
+
+	if s.LabelSelector != nil {
+		selector, err := v1.LabelSelectorAsSelector(s.LabelSelector)
+		if err != nil {
+			return false, fmt.Errorf("%s label selector: %v", s.Kind, err)
+		}
+		if !selector.Matches(labels.Set(obj.GetLabels())) {
+			return false, nil
+		}
+	}
+
+	if s.FieldSelector != nil {
+		for _, req := range s.FieldSelector.MatchExpressions {
+			value, _, _ := unstructured.NestedFieldNoCopy(obj.Object, strings.Split(req.Field, ".")...)
+			equal := fmt.Sprint(value) == req.Value
+			if value == nil {
+				equal = req.Value == ""
+			}
+
+			switch req.Operator {
+			case "=", "==", "Equals":
+				if !equal {
+					return false, nil
+				}
+			case "!=", "NotEquals":
+				if equal {
+					return false, nil
+				}
+			default:
+				return false, fmt.Errorf("%s field selector: unknown operator %q", s.Kind, req.Operator)
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// sanitizeObject strips server-side metadata and redacts Secret data except for the kept Secrets.
+func sanitizeObject(obj *unstructured.Unstructured, keepSecrets []string) {
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "selfLink")
+
+	// The last applied configuration duplicates the object, Secret data included.
+	if annotations := obj.GetAnnotations(); annotations != nil {
+		delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		obj.SetAnnotations(annotations)
+	}
+
+	if obj.GetAPIVersion() != "v1" || obj.GetKind() != "Secret" {
+		return
+	}
+	ref := obj.GetNamespace() + "/" + obj.GetName()
+	if containsString(keepSecrets, ref) {
+		return
+	}
+
+	redacted := base64.StdEncoding.EncodeToString([]byte(redactedSecretValue))
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := obj.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range data {
+			if containsString(keepSecrets, ref+"/"+key) {
+				continue
+			}
+			if field == "data" {
+				data[key] = redacted
+			} else {
+				data[key] = redactedSecretValue
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/flant/shell-operator/pkg/kube_events_manager/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const recorderDump = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: d8-system
+    labels:
+      heritage: deckhouse
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: default
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: registry
+    namespace: d8-system
+    resourceVersion: "123"
+    managedFields:
+    - manager: kubectl
+    annotations:
+      kubectl.kubernetes.io/last-applied-configuration: '{"data":{"password":"c2VjcmV0"}}'
+  data:
+    password: c2VjcmV0
+    address: cmVnaXN0cnkuZXhhbXBsZS5jb20=
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: registry
+    namespace: default
+  data:
+    password: c2VjcmV0
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: deckhouse-1
+  namespace: d8-system
+  labels:
+    app: deckhouse
+spec:
+  nodeName: master-0
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: deckhouse-2
+  namespace: d8-system
+  labels:
+    app: deckhouse
+spec:
+  nodeName: master-1
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: nginx
+  namespace: d8-system
+  labels:
+    app: nginx
+spec:
+  nodeName: master-0
+`
+
+func recordTestObjects(t *testing.T, selectors ...bindingSelector) []unstructured.Unstructured {
+	path := filepath.Join(t.TempDir(), "dump.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(recorderDump), 0644))
+
+	source, err := NewDumpSource(path)
+	require.NoError(t, err)
+
+	objects, err := recordObjects(source, selectors)
+	require.NoError(t, err)
+	return objects
+}
+
+func objectNames(objects []unstructured.Unstructured) []string {
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, obj.GetNamespace()+"/"+obj.GetName())
+	}
+	return names
+}
+
+func TestRecordObjectsBySelectors(t *testing.T) {
+	t.Run("Namespace label selector", func(t *testing.T) {
+		objects := recordTestObjects(t, bindingSelector{
+			ApiVersion: "v1",
+			Kind:       "Secret",
+			Namespace: &types.NamespaceSelector{
+				LabelSelector: &v1.LabelSelector{MatchLabels: map[string]string{"heritage": "deckhouse"}},
+			},
+		})
+		assert.Equal(t, []string{"d8-system/registry"}, objectNames(objects))
+	})
+
+	t.Run("Label and field selectors", func(t *testing.T) {
+		objects := recordTestObjects(t, bindingSelector{
+			Kind:          "Pod",
+			LabelSelector: &v1.LabelSelector{MatchLabels: map[string]string{"app": "deckhouse"}},
+			FieldSelector: &types.FieldSelector{
+				MatchExpressions: []types.FieldSelectorRequirement{{Field: "spec.nodeName", Operator: "=", Value: "master-0"}},
+			},
+		})
+		assert.Equal(t, []string{"d8-system/deckhouse-1"}, objectNames(objects))
+	})
+
+	t.Run("Objects selected by several bindings are recorded once", func(t *testing.T) {
+		objects := recordTestObjects(t,
+			bindingSelector{Kind: "Pod", NameSelector: &types.NameSelector{MatchNames: []string{"nginx"}}},
+			bindingSelector{Kind: "Pod", Namespace: &types.NamespaceSelector{NameSelector: &types.NameSelector{MatchNames: []string{"d8-system"}}}},
+		)
+		assert.Equal(t, []string{"d8-system/deckhouse-1", "d8-system/deckhouse-2", "d8-system/nginx"}, objectNames(objects))
+	})
+}
+
+func TestSanitizeObject(t *testing.T) {
+	objects := recordTestObjects(t, bindingSelector{ApiVersion: "v1", Kind: "Secret"})
+	require.Len(t, objects, 2)
+
+	keepSecrets := []string{"d8-system/registry/address", "default/registry"}
+	for i := range objects {
+		sanitizeObject(&objects[i], keepSecrets)
+	}
+
+	kept := objects[0]
+	assert.Equal(t, "d8-system", kept.GetNamespace())
+	assert.Equal(t, map[string]interface{}{
+		"password": "cmVkYWN0ZWQ=",
+		"address":  "cmVnaXN0cnkuZXhhbXBsZS5jb20=",
+	}, kept.Object["data"])
+	assert.Empty(t, kept.GetResourceVersion())
+	assert.Empty(t, kept.GetManagedFields())
+	assert.Empty(t, kept.GetAnnotations())
+
+	assert.Equal(t, map[string]interface{}{"password": "c2VjcmV0"}, objects[1].Object["data"])
+}
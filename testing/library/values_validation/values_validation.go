@@ -26,9 +26,11 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
+// GlobalOpenAPIDir is the directory with global values schemas, it could be changed to lint modules outside the repository
+var GlobalOpenAPIDir = filepath.Join("/deckhouse", "global-hooks", "openapi")
+
 func LoadOpenAPISchemas(validator *validation.ValuesValidator, moduleName, modulePath string) error {
-	openAPIDir := filepath.Join("/deckhouse", "global-hooks", "openapi")
-	configBytes, valuesBytes, err := module_manager.ReadOpenAPIFiles(openAPIDir)
+	configBytes, valuesBytes, err := module_manager.ReadOpenAPIFiles(GlobalOpenAPIDir)
 	if err != nil {
 		return fmt.Errorf("read global openAPI schemas: %v", err)
 	}
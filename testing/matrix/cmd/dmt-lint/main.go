@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// dmt-lint lints Deckhouse modules: the module structure and helm templates rendered with values
+// generated from OpenAPI schemas or values_matrix_test.yaml.
+//
+// Usage:
+//
+//	dmt-lint [flags] [module or modules directory...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/deckhouse/deckhouse/testing/library/values_validation"
+	"github.com/deckhouse/deckhouse/testing/matrix/linter"
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/report"
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/modules"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var format string
+	flag.StringVar(&format, "format", report.FormatText, "Output format: text, json or sarif.")
+	var output string
+	flag.StringVar(&output, "output", "", "Output file. Stdout is used if not passed.")
+	var globalOpenAPIDir string
+	flag.StringVar(&globalOpenAPIDir, "global-openapi-dir", values_validation.GlobalOpenAPIDir, "Directory with Deckhouse global values schemas.")
+	var listRules bool
+	flag.BoolVar(&listRules, "rules", false, "Print registered rules and exit.")
+	flag.Parse()
+
+	if listRules {
+		for _, rule := range errors.Rules() {
+			fmt.Printf("%s\t%s\t%s\n", rule.ID, rule.Severity, rule.Description)
+		}
+		return 0
+	}
+
+	values_validation.GlobalOpenAPIDir = globalOpenAPIDir
+
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	for i, dir := range dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			fmt.Printf("Directory '%s': %v\n", dir, err)
+			return 2
+		}
+		dirs[i] = absDir
+	}
+
+	lintErrors, err := lint(dirs)
+	if err != nil {
+		fmt.Printf("Lint modules: %v\n", err)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Printf("Create output file '%s': %v\n", output, err)
+			return 2
+		}
+		defer f.Close()
+		w = f
+	}
+
+	baseDir, _ := os.Getwd()
+	if err := report.Write(w, format, lintErrors, baseDir); err != nil {
+		fmt.Printf("Write report: %v\n", err)
+		return 2
+	}
+
+	if lintErrors.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+func lint(dirs []string) (errors.LintRuleErrorsList, error) {
+	discoveredModules, lintErrors, err := modules.GetModules(dirs, nil)
+	if err != nil {
+		return lintErrors, err
+	}
+
+	for _, module := range discoveredModules {
+		moduleErrors, err := linter.Lint("", module)
+		if err != nil {
+			// render errors are reported as a rule to show them along with other errors
+			lintErrors.Add(errors.NewLintRuleError(
+				"MATRIX001",
+				"module = "+module.Name,
+				nil,
+				"%v", err,
+			).WithFilePath(module.Path))
+			continue
+		}
+		lintErrors.Merge(moduleErrors)
+	}
+
+	return lintErrors, nil
+}
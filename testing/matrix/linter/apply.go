@@ -23,12 +23,14 @@ import (
 
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
-	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/resources"
+	// register VPA and PDB checks
+	_ "github.com/deckhouse/deckhouse/testing/matrix/linter/rules/resources"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/storage"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/utils"
 )
 
-func ApplyLintRules(module utils.Module, values string, objectStore *storage.UnstructuredObjectStore) error {
+// ApplyLintRules applies registered rules to rendered objects and filters errors with the module configuration
+func ApplyLintRules(module utils.Module, values string, objectStore *storage.UnstructuredObjectStore) (errors.LintRuleErrorsList, error) {
 	var v struct {
 		Global struct {
 			EnabledModules []string `yaml:"enabledModules"`
@@ -36,7 +38,7 @@ func ApplyLintRules(module utils.Module, values string, objectStore *storage.Uns
 	}
 	err := yaml.Unmarshal([]byte(values), &v)
 	if err != nil {
-		return fmt.Errorf("unable to parse global.enabledModules values section")
+		return errors.LintRuleErrorsList{}, fmt.Errorf("unable to parse global.enabledModules values section")
 	}
 
 	// Use map for faster lookups
@@ -58,9 +60,8 @@ func ApplyLintRules(module utils.Module, values string, objectStore *storage.Uns
 		linter.ApplyContainerRules(object)
 	}
 
-	resources.ControllerMustHaveVPA(&linter)
-	resources.ControllerMustHavePDB(&linter)
-	resources.DaemonSetMustNotHavePDB(&linter)
+	linter.ApplyModuleRules()
 
-	return linter.ErrorsList.ConvertToError()
+	linter.ErrorsList.SetDefaultFilePath(module.Path)
+	return module.Config.Apply(module.Path, *linter.ErrorsList), nil
 }
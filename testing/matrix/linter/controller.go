@@ -34,6 +34,7 @@ import (
 
 	"github.com/deckhouse/deckhouse/testing/library/helm"
 	"github.com/deckhouse/deckhouse/testing/library/values_validation"
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/storage"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/utils"
 )
@@ -42,11 +43,23 @@ var (
 	workersQuantity = runtime.NumCPU() * 8
 )
 
+func init() {
+	errors.RegisterRule(errors.Rule{
+		ID:          "MATRIX001",
+		Severity:    errors.SeverityError,
+		Description: "Module chart must render with all generated values",
+	})
+}
+
 type ModuleController struct {
 	Module          utils.Module
 	Values          []string
 	Chart           *chart.Chart
 	ValuesValidator *validation.ValuesValidator
+
+	// results are collected from all test cases, the same errors are reported once
+	resultsMu sync.Mutex
+	results   errors.LintRuleErrorsList
 }
 
 func NewModuleController(m utils.Module, values []string) *ModuleController {
@@ -99,6 +112,24 @@ func (w *Worker) Start(wg *sync.WaitGroup, c *ModuleController) {
 }
 
 func (c *ModuleController) Run() error {
+	results, err := c.Lint()
+	if err != nil {
+		return err
+	}
+
+	if err := results.ConvertToError(); err != nil {
+		return err
+	}
+
+	// only warnings are left
+	fmt.Print(results.String())
+	fmt.Print(testsSuccessful(c.Module.Name, len(c.Values)))
+	return nil
+}
+
+// Lint runs all test cases and returns errors found by lint rules. The error is returned
+// if values are invalid or the chart cannot be rendered.
+func (c *ModuleController) Lint() (errors.LintRuleErrorsList, error) {
 	testCasesQuantity := len(c.Values)
 
 	signalCh := make(chan os.Signal, 1)
@@ -127,17 +158,29 @@ func (c *ModuleController) Run() error {
 	for {
 		select {
 		case <-doneCh:
-			fmt.Print(testsSuccessful(c.Module.Name, testCasesQuantity))
-			return nil
+			// a worker could fail right before the last task is done
+			select {
+			case err := <-errorsCh:
+				return errors.LintRuleErrorsList{}, err
+			default:
+			}
+			return c.results, nil
 		case s := <-signalCh:
 			fmt.Printf("\nReceived signal %s, exiting...\n", s)
-			return nil
+			return errors.LintRuleErrorsList{}, nil
 		case err := <-errorsCh:
-			return err
+			return errors.LintRuleErrorsList{}, err
 		}
 	}
 }
 
+func (c *ModuleController) addResults(results errors.LintRuleErrorsList) {
+	c.resultsMu.Lock()
+	defer c.resultsMu.Unlock()
+
+	c.results.Merge(results)
+}
+
 func (c *ModuleController) RunRender(values string, objectStore *storage.UnstructuredObjectStore) (lintError error) {
 	var renderer helm.Renderer
 	renderer.Name = c.Module.Name
@@ -191,10 +234,12 @@ func lint(c *ModuleController, task *Task) error {
 		return testsError(task.index, err, task.values)
 	}
 
-	err = ApplyLintRules(c.Module, task.values, &objectStore)
+	results, err := ApplyLintRules(c.Module, task.values, &objectStore)
 	if err != nil {
-		return err
+		return testsError(task.index, err, task.values)
 	}
+
+	c.addResults(results)
 	return nil
 }
 
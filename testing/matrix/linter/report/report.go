@@ -0,0 +1,213 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
+)
+
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+const (
+	toolName       = "dmt-lint"
+	toolURI        = "https://github.com/deckhouse/deckhouse/tree/main/testing/matrix"
+	sarifVersion   = "2.1.0"
+	sarifSchemaURI = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Write writes lint errors in the format. File paths are written relative to the baseDir if possible.
+func Write(w io.Writer, format string, list errors.LintRuleErrorsList, baseDir string) error {
+	switch format {
+	case FormatText:
+		_, err := io.WriteString(w, list.String())
+		return err
+	case FormatJSON:
+		return writeJSON(w, toJSON(list, baseDir))
+	case FormatSARIF:
+		return writeJSON(w, toSARIF(list, baseDir))
+	default:
+		return fmt.Errorf("unknown format %q, must be %s, %s or %s", format, FormatText, FormatJSON, FormatSARIF)
+	}
+}
+
+type jsonError struct {
+	ID          string `json:"id"`
+	Severity    string `json:"severity"`
+	Description string `json:"description,omitempty"`
+	Message     string `json:"message"`
+	Object      string `json:"object,omitempty"`
+	Value       string `json:"value,omitempty"`
+	File        string `json:"file,omitempty"`
+}
+
+func toJSON(list errors.LintRuleErrorsList, baseDir string) []jsonError {
+	result := make([]jsonError, 0)
+	for _, err := range list.Errors() {
+		rule, _ := errors.GetRule(err.ID)
+		result = append(result, jsonError{
+			ID:          err.ID,
+			Severity:    level(err.Severity),
+			Description: rule.Description,
+			Message:     err.Text,
+			Object:      err.ObjectID,
+			Value:       formatValue(err.Value),
+			File:        relativePath(baseDir, err.FilePath),
+		})
+	}
+	return result
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func toSARIF(list errors.LintRuleErrorsList, baseDir string) sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           toolName,
+			InformationURI: toolURI,
+			Rules:          make([]sarifRule, 0),
+		}},
+		Results: make([]sarifResult, 0),
+	}
+
+	for _, rule := range errors.Rules() {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: string(rule.Severity)},
+		})
+	}
+
+	for _, err := range list.Errors() {
+		message := []string{err.Text}
+		if err.ObjectID != "" {
+			message = append(message, "Object: "+err.ObjectID)
+		}
+		if value := formatValue(err.Value); value != "" {
+			message = append(message, "Value: "+value)
+		}
+
+		result := sarifResult{
+			RuleID:  err.ID,
+			Level:   level(err.Severity),
+			Message: sarifMessage{Text: strings.Join(message, "\n")},
+		}
+		if err.FilePath != "" {
+			result.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(relativePath(baseDir, err.FilePath))},
+			}}}
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	return sarifLog{Version: sarifVersion, Schema: sarifSchemaURI, Runs: []sarifRun{run}}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// level returns the severity name, errors created without the severity are errors
+func level(severity errors.Severity) string {
+	if severity == errors.SeverityWarning {
+		return string(errors.SeverityWarning)
+	}
+	return string(errors.SeverityError)
+}
+
+func formatValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func relativePath(baseDir, path string) string {
+	if baseDir == "" || path == "" {
+		return path
+	}
+
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
+)
+
+func init() {
+	errors.RegisterRule(
+		errors.Rule{ID: "TEST001", Severity: errors.SeverityError, Description: "Test error"},
+		errors.Rule{ID: "TEST002", Severity: errors.SeverityWarning, Description: "Test warning"},
+	)
+}
+
+func testErrors() errors.LintRuleErrorsList {
+	var list errors.LintRuleErrorsList
+	list.Add(errors.NewLintRuleError("TEST001", "kind = Deployment ; name = app", 1, "Error").
+		WithFilePath("/deckhouse/modules/000-test/templates/app.yaml"))
+	list.Add(errors.NewLintRuleError("TEST002", "module = test", nil, "Warning"))
+	return list
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatSARIF, testErrors(), "/deckhouse"); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected SARIF log: %s", buf.String())
+	}
+
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) < 2 {
+		t.Errorf("expected registered rules in the driver, got %v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %v", run.Results)
+	}
+
+	result := run.Results[0]
+	if result.RuleID != "TEST001" || result.Level != "error" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if uri := result.Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "modules/000-test/templates/app.yaml" {
+		t.Errorf("expected the relative file path, got %q", uri)
+	}
+	if result.Message.Text != "Error\nObject: kind = Deployment ; name = app\nValue: 1" {
+		t.Errorf("unexpected message %q", result.Message.Text)
+	}
+
+	if run.Results[1].Level != "warning" || len(run.Results[1].Locations) != 0 {
+		t.Errorf("unexpected result %+v", run.Results[1])
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, testErrors(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var result []jsonError
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := jsonError{
+		ID:          "TEST001",
+		Severity:    "error",
+		Description: "Test error",
+		Message:     "Error",
+		Object:      "kind = Deployment ; name = app",
+		Value:       "1",
+		File:        "/deckhouse/modules/000-test/templates/app.yaml",
+	}
+	if len(result) != 2 || result[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "xml", testErrors(), ""); err == nil {
+		t.Error("expected an error for the unknown format")
+	}
+}
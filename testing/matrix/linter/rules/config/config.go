@@ -0,0 +1,198 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
+)
+
+// Filename is the name of the linter configuration file in the module directory
+const Filename = ".dmtlint.yaml"
+
+// ModuleConfig is the linter configuration of a module
+type ModuleConfig struct {
+	// Disable switches rules off for the whole module
+	Disable []string `json:"disable,omitempty"`
+	// Severity overrides default severities of rules
+	Severity map[string]errors.Severity `json:"severity,omitempty"`
+	// Exclude switches rules off for matching objects or files
+	Exclude []Exclude `json:"exclude,omitempty"`
+}
+
+// Exclude matches errors by the object or the file. All fields are glob patterns,
+// empty fields match everything.
+type Exclude struct {
+	Rules     []string `json:"rules"`
+	Kind      string   `json:"kind,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Container string   `json:"container,omitempty"`
+	// File is relative to the module directory
+	File string `json:"file,omitempty"`
+}
+
+// Load reads the configuration from the module directory. Returns an empty configuration if there is no file.
+func Load(modulePath string) (*ModuleConfig, error) {
+	content, err := ioutil.ReadFile(filepath.Join(modulePath, Filename))
+	if os.IsNotExist(err) {
+		return &ModuleConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c ModuleConfig
+	if err := yaml.UnmarshalStrict(content, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", Filename, err)
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", Filename, err)
+	}
+
+	return &c, nil
+}
+
+func (c *ModuleConfig) validate() error {
+	for _, id := range c.Disable {
+		if _, ok := errors.GetRule(id); !ok {
+			return fmt.Errorf("disable: unknown rule %q", id)
+		}
+	}
+
+	for id, severity := range c.Severity {
+		if _, ok := errors.GetRule(id); !ok {
+			return fmt.Errorf("severity: unknown rule %q", id)
+		}
+		if !severity.IsValid() {
+			return fmt.Errorf("severity: rule %s has invalid severity %q, must be %q or %q", id, severity, errors.SeverityError, errors.SeverityWarning)
+		}
+	}
+
+	for i, exclude := range c.Exclude {
+		if len(exclude.Rules) == 0 {
+			return fmt.Errorf("exclude[%d]: rules are required", i)
+		}
+		for _, id := range exclude.Rules {
+			if _, ok := errors.GetRule(id); !ok {
+				return fmt.Errorf("exclude[%d]: unknown rule %q", i, id)
+			}
+		}
+		for _, pattern := range []string{exclude.Kind, exclude.Namespace, exclude.Name, exclude.Container, exclude.File} {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("exclude[%d]: pattern %q: %v", i, pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply drops disabled and excluded errors and overrides severities
+func (c *ModuleConfig) Apply(modulePath string, list errors.LintRuleErrorsList) errors.LintRuleErrorsList {
+	if c == nil {
+		return list
+	}
+
+	var result errors.LintRuleErrorsList
+
+	for _, err := range list.Errors() {
+		if c.isDisabled(err.ID) || c.isExcluded(modulePath, err) {
+			continue
+		}
+		if severity, ok := c.Severity[err.ID]; ok {
+			err.Severity = severity
+		}
+		result.Add(err)
+	}
+
+	return result
+}
+
+func (c *ModuleConfig) isDisabled(id string) bool {
+	for _, disabled := range c.Disable {
+		if disabled == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ModuleConfig) isExcluded(modulePath string, err errors.LintRuleError) bool {
+	object := parseObjectID(err.ObjectID)
+
+	file, relErr := filepath.Rel(modulePath, err.FilePath)
+	if relErr != nil || err.FilePath == "" {
+		file = err.FilePath
+	}
+
+	for _, exclude := range c.Exclude {
+		if !contains(exclude.Rules, err.ID) {
+			continue
+		}
+
+		if match(exclude.Kind, object["kind"]) &&
+			match(exclude.Namespace, object["namespace"]) &&
+			match(exclude.Name, object["name"]) &&
+			match(exclude.Container, object["container"]) &&
+			match(exclude.File, file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseObjectID parses object identities like "kind = Deployment ; name = deckhouse ; namespace = d8-system; container = init"
+func parseObjectID(objectID string) map[string]string {
+	result := make(map[string]string)
+
+	for _, part := range strings.Split(objectID, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return result
+}
+
+func match(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := filepath.Match(pattern, value)
+	return matched
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
+)
+
+func init() {
+	errors.RegisterRule(
+		errors.Rule{ID: "TEST001", Severity: errors.SeverityError},
+		errors.Rule{ID: "TEST002", Severity: errors.SeverityError},
+		errors.Rule{ID: "TEST003", Severity: errors.SeverityError},
+	)
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, Filename), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "valid config",
+			content: `
+disable: [TEST001]
+severity:
+  TEST002: warning
+exclude:
+- rules: [TEST003]
+  kind: DaemonSet
+  name: controller-*
+`,
+		},
+		{
+			name:    "unknown rule",
+			content: `disable: [TEST999]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid severity",
+			content: `severity: {TEST001: info}`,
+			wantErr: true,
+		},
+		{
+			name:    "exclude without rules",
+			content: `exclude: [{kind: DaemonSet}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			content: `disabled: [TEST001]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("no config", func(t *testing.T) {
+		c, err := Load(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Disable) != 0 || len(c.Exclude) != 0 || len(c.Severity) != 0 {
+			t.Errorf("expected empty config, got %+v", c)
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	modulePath := writeConfig(t, `
+disable: [TEST001]
+severity:
+  TEST002: warning
+exclude:
+- rules: [TEST003]
+  kind: DaemonSet
+  namespace: d8-*
+  name: controller-*
+  container: proxy
+- rules: [TEST003]
+  file: images/*/Dockerfile
+`)
+	c, err := Load(modulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list errors.LintRuleErrorsList
+	list.Add(errors.NewLintRuleError("TEST001", "module = test", nil, "disabled"))
+	list.Add(errors.NewLintRuleError("TEST002", "module = test", nil, "warning"))
+	list.Add(errors.NewLintRuleError("TEST003", "kind = DaemonSet ; name = controller-main ; namespace = d8-test; container = proxy", nil, "excluded"))
+	list.Add(errors.NewLintRuleError("TEST003", "kind = DaemonSet ; name = controller-main ; namespace = d8-test; container = controller", nil, "other container"))
+	list.Add(errors.NewLintRuleError("TEST003", "kind = Deployment ; name = controller-main ; namespace = d8-test", nil, "other kind"))
+	list.Add(errors.NewLintRuleError("TEST003", "module = test", nil, "excluded file").
+		WithFilePath(filepath.Join(modulePath, "images", "app", "Dockerfile")))
+
+	applied := c.Apply(modulePath, list)
+	result := applied.Errors()
+
+	texts := make(map[string]errors.Severity)
+	for _, err := range result {
+		texts[err.Text] = err.Severity
+	}
+
+	expected := map[string]errors.Severity{
+		"warning":         errors.SeverityWarning,
+		"other container": errors.SeverityError,
+		"other kind":      errors.SeverityError,
+	}
+	if len(texts) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, texts)
+	}
+	for text, severity := range expected {
+		if texts[text] != severity {
+			t.Errorf("%q: expected severity %q, got %q", text, severity, texts[text])
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"path/filepath"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/storage"
+)
+
+// ObjectCheck lints a single rendered object
+type ObjectCheck func(l *ObjectLinter, object storage.StoreObject) errors.LintRuleError
+
+// ContainerCheck lints a container of a rendered object, it is called for every container
+type ContainerCheck func(object storage.StoreObject, container v1.Container) errors.LintRuleError
+
+// ModuleCheck lints all rendered objects of a module at once, e.g., to find pod controllers without a VPA.
+// It adds errors to the ObjectLinter.ErrorsList itself.
+type ModuleCheck func(l *ObjectLinter)
+
+var (
+	objectChecks    []ObjectCheck
+	containerChecks []ContainerCheck
+	moduleChecks    []ModuleCheck
+)
+
+// RegisterObjectCheck adds checks to run for every rendered object, it is intended to be called from init functions.
+// Rule IDs reported by checks must be registered with errors.RegisterRule.
+func RegisterObjectCheck(checks ...ObjectCheck) {
+	objectChecks = append(objectChecks, checks...)
+}
+
+// RegisterContainerCheck adds checks to run for every container of rendered objects
+func RegisterContainerCheck(checks ...ContainerCheck) {
+	containerChecks = append(containerChecks, checks...)
+}
+
+// RegisterModuleCheck adds checks to run for all rendered objects of a module
+func RegisterModuleCheck(checks ...ModuleCheck) {
+	moduleChecks = append(moduleChecks, checks...)
+}
+
+// objectCheck adapts checks that do not need the linter state
+func objectCheck(f func(object storage.StoreObject) errors.LintRuleError) ObjectCheck {
+	return func(_ *ObjectLinter, object storage.StoreObject) errors.LintRuleError {
+		return f(object)
+	}
+}
+
+func (l *ObjectLinter) ApplyObjectRules(object storage.StoreObject) {
+	for _, check := range objectChecks {
+		l.add(object, check(l, object))
+	}
+}
+
+func (l *ObjectLinter) ApplyContainerRules(object storage.StoreObject) {
+	containers, err := object.GetContainers()
+	if err != nil {
+		panic(err)
+	}
+	for _, container := range containers {
+		for _, check := range containerChecks {
+			l.add(object, check(object, container))
+		}
+	}
+}
+
+func (l *ObjectLinter) ApplyModuleRules() {
+	for _, check := range moduleChecks {
+		check(l)
+	}
+}
+
+// add binds the error to the template file of the object
+func (l *ObjectLinter) add(object storage.StoreObject, err errors.LintRuleError) {
+	if err.IsEmpty() {
+		return
+	}
+	if err.FilePath == "" {
+		err.FilePath = filepath.Join(l.Module.Path, object.ShortPath())
+	}
+	l.ErrorsList.Add(err)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package errors
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -29,6 +30,9 @@ type LintRuleError struct {
 	ID       string
 	ObjectID string
 	Value    interface{}
+	Severity Severity
+	// FilePath is the file where the error is found, or the module directory if the file is unknown
+	FilePath string
 }
 
 func (l *LintRuleError) EqualsTo(candidate LintRuleError) bool {
@@ -45,9 +49,15 @@ func NewLintRuleError(id, objectID string, value interface{}, template string, a
 		Value:    value,
 		Text:     fmt.Sprintf(template, a...),
 		ID:       id,
+		Severity: ruleSeverity(id),
 	}
 }
 
+func (l LintRuleError) WithFilePath(path string) LintRuleError {
+	l.FilePath = path
+	return l
+}
+
 var EmptyRuleError = LintRuleError{Text: "", ID: "", ObjectID: ""}
 
 type LintRuleErrorsList struct {
@@ -67,20 +77,47 @@ func (l *LintRuleErrorsList) Add(e LintRuleError) {
 }
 
 func (l *LintRuleErrorsList) Merge(e LintRuleErrorsList) {
-	l.data = append(l.data, e.data...)
+	for _, err := range e.data {
+		l.Add(err)
+	}
 }
 
-func (l *LintRuleErrorsList) ConvertToError() error {
-	if len(l.data) == 0 {
-		return nil
+// Errors returns all collected errors regardless of the severity
+func (l *LintRuleErrorsList) Errors() []LintRuleError {
+	return append([]LintRuleError(nil), l.data...)
+}
+
+// SetDefaultFilePath sets the path for errors that are not bound to a file
+func (l *LintRuleErrorsList) SetDefaultFilePath(path string) {
+	for i := range l.data {
+		if l.data[i].FilePath == "" {
+			l.data[i].FilePath = path
+		}
+	}
+}
+
+// HasErrors returns true if there are errors with the error severity
+func (l *LintRuleErrorsList) HasErrors() bool {
+	for _, err := range l.data {
+		if err.Severity != SeverityWarning {
+			return true
+		}
 	}
+	return false
+}
 
+func (l *LintRuleErrorsList) String() string {
 	builder := strings.Builder{}
 	for _, err := range l.data {
+		id := color.New(color.FgHiBlue).SprintfFunc()("[#%s]", err.ID)
+		if err.Severity == SeverityWarning {
+			id += color.New(color.FgYellow).SprintFunc()(" warning")
+		}
+
 		builder.WriteString(fmt.Sprintf(
 			"%s%s\n\tMessage\t- %s\n\tObject\t- %s\n",
 			emoji.Sprintf(":monkey:"),
-			color.New(color.FgHiBlue).SprintfFunc()("[#%s]", err.ID),
+			id,
 			color.New(color.FgRed).SprintfFunc()(err.Text),
 			err.ObjectID,
 		))
@@ -90,5 +127,15 @@ func (l *LintRuleErrorsList) ConvertToError() error {
 		}
 		builder.WriteString("\n")
 	}
-	return fmt.Errorf(builder.String())
+	return builder.String()
+}
+
+// ConvertToError returns an error only if there are errors with the error severity,
+// warnings are included to the message, but do not fail the linting on their own.
+func (l *LintRuleErrorsList) ConvertToError() error {
+	if !l.HasErrors() {
+		return nil
+	}
+
+	return errors.New(l.String())
 }
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errors
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type Severity string
+
+const (
+	// SeverityError fails the linting
+	SeverityError Severity = "error"
+	// SeverityWarning is reported, but does not fail the linting
+	SeverityWarning Severity = "warning"
+)
+
+func (s Severity) IsValid() bool {
+	return s == SeverityError || s == SeverityWarning
+}
+
+// Rule describes a lint rule. Every rule ID reported by the linter must be registered
+// by the package that implements the rule.
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = make(map[string]Rule)
+)
+
+// RegisterRule registers rules in the catalog, it is intended to be called from init functions.
+func RegisterRule(newRules ...Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	for _, rule := range newRules {
+		if _, ok := rules[rule.ID]; ok {
+			panic(fmt.Sprintf("lint rule %s is already registered", rule.ID))
+		}
+		if !rule.Severity.IsValid() {
+			panic(fmt.Sprintf("lint rule %s has invalid severity %q", rule.ID, rule.Severity))
+		}
+		rules[rule.ID] = rule
+	}
+}
+
+func GetRule(id string) (Rule, bool) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	rule, ok := rules[id]
+	return rule, ok
+}
+
+// Rules returns all registered rules sorted by ID
+func Rules() []Rule {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	result := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, rule)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
+
+// ruleSeverity returns the default severity of the rule, unknown rules are errors
+func ruleSeverity(id string) Severity {
+	if rule, ok := GetRule(id); ok {
+		return rule.Severity
+	}
+	return SeverityError
+}
@@ -27,10 +27,6 @@ import (
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
 )
 
-func skipModuleImageNameIfNeeded(filePath string) bool {
-	return filePath == "/deckhouse/modules/021-cni-cilium/images/cilium/Dockerfile"
-}
-
 var regexPatterns = map[string]string{
 	`$BASE_ALPINE`:           imageRegexp(`alpine:[\d.]+`),
 	`$BASE_DEBIAN`:           imageRegexp(`debian:[\d.]+`),
@@ -83,7 +79,7 @@ func checkImageNamesInDockerAndWerfFiles(lintRuleErrorsList *errors.LintRuleErro
 
 	if err != nil {
 		lintRuleErrorsList.Add(errors.NewLintRuleError(
-			"MODULE001",
+			"MODULE006",
 			moduleLabel(name),
 			imagesPath,
 			"Cannot read directory structure:%s",
@@ -92,10 +88,7 @@ func checkImageNamesInDockerAndWerfFiles(lintRuleErrorsList *errors.LintRuleErro
 		return
 	}
 	for _, filePath := range filePaths {
-		if skipModuleImageNameIfNeeded(filePath) {
-			continue
-		}
-		lintRuleErrorsList.Add(lintOneDockerfileOrWerfYAML(name, filePath, imagesPath))
+		lintRuleErrorsList.Add(lintOneDockerfileOrWerfYAML(name, filePath, imagesPath).WithFilePath(filePath))
 	}
 }
 
@@ -103,7 +96,7 @@ func lintOneDockerfileOrWerfYAML(name, filePath, imagesPath string) errors.LintR
 	file, err := os.Open(filePath)
 	if err != nil {
 		return errors.NewLintRuleError(
-			"MODULE001",
+			"MODULE006",
 			moduleLabel(name),
 			filePath,
 			"Error opening file:%s",
@@ -117,7 +110,7 @@ func lintOneDockerfileOrWerfYAML(name, filePath, imagesPath string) errors.LintR
 	relativeFilePath, err := filepath.Rel(imagesPath, filePath)
 	if err != nil {
 		return errors.NewLintRuleError(
-			"MODULE001",
+			"MODULE006",
 			moduleLabel(name),
 			filePath,
 			"Error calculating relative file path:%s",
@@ -137,7 +130,7 @@ func lintOneDockerfileOrWerfYAML(name, filePath, imagesPath string) errors.LintR
 		result, ciVariable := isImageNameUnacceptable(line)
 		if result {
 			return errors.NewLintRuleError(
-				"MODULE001",
+				"MODULE006",
 				fmt.Sprintf("module = %s, image = %s, line = %d", name, relativeFilePath, linePos),
 				line,
 				"Please use %s as an image name", ciVariable,
@@ -154,7 +147,7 @@ func lintOneDockerfileOrWerfYAML(name, filePath, imagesPath string) errors.LintR
 					result, message := isWerfInstructionUnacceptable(fromTrimmed)
 					if result {
 						return errors.NewLintRuleError(
-							"MODULE001",
+							"MODULE006",
 							fmt.Sprintf("module = %s, image = %s", name, relativeFilePath),
 							fromTrimmed,
 							message,
@@ -175,7 +168,7 @@ func lintOneDockerfileOrWerfYAML(name, filePath, imagesPath string) errors.LintR
 		result, message := isDockerfileInstructionUnacceptable(fromInstruction, lastInstruction)
 		if result {
 			return errors.NewLintRuleError(
-				"MODULE001",
+				"MODULE006",
 				fmt.Sprintf("module = %s, image = %s", name, relativeFilePath),
 				fromInstruction,
 				message,
@@ -25,6 +25,7 @@ import (
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/config"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/utils"
 )
@@ -41,6 +42,19 @@ const (
 
 var toHelmignore = []string{hooksDir, openapiDir, crdsDir, imagesDir, "enabled"}
 
+func init() {
+	errors.RegisterRule(
+		errors.Rule{ID: "MODULE001", Severity: errors.SeverityError, Description: "Module files must be listed in .helmignore"},
+		errors.Rule{ID: "MODULE002", Severity: errors.SeverityError, Description: "Module must have Chart.yaml, .namespace and values_matrix_test.yaml or openapi"},
+		errors.Rule{ID: "MODULE003", Severity: errors.SeverityError, Description: "Module must describe used open source projects in oss.yaml"},
+		errors.Rule{ID: "MODULE004", Severity: errors.SeverityError, Description: "CRDs must use apiextensions.k8s.io/v1"},
+		errors.Rule{ID: "MODULE005", Severity: errors.SeverityError, Description: "Module hooks must have the common_test.go file"},
+		errors.Rule{ID: "MODULE006", Severity: errors.SeverityError, Description: "Images must be built from the Deckhouse base images"},
+		errors.Rule{ID: "MODULE007", Severity: errors.SeverityError, Description: "Module linter configuration must be valid"},
+		errors.Rule{ID: "MODULE060", Severity: errors.SeverityError, Description: "Module monitoring rules must be deployed with templates/monitoring.yaml"},
+	)
+}
+
 func moduleLabel(n string) string {
 	return fmt.Sprintf("module = %s", n)
 }
@@ -143,8 +157,6 @@ func helmignoreModuleRule(name, path string) errors.LintRuleError {
 }
 
 func GetDeckhouseModulesWithValuesMatrixTests(focusNames map[string]struct{}) ([]utils.Module, error) {
-	var modules []utils.Module
-
 	var possibleModulesPaths []string
 	modulesDir, ok := os.LookupEnv("MODULES_DIR")
 	if !ok {
@@ -157,18 +169,32 @@ func GetDeckhouseModulesWithValuesMatrixTests(focusNames map[string]struct{}) ([
 		possibleModulesPaths = []string{modulesDir}
 	}
 
+	modules, lintRuleErrorsList, err := GetModules(possibleModulesPaths, focusNames)
+	if err != nil {
+		return modules, err
+	}
+	return modules, lintRuleErrorsList.ConvertToError()
+}
+
+// GetModules finds modules in the directories and lints their structure.
+// A directory can be a module directory or a directory that contains modules in subdirectories.
+func GetModules(dirs []string, focusNames map[string]struct{}) ([]utils.Module, errors.LintRuleErrorsList, error) {
+	var (
+		modules            []utils.Module
+		lintRuleErrorsList errors.LintRuleErrorsList
+	)
+
 	var modulesPaths []string
-	for _, possibleModuleDir := range possibleModulesPaths {
+	for _, possibleModuleDir := range dirs {
 		result, err := getModulePaths(possibleModuleDir)
 		if err != nil {
-			return modules, fmt.Errorf("search modules with %q: %v", ChartConfigFilename, err)
+			return modules, lintRuleErrorsList, fmt.Errorf("search modules with %q: %v", ChartConfigFilename, err)
 		}
 
 		modulesPaths = append(modulesPaths, result...)
 	}
 
 	hasFocusNames := len(focusNames) > 0
-	var lintRuleErrorsList errors.LintRuleErrorsList
 	for _, modulePath := range modulesPaths {
 		if hasFocusNames {
 			moduleName := filepath.Base(modulePath)
@@ -185,7 +211,7 @@ func GetDeckhouseModulesWithValuesMatrixTests(focusNames map[string]struct{}) ([
 		}
 		modules = append(modules, module)
 	}
-	return modules, lintRuleErrorsList.ConvertToError()
+	return modules, lintRuleErrorsList, nil
 }
 
 func isExistsOnFilesystem(parts ...string) bool {
@@ -238,29 +264,46 @@ func getModulePaths(modulesDir string) ([]string, error) {
 func lintModuleStructure(lintRuleErrorsList *errors.LintRuleErrorsList, modulePath string) (utils.Module, bool) {
 	moduleName := filepath.Base(modulePath)
 
-	lintRuleErrorsList.Add(helmignoreModuleRule(moduleName, modulePath))
-	lintRuleErrorsList.Add(commonTestGoForHooks(moduleName, modulePath))
-	checkImageNamesInDockerAndWerfFiles(lintRuleErrorsList, moduleName, modulePath)
+	var moduleErrors errors.LintRuleErrorsList
+	cfg, err := config.Load(modulePath)
+	if err != nil {
+		moduleErrors.Add(errors.NewLintRuleError(
+			"MODULE007",
+			moduleLabel(moduleName),
+			nil,
+			"Invalid linter configuration: %v", err,
+		).WithFilePath(filepath.Join(modulePath, config.Filename)))
+	}
+
+	// errors are filtered with the module configuration before reporting
+	defer func() {
+		moduleErrors.SetDefaultFilePath(modulePath)
+		lintRuleErrorsList.Merge(cfg.Apply(modulePath, moduleErrors))
+	}()
+
+	moduleErrors.Add(helmignoreModuleRule(moduleName, modulePath))
+	moduleErrors.Add(commonTestGoForHooks(moduleName, modulePath))
+	checkImageNamesInDockerAndWerfFiles(&moduleErrors, moduleName, modulePath)
 
 	name, lintError := chartModuleRule(moduleName, modulePath)
-	lintRuleErrorsList.Add(lintError)
+	moduleErrors.Add(lintError)
 	if name == "" {
 		return utils.Module{}, false
 	}
 
 	namespace, lintError := namespaceModuleRule(moduleName, modulePath)
-	lintRuleErrorsList.Add(lintError)
+	moduleErrors.Add(lintError)
 	if namespace == "" {
 		return utils.Module{}, false
 	}
 
 	if isExistsOnFilesystem(modulePath, crdsDir) {
-		lintRuleErrorsList.Merge(crdsModuleRule(moduleName, filepath.Join(modulePath, crdsDir)))
+		moduleErrors.Merge(crdsModuleRule(moduleName, filepath.Join(modulePath, crdsDir)))
 	}
 
-	lintRuleErrorsList.Merge(ossModuleRule(moduleName, modulePath))
-	lintRuleErrorsList.Add(monitoringModuleRule(moduleName, modulePath, namespace))
+	moduleErrors.Merge(ossModuleRule(moduleName, modulePath))
+	moduleErrors.Add(monitoringModuleRule(moduleName, modulePath, namespace))
 
-	module := utils.Module{Name: name, Path: modulePath, Namespace: namespace}
+	module := utils.Module{Name: name, Path: modulePath, Namespace: namespace, Config: cfg}
 	return module, true
 }
@@ -34,10 +34,10 @@ const ossFilename = "oss.yaml"
 func ossModuleRule(name, moduleRoot string) linterrors.LintRuleErrorsList {
 	lintErrors := linterrors.LintRuleErrorsList{}
 
-	if errs := verifyOssFile(name, moduleRoot); len(errs) > 0 {
+	if errs := verifyOssFile(moduleRoot); len(errs) > 0 {
 		for _, err := range errs {
 			ruleErr := linterrors.NewLintRuleError(
-				"MODULE001",
+				"MODULE003",
 				moduleLabel(name),
 				nil,
 				ossFileErrorMessage(err),
@@ -57,11 +57,7 @@ func ossFileErrorMessage(err error) string {
 	return fmt.Sprintf("Invalid %s: %s", ossFilename, err.Error())
 }
 
-func verifyOssFile(name, moduleRoot string) []error {
-	if shouldIgnoreOssInfo(name) {
-		return nil
-	}
-
+func verifyOssFile(moduleRoot string) []error {
 	projects, err := readOssFile(moduleRoot)
 	if err == nil && len(projects) == 0 {
 		err = fmt.Errorf("no projects described")
@@ -148,40 +144,6 @@ func parseProjectList(b []byte) ([]ossProject, error) {
 	return projects, nil
 }
 
-var skipOssChecks = map[string]struct{}{
-	// module name
-	"010-priority-class":                      {},
-	"013-helm":                                {}, // helm in 020-deckhouse
-	"021-kube-proxy":                          {},
-	"030-cloud-provider-aws":                  {},
-	"030-cloud-provider-azure":                {},
-	"030-cloud-provider-gcp":                  {},
-	"030-cloud-provider-openstack":            {},
-	"030-cloud-provider-vsphere":              {},
-	"030-cloud-provider-yandex":               {},
-	"035-cni-simple-bridge":                   {},
-	"140-user-authz":                          {},
-	"340-extended-monitoring":                 {},
-	"340-monitoring-applications":             {},
-	"340-monitoring-custom":                   {},
-	"340-monitoring-kubernetes-control-plane": {},
-	"340-monitoring-ping":                     {},
-	"350-node-local-dns":                      {},
-	"400-nginx-ingress":                       {}, // nginx in 402-ingress-nginx
-	"450-network-gateway":                     {},
-	"500-basic-auth":                          {}, // nginx in 402-ingress-nginx
-	"500-okmeter":                             {},
-	"500-upmeter":                             {},
-	"600-secret-copier":                       {},
-	"810-deckhouse-web":                       {},
-}
-
-// TODO When lintignore files will be implemented in modules, detect "oss.yaml" line in it
-func shouldIgnoreOssInfo(moduleName string) bool {
-	_, found := skipOssChecks[moduleName]
-	return found
-}
-
 type ossProject struct {
 	Name        string `yaml:"name"`           // example: Dex
 	Description string `yaml:"description"`    // example: A Federated OpenID Connect Provider with pluggable connectors
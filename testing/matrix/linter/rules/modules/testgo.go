@@ -48,7 +48,7 @@ func commonTestGoForHooks(name, path string) errors.LintRuleError {
 	commonTestPath := filepath.Join(path, hooksDir, "common_test.go")
 	if !isExistsOnFilesystem(commonTestPath) {
 		return errors.NewLintRuleError(
-			"MODULE001",
+			"MODULE005",
 			moduleLabel(name),
 			nil,
 			"Module does not contain %q file", commonTestPath,
@@ -58,7 +58,7 @@ func commonTestGoForHooks(name, path string) errors.LintRuleError {
 	contentBytes, err := ioutil.ReadFile(commonTestPath)
 	if err != nil {
 		return errors.NewLintRuleError(
-			"MODULE001",
+			"MODULE005",
 			moduleLabel(name),
 			nil,
 			"Module does not contain %q file", commonTestPath,
@@ -88,7 +88,7 @@ func commonTestGoForHooks(name, path string) errors.LintRuleError {
 		errstr := strings.Join(errs, "\n")
 
 		return errors.NewLintRuleError(
-			"MODULE001",
+			"MODULE005",
 			moduleLabel(name),
 			nil,
 			errstr,
@@ -39,6 +39,17 @@ func (s *nsLabelSelector) Matches(namespace string, labelSet labels.Set) bool {
 	return s.namespace == namespace && s.selector.Matches(labelSet)
 }
 
+func init() {
+	errors.RegisterRule(
+		errors.Rule{ID: "PDB001", Severity: errors.SeverityError, Description: "Pods of Deployments and StatefulSets must be covered by a PodDisruptionBudget"},
+		errors.Rule{ID: "PDB002", Severity: errors.SeverityError, Description: "Pods of DaemonSets must not be covered by a PodDisruptionBudget"},
+		errors.Rule{ID: "PDB003", Severity: errors.SeverityError, Description: "PodDisruptionBudget and its selector must be valid"},
+		errors.Rule{ID: "PDB004", Severity: errors.SeverityError, Description: "Pod controller must be parsable"},
+	)
+
+	rules.RegisterModuleCheck(ControllerMustHavePDB, DaemonSetMustNotHavePDB)
+}
+
 // ControllerMustHavePDB adds linting errors if there are pods from controllers which are not covered (except DaemonSets)
 // by a PodDisruptionBudget
 func ControllerMustHavePDB(linter *rules.ObjectLinter) {
@@ -177,7 +188,7 @@ func parsePDBSelector(pdbObj storage.StoreObject) (labels.Selector, errors.LintR
 	err := converter.FromUnstructured(content, pdb)
 	if err != nil {
 		lerr := errors.NewLintRuleError(
-			"PDB002",
+			"PDB003",
 			pdbObj.Identity(),
 			err,
 			"Cannot parse PodDisruptionBudget")
@@ -18,7 +18,6 @@ package resources
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/flant/addon-operator/sdk"
 	appsv1 "k8s.io/api/apps/v1"
@@ -27,10 +26,21 @@ import (
 
 	"github.com/deckhouse/deckhouse/go_lib/set"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules"
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/storage"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/utils"
 )
 
+func init() {
+	errors.RegisterRule(errors.Rule{
+		ID:          "VPA005",
+		Severity:    errors.SeverityError,
+		Description: "Pod controllers must have a VPA with resource policies for all containers",
+	})
+
+	rules.RegisterModuleCheck(ControllerMustHaveVPA)
+}
+
 // ControllerMustHaveVPA fills linting error regarding VPA
 func ControllerMustHaveVPA(linter *rules.ObjectLinter) {
 	if !linter.CheckModuleEnabled("vertical-pod-autoscaler-crd") {
@@ -42,8 +52,7 @@ func ControllerMustHaveVPA(linter *rules.ObjectLinter) {
 	vpaTargets, vpaTolerationGroups, vpaContainerNamesMap := parseTargetsAndTolerationGroups(scope)
 
 	for index, object := range scope.Objects() {
-		// Skip non-pod controllers and modules which control VPA themselves
-		if !isPodController(object.Unstructured.GetKind()) || shouldSkipModuleResource(linter.Module.Name, &index) {
+		if !isPodController(object.Unstructured.GetKind()) {
 			continue
 		}
 
@@ -71,37 +80,6 @@ func isPodControllerDaemonSet(kind string) bool {
 	return kind == "DaemonSet"
 }
 
-func shouldSkipModuleResource(moduleName string, r *storage.ResourceIndex) bool {
-	switch moduleName {
-	// Controllers VPA is configured through cr settings
-	case "ingress-nginx":
-		return r.Kind == "DaemonSet" && r.Namespace == "d8-ingress-nginx" && strings.HasPrefix(r.Name, "controller-")
-
-	// Controllers VPA is configured through cm settings
-	case "log-shipper":
-		return r.Kind == "DaemonSet" && r.Namespace == "d8-log-shipper" && r.Name == "log-shipper-agent"
-
-	// Controllers VPA is configured through cm settings
-	case "cni-cilium":
-		return r.Kind == "DaemonSet" && r.Namespace == "d8-cni-cilium" && r.Name == "agent"
-
-	// Linstor resources requests is configured by operator
-	case "linstor":
-		return r.Kind == "Deployment" && r.Namespace == "d8-linstor" && r.Name == "piraeus-operator"
-
-	// Network gateway snat daemonset tolerations is configured through module values
-	case "network-gateway":
-		return r.Kind == "DaemonSet" && r.Namespace == "d8-network-gateway" && r.Name == "snat"
-
-	// Metal LB speaker daemonset tolerations is configured through module values
-	case "metallb":
-		return r.Kind == "DaemonSet" && r.Namespace == "d8-metallb" && r.Name == "speaker"
-
-	default:
-		return false
-	}
-}
-
 // parseTargetsAndTolerationGroups resolves target resource indexes
 func parseTargetsAndTolerationGroups(scope *lintingScope) (map[storage.ResourceIndex]struct{}, map[storage.ResourceIndex]string, map[storage.ResourceIndex]set.Set) {
 	vpaTargets := make(map[storage.ResourceIndex]struct{})
@@ -25,6 +25,14 @@ import (
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/utils"
 )
 
+func init() {
+	errors.RegisterRule(errors.Rule{
+		ID:          "MANIFEST054",
+		Severity:    errors.SeverityError,
+		Description: "RoleBindings must refer to ServiceAccounts that exist in the module",
+	})
+}
+
 func ObjectBindingSubjectServiceAccountCheck(m utils.Module, object storage.StoreObject, objectStore *storage.UnstructuredObjectStore) errors.LintRuleError {
 	if m.Name == "user-authz" {
 		return errors.EmptyRuleError
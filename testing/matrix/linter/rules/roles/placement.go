@@ -33,6 +33,14 @@ const (
 	RootRBACToUsPath            = "templates/rbac-to-us.yaml"
 )
 
+func init() {
+	errors.RegisterRule(errors.Rule{
+		ID:          "MANIFEST053",
+		Severity:    errors.SeverityError,
+		Description: "RBAC objects and ServiceAccounts must follow the module naming and placement conventions",
+	})
+}
+
 func isSystemNamespace(actual string) bool {
 	return actual == "default" || actual == "kube-system"
 }
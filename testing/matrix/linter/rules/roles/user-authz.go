@@ -26,6 +26,14 @@ import (
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/utils"
 )
 
+func init() {
+	errors.RegisterRule(errors.Rule{
+		ID:          "MANIFEST051",
+		Severity:    errors.SeverityError,
+		Description: "User-authz ClusterRoles must be defined in templates/user-authz-cluster-roles.yaml with the access-level annotation",
+	})
+}
+
 /*
 ObjectUserAuthzClusterRolePath validates that files for user-authz contains only cluster roles.
 Also, it validates that role names equals to d8:user-authz:<ChartName>:<AccessLevel>
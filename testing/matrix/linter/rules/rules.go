@@ -18,7 +18,6 @@ package rules
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	appsv1 "k8s.io/api/apps/v1"
@@ -33,53 +32,59 @@ import (
 
 const defaultRegistry = "registry.example.com/deckhouse"
 
-func skipObjectIfNeeded(o *storage.StoreObject) bool {
-	// Dynatrace module deprecated and will be removed
-	if o.Unstructured.GetKind() == "Deployment" && o.Unstructured.GetNamespace() == "d8-dynatrace" {
-		return true
-	}
-	// Control plane configurator module used only in kops clusters and will be removed
-	if o.Unstructured.GetKind() == "DaemonSet" && o.Unstructured.GetNamespace() == "d8-system" &&
-		o.Unstructured.GetName() == "control-plane-configurator" {
-		return true
-	}
-	// Control plane proxy uses `flant/kube-ca-auth-proxy` with nginx and should be refactored
-	if o.Unstructured.GetKind() == "DaemonSet" && o.Unstructured.GetNamespace() == "d8-monitoring" &&
-		strings.HasPrefix(o.Unstructured.GetName(), "control-plane-proxy") {
-		return true
-	}
-	// Ingress Nginx has a lot of hardcoded configuration, which makes it hard to get secured
-	if o.Unstructured.GetKind() == "DaemonSet" && o.Unstructured.GetNamespace() == "d8-ingress-nginx" {
-		return true
-	}
-	// Istio kiali needs to patch index.html file
-	if o.Unstructured.GetKind() == "Deployment" && o.Unstructured.GetNamespace() == "d8-istio" &&
-		o.Unstructured.GetName() == "kiali" {
-		return true
-	}
-
-	return false
-}
+func init() {
+	errors.RegisterRule(
+		errors.Rule{ID: "CONTAINER001", Severity: errors.SeverityError, Description: "Container names must be unique"},
+		errors.Rule{ID: "CONTAINER002", Severity: errors.SeverityError, Description: "Container env variable names must be unique"},
+		errors.Rule{ID: "CONTAINER003", Severity: errors.SeverityError, Description: "Images must be deployed from the default registry"},
+		errors.Rule{ID: "CONTAINER004", Severity: errors.SeverityError, Description: "Image tag must be imageHash"},
+		errors.Rule{ID: "CONTAINER005", Severity: errors.SeverityError, Description: "Container securityContext must be defined"},
+		errors.Rule{ID: "CONTAINER006", Severity: errors.SeverityError, Description: "Container ephemeral storage requests must be defined"},
+		errors.Rule{ID: "CONTAINER007", Severity: errors.SeverityError, Description: "Containers in hostNetwork must use ports below 10500"},
+		errors.Rule{ID: "CONTAINER008", Severity: errors.SeverityError, Description: "Container imagePullPolicy must be unspecified or IfNotPresent"},
+		errors.Rule{ID: "CONTAINER009", Severity: errors.SeverityError, Description: "Containers must not use ports <= 1024"},
+		errors.Rule{ID: "MANIFEST001", Severity: errors.SeverityError, Description: "Objects must have the module and heritage labels"},
+		errors.Rule{ID: "MANIFEST002", Severity: errors.SeverityError, Description: "Objects must not use deprecated API versions"},
+		errors.Rule{ID: "MANIFEST003", Severity: errors.SeverityError, Description: "Pod securityContext must define runAsNonRoot, runAsUser and runAsGroup"},
+		errors.Rule{ID: "MANIFEST007", Severity: errors.SeverityError, Description: "Objects must be convertible to their Kubernetes types"},
+		errors.Rule{ID: "MANIFEST008", Severity: errors.SeverityError, Description: "Deployment revisionHistoryLimit must be less or equal to 2"},
+		errors.Rule{ID: "MANIFEST009", Severity: errors.SeverityError, Description: "Pod controllers must use an allowed priority class"},
+		errors.Rule{ID: "MANIFEST010", Severity: errors.SeverityError, Description: "dnsPolicy must be ClusterFirstWithHostNet in hostNetwork"},
+	)
 
-func skipObjectContainerIfNeeded(o *storage.StoreObject, c *v1.Container) bool {
-	// Control plane manager image-holder containers run `/pause` and has no additional parameters
-	if o.Unstructured.GetKind() == "DaemonSet" && o.Unstructured.GetNamespace() == "kube-system" &&
-		o.Unstructured.GetName() == "d8-control-plane-manager" &&
-		strings.HasPrefix(c.Name, "image-holder") {
-		return true
-	}
-	// Coredns listens :53 port in hostNetwork
-	if o.Unstructured.GetKind() == "DaemonSet" && (o.Unstructured.GetNamespace() == "d8-system") || (o.Unstructured.GetNamespace() == "kube-system") &&
-		o.Unstructured.GetName() == "node-local-dns" && c.Name == "coredns" {
-		return true
-	}
-	// Chrony listens :123 port in hostNetwork
-	if o.Unstructured.GetKind() == "DaemonSet" && o.Unstructured.GetNamespace() == "d8-chrony" &&
-		o.Unstructured.GetName() == "chrony" && c.Name == "chrony" {
-		return true
-	}
+	RegisterObjectCheck(
+		objectCheck(objectRecommendedLabels),
+		objectCheck(containerNameDuplicates),
+		objectCheck(objectAPIVersion),
+		func(l *ObjectLinter, o storage.StoreObject) errors.LintRuleError {
+			if !l.CheckModuleEnabled("priority-class") {
+				return errors.EmptyRuleError
+			}
+			return objectPriorityClass(o)
+		},
+		objectCheck(objectDNSPolicy),
+		func(l *ObjectLinter, o storage.StoreObject) errors.LintRuleError {
+			return roles.ObjectUserAuthzClusterRolePath(l.Module, o)
+		},
+		func(l *ObjectLinter, o storage.StoreObject) errors.LintRuleError {
+			return roles.ObjectRBACPlacement(l.Module, o)
+		},
+		func(l *ObjectLinter, o storage.StoreObject) errors.LintRuleError {
+			return roles.ObjectBindingSubjectServiceAccountCheck(l.Module, o, l.ObjectStore)
+		},
+		objectCheck(objectSecurityContext),
+		objectCheck(objectRevisionHistoryLimit),
+		objectCheck(objectHostNetworkPorts),
+	)
 
-	return false
+	RegisterContainerCheck(
+		containerEnvVariablesDuplicates,
+		containerImageTagCheck,
+		containerImagePullPolicy,
+		containerStorageEphemeral,
+		containerSecurityContext,
+		containerPorts,
+	)
 }
 
 type ObjectLinter struct {
@@ -95,31 +100,9 @@ func (l *ObjectLinter) CheckModuleEnabled(name string) bool {
 	return ok
 }
 
-func (l *ObjectLinter) ApplyContainerRules(object storage.StoreObject) {
-	containers, err := object.GetContainers()
-	if err != nil {
-		panic(err)
-	}
-	if len(containers) == 0 {
-		return
-	}
-
-	l.ErrorsList.Add(containerNameDuplicates(object, containers))
-	l.ErrorsList.Add(containerEnvVariablesDuplicates(object, containers))
-	l.ErrorsList.Add(containerImageTagCheck(object, containers))
-	l.ErrorsList.Add(containersImagePullPolicy(object, containers))
-
-	if !skipObjectIfNeeded(&object) {
-		l.ErrorsList.Add(containerStorageEphemeral(object, containers))
-		l.ErrorsList.Add(containerSecurityContext(object, containers))
-		l.ErrorsList.Add(containerPorts(object, containers))
-	}
-}
-
-func containersImagePullPolicy(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
+func containerImagePullPolicy(object storage.StoreObject, c v1.Container) errors.LintRuleError {
 	o := object.Unstructured
-	if o.GetNamespace() == "d8-system" && o.GetKind() == "Deployment" && o.GetName() == "deckhouse" {
-		c := containers[0]
+	if o.GetNamespace() == "d8-system" && o.GetKind() == "Deployment" && o.GetName() == "deckhouse" && c.Name == "deckhouse" {
 		if c.ImagePullPolicy != "Always" {
 			// image pull policy must be Always,
 			// because changing d8-system/deckhouse-registry triggers restart deckhouse deployment
@@ -127,7 +110,7 @@ func containersImagePullPolicy(object storage.StoreObject, containers []v1.Conta
 			// and restarting deckhouse with invalid creads will break all static pods on masters
 			// and bashible
 			return errors.NewLintRuleError(
-				"CONTAINER004",
+				"CONTAINER008",
 				object.Identity()+"; container = "+c.Name,
 				c.ImagePullPolicy,
 				"Container imagePullPolicy should be unspecified or \"Always\"",
@@ -137,10 +120,23 @@ func containersImagePullPolicy(object storage.StoreObject, containers []v1.Conta
 		return errors.EmptyRuleError
 	}
 
-	return containerImagePullPolicyIfNotPresent(object, containers)
+	if c.ImagePullPolicy == "" || c.ImagePullPolicy == "IfNotPresent" {
+		return errors.EmptyRuleError
+	}
+	return errors.NewLintRuleError(
+		"CONTAINER008",
+		object.Identity()+"; container = "+c.Name,
+		c.ImagePullPolicy,
+		"Container imagePullPolicy should be unspecified or \"IfNotPresent\"",
+	)
 }
 
-func containerNameDuplicates(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
+func containerNameDuplicates(object storage.StoreObject) errors.LintRuleError {
+	containers, err := object.GetContainers()
+	if err != nil {
+		return newConvertError(object, err)
+	}
+
 	names := make(map[string]struct{})
 	for _, c := range containers {
 		if _, ok := names[c.Name]; ok {
@@ -151,163 +147,91 @@ func containerNameDuplicates(object storage.StoreObject, containers []v1.Contain
 	return errors.EmptyRuleError
 }
 
-func containerEnvVariablesDuplicates(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
-	for _, c := range containers {
-		envVariables := make(map[string]struct{})
-		for _, variable := range c.Env {
-			if _, ok := envVariables[variable.Name]; ok {
-				return errors.NewLintRuleError(
-					"CONTAINER002",
-					object.Identity()+"; container = "+c.Name,
-					variable.Name,
-					"Container has two env variables with same name",
-				)
-			}
-			envVariables[variable.Name] = struct{}{}
+func containerEnvVariablesDuplicates(object storage.StoreObject, c v1.Container) errors.LintRuleError {
+	envVariables := make(map[string]struct{})
+	for _, variable := range c.Env {
+		if _, ok := envVariables[variable.Name]; ok {
+			return errors.NewLintRuleError(
+				"CONTAINER002",
+				object.Identity()+"; container = "+c.Name,
+				variable.Name,
+				"Container has two env variables with same name",
+			)
 		}
+		envVariables[variable.Name] = struct{}{}
 	}
 	return errors.EmptyRuleError
 }
 
-func shouldSkipModuleContainer(module string, container string) bool {
-	// okmeter module uses images from external repo - registry.okmeter.io/agent/okagent:stub
-	if module == "okmeter" && container == "okagent" {
-		return true
-	}
-	// control-plane-manager uses `$images` as dict to render static pod manifests,
-	// so we cannot use helm lib `helm_lib_module_image` helper because `$images`
-	// is also rendered in `dhctl` tool on cluster bootstrap.
-	if module == "d8-control-plane-manager" && strings.HasPrefix(container, "image-holder") {
-		return true
+func containerImageTagCheck(object storage.StoreObject, c v1.Container) errors.LintRuleError {
+	t, err := name.NewTag(c.Image)
+	if err != nil {
+		return errors.NewLintRuleError(
+			"CONTAINER003",
+			object.Identity()+"; container = "+c.Name,
+			nil,
+			"Can't parse an image for container: %v", err,
+		)
 	}
-	return false
-}
-
-func containerImageTagCheck(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
-	for _, c := range containers {
-		if shouldSkipModuleContainer(object.Unstructured.GetName(), c.Name) {
-			continue
-		}
+	registry := fmt.Sprintf("%s/%s", t.RegistryStr(), t.RepositoryStr())
+	tag := t.TagStr()
 
-		t, err := name.NewTag(c.Image)
-		if err != nil {
-			return errors.NewLintRuleError(
-				"CONTAINER003",
-				object.Identity()+"; container = "+c.Name,
-				nil,
-				"Can't parse an image for container: %v", err,
-			)
-		}
-		registry := fmt.Sprintf("%s/%s", t.RegistryStr(), t.RepositoryStr())
-		tag := t.TagStr()
-
-		if registry != defaultRegistry {
-			return errors.NewLintRuleError("CONTAINER003",
-				object.Identity()+"; container = "+c.Name,
-				nil,
-				"All images must be deployed from the same default registry - "+defaultRegistry,
-			)
-		}
+	if registry != defaultRegistry {
+		return errors.NewLintRuleError("CONTAINER003",
+			object.Identity()+"; container = "+c.Name,
+			nil,
+			"All images must be deployed from the same default registry - "+defaultRegistry,
+		)
+	}
 
-		if tag != "imageHash" {
-			return errors.NewLintRuleError("CONTAINER004",
-				object.Identity()+"; container = "+c.Name,
-				nil,
-				"Image tag should be `imageHash`",
-			)
-		}
+	if tag != "imageHash" {
+		return errors.NewLintRuleError("CONTAINER004",
+			object.Identity()+"; container = "+c.Name,
+			nil,
+			"Image tag should be `imageHash`",
+		)
 	}
 	return errors.EmptyRuleError
 }
 
-func containerImagePullPolicyIfNotPresent(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
-	for _, c := range containers {
-		if c.ImagePullPolicy == "" || c.ImagePullPolicy == "IfNotPresent" {
-			continue
-		}
+func containerStorageEphemeral(object storage.StoreObject, c v1.Container) errors.LintRuleError {
+	if c.Resources.Requests.StorageEphemeral() == nil || c.Resources.Requests.StorageEphemeral().Value() == 0 {
 		return errors.NewLintRuleError(
-			"CONTAINER004",
+			"CONTAINER006",
 			object.Identity()+"; container = "+c.Name,
-			c.ImagePullPolicy,
-			"Container imagePullPolicy should be unspecified or \"IfNotPresent\"",
+			nil,
+			"Container StorageEphemeral is not defined in Resources.Requests",
 		)
 	}
 	return errors.EmptyRuleError
 }
 
-func containerStorageEphemeral(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
-	for _, c := range containers {
-		if skipObjectContainerIfNeeded(&object, &c) {
-			continue
-		}
-		if c.Resources.Requests.StorageEphemeral() == nil || c.Resources.Requests.StorageEphemeral().Value() == 0 {
-			return errors.NewLintRuleError(
-				"CONTAINER006",
-				object.Identity()+"; container = "+c.Name,
-				nil,
-				"Container StorageEphemeral is not defined in Resources.Requests",
-			)
-		}
+func containerSecurityContext(object storage.StoreObject, c v1.Container) errors.LintRuleError {
+	if c.SecurityContext == nil {
+		return errors.NewLintRuleError(
+			"CONTAINER005",
+			object.Identity()+"; container = "+c.Name,
+			nil,
+			"Container SecurityContext is not defined",
+		)
 	}
 	return errors.EmptyRuleError
 }
 
-func containerSecurityContext(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
-	for _, c := range containers {
-		if skipObjectContainerIfNeeded(&object, &c) {
-			continue
-		}
-		if c.SecurityContext == nil {
+func containerPorts(object storage.StoreObject, c v1.Container) errors.LintRuleError {
+	for _, p := range c.Ports {
+		if p.ContainerPort <= 1024 {
 			return errors.NewLintRuleError(
-				"CONTAINER005",
+				"CONTAINER009",
 				object.Identity()+"; container = "+c.Name,
-				nil,
-				"Container SecurityContext is not defined",
+				p.ContainerPort,
+				"Container uses port <= 1024",
 			)
 		}
 	}
 	return errors.EmptyRuleError
 }
 
-func containerPorts(object storage.StoreObject, containers []v1.Container) errors.LintRuleError {
-	for _, c := range containers {
-		if skipObjectContainerIfNeeded(&object, &c) {
-			continue
-		}
-		for _, p := range c.Ports {
-			if p.ContainerPort <= 1024 {
-				return errors.NewLintRuleError(
-					"CONTAINER006",
-					object.Identity()+"; container = "+c.Name,
-					p.ContainerPort,
-					"Container uses port <= 1024",
-				)
-			}
-		}
-	}
-	return errors.EmptyRuleError
-}
-
-func (l *ObjectLinter) ApplyObjectRules(object storage.StoreObject) {
-	l.ErrorsList.Add(objectRecommendedLabels(object))
-	l.ErrorsList.Add(objectAPIVersion(object))
-	if l.CheckModuleEnabled("priority-class") {
-		l.ErrorsList.Add(objectPriorityClass(object))
-	}
-	l.ErrorsList.Add(objectDNSPolicy(object))
-
-	l.ErrorsList.Add(roles.ObjectUserAuthzClusterRolePath(l.Module, object))
-	l.ErrorsList.Add(roles.ObjectRBACPlacement(l.Module, object))
-	l.ErrorsList.Add(roles.ObjectBindingSubjectServiceAccountCheck(l.Module, object, l.ObjectStore))
-
-	if !skipObjectIfNeeded(&object) {
-		l.ErrorsList.Add(objectSecurityContext(object))
-	}
-
-	l.ErrorsList.Add(objectRevisionHistoryLimit(object))
-	l.ErrorsList.Add(objectHostNetworkPorts(object))
-}
-
 func objectRecommendedLabels(object storage.StoreObject) errors.LintRuleError {
 	labels := object.Unstructured.GetLabels()
 	if _, ok := labels["module"]; !ok {
@@ -453,7 +377,7 @@ func objectPriorityClass(object storage.StoreObject) errors.LintRuleError {
 	switch priorityClass {
 	case "":
 		return errors.NewLintRuleError(
-			"MANIFEST007",
+			"MANIFEST009",
 			object.Identity(),
 			priorityClass,
 			"Priority class must not be empty",
@@ -461,7 +385,7 @@ func objectPriorityClass(object storage.StoreObject) errors.LintRuleError {
 	case "system-node-critical", "system-cluster-critical", "cluster-medium", "cluster-low" /* TODO: delete after migrating to 1.19 -> */, "cluster-critical":
 	default:
 		return errors.NewLintRuleError(
-			"MANIFEST007",
+			"MANIFEST009",
 			object.Identity(),
 			priorityClass,
 			"Priority class is not allowed",
@@ -600,8 +524,6 @@ func objectHostNetworkPorts(object storage.StoreObject) errors.LintRuleError {
 
 func objectDNSPolicy(object storage.StoreObject) errors.LintRuleError {
 	kind := object.Unstructured.GetKind()
-	name := object.Unstructured.GetName()
-	namespace := object.Unstructured.GetNamespace()
 	converter := runtime.DefaultUnstructuredConverter
 
 	var dnsPolicy string
@@ -642,10 +564,6 @@ func objectDNSPolicy(object storage.StoreObject) errors.LintRuleError {
 		return errors.EmptyRuleError
 	}
 
-	if shouldSkipDNSPolicyResource(name, kind, namespace, hostNetwork, dnsPolicy) {
-		return errors.EmptyRuleError
-	}
-
 	if !hostNetwork {
 		return errors.EmptyRuleError
 	}
@@ -655,28 +573,9 @@ func objectDNSPolicy(object storage.StoreObject) errors.LintRuleError {
 	}
 
 	return errors.NewLintRuleError(
-		"MANIFEST007",
+		"MANIFEST010",
 		object.Identity(),
 		dnsPolicy,
 		"dnsPolicy must be `ClusterFirstWithHostNet` when hostNetwork is `true`",
 	)
 }
-
-func shouldSkipDNSPolicyResource(name string, kind string, namespace string, hostNetwork bool, dnsPolicy string) bool {
-	switch name {
-	// Cloud controller manager should work if cluster dns isn't responding or if cni isn't working
-	case "cloud-controller-manager":
-		return kind == "Deployment" && strings.HasPrefix(namespace, "d8-cloud-provider-") && hostNetwork && dnsPolicy == "Default"
-
-	// Bashible-apiserver should work if cluster dns isn't responding or if cni isn't working
-	case "bashible-apiserver":
-		return kind == "Deployment" && namespace == "d8-cloud-instance-manager" && hostNetwork && dnsPolicy == "Default"
-
-	// Deckhouse main pod use Default policy when cluster isn't bootstrapped
-	case "deckhouse":
-		return kind == "Deployment" && namespace == "d8-system" && hostNetwork && dnsPolicy == "Default"
-
-	default:
-		return false
-	}
-}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/errors"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/rules/modules"
 	"github.com/deckhouse/deckhouse/testing/matrix/linter/utils"
 )
@@ -40,41 +41,60 @@ func isExist(baseDir, filename string) bool {
 }
 
 func Run(tmpDir string, m utils.Module) error {
-	var err error
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Printf("panic on linter run occurred: %v\n", r)
 		}
 	}()
 
-	// Silence default loggers
-	log.SetOutput(ioutil.Discard)      // helm
-	logrus.SetLevel(logrus.PanicLevel) // shell-operator
-
-	var values []string
+	values, err := moduleValues(tmpDir, m)
 	if err != nil {
 		return err
 	}
 
-	if isExist(m.Path, "openapi") && !isExist(m.Path, "values_matrix_test.yaml") {
-		values, err = ComposeValuesFromSchemas(m)
-		if err != nil {
-			return fmt.Errorf("saving values from openapi: %v", err)
-		}
-	} else {
-		f, err := LoadConfiguration(filepath.Join(m.Path, modules.ValuesConfigFilename), "", tmpDir)
-		if err != nil {
-			return fmt.Errorf("configuration loading error: %v", err)
+	return NewModuleController(m, values).Run()
+}
+
+// Lint renders the module with all generated values and returns errors found by lint rules
+func Lint(tmpDir string, m utils.Module) (lintErrors errors.LintRuleErrorsList, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic on linter run occurred: %v", r)
 		}
-		defer f.Close()
+	}()
+
+	values, err := moduleValues(tmpDir, m)
+	if err != nil {
+		return lintErrors, err
+	}
+
+	return NewModuleController(m, values).Lint()
+}
 
-		f.FindAll()
+func moduleValues(tmpDir string, m utils.Module) ([]string, error) {
+	// Silence default loggers
+	log.SetOutput(ioutil.Discard)      // helm
+	logrus.SetLevel(logrus.PanicLevel) // shell-operator
 
-		values, err = f.ReturnValues()
+	if isExist(m.Path, "openapi") && !isExist(m.Path, "values_matrix_test.yaml") {
+		values, err := ComposeValuesFromSchemas(m)
 		if err != nil {
-			return fmt.Errorf("saving values error: %v", err)
+			return nil, fmt.Errorf("saving values from openapi: %v", err)
 		}
+		return values, nil
 	}
 
-	return NewModuleController(m, values).Run()
+	f, err := LoadConfiguration(filepath.Join(m.Path, modules.ValuesConfigFilename), "", tmpDir)
+	if err != nil {
+		return nil, fmt.Errorf("configuration loading error: %v", err)
+	}
+	defer f.Close()
+
+	f.FindAll()
+
+	values, err := f.ReturnValues()
+	if err != nil {
+		return nil, fmt.Errorf("saving values error: %v", err)
+	}
+	return values, nil
 }
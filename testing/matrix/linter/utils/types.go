@@ -16,8 +16,12 @@ limitations under the License.
 
 package utils
 
+import "github.com/deckhouse/deckhouse/testing/matrix/linter/rules/config"
+
 type Module struct {
 	Name      string
 	Namespace string
 	Path      string
+	// Config is the linter configuration from the module directory
+	Config *config.ModuleConfig
 }
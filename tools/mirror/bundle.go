@@ -0,0 +1,359 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+const (
+	formatLayout  = "layout"
+	formatTarball = "tarball"
+
+	// refNameAnnotation keeps the image reference relative to the edition repository in the OCI layout index.
+	refNameAnnotation = "org.opencontainers.image.ref.name"
+
+	partialSuffix = ".partial"
+)
+
+// bundle is a local directory with images.
+type bundle interface {
+	// Has reports if the image is already in the bundle, the digest is empty if it is unknown.
+	Has(ref string, digest v1.Hash) (bool, error)
+	Write(ref string, img v1.Image) error
+	Image(ref string) (v1.Image, error)
+	Refs() ([]string, error)
+}
+
+// openBundle opens the bundle in the directory. Format is detected for the existing bundle if it is empty.
+func openBundle(dir, format string) (bundle, error) {
+	if format == "" {
+		format = formatTarball
+		if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+			format = formatLayout
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case formatLayout:
+		return openLayoutBundle(dir)
+	case formatTarball:
+		return &tarballBundle{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown bundle format %q, must be %s or %s", format, formatLayout, formatTarball)
+	}
+}
+
+// layoutBundle stores images in the OCI image layout. Blobs are shared between images and releases,
+// so a blob is downloaded once. Blobs are written to temporary files and renamed only after
+// the digest is verified, an interrupted pull never leaves a broken blob.
+type layoutBundle struct {
+	path layout.Path
+
+	// mu guards index.json
+	mu sync.Mutex
+}
+
+func openLayoutBundle(dir string) (*layoutBundle, error) {
+	p, err := layout.FromPath(dir)
+	if err != nil {
+		p, err = layout.Write(dir, empty.Index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// remove leftovers of interrupted pulls
+	partials, err := filepath.Glob(filepath.Join(dir, "blobs", "*", "*"+partialSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, partial := range partials {
+		if err := os.Remove(partial); err != nil {
+			return nil, err
+		}
+	}
+
+	return &layoutBundle{path: p}, nil
+}
+
+func (b *layoutBundle) descriptor(ref string) (*v1.Descriptor, error) {
+	index, err := b.path.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range manifest.Manifests {
+		if desc.Annotations[refNameAnnotation] == ref {
+			desc := desc
+			return &desc, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (b *layoutBundle) Has(ref string, digest v1.Hash) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	desc, err := b.descriptor(ref)
+	if err != nil || desc == nil {
+		return false, err
+	}
+
+	return digest == v1.Hash{} || desc.Digest == digest, nil
+}
+
+func (b *layoutBundle) Write(ref string, img v1.Image) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		err = b.writeBlob(digest, layer.Compressed)
+		if err != nil {
+			return err
+		}
+	}
+
+	configName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	config, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	err = b.writeBlob(configName, bytesReader(config))
+	if err != nil {
+		return err
+	}
+
+	// the manifest is the last, the image is complete when it exists
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	manifest, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	err = b.writeBlob(digest, bytesReader(manifest))
+	if err != nil {
+		return err
+	}
+
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err = b.path.RemoveDescriptors(match.Annotation(refNameAnnotation, ref))
+	if err != nil {
+		return err
+	}
+
+	return b.path.AppendDescriptor(v1.Descriptor{
+		MediaType:   mediaType,
+		Size:        int64(len(manifest)),
+		Digest:      digest,
+		Annotations: map[string]string{refNameAnnotation: ref},
+	})
+}
+
+// writeBlob writes the blob if it does not exist. The content is verified against the digest.
+func (b *layoutBundle) writeBlob(digest v1.Hash, open func() (io.ReadCloser, error)) error {
+	dir := filepath.Join(string(b.path), "blobs", digest.Algorithm)
+	file := filepath.Join(dir, digest.Hex)
+
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return retry("download blob "+digest.String(), func() error {
+		rc, err := open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		tmp, err := ioutil.TempFile(dir, digest.Hex+".*"+partialSuffix)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+
+		hash, _, err := v1.SHA256(io.TeeReader(rc, tmp))
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		if hash != digest {
+			return fmt.Errorf("digest mismatch, got %s", hash)
+		}
+
+		return os.Rename(tmp.Name(), file)
+	})
+}
+
+func (b *layoutBundle) Image(ref string) (v1.Image, error) {
+	b.mu.Lock()
+	desc, err := b.descriptor(ref)
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if desc == nil {
+		return nil, fmt.Errorf("image %s is not found in the bundle", ref)
+	}
+
+	return b.path.Image(desc.Digest)
+}
+
+func (b *layoutBundle) Refs() ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	index, err := b.path.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, 0, len(manifest.Manifests))
+	for _, desc := range manifest.Manifests {
+		if ref, ok := desc.Annotations[refNameAnnotation]; ok {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+
+	return refs, nil
+}
+
+// tarballBundle stores every image in a separate tarball (docker save format) named after the ref,
+// e.g., "v1.35.0" or "install:v1.35.0". The format is supported by old tools, but blobs are not shared.
+type tarballBundle struct {
+	dir string
+}
+
+func (b *tarballBundle) file(ref string) string {
+	return filepath.Join(b.dir, ref)
+}
+
+// Has checks only the file existence, tags of Deckhouse images are immutable.
+func (b *tarballBundle) Has(ref string, _ v1.Hash) (bool, error) {
+	_, err := os.Stat(b.file(ref))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *tarballBundle) Write(ref string, img v1.Image) error {
+	tag, err := name.NewTag("mirror.local/deckhouse:" + strings.ReplaceAll(ref, ":", "-"))
+	if err != nil {
+		return err
+	}
+
+	return retry("write "+ref, func() error {
+		tmp, err := ioutil.TempFile(b.dir, "."+strings.ReplaceAll(ref, ":", "-")+".*"+partialSuffix)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+
+		err = tarball.Write(tag, img, tmp)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+
+		return os.Rename(tmp.Name(), b.file(ref))
+	})
+}
+
+func (b *tarballBundle) Image(ref string) (v1.Image, error) {
+	return tarball.ImageFromPath(b.file(ref), nil)
+}
+
+func (b *tarballBundle) Refs() ([]string, error) {
+	entries, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		refs = append(refs, entry.Name())
+	}
+	sort.Strings(refs)
+
+	return refs, nil
+}
+
+func bytesReader(b []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// imagesTagsPath is the path to the tags of modules images in the Deckhouse image.
+const imagesTagsPath = "deckhouse/modules/images_tags.json"
+
+// installRepo is the repository of the installer image relative to the edition repository.
+const installRepo = "install"
+
+// releaseImages returns references of all images of the release relative to the edition repository:
+// the Deckhouse image, the installer image and modules images. Modules images are stored in the edition
+// repository with content-based tags, so the same image is pulled once for all modules.
+func releaseImages(release string, imagesTags []byte) ([]string, error) {
+	var modules map[string]map[string]string
+	err := json.Unmarshal(imagesTags, &modules)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", imagesTagsPath, err)
+	}
+
+	unique := make(map[string]struct{})
+	for _, images := range modules {
+		for _, tag := range images {
+			unique[tag] = struct{}{}
+		}
+	}
+
+	tags := make([]string, 0, len(unique))
+	for tag := range unique {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	refs := make([]string, 0, len(tags)+2)
+	refs = append(refs, release, installRepo+":"+release)
+	refs = append(refs, tags...)
+
+	return refs, nil
+}
+
+// readImagesTags reads images_tags.json from the Deckhouse image.
+func readImagesTags(img v1.Image) ([]byte, error) {
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s is not found in the image", imagesTagsPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// names could be absolute or start with "./"
+		if path.Clean("/"+hdr.Name) == "/"+imagesTagsPath {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
+
+// targetReference returns the reference of the image in the target repository.
+// Refs are relative to the edition repository, e.g., "v1.35.0", "install:v1.35.0" or a module image tag.
+func targetReference(repo, ref string) string {
+	for i := len(ref) - 1; i >= 0; i-- {
+		if ref[i] == ':' {
+			return repo + "/" + ref[:i] + ":" + ref[i+1:]
+		}
+	}
+	return repo + ":" + ref
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+/*
+d8-mirror copies Deckhouse release images to an air-gapped registry.
+
+USAGE:
+
+1. Compile it using makefile - make bin/d8-mirror
+2. Pull images on a host with access to registry.deckhouse.io:
+   d8-mirror pull --release v1.35.0 --edition ee --license <key> --output-dir ./d8-bundle
+3. Copy the directory to a host with access to the private registry and push images:
+   d8-mirror push --source-dir ./d8-bundle --path registry.example.com/deckhouse
+*/
+
+const usage = `Usage: d8-mirror <command> [flags]
+
+Commands:
+  pull    Pull all images of a Deckhouse release to a local directory.
+  push    Push images from a local directory to a registry.
+  verify  Verify digests of images in a local directory.
+
+Run "d8-mirror <command> -h" for the command flags.
+`
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "pull":
+		err = runPull(os.Args[2:])
+	case "push":
+		err = runPush(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+}
+
+func newFlagSet(name, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: d8-mirror %s [flags]\n\n%s\n\nFlags:\n", name, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+const retryAttempts = 5
+
+// retry runs the function until it succeeds, flaky links should not fail the whole operation.
+func retry(what string, f func() error) error {
+	var err error
+	delay := time.Second
+
+	for attempt := 1; attempt <= retryAttempts; attempt++ {
+		err = f()
+		if err == nil {
+			return nil
+		}
+		if attempt == retryAttempts {
+			break
+		}
+
+		log.Printf("%s failed (attempt %d of %d), retrying in %s: %s", what, attempt, retryAttempts, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	return fmt.Errorf("%s: %w", what, err)
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	fakeregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+func TestReleaseImages(t *testing.T) {
+	refs, err := releaseImages("v1.35.0", []byte(`{
+		"common": {"kubeRbacProxy": "b2d6f0a9", "alpine": "0c62d58c"},
+		"prometheus": {"prometheus": "a1b2c3d4", "kubeRbacProxy": "b2d6f0a9"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"v1.35.0", "install:v1.35.0", "0c62d58c", "a1b2c3d4", "b2d6f0a9"}
+	if len(refs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, refs)
+	}
+	for i := range expected {
+		if refs[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, refs)
+		}
+	}
+}
+
+func TestTargetReference(t *testing.T) {
+	cases := map[string]string{
+		"v1.35.0":         "registry.example.com/deckhouse:v1.35.0",
+		"install:v1.35.0": "registry.example.com/deckhouse/install:v1.35.0",
+		"0c62d58c":        "registry.example.com/deckhouse:0c62d58c",
+	}
+
+	for ref, expected := range cases {
+		if got := targetReference("registry.example.com/deckhouse", ref); got != expected {
+			t.Errorf("%s: expected %s, got %s", ref, expected, got)
+		}
+	}
+}
+
+func TestLayoutBundleRejectsBrokenBlob(t *testing.T) {
+	b, err := openLayoutBundle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, _, err := v1.SHA256(bytes.NewReader([]byte("expected")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.writeBlob(digest, bytesReader([]byte("corrupted")))
+	if err == nil {
+		t.Fatal("expected digest mismatch error")
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(string(b.path), "blobs", "sha256", "*"))
+	if len(matches) != 0 {
+		t.Fatalf("broken blob must not be written, found %v", matches)
+	}
+}
+
+func TestPullAndPush(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	srv := httptest.NewServer(fakeregistry.New(fakeregistry.Logger(log.New(ioutil.Discard, "", 0))))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := u.Host
+
+	release := seedRelease(t, host+"/deckhouse/ce", "v1.35.0", "0c62d58c", "a1b2c3d4")
+
+	for _, format := range []string{formatLayout, formatTarball} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := pullOptions{
+				release:   "v1.35.0",
+				edition:   "ce",
+				source:    host + "/deckhouse",
+				outputDir: dir,
+				format:    format,
+				jobs:      2,
+			}
+
+			if err := pull(opts); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := openBundle(dir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			refs, err := b.Refs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(refs) != 4 {
+				t.Fatalf("expected 4 images in the bundle, got %v", refs)
+			}
+			if err := verify(b, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			// the second pull must not fail and must not change the bundle
+			if err := pull(opts); err != nil {
+				t.Fatal(err)
+			}
+
+			target := host + "/mirror-" + format
+			err = push(pushOptions{sourceDir: dir, path: target, jobs: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for ref, img := range release {
+				ref, err := name.ParseReference(targetReference(target, ref))
+				if err != nil {
+					t.Fatal(err)
+				}
+				desc, err := remote.Head(ref)
+				if err != nil {
+					t.Fatalf("%s: %s", ref, err)
+				}
+				digest, _ := img.Digest()
+				if format == formatLayout && desc.Digest != digest {
+					t.Fatalf("%s: expected digest %s, got %s", ref, digest, desc.Digest)
+				}
+			}
+		})
+	}
+}
+
+// seedRelease pushes the release images to the registry and returns them by refs.
+func seedRelease(t *testing.T, repo, release string, tags ...string) map[string]v1.Image {
+	t.Helper()
+
+	imagesTags := `{"common": {`
+	for i, tag := range tags {
+		if i > 0 {
+			imagesTags += ","
+		}
+		imagesTags += `"image` + tag + `": "` + tag + `"`
+	}
+	imagesTags += `}}`
+
+	deckhouse, err := mutate.AppendLayers(empty.Image, fileLayer(t, "/"+imagesTagsPath, imagesTags))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images := map[string]v1.Image{release: deckhouse}
+	for _, ref := range append([]string{installRepo + ":" + release}, tags...) {
+		img, err := random.Image(1024, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images[ref] = img
+	}
+
+	for ref, img := range images {
+		reference, err := name.ParseReference(targetReference(repo, ref))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(reference, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return images
+}
+
+func fileLayer(t *testing.T, path, content string) v1.Layer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: path, Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := tarball.LayerFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
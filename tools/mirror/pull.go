@@ -0,0 +1,238 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	defaultSourceRepo = "registry.deckhouse.io/deckhouse"
+	githubTagsURL     = "https://api.github.com/repos/deckhouse/deckhouse/tags"
+)
+
+type pullOptions struct {
+	release   string
+	edition   string
+	license   string
+	source    string
+	outputDir string
+	format    string
+	jobs      int
+	insecure  bool
+}
+
+func runPull(args []string) error {
+	var opts pullOptions
+
+	fs := newFlagSet("pull", "Pull all images of a Deckhouse release to a local directory.\n"+
+		"Images which are already in the directory are skipped, so the directory could be reused for the next releases.")
+	fs.StringVar(&opts.release, "release", "", "Deckhouse release to pull, e.g., v1.35.0 (default: the latest release)")
+	fs.StringVar(&opts.edition, "edition", "ee", "Deckhouse edition to pull: ce, ee or fe")
+	fs.StringVar(&opts.license, "license", "", "License key for the Deckhouse registry")
+	fs.StringVar(&opts.source, "source", defaultSourceRepo, "Repository of Deckhouse editions")
+	fs.StringVar(&opts.outputDir, "output-dir", "", "Directory to pull images to")
+	fs.StringVar(&opts.format, "format", formatLayout, "Format of the directory: layout (OCI image layout) or tarball (a tarball per image)")
+	fs.IntVar(&opts.jobs, "jobs", 4, "Number of images to pull concurrently")
+	fs.BoolVar(&opts.insecure, "insecure", false, "Use HTTP or HTTPS without certificate verification for the source registry")
+	_ = fs.Parse(args)
+
+	switch {
+	case opts.outputDir == "":
+		return errors.New("--output-dir is required")
+	case opts.edition != "ce" && opts.edition != "ee" && opts.edition != "fe":
+		return fmt.Errorf("--edition value %q is illegal, must be ce, ee or fe", opts.edition)
+	case opts.edition != "ce" && opts.license == "" && opts.source == defaultSourceRepo:
+		return errors.New("license is required to pull Deckhouse Enterprise Edition, please provide it with --license")
+	case opts.jobs < 1:
+		return errors.New("--jobs must be positive")
+	}
+
+	if opts.release == "" {
+		release, err := latestRelease()
+		if err != nil {
+			return fmt.Errorf("get the latest release, please provide it with --release: %w", err)
+		}
+		opts.release = release
+	}
+
+	return pull(opts)
+}
+
+func pull(opts pullOptions) error {
+	b, err := openBundle(opts.outputDir, opts.format)
+	if err != nil {
+		return err
+	}
+
+	auth := authn.Anonymous
+	if opts.license != "" {
+		auth = &authn.Basic{Username: "license-token", Password: opts.license}
+	}
+	source := newRegistry(opts.source+"/"+opts.edition, opts.insecure, remote.WithAuth(auth))
+
+	log.Printf("Pulling Deckhouse %s %s to %s", opts.edition, opts.release, opts.outputDir)
+
+	var pulled, skipped, done int64
+	count := func(ok bool) {
+		if ok {
+			atomic.AddInt64(&pulled, 1)
+		} else {
+			atomic.AddInt64(&skipped, 1)
+		}
+	}
+
+	// images_tags.json is read from the pulled image to not download it twice
+	ok, err := pullImage(b, source, opts.release)
+	if err != nil {
+		return err
+	}
+	count(ok)
+	deckhouseImage, err := b.Image(opts.release)
+	if err != nil {
+		return err
+	}
+	imagesTags, err := readImagesTags(deckhouseImage)
+	if err != nil {
+		return err
+	}
+	refs, err := releaseImages(opts.release, imagesTags)
+	if err != nil {
+		return err
+	}
+
+	// the Deckhouse image is the first one
+	refs = refs[1:]
+
+	err = parallel(refs, opts.jobs, func(ref string) error {
+		ok, err := pullImage(b, source, ref)
+		if err != nil {
+			return err
+		}
+		count(ok)
+		log.Printf("[%d/%d] %s", atomic.AddInt64(&done, 1), len(refs), ref)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Operation is complete: %d images pulled, %d images are already in the directory", pulled, skipped)
+	return nil
+}
+
+// pullImage pulls the image unless it is already in the bundle. Returns false if the image is skipped.
+func pullImage(b bundle, source *registry, ref string) (bool, error) {
+	img, err := source.Image(ref)
+	if err != nil {
+		return false, err
+	}
+
+	// the manifest is already fetched, the digest is not a request
+	digest, err := img.Digest()
+	if err != nil {
+		return false, err
+	}
+
+	has, err := b.Has(ref, digest)
+	if err != nil || has {
+		return false, err
+	}
+
+	err = b.Write(ref, img)
+	if err != nil {
+		return false, fmt.Errorf("pull %s: %w", ref, err)
+	}
+
+	return true, nil
+}
+
+// parallel runs the function for all items with the limited concurrency and returns the first error.
+func parallel(items []string, jobs int, f func(string) error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	queue := make(chan string)
+	failed := make(chan struct{})
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				if err := f(item); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+loop:
+	for _, item := range items {
+		select {
+		case queue <- item:
+		case <-failed:
+			break loop
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return firstErr
+}
+
+func latestRelease() (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	res, err := client.Get(githubTagsURL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	var tags []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tags); err != nil {
+		return "", err
+	}
+	if len(tags) == 0 {
+		return "", errors.New("no tags found")
+	}
+
+	return tags[0].Name, nil
+}
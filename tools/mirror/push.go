@@ -0,0 +1,121 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+type pushOptions struct {
+	sourceDir string
+	path      string
+	username  string
+	password  string
+	jobs      int
+	insecure  bool
+}
+
+func runPush(args []string) error {
+	var opts pushOptions
+
+	fs := newFlagSet("push", "Push images from a local directory to a registry.\n"+
+		"Images are pushed to the path instead of the edition repository, e.g., registry.example.com/deckhouse:v1.35.0 and\n"+
+		"registry.example.com/deckhouse/install:v1.35.0. Images which are already in the registry are skipped.")
+	fs.StringVar(&opts.sourceDir, "source-dir", "", "Directory with images")
+	fs.StringVar(&opts.path, "path", "", "Registry path to push images to, e.g., registry.example.com/deckhouse")
+	fs.StringVar(&opts.username, "username", "", "Username for the registry (default: credentials from the docker config)")
+	fs.StringVar(&opts.password, "password", "", "Password for the registry")
+	fs.IntVar(&opts.jobs, "jobs", 4, "Number of images to push concurrently")
+	fs.BoolVar(&opts.insecure, "insecure", false, "Use HTTP or HTTPS without certificate verification for the registry")
+	_ = fs.Parse(args)
+
+	switch {
+	case opts.sourceDir == "":
+		return errors.New("--source-dir is required")
+	case opts.path == "":
+		return errors.New("--path is required")
+	case opts.jobs < 1:
+		return errors.New("--jobs must be positive")
+	}
+
+	return push(opts)
+}
+
+func push(opts pushOptions) error {
+	b, err := openBundle(opts.sourceDir, "")
+	if err != nil {
+		return err
+	}
+
+	refs, err := b.Refs()
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("no images found in %s", opts.sourceDir)
+	}
+
+	auth := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+	if opts.username != "" {
+		auth = remote.WithAuth(&authn.Basic{Username: opts.username, Password: opts.password})
+	}
+	target := newRegistry(opts.path, opts.insecure, auth)
+
+	log.Printf("Pushing %d images from %s to %s", len(refs), opts.sourceDir, opts.path)
+
+	var pushed, skipped, done int64
+
+	err = parallel(refs, opts.jobs, func(ref string) error {
+		img, err := b.Image(ref)
+		if err != nil {
+			return err
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			return err
+		}
+
+		remoteDigest, err := target.Digest(ref)
+		if err != nil {
+			return err
+		}
+
+		if remoteDigest == digest {
+			atomic.AddInt64(&skipped, 1)
+		} else {
+			if err := target.Write(ref, img); err != nil {
+				return err
+			}
+			atomic.AddInt64(&pushed, 1)
+		}
+
+		log.Printf("[%d/%d] %s", atomic.AddInt64(&done, 1), len(refs), targetReference(opts.path, ref))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Operation is complete: %d images pushed, %d images are already in the registry", pushed, skipped)
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// registry is a repository in a remote registry. Refs are relative to the repository.
+type registry struct {
+	repo     string
+	nameOpts []name.Option
+	opts     []remote.Option
+}
+
+func newRegistry(repo string, insecure bool, opts ...remote.Option) *registry {
+	r := &registry{repo: repo, opts: opts}
+
+	if insecure {
+		r.nameOpts = append(r.nameOpts, name.Insecure)
+		r.opts = append(r.opts, remote.WithTransport(&http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint: gosec
+		}))
+	}
+
+	return r
+}
+
+func (r *registry) reference(ref string) (name.Reference, error) {
+	return name.ParseReference(targetReference(r.repo, ref), r.nameOpts...)
+}
+
+// Image returns the image with the fetched manifest, layers are fetched lazily.
+func (r *registry) Image(ref string) (v1.Image, error) {
+	reference, err := r.reference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var img v1.Image
+	err = retry("get "+reference.String(), func() error {
+		img, err = remote.Image(reference, r.opts...)
+		return err
+	})
+
+	return img, err
+}
+
+// Digest returns the digest of the image or an empty hash if the image does not exist.
+func (r *registry) Digest(ref string) (v1.Hash, error) {
+	reference, err := r.reference(ref)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	var digest v1.Hash
+	err = retry("head "+reference.String(), func() error {
+		desc, err := remote.Head(reference, r.opts...)
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			digest = v1.Hash{}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		digest = desc.Digest
+		return nil
+	})
+
+	return digest, err
+}
+
+func (r *registry) Write(ref string, img v1.Image) error {
+	reference, err := r.reference(ref)
+	if err != nil {
+		return err
+	}
+
+	// layers which already exist in the registry are not uploaded
+	return retry("push "+reference.String(), func() error {
+		return remote.Write(reference, img, r.opts...)
+	})
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Flant JSC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func runVerify(args []string) error {
+	var (
+		sourceDir string
+		jobs      int
+	)
+
+	fs := newFlagSet("verify", "Verify digests of all images in a local directory, e.g., after copying it to another host.")
+	fs.StringVar(&sourceDir, "source-dir", "", "Directory with images")
+	fs.IntVar(&jobs, "jobs", 4, "Number of images to verify concurrently")
+	_ = fs.Parse(args)
+
+	switch {
+	case sourceDir == "":
+		return errors.New("--source-dir is required")
+	case jobs < 1:
+		return errors.New("--jobs must be positive")
+	}
+
+	b, err := openBundle(sourceDir, "")
+	if err != nil {
+		return err
+	}
+
+	return verify(b, jobs)
+}
+
+func verify(b bundle, jobs int) error {
+	refs, err := b.Refs()
+	if err != nil {
+		return err
+	}
+
+	var failed int64
+
+	err = parallel(refs, jobs, func(ref string) error {
+		img, err := b.Image(ref)
+		if err == nil {
+			err = validate.Image(img)
+		}
+		if err != nil {
+			atomic.AddInt64(&failed, 1)
+			log.Printf("%s: %s", ref, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images are broken", failed, len(refs))
+	}
+
+	log.Printf("All %d images are valid", len(refs))
+	return nil
+}